@@ -7,7 +7,9 @@ import (
 	"github.com/Kelvedler/ChemicalStorage/pkg/common"
 	"github.com/Kelvedler/ChemicalStorage/pkg/db"
 	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/live"
 	"github.com/Kelvedler/ChemicalStorage/pkg/view"
+	"github.com/Kelvedler/ChemicalStorage/pkg/webhook"
 )
 
 func main() {
@@ -17,7 +19,10 @@ func main() {
 	validate := common.NewValidator()
 	sanitize := common.NewSanitizer()
 	dbpool := db.NewConnectionPool(ctx, mainLogger)
-	router := view.BaseRouter(dbpool, sanitize, validate, mainLogger)
+	go webhook.NewDispatcher(dbpool, mainLogger).Run(ctx)
+	broker := live.NewBroker(mainLogger)
+	go broker.Run(ctx)
+	router := view.BaseRouter(dbpool, sanitize, validate, broker, mainLogger)
 	err := http.ListenAndServe(":8000", router)
 	mainLogger.Error(err.Error())
 }
@@ -0,0 +1 @@
+ALTER TABLE storage_user DROP reviewed_at, DROP reviewed_by, DROP rejected, DROP review_note;
@@ -0,0 +1 @@
+ALTER TABLE storage_user ADD reviewed_at timestamptz, ADD reviewed_by uuid REFERENCES storage_user (id) ON DELETE SET NULL, ADD rejected boolean NOT NULL DEFAULT false, ADD review_note varchar(500) NOT NULL DEFAULT '';
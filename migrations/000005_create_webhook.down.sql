@@ -0,0 +1,9 @@
+DROP TRIGGER mdt_webhook_delivery ON webhook_delivery;
+
+DROP TABLE webhook_delivery;
+
+DROP TYPE webhook_delivery_status;
+
+DROP TRIGGER mdt_webhook ON webhook;
+
+DROP TABLE webhook;
@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS webhook(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  url varchar(500) NOT NULL,
+  secret varchar(64) NOT NULL,
+  events varchar(50)[] NOT NULL,
+  active boolean NOT NULL DEFAULT true
+);
+
+CREATE TRIGGER mdt_webhook
+  BEFORE UPDATE ON webhook
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
+
+CREATE TYPE webhook_delivery_status AS ENUM ('pending', 'succeeded', 'failed');
+
+CREATE TABLE IF NOT EXISTS webhook_delivery(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  webhook uuid NOT NULL REFERENCES webhook (id) ON DELETE CASCADE,
+  event varchar(50) NOT NULL,
+  payload jsonb NOT NULL,
+  status webhook_delivery_status NOT NULL DEFAULT 'pending',
+  attempts smallint NOT NULL DEFAULT 0,
+  next_attempt_at timestamptz NOT NULL DEFAULT now(),
+  response_code smallint,
+  error varchar(500) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX webhook_delivery_pending_idx ON webhook_delivery (next_attempt_at) WHERE status = 'pending';
+
+CREATE TRIGGER mdt_webhook_delivery
+  BEFORE UPDATE ON webhook_delivery
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
@@ -0,0 +1,3 @@
+DROP TRIGGER reagent_instance_notify ON reagent_instance;
+
+DROP FUNCTION reagent_instance_notify;
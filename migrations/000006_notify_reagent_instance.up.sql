@@ -0,0 +1,12 @@
+CREATE FUNCTION reagent_instance_notify() RETURNS trigger AS $reagent_instance_notify$
+  BEGIN
+    PERFORM pg_notify(
+      'reagent_instance',
+      json_build_object('id', NEW.id, 'reagent', NEW.reagent, 'op', lower(TG_OP))::text
+    );
+    RETURN NULL;
+  END;
+$reagent_instance_notify$ LANGUAGE plpgsql;
+
+CREATE TRIGGER reagent_instance_notify AFTER INSERT OR UPDATE ON reagent_instance
+  FOR EACH ROW EXECUTE FUNCTION reagent_instance_notify();
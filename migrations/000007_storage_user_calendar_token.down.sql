@@ -0,0 +1 @@
+ALTER TABLE storage_user DROP calendar_token;
@@ -0,0 +1 @@
+ALTER TABLE storage_user ADD calendar_token varchar(64), ADD UNIQUE (calendar_token);
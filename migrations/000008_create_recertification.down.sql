@@ -0,0 +1,3 @@
+DROP TRIGGER mdt_reagent_instance_recertification ON reagent_instance_recertification;
+
+DROP TABLE reagent_instance_recertification;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS reagent_instance_recertification(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  reagent_instance uuid NOT NULL REFERENCES reagent_instance (id) ON DELETE CASCADE,
+  old_expires_at date NOT NULL,
+  new_expires_at date NOT NULL,
+  storage_user uuid REFERENCES storage_user (id) ON DELETE SET NULL,
+  justification varchar(500) NOT NULL,
+  attachment bytea,
+  attachment_name varchar(255) NOT NULL DEFAULT '',
+  attachment_type varchar(100) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX reagent_instance_recertification_instance_idx ON reagent_instance_recertification (reagent_instance);
+
+CREATE TRIGGER mdt_reagent_instance_recertification
+  BEFORE UPDATE ON reagent_instance_recertification
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
@@ -0,0 +1,9 @@
+DROP TRIGGER storage_parent_constraint ON storage;
+
+DROP FUNCTION storage_parent_constraint;
+
+DROP INDEX storage_parent_idx;
+
+ALTER TABLE storage DROP parent, DROP kind;
+
+DROP TYPE storage_kind;
@@ -0,0 +1,24 @@
+CREATE TYPE storage_kind AS ENUM ('building', 'room', 'storage', 'shelf');
+
+ALTER TABLE storage ADD kind storage_kind NOT NULL DEFAULT 'storage', ADD parent uuid REFERENCES storage (id) ON DELETE RESTRICT;
+
+CREATE INDEX storage_parent_idx ON storage (parent);
+
+CREATE FUNCTION storage_parent_constraint() RETURNS trigger AS $storage_parent_constraint$
+  DECLARE
+    parent_kind storage_kind := (SELECT kind FROM storage WHERE id = NEW.parent);
+  BEGIN
+    IF parent_kind >= NEW.kind OR EXISTS (SELECT 1 FROM storage WHERE parent = NEW.id AND kind <= NEW.kind) THEN
+      RAISE EXCEPTION USING
+        ERRCODE = 'A0004',
+        MESSAGE = 'parent kind must precede child kind',
+        CONSTRAINT = 'storage_parent_constraint',
+        TABLE = 'storage',
+        COLUMN = 'parent';
+    END IF;
+    RETURN NEW;
+  END;
+$storage_parent_constraint$ LANGUAGE plpgsql;
+
+CREATE TRIGGER storage_parent_constraint BEFORE INSERT OR UPDATE ON storage
+  FOR EACH ROW EXECUTE FUNCTION storage_parent_constraint();
@@ -0,0 +1,17 @@
+CREATE OR REPLACE FUNCTION cell_constraint() RETURNS trigger AS $cell_constraint$
+  DECLARE
+    cell_max smallint := (SELECT number FROM storage_cell WHERE storage = NEW.id ORDER BY number DESC LIMIT 1);
+  BEGIN
+    if NEW.cells < cell_max THEN
+      RAISE EXCEPTION USING
+        ERRCODE = 'A0002',
+        MESSAGE = 'cell with higher number exist',
+        CONSTRAINT = 'storage_cells_constraint',
+        TABLE = 'storage',
+        COLUMN = 'cells';
+    END IF;
+    RETURN NEW;
+  END;
+$cell_constraint$ LANGUAGE plpgsql;
+
+ALTER TABLE storage DROP description;
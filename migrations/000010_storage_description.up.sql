@@ -0,0 +1,29 @@
+ALTER TABLE storage ADD description varchar(1000) NOT NULL DEFAULT '';
+
+CREATE OR REPLACE FUNCTION cell_constraint() RETURNS trigger AS $cell_constraint$
+  DECLARE
+    occupied_cells text := (
+      SELECT string_agg(occupied.number::text, ', ' ORDER BY occupied.number)
+      FROM (
+        SELECT DISTINCT storage_cell.number
+        FROM storage_cell
+        JOIN reagent_instance ON reagent_instance.storage_cell = storage_cell.id
+        WHERE storage_cell.storage = NEW.id
+          AND storage_cell.number > NEW.cells
+          AND reagent_instance.used_at IS NULL
+          AND reagent_instance.deleted_at IS NULL
+      ) occupied
+    );
+  BEGIN
+    IF occupied_cells IS NOT NULL THEN
+      RAISE EXCEPTION USING
+        ERRCODE = 'A0002',
+        MESSAGE = 'cell with higher number exist',
+        DETAIL = occupied_cells,
+        CONSTRAINT = 'storage_cells_constraint',
+        TABLE = 'storage',
+        COLUMN = 'cells';
+    END IF;
+    RETURN NEW;
+  END;
+$cell_constraint$ LANGUAGE plpgsql;
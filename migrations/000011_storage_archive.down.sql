@@ -0,0 +1,9 @@
+ALTER TABLE reagent_instance
+  DROP CONSTRAINT reagent_instance_storage_cell_fkey,
+  ADD CONSTRAINT reagent_instance_storage_cell_fkey FOREIGN KEY (storage_cell) REFERENCES storage_cell (id) ON DELETE SET NULL;
+
+DROP TRIGGER storage_archived_constraint ON storage;
+
+DROP FUNCTION storage_archived_constraint;
+
+ALTER TABLE storage DROP archived_at;
@@ -0,0 +1,29 @@
+ALTER TABLE storage ADD archived_at timestamptz;
+
+CREATE FUNCTION storage_archived_constraint() RETURNS trigger AS $storage_archived_constraint$
+  BEGIN
+    IF OLD.archived_at IS NULL AND NEW.archived_at IS NOT NULL AND EXISTS (
+      SELECT 1
+      FROM reagent_instance
+      JOIN storage_cell ON reagent_instance.storage_cell = storage_cell.id
+      WHERE storage_cell.storage = NEW.id
+        AND reagent_instance.used_at IS NULL
+        AND reagent_instance.deleted_at IS NULL
+    ) THEN
+      RAISE EXCEPTION USING
+        ERRCODE = 'A0005',
+        MESSAGE = 'storage is not empty',
+        CONSTRAINT = 'storage_archived_constraint',
+        TABLE = 'storage',
+        COLUMN = 'archived_at';
+    END IF;
+    RETURN NEW;
+  END;
+$storage_archived_constraint$ LANGUAGE plpgsql;
+
+CREATE TRIGGER storage_archived_constraint BEFORE UPDATE ON storage
+  FOR EACH ROW EXECUTE FUNCTION storage_archived_constraint();
+
+ALTER TABLE reagent_instance
+  DROP CONSTRAINT reagent_instance_storage_cell_fkey,
+  ADD CONSTRAINT reagent_instance_storage_cell_fkey FOREIGN KEY (storage_cell) REFERENCES storage_cell (id) ON DELETE RESTRICT;
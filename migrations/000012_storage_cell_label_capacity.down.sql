@@ -0,0 +1,5 @@
+DROP TRIGGER cell_capacity_limit ON reagent_instance;
+
+DROP FUNCTION cell_capacity_limit;
+
+ALTER TABLE storage_cell DROP capacity, DROP label;
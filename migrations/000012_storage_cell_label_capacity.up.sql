@@ -0,0 +1,34 @@
+ALTER TABLE storage_cell ADD label varchar(50) NOT NULL DEFAULT '', ADD capacity smallint CHECK (capacity > 0);
+
+CREATE FUNCTION cell_capacity_limit() RETURNS trigger AS $cell_capacity_limit$
+  DECLARE
+    cell_capacity smallint;
+  BEGIN
+    IF NEW.storage_cell IS NULL OR NEW.used_at IS NOT NULL OR NEW.deleted_at IS NOT NULL THEN
+      RETURN NEW;
+    END IF;
+    IF TG_OP = 'UPDATE' AND OLD.storage_cell IS NOT DISTINCT FROM NEW.storage_cell THEN
+      RETURN NEW;
+    END IF;
+    cell_capacity := (SELECT capacity FROM storage_cell WHERE id = NEW.storage_cell);
+    IF cell_capacity IS NOT NULL AND cell_capacity <= (
+      SELECT COUNT(*)
+      FROM reagent_instance
+      WHERE storage_cell = NEW.storage_cell
+        AND id != NEW.id
+        AND used_at IS NULL
+        AND deleted_at IS NULL
+    ) THEN
+      RAISE EXCEPTION USING
+        ERRCODE = 'A0006',
+        MESSAGE = 'cell capacity exceeded',
+        CONSTRAINT = 'storage_cell_number_capacity',
+        TABLE = 'storage_cell',
+        COLUMN = 'number';
+    END IF;
+    RETURN NEW;
+  END;
+$cell_capacity_limit$ LANGUAGE plpgsql;
+
+CREATE TRIGGER cell_capacity_limit BEFORE INSERT OR UPDATE ON reagent_instance
+  FOR EACH ROW EXECUTE FUNCTION cell_capacity_limit();
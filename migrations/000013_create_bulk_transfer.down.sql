@@ -0,0 +1,7 @@
+DROP TRIGGER mdt_bulk_transfer_item ON bulk_transfer_item;
+
+DROP TRIGGER mdt_bulk_transfer ON bulk_transfer;
+
+DROP TABLE bulk_transfer_item;
+
+DROP TABLE bulk_transfer;
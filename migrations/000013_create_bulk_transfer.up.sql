@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS bulk_transfer(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  storage_user uuid REFERENCES storage_user (id) ON DELETE SET NULL,
+  storage_cell uuid NOT NULL REFERENCES storage_cell (id) ON DELETE RESTRICT,
+  moved integer NOT NULL DEFAULT 0,
+  skipped integer NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS bulk_transfer_item(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  bulk_transfer uuid NOT NULL REFERENCES bulk_transfer (id) ON DELETE CASCADE,
+  reagent_instance uuid NOT NULL REFERENCES reagent_instance (id) ON DELETE CASCADE,
+  from_storage_cell uuid REFERENCES storage_cell (id) ON DELETE SET NULL,
+  moved boolean NOT NULL,
+  reason varchar(100) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX bulk_transfer_item_bulk_transfer_idx ON bulk_transfer_item (bulk_transfer);
+
+CREATE TRIGGER mdt_bulk_transfer
+  BEFORE UPDATE ON bulk_transfer
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
+
+CREATE TRIGGER mdt_bulk_transfer_item
+  BEFORE UPDATE ON bulk_transfer_item
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
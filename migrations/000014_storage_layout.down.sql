@@ -0,0 +1 @@
+ALTER TABLE storage DROP CONSTRAINT storage_layout_check, DROP columns, DROP rows;
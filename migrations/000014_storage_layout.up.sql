@@ -0,0 +1,4 @@
+ALTER TABLE storage
+  ADD rows smallint NOT NULL DEFAULT 0 CHECK (rows >= 0),
+  ADD columns smallint NOT NULL DEFAULT 0 CHECK (columns >= 0),
+  ADD CONSTRAINT storage_layout_check CHECK ((rows = 0 AND columns = 0) OR (rows > 0 AND columns > 0 AND rows * columns = cells));
@@ -0,0 +1,5 @@
+DROP TRIGGER mdt_storage_access ON storage_access;
+
+DROP TABLE storage_access;
+
+ALTER TABLE storage DROP responsible;
@@ -0,0 +1,15 @@
+ALTER TABLE storage ADD responsible uuid REFERENCES storage_user (id) ON DELETE SET NULL;
+
+CREATE TABLE IF NOT EXISTS storage_access(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  storage uuid NOT NULL REFERENCES storage (id) ON DELETE CASCADE,
+  storage_user uuid NOT NULL REFERENCES storage_user (id) ON DELETE CASCADE,
+  CONSTRAINT storage_access_storage_user_key UNIQUE (storage, storage_user)
+);
+
+CREATE TRIGGER mdt_storage_access
+  BEFORE UPDATE ON storage_access
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
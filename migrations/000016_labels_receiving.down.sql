@@ -0,0 +1,11 @@
+DROP INDEX reagent_instance_receiving_idx;
+
+ALTER TABLE reagent_instance DROP receiving;
+
+ALTER TABLE reagent_instance DROP lot;
+
+DROP TRIGGER mdt_receiving ON receiving;
+
+DROP TABLE receiving;
+
+ALTER TABLE reagent DROP hazards;
@@ -0,0 +1,20 @@
+ALTER TABLE reagent ADD hazards varchar(5)[] NOT NULL DEFAULT '{}';
+
+CREATE TABLE IF NOT EXISTS receiving(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  storage_user uuid REFERENCES storage_user (id) ON DELETE SET NULL,
+  reagent uuid NOT NULL REFERENCES reagent (id) ON DELETE CASCADE
+);
+
+ALTER TABLE reagent_instance ADD lot varchar(50) NOT NULL DEFAULT '';
+
+ALTER TABLE reagent_instance ADD receiving uuid REFERENCES receiving (id) ON DELETE SET NULL;
+
+CREATE INDEX reagent_instance_receiving_idx ON reagent_instance (receiving);
+
+CREATE TRIGGER mdt_receiving
+  BEFORE UPDATE ON receiving
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
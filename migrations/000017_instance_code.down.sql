@@ -0,0 +1,5 @@
+ALTER TABLE reagent_instance DROP code;
+
+DROP FUNCTION instance_code;
+
+DROP SEQUENCE reagent_instance_code_seq;
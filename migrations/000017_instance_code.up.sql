@@ -0,0 +1,22 @@
+CREATE SEQUENCE IF NOT EXISTS reagent_instance_code_seq;
+
+CREATE FUNCTION instance_code(n bigint) RETURNS varchar AS $instance_code$
+  SELECT 'CS-' || lpad(n::text, GREATEST(6, length(n::text)), '0');
+$instance_code$ LANGUAGE sql IMMUTABLE;
+
+ALTER TABLE reagent_instance ADD code varchar(20);
+
+ALTER TABLE reagent_instance DISABLE TRIGGER USER;
+
+UPDATE reagent_instance SET code = instance_code(numbered.n)
+  FROM (SELECT id, row_number() OVER (ORDER BY created_at, id) AS n FROM reagent_instance) AS numbered
+  WHERE reagent_instance.id = numbered.id;
+
+ALTER TABLE reagent_instance ENABLE TRIGGER USER;
+
+SELECT setval('reagent_instance_code_seq', COALESCE((SELECT COUNT(*) FROM reagent_instance), 0) + 1, false);
+
+ALTER TABLE reagent_instance
+  ALTER code SET DEFAULT instance_code(nextval('reagent_instance_code_seq')),
+  ALTER code SET NOT NULL,
+  ADD CONSTRAINT reagent_instance_code_key UNIQUE (code);
@@ -0,0 +1,17 @@
+DROP TRIGGER mdt_stocktake_action ON stocktake_action;
+
+DROP TRIGGER mdt_stocktake_scan ON stocktake_scan;
+
+DROP TRIGGER mdt_stocktake ON stocktake;
+
+DROP INDEX stocktake_action_stocktake_idx;
+
+DROP INDEX stocktake_storage_key;
+
+DROP INDEX stocktake_storage_idx;
+
+DROP TABLE stocktake_action;
+
+DROP TABLE stocktake_scan;
+
+DROP TABLE stocktake;
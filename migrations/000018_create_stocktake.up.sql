@@ -0,0 +1,52 @@
+CREATE TABLE IF NOT EXISTS stocktake(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  storage uuid NOT NULL REFERENCES storage (id) ON DELETE CASCADE,
+  storage_user uuid REFERENCES storage_user (id) ON DELETE SET NULL,
+  finished_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS stocktake_scan(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  stocktake uuid NOT NULL REFERENCES stocktake (id) ON DELETE CASCADE,
+  code varchar(50) NOT NULL,
+  storage_cell uuid REFERENCES storage_cell (id) ON DELETE SET NULL,
+  reagent_instance uuid REFERENCES reagent_instance (id) ON DELETE SET NULL,
+  CONSTRAINT stocktake_scan_code_key UNIQUE (stocktake, code)
+);
+
+CREATE TABLE IF NOT EXISTS stocktake_action(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  stocktake uuid NOT NULL REFERENCES stocktake (id) ON DELETE CASCADE,
+  reagent_instance uuid NOT NULL REFERENCES reagent_instance (id) ON DELETE CASCADE,
+  storage_user uuid REFERENCES storage_user (id) ON DELETE SET NULL,
+  action varchar(10) NOT NULL CHECK (action IN ('transfer', 'lost')),
+  from_storage_cell uuid REFERENCES storage_cell (id) ON DELETE SET NULL,
+  to_storage_cell uuid REFERENCES storage_cell (id) ON DELETE SET NULL
+);
+
+CREATE INDEX stocktake_storage_idx ON stocktake (storage);
+
+CREATE UNIQUE INDEX stocktake_storage_key ON stocktake (storage) WHERE finished_at IS NULL;
+
+CREATE INDEX stocktake_action_stocktake_idx ON stocktake_action (stocktake);
+
+CREATE TRIGGER mdt_stocktake
+  BEFORE UPDATE ON stocktake
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
+
+CREATE TRIGGER mdt_stocktake_scan
+  BEFORE UPDATE ON stocktake_scan
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
+
+CREATE TRIGGER mdt_stocktake_action
+  BEFORE UPDATE ON stocktake_action
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
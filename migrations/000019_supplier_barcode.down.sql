@@ -0,0 +1,11 @@
+ALTER TABLE receiving DROP size;
+
+ALTER TABLE receiving DROP grade;
+
+ALTER TABLE receiving DROP supplier;
+
+DROP TRIGGER mdt_supplier_barcode ON supplier_barcode;
+
+DROP INDEX supplier_barcode_reagent_idx;
+
+DROP TABLE supplier_barcode;
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS supplier_barcode(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  barcode varchar(50) NOT NULL,
+  reagent uuid NOT NULL REFERENCES reagent (id) ON DELETE CASCADE,
+  supplier varchar(100) NOT NULL DEFAULT '',
+  grade varchar(50) NOT NULL DEFAULT '',
+  size varchar(50) NOT NULL DEFAULT '',
+  CONSTRAINT supplier_barcode_barcode_key UNIQUE (barcode)
+);
+
+CREATE INDEX supplier_barcode_reagent_idx ON supplier_barcode (reagent);
+
+ALTER TABLE receiving ADD supplier varchar(100) NOT NULL DEFAULT '';
+
+ALTER TABLE receiving ADD grade varchar(50) NOT NULL DEFAULT '';
+
+ALTER TABLE receiving ADD size varchar(50) NOT NULL DEFAULT '';
+
+CREATE TRIGGER mdt_supplier_barcode
+  BEFORE UPDATE ON supplier_barcode
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
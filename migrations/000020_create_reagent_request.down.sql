@@ -0,0 +1,15 @@
+DROP TRIGGER mdt_reagent_request_instance ON reagent_request_instance;
+
+DROP TRIGGER mdt_reagent_request_item ON reagent_request_item;
+
+DROP TRIGGER mdt_reagent_request ON reagent_request;
+
+DROP INDEX reagent_request_instance_reagent_instance_idx;
+
+DROP TABLE reagent_request_instance;
+
+DROP TABLE reagent_request_item;
+
+DROP INDEX reagent_request_storage_user_idx;
+
+DROP TABLE reagent_request;
@@ -0,0 +1,50 @@
+CREATE TABLE IF NOT EXISTS reagent_request(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  storage_user uuid NOT NULL REFERENCES storage_user (id) ON DELETE CASCADE,
+  title varchar(200) NOT NULL,
+  needed_by date NOT NULL,
+  status varchar(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'partial', 'rejected')),
+  reviewer uuid REFERENCES storage_user (id) ON DELETE SET NULL,
+  reviewed_at timestamptz,
+  comment varchar(500) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX reagent_request_storage_user_idx ON reagent_request (storage_user);
+
+CREATE TABLE IF NOT EXISTS reagent_request_item(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  reagent_request uuid NOT NULL REFERENCES reagent_request (id) ON DELETE CASCADE,
+  reagent uuid NOT NULL REFERENCES reagent (id) ON DELETE CASCADE,
+  amount varchar(50) NOT NULL DEFAULT '',
+  CONSTRAINT reagent_request_item_reagent_key UNIQUE (reagent_request, reagent)
+);
+
+CREATE TABLE IF NOT EXISTS reagent_request_instance(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  reagent_request_item uuid NOT NULL REFERENCES reagent_request_item (id) ON DELETE CASCADE,
+  reagent_instance uuid NOT NULL REFERENCES reagent_instance (id) ON DELETE CASCADE,
+  CONSTRAINT reagent_request_instance_reagent_instance_key UNIQUE (reagent_request_item, reagent_instance)
+);
+
+CREATE INDEX reagent_request_instance_reagent_instance_idx ON reagent_request_instance (reagent_instance);
+
+CREATE TRIGGER mdt_reagent_request
+  BEFORE UPDATE ON reagent_request
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
+
+CREATE TRIGGER mdt_reagent_request_item
+  BEFORE UPDATE ON reagent_request_item
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
+
+CREATE TRIGGER mdt_reagent_request_instance
+  BEFORE UPDATE ON reagent_request_instance
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
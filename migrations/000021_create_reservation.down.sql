@@ -0,0 +1,5 @@
+DROP TRIGGER mdt_reservation ON reservation;
+
+DROP INDEX reservation_reagent_instance_idx;
+
+DROP TABLE reservation;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS reservation(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  reagent_instance uuid NOT NULL REFERENCES reagent_instance (id) ON DELETE CASCADE,
+  storage_user uuid NOT NULL REFERENCES storage_user (id) ON DELETE CASCADE,
+  purpose varchar(200) NOT NULL,
+  reserved_from date NOT NULL,
+  reserved_until date NOT NULL,
+  reagent_request uuid REFERENCES reagent_request (id) ON DELETE SET NULL,
+  CONSTRAINT reservation_reserved_until_check CHECK (reserved_until >= reserved_from)
+);
+
+CREATE INDEX reservation_reagent_instance_idx ON reservation (reagent_instance, reserved_until);
+
+CREATE TRIGGER mdt_reservation
+  BEFORE UPDATE ON reservation
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
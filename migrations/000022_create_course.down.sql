@@ -0,0 +1,17 @@
+DROP TRIGGER mdt_lab_session ON lab_session;
+
+DROP TRIGGER mdt_practical_item ON practical_item;
+
+DROP TRIGGER mdt_practical ON practical;
+
+DROP TRIGGER mdt_course ON course;
+
+DROP INDEX lab_session_scheduled_on_idx;
+
+DROP TABLE lab_session;
+
+DROP TABLE practical_item;
+
+DROP TABLE practical;
+
+DROP TABLE course;
@@ -0,0 +1,63 @@
+CREATE TABLE IF NOT EXISTS course(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  storage_user uuid NOT NULL REFERENCES storage_user (id) ON DELETE CASCADE,
+  name varchar(200) NOT NULL,
+  CONSTRAINT course_name_key UNIQUE (storage_user, name)
+);
+
+CREATE TABLE IF NOT EXISTS practical(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  course uuid NOT NULL REFERENCES course (id) ON DELETE CASCADE,
+  title varchar(200) NOT NULL,
+  CONSTRAINT practical_title_key UNIQUE (course, title)
+);
+
+CREATE TABLE IF NOT EXISTS practical_item(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  practical uuid NOT NULL REFERENCES practical (id) ON DELETE CASCADE,
+  reagent uuid NOT NULL REFERENCES reagent (id) ON DELETE CASCADE,
+  amount numeric(10, 3) NOT NULL CHECK (amount > 0),
+  unit varchar(20) NOT NULL DEFAULT '',
+  per varchar(10) NOT NULL CHECK (per IN ('student', 'group')),
+  container_amount numeric(10, 3) NOT NULL DEFAULT 0 CHECK (container_amount >= 0),
+  CONSTRAINT practical_item_reagent_key UNIQUE (practical, reagent)
+);
+
+CREATE TABLE IF NOT EXISTS lab_session(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  practical uuid NOT NULL REFERENCES practical (id) ON DELETE CASCADE,
+  scheduled_on date NOT NULL,
+  students smallint NOT NULL CHECK (students > 0),
+  group_size smallint NOT NULL CHECK (group_size > 0),
+  reagent_request uuid REFERENCES reagent_request (id) ON DELETE SET NULL
+);
+
+CREATE INDEX lab_session_scheduled_on_idx ON lab_session (scheduled_on);
+
+CREATE TRIGGER mdt_course
+  BEFORE UPDATE ON course
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
+
+CREATE TRIGGER mdt_practical
+  BEFORE UPDATE ON practical
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
+
+CREATE TRIGGER mdt_practical_item
+  BEFORE UPDATE ON practical_item
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
+
+CREATE TRIGGER mdt_lab_session
+  BEFORE UPDATE ON lab_session
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
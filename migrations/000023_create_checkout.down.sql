@@ -0,0 +1,7 @@
+DROP TRIGGER mdt_checkout ON checkout;
+
+DROP INDEX checkout_due_at_idx;
+
+DROP INDEX checkout_reagent_instance_key;
+
+DROP TABLE checkout;
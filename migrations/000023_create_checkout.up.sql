@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS checkout(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  reagent_instance uuid NOT NULL REFERENCES reagent_instance (id) ON DELETE CASCADE,
+  storage_user uuid NOT NULL REFERENCES storage_user (id) ON DELETE CASCADE,
+  location varchar(100) NOT NULL,
+  due_at timestamptz NOT NULL,
+  from_storage_cell uuid REFERENCES storage_cell (id) ON DELETE SET NULL,
+  returned_at timestamptz,
+  returned_by uuid REFERENCES storage_user (id) ON DELETE SET NULL,
+  to_storage_cell uuid REFERENCES storage_cell (id) ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX checkout_reagent_instance_key ON checkout (reagent_instance) WHERE returned_at IS NULL;
+
+CREATE INDEX checkout_due_at_idx ON checkout (due_at) WHERE returned_at IS NULL;
+
+CREATE TRIGGER mdt_checkout
+  BEFORE UPDATE ON checkout
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
@@ -0,0 +1,11 @@
+DROP TRIGGER mdt_bom_line ON bom_line;
+
+DROP TRIGGER mdt_bom_check ON bom_check;
+
+DROP TABLE bom_line;
+
+DROP INDEX bom_check_storage_user_idx;
+
+DROP TABLE bom_check;
+
+ALTER TABLE reagent DROP CONSTRAINT reagent_cas_key, DROP cas;
@@ -0,0 +1,33 @@
+ALTER TABLE reagent ADD cas varchar(12), ADD CONSTRAINT reagent_cas_key UNIQUE (cas);
+
+CREATE TABLE IF NOT EXISTS bom_check(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  storage_user uuid NOT NULL REFERENCES storage_user (id) ON DELETE CASCADE,
+  title varchar(200) NOT NULL
+);
+
+CREATE INDEX bom_check_storage_user_idx ON bom_check (storage_user);
+
+CREATE TABLE IF NOT EXISTS bom_line(
+  id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  created_at timestamptz NOT NULL DEFAULT now(),
+  updated_at timestamptz NOT NULL DEFAULT now(),
+  bom_check uuid NOT NULL REFERENCES bom_check (id) ON DELETE CASCADE,
+  position smallint NOT NULL,
+  query varchar(300) NOT NULL,
+  amount smallint NOT NULL DEFAULT 1,
+  reagent uuid REFERENCES reagent (id) ON DELETE SET NULL,
+  CONSTRAINT bom_line_position_key UNIQUE (bom_check, position)
+);
+
+CREATE TRIGGER mdt_bom_check
+  BEFORE UPDATE ON bom_check
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
+
+CREATE TRIGGER mdt_bom_line
+  BEFORE UPDATE ON bom_line
+  FOR EACH ROW
+  EXECUTE PROCEDURE moddatetime (updated_at);
@@ -0,0 +1,5 @@
+ALTER TABLE storage DROP inspected_at, DROP inspection_days;
+
+ALTER TABLE reagent_instance DROP peroxide_tested_at;
+
+ALTER TABLE reagent DROP peroxide_test_days;
@@ -0,0 +1,5 @@
+ALTER TABLE reagent ADD peroxide_test_days smallint CONSTRAINT reagent_peroxide_test_days_check CHECK (peroxide_test_days > 0);
+
+ALTER TABLE reagent_instance ADD peroxide_tested_at date;
+
+ALTER TABLE storage ADD inspection_days smallint CONSTRAINT storage_inspection_days_check CHECK (inspection_days > 0), ADD inspected_at date;
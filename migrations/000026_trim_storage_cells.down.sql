@@ -0,0 +1 @@
+-- Deleted empty storage cells are not restored; this migration cannot be reversed.
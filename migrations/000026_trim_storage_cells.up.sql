@@ -0,0 +1,8 @@
+DELETE FROM storage_cell
+USING storage
+WHERE storage_cell.storage = storage.id
+  AND storage_cell.number > storage.cells
+  AND NOT EXISTS (
+    SELECT 1 FROM reagent_instance
+    WHERE reagent_instance.storage_cell = storage_cell.id
+  );
@@ -0,0 +1,3 @@
+DROP TRIGGER cell_capacity_constraint ON storage_cell;
+
+DROP FUNCTION cell_capacity_constraint;
@@ -0,0 +1,23 @@
+CREATE FUNCTION cell_capacity_constraint() RETURNS trigger AS $cell_capacity_constraint$
+  BEGIN
+    IF NEW.capacity IS NOT NULL AND NEW.capacity < (
+      SELECT COUNT(*)
+      FROM reagent_instance
+      WHERE storage_cell = NEW.id
+        AND used_at IS NULL
+        AND deleted_at IS NULL
+    ) THEN
+      RAISE EXCEPTION USING
+        ERRCODE = 'A0002',
+        MESSAGE = 'cell capacity below occupancy',
+        DETAIL = NEW.number::text,
+        CONSTRAINT = 'storage_cell_capacity_constraint',
+        TABLE = 'storage_cell',
+        COLUMN = 'capacity';
+    END IF;
+    RETURN NEW;
+  END;
+$cell_capacity_constraint$ LANGUAGE plpgsql;
+
+CREATE TRIGGER cell_capacity_constraint BEFORE UPDATE OF capacity ON storage_cell
+  FOR EACH ROW EXECUTE FUNCTION cell_capacity_constraint();
@@ -0,0 +1 @@
+ALTER TABLE bom_line DROP COLUMN status;
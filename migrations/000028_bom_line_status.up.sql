@@ -0,0 +1,3 @@
+ALTER TABLE bom_line ADD status varchar(20) NOT NULL DEFAULT 'missing' CHECK (status IN ('resolved', 'approximate', 'ambiguous', 'missing'));
+
+UPDATE bom_line SET status = 'resolved' WHERE reagent IS NOT NULL;
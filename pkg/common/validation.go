@@ -3,15 +3,34 @@ package common
 import (
 	"fmt"
 	"reflect"
+	"regexp"
 
 	"github.com/go-playground/validator/v10"
 )
 
+var casPattern = regexp.MustCompile(`^([0-9]{2,7})-([0-9]{2})-([0-9])$`)
+
 func NewValidator() (v *validator.Validate) {
 	v = validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterValidation("cas", func(fl validator.FieldLevel) bool {
+		return CASValid(fl.Field().String())
+	})
 	return v
 }
 
+func CASValid(cas string) bool {
+	match := casPattern.FindStringSubmatch(cas)
+	if match == nil {
+		return false
+	}
+	digits := match[1] + match[2]
+	sum := 0
+	for i := range digits {
+		sum += int(digits[len(digits)-1-i]-'0') * (i + 1)
+	}
+	return sum%10 == int(match[3][0]-'0')
+}
+
 type ValidationError struct {
 	asMapLocal map[string]string
 	asString   string
@@ -0,0 +1,276 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type BomCheck struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	StorageUser uuid.UUID `json:"storage_user"`
+	Title       string    `json:"title"        validate:"gte=3,lte=200" uaLocal:"назва"`
+}
+
+type BomLine struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	BomCheck  uuid.UUID `json:"bom_check"`
+	Position  int       `json:"position"`
+	Query     string    `json:"query"      validate:"gte=1,lte=300"  uaLocal:"рядок"`
+	Amount    int       `json:"amount"     validate:"min=1,max=1000" uaLocal:"кількість"`
+	Reagent   uuid.UUID `json:"reagent"`
+	Status    string    `json:"status"`
+}
+
+type BomLineExtended struct {
+	BomLine BomLine
+	Reagent Reagent
+}
+
+type BomCheckExtended struct {
+	BomCheck    BomCheck
+	StorageUser StorageUser
+	LinesCount  int
+	Lines       []BomLineExtended
+}
+
+type BomChecksRange struct {
+	Checks        []BomCheckExtended
+	StorageUserID uuid.UUID
+}
+
+type ReagentCatalog struct {
+	Reagents []Reagent
+}
+
+type ReagentLocation struct {
+	Reagent     uuid.UUID
+	Storage     Storage
+	StorageCell StorageCell
+	Instances   int
+}
+
+type ReagentLocationsRange struct {
+	Locations  []ReagentLocation
+	ReagentIDs []uuid.UUID
+}
+
+func (c BomCheckExtended) createQueue(
+	batch *pgx.Batch,
+) {
+	queries := make([]string, len(c.Lines))
+	amounts := make([]int16, len(c.Lines))
+	reagents := make([]pgtype.UUID, len(c.Lines))
+	statuses := make([]string, len(c.Lines))
+	for i, line := range c.Lines {
+		queries[i] = line.BomLine.Query
+		amounts[i] = int16(line.BomLine.Amount)
+		reagents[i] = uuidToPgType(line.BomLine.Reagent)
+		statuses[i] = line.BomLine.Status
+	}
+	created := "INSERT INTO bom_check(storage_user, title) VALUES($1, $2) RETURNING id, created_at, updated_at"
+	lines := "INSERT INTO bom_line(bom_check, position, query, amount, reagent, status) SELECT created.id, line.position, line.query, line.amount, line.reagent, line.status FROM created, unnest($3::text[], $4::smallint[], $5::uuid[], $6::text[]) WITH ORDINALITY AS line(query, amount, reagent, status, position)"
+	query := fmt.Sprintf(
+		"WITH created AS (%s), lines AS (%s) SELECT id, created_at, updated_at FROM created",
+		created,
+		lines,
+	)
+	batch.Queue(query, c.BomCheck.StorageUser, c.BomCheck.Title, queries, amounts, reagents, statuses)
+}
+
+func (c *BomCheckExtended) createResult(results pgx.BatchResults) error {
+	return results.QueryRow().Scan(&c.BomCheck.ID, &c.BomCheck.CreatedAt, &c.BomCheck.UpdatedAt)
+}
+
+func (c *BomCheckExtended) Create() (BatchOperation, BatchRead) {
+	return c.createQueue, c.createResult
+}
+
+func (c BomCheckExtended) getQueue(
+	batch *pgx.Batch,
+) {
+	query := "SELECT bom_check.created_at, bom_check.updated_at, bom_check.title, storage_user.name FROM bom_check JOIN storage_user ON bom_check.storage_user = storage_user.id WHERE bom_check.id=$1 AND bom_check.storage_user=$2"
+	batch.Queue(query, c.BomCheck.ID, c.BomCheck.StorageUser)
+	query = "SELECT bom_line.id, bom_line.created_at, bom_line.updated_at, bom_line.position, bom_line.query, bom_line.amount, bom_line.status, reagent.id, reagent.name, reagent.formula, reagent.cas FROM bom_line JOIN bom_check ON bom_line.bom_check = bom_check.id LEFT JOIN reagent ON bom_line.reagent = reagent.id WHERE bom_check.id=$1 AND bom_check.storage_user=$2 ORDER BY bom_line.position"
+	batch.Queue(query, c.BomCheck.ID, c.BomCheck.StorageUser)
+}
+
+func (c *BomCheckExtended) getResult(results pgx.BatchResults) error {
+	err := results.QueryRow().Scan(
+		&c.BomCheck.CreatedAt,
+		&c.BomCheck.UpdatedAt,
+		&c.BomCheck.Title,
+		&c.StorageUser.Name,
+	)
+	if err != nil {
+		rows, _ := results.Query()
+		rows.Close()
+		return err
+	}
+	c.StorageUser.ID = c.BomCheck.StorageUser
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		line := BomLineExtended{BomLine: BomLine{BomCheck: c.BomCheck.ID}}
+		var reagentID pgtype.UUID
+		var name, formula, cas pgtype.Text
+		err = rows.Scan(
+			&line.BomLine.ID,
+			&line.BomLine.CreatedAt,
+			&line.BomLine.UpdatedAt,
+			&line.BomLine.Position,
+			&line.BomLine.Query,
+			&line.BomLine.Amount,
+			&line.BomLine.Status,
+			&reagentID,
+			&name,
+			&formula,
+			&cas,
+		)
+		if err != nil {
+			return err
+		}
+		line.BomLine.Reagent = reagentID.Bytes
+		line.Reagent.ID = reagentID.Bytes
+		line.Reagent.Name = name.String
+		line.Reagent.Formula = formula.String
+		line.Reagent.Cas = cas.String
+		c.Lines = append(c.Lines, line)
+	}
+	c.LinesCount = len(c.Lines)
+	return rows.Err()
+}
+
+func (c *BomCheckExtended) Get() (BatchOperation, BatchRead) {
+	return c.getQueue, c.getResult
+}
+
+func (c BomCheckExtended) deleteQueue(
+	batch *pgx.Batch,
+) {
+	query := "DELETE FROM bom_check WHERE id=$1 AND storage_user=$2"
+	batch.Queue(query, c.BomCheck.ID, c.BomCheck.StorageUser)
+}
+
+func (c *BomCheckExtended) Delete() (BatchOperation, BatchRead) {
+	return c.deleteQueue, affectedRowsResult
+}
+
+func (r BomChecksRange) getQueue(
+	batch *pgx.Batch,
+) {
+	query := "SELECT bom_check.id, bom_check.created_at, bom_check.updated_at, bom_check.title, (SELECT COUNT(*) FROM bom_line WHERE bom_line.bom_check = bom_check.id) FROM bom_check WHERE bom_check.storage_user=$1 ORDER BY bom_check.created_at DESC"
+	batch.Queue(query, r.StorageUserID)
+}
+
+func (r *BomChecksRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		check := BomCheckExtended{BomCheck: BomCheck{StorageUser: r.StorageUserID}}
+		err = rows.Scan(
+			&check.BomCheck.ID,
+			&check.BomCheck.CreatedAt,
+			&check.BomCheck.UpdatedAt,
+			&check.BomCheck.Title,
+			&check.LinesCount,
+		)
+		if err != nil {
+			return err
+		}
+		r.Checks = append(r.Checks, check)
+	}
+	return rows.Err()
+}
+
+func (r *BomChecksRange) Get() (BatchOperation, BatchRead) {
+	return r.getQueue, r.getResult
+}
+
+func (c ReagentCatalog) getQueue(
+	batch *pgx.Batch,
+) {
+	query := "SELECT id, name, formula, COALESCE(cas, '') FROM reagent ORDER BY name"
+	batch.Queue(query)
+}
+
+func (c *ReagentCatalog) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var reagent Reagent
+		err = rows.Scan(&reagent.ID, &reagent.Name, &reagent.Formula, &reagent.Cas)
+		if err != nil {
+			return err
+		}
+		c.Reagents = append(c.Reagents, reagent)
+	}
+	return rows.Err()
+}
+
+func (c *ReagentCatalog) Get() (BatchOperation, BatchRead) {
+	return c.getQueue, c.getResult
+}
+
+func (r ReagentLocationsRange) getQueue(
+	batch *pgx.Batch,
+) {
+	filter := "reagent_instance.reagent = ANY($1::uuid[]) AND " + availableInstance
+	query := fmt.Sprintf(
+		"SELECT reagent_instance.reagent, storage.id, storage.name, storage_cell.id, storage_cell.number, COUNT(*) FROM reagent_instance LEFT JOIN storage_cell ON reagent_instance.storage_cell = storage_cell.id LEFT JOIN storage ON storage_cell.storage = storage.id WHERE %s GROUP BY reagent_instance.reagent, storage.id, storage.name, storage_cell.id, storage_cell.number ORDER BY storage.name, storage_cell.number",
+		filter,
+	)
+	batch.Queue(query, r.ReagentIDs)
+}
+
+func (r *ReagentLocationsRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var location ReagentLocation
+		var storageID, cellID pgtype.UUID
+		var storageName pgtype.Text
+		var cellNumber pgtype.Int2
+		err = rows.Scan(
+			&location.Reagent,
+			&storageID,
+			&storageName,
+			&cellID,
+			&cellNumber,
+			&location.Instances,
+		)
+		if err != nil {
+			return err
+		}
+		location.Storage.ID = storageID.Bytes
+		location.Storage.Name = storageName.String
+		location.StorageCell.ID = cellID.Bytes
+		location.StorageCell.Storage = storageID.Bytes
+		location.StorageCell.Number = cellNumber.Int16
+		r.Locations = append(r.Locations, location)
+	}
+	return rows.Err()
+}
+
+func (r *ReagentLocationsRange) Get() (BatchOperation, BatchRead) {
+	return r.getQueue, r.getResult
+}
@@ -0,0 +1,246 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const checkedOut = "EXISTS (SELECT 1 FROM checkout WHERE checkout.reagent_instance = reagent_instance.id AND checkout.returned_at IS NULL)"
+
+type Checkout struct {
+	ID              uuid.UUID `json:"id"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	ReagentInstance uuid.UUID `json:"reagent_instance"`
+	StorageUser     uuid.UUID `json:"storage_user"`
+	Location        string    `json:"location"          validate:"gte=2,lte=100" uaLocal:"місце"`
+	DueAt           time.Time `json:"due_at"`
+	FromStorageCell uuid.UUID `json:"from_storage_cell"`
+	ReturnedAt      time.Time `json:"returned_at"`
+	ReturnedBy      uuid.UUID `json:"returned_by"`
+	ToStorageCell   uuid.UUID `json:"to_storage_cell"`
+}
+
+type CheckoutExtended struct {
+	Checkout        Checkout
+	StorageUser     StorageUser
+	ReagentInstance ReagentInstance
+	Reagent         Reagent
+	FromStorage     Storage
+	FromStorageCell StorageCell
+	ToStorageCell   StorageCell
+	Overdue         bool
+}
+
+type CheckoutsRange struct {
+	Checkouts     []CheckoutExtended
+	ReagentID     uuid.UUID
+	InstanceID    uuid.UUID
+	StorageUserID uuid.UUID
+	Overdue       bool
+}
+
+func (c Checkout) createQueue(
+	batch *pgx.Batch,
+) {
+	filter := fmt.Sprintf(
+		"id=$1 AND used_at IS NULL AND deleted_at IS NULL AND NOT %s AND NOT %s",
+		checkedOut,
+		reservedForOthers(2),
+	)
+	query := fmt.Sprintf(
+		"INSERT INTO checkout(reagent_instance, storage_user, location, due_at, from_storage_cell) SELECT id, $2::uuid, $3::text, $4::timestamptz, storage_cell FROM reagent_instance WHERE %s RETURNING id, created_at, updated_at, from_storage_cell",
+		filter,
+	)
+	batch.Queue(query, c.ReagentInstance, c.StorageUser, c.Location, c.DueAt)
+}
+
+func (c *Checkout) createResult(results pgx.BatchResults) error {
+	var fromCell pgtype.UUID
+	err := results.QueryRow().Scan(&c.ID, &c.CreatedAt, &c.UpdatedAt, &fromCell)
+	if err != nil {
+		return err
+	}
+	c.FromStorageCell = fromCell.Bytes
+	return nil
+}
+
+func (c *Checkout) Create() (BatchOperation, BatchRead) {
+	return c.createQueue, c.createResult
+}
+
+func (c CheckoutExtended) returnQueue(
+	batch *pgx.Batch,
+) {
+	open := "SELECT 1 FROM checkout WHERE reagent_instance=$3 AND returned_at IS NULL AND ($4::uuid IS NULL OR storage_user=$4)"
+	cell := fmt.Sprintf(
+		"INSERT INTO storage_cell(storage, number) SELECT $1::uuid, $2::smallint WHERE EXISTS (SELECT 1 FROM storage WHERE id=$1::uuid AND archived_at IS NULL) AND EXISTS (%s) ON CONFLICT ON CONSTRAINT storage_cell_storage_number_key DO NOTHING",
+		open,
+	)
+	batch.Queue(
+		cell,
+		c.ToStorageCell.Storage,
+		c.ToStorageCell.Number,
+		c.Checkout.ReagentInstance,
+		uuidToPgType(c.Checkout.StorageUser),
+	)
+	target := activeCell(3, 4)
+	returned := "UPDATE checkout SET returned_at=now(), returned_by=$2, to_storage_cell=(SELECT id FROM target) WHERE reagent_instance=$1 AND returned_at IS NULL AND ($5::uuid IS NULL OR storage_user=$5) AND EXISTS (SELECT 1 FROM target) RETURNING id, reagent_instance, to_storage_cell, returned_at"
+	query := fmt.Sprintf(
+		"WITH target AS (%s), returned AS (%s), moved AS (UPDATE reagent_instance SET storage_cell=returned.to_storage_cell FROM returned WHERE reagent_instance.id = returned.reagent_instance AND reagent_instance.storage_cell IS DISTINCT FROM returned.to_storage_cell) SELECT returned.id, returned.to_storage_cell, returned.returned_at FROM returned",
+		target,
+		returned,
+	)
+	batch.Queue(
+		query,
+		c.Checkout.ReagentInstance,
+		c.Checkout.ReturnedBy,
+		c.ToStorageCell.Storage,
+		c.ToStorageCell.Number,
+		uuidToPgType(c.Checkout.StorageUser),
+	)
+}
+
+func (c *CheckoutExtended) returnResult(results pgx.BatchResults) error {
+	_, err := results.Exec()
+	if err != nil {
+		rows, _ := results.Query()
+		rows.Close()
+		return err
+	}
+	err = results.QueryRow().Scan(
+		&c.Checkout.ID,
+		&c.Checkout.ToStorageCell,
+		&c.Checkout.ReturnedAt,
+	)
+	if err != nil {
+		return err
+	}
+	c.ToStorageCell.ID = c.Checkout.ToStorageCell
+	return nil
+}
+
+func (c *CheckoutExtended) Return() (BatchOperation, BatchRead) {
+	return c.returnQueue, c.returnResult
+}
+
+type InstanceNotification struct {
+	InstanceID uuid.UUID
+	Op         string
+}
+
+func (n InstanceNotification) notifyQueue(
+	batch *pgx.Batch,
+) {
+	query := "SELECT pg_notify('reagent_instance', json_build_object('id', id, 'reagent', reagent, 'op', $2::text)::text) FROM reagent_instance WHERE id=$1 AND NOT xmin = pg_current_xact_id()::xid AND EXISTS (SELECT 1 FROM checkout WHERE checkout.reagent_instance=$1 AND checkout.xmin = pg_current_xact_id()::xid)"
+	batch.Queue(query, n.InstanceID, n.Op)
+}
+
+func (n *InstanceNotification) notifyResult(results pgx.BatchResults) error {
+	_, err := results.Exec()
+	return err
+}
+
+func (n *InstanceNotification) Notify() (BatchOperation, BatchRead) {
+	return n.notifyQueue, n.notifyResult
+}
+
+func (r CheckoutsRange) getQueue(
+	batch *pgx.Batch,
+) {
+	cols := "checkout.id, checkout.created_at, checkout.updated_at, checkout.reagent_instance, checkout.storage_user, checkout.location, checkout.due_at, checkout.from_storage_cell, checkout.due_at < now(), storage_user.name, reagent_instance.code, reagent.id, reagent.name, reagent.formula, storage_cell.number, storage.id, storage.name"
+	join := "JOIN storage_user ON checkout.storage_user = storage_user.id JOIN reagent_instance ON checkout.reagent_instance = reagent_instance.id JOIN reagent ON reagent_instance.reagent = reagent.id LEFT JOIN storage_cell ON checkout.from_storage_cell = storage_cell.id LEFT JOIN storage ON storage_cell.storage = storage.id"
+	filters := []string{
+		"checkout.returned_at IS NULL",
+		"reagent_instance.used_at IS NULL",
+		"reagent_instance.deleted_at IS NULL",
+	}
+	var args []any
+	if r.ReagentID != uuid.Nil {
+		args = append(args, r.ReagentID)
+		filters = append(filters, fmt.Sprintf("reagent.id=$%d", len(args)))
+	}
+	if r.InstanceID != uuid.Nil {
+		args = append(args, r.InstanceID)
+		filters = append(filters, fmt.Sprintf("reagent_instance.id=$%d", len(args)))
+	}
+	if r.StorageUserID != uuid.Nil {
+		args = append(args, r.StorageUserID)
+		filters = append(filters, fmt.Sprintf("checkout.storage_user=$%d", len(args)))
+	}
+	if r.Overdue {
+		filters = append(filters, "checkout.due_at < now()")
+	}
+	query := fmt.Sprintf(
+		"SELECT %s FROM checkout %s WHERE %s ORDER BY checkout.due_at, reagent.name",
+		cols,
+		join,
+		strings.Join(filters, " AND "),
+	)
+	batch.Queue(query, args...)
+}
+
+func (r *CheckoutsRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c CheckoutExtended
+		var fromCell, fromStorage pgtype.UUID
+		var fromNumber pgtype.Int2
+		var fromName pgtype.Text
+		err = rows.Scan(
+			&c.Checkout.ID,
+			&c.Checkout.CreatedAt,
+			&c.Checkout.UpdatedAt,
+			&c.Checkout.ReagentInstance,
+			&c.Checkout.StorageUser,
+			&c.Checkout.Location,
+			&c.Checkout.DueAt,
+			&fromCell,
+			&c.Overdue,
+			&c.StorageUser.Name,
+			&c.ReagentInstance.Code,
+			&c.Reagent.ID,
+			&c.Reagent.Name,
+			&c.Reagent.Formula,
+			&fromNumber,
+			&fromStorage,
+			&fromName,
+		)
+		if err != nil {
+			return err
+		}
+		c.StorageUser.ID = c.Checkout.StorageUser
+		c.ReagentInstance.ID = c.Checkout.ReagentInstance
+		c.ReagentInstance.Reagent = c.Reagent.ID
+		c.Checkout.FromStorageCell = fromCell.Bytes
+		c.FromStorageCell.ID = fromCell.Bytes
+		c.FromStorageCell.Number = fromNumber.Int16
+		c.FromStorageCell.Storage = fromStorage.Bytes
+		c.FromStorage.ID = fromStorage.Bytes
+		c.FromStorage.Name = fromName.String
+		r.Checkouts = append(r.Checkouts, c)
+	}
+	return rows.Err()
+}
+
+func (r *CheckoutsRange) Get() (BatchOperation, BatchRead) {
+	return r.getQueue, r.getResult
+}
+
+func (r CheckoutsRange) ByInstance(instanceID uuid.UUID) (CheckoutExtended, bool) {
+	for _, checkout := range r.Checkouts {
+		if checkout.Checkout.ReagentInstance == instanceID {
+			return checkout, true
+		}
+	}
+	return CheckoutExtended{}, false
+}
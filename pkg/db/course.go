@@ -0,0 +1,528 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	PerStudent = "student"
+	PerGroup   = "group"
+)
+
+type Course struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	StorageUser uuid.UUID `json:"storage_user"`
+	Name        string    `json:"name"         validate:"gte=3,lte=200" uaLocal:"назва"`
+}
+
+type Practical struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Course    uuid.UUID `json:"course"`
+	Title     string    `json:"title"      validate:"gte=3,lte=200" uaLocal:"назва"`
+}
+
+type PracticalItem struct {
+	ID              uuid.UUID `json:"id"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	Practical       uuid.UUID `json:"practical"`
+	Reagent         uuid.UUID `json:"reagent"`
+	Amount          float64   `json:"amount"           validate:"gt=0,lt=10000000"    uaLocal:"кількість"`
+	Unit            string    `json:"unit"             validate:"lte=20"              uaLocal:"одиниця"`
+	Per             string    `json:"per"              validate:"oneof=student group" uaLocal:"розрахунок"`
+	ContainerAmount float64   `json:"container_amount" validate:"min=0,lt=10000000"   uaLocal:"вміст ємності"`
+}
+
+type LabSession struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Practical      uuid.UUID `json:"practical"`
+	ScheduledOn    time.Time `json:"scheduled_on"`
+	Students       int       `json:"students"        validate:"min=1,max=500" uaLocal:"кількість студентів"`
+	GroupSize      int       `json:"group_size"      validate:"min=1,max=50"  uaLocal:"розмір групи"`
+	ReagentRequest uuid.UUID `json:"reagent_request"`
+}
+
+type PracticalItemExtended struct {
+	PracticalItem PracticalItem
+	Reagent       Reagent
+	Course        Course
+}
+
+type PracticalExtended struct {
+	Practical Practical
+	Course    Course
+	Items     []PracticalItemExtended
+}
+
+type LabSessionExtended struct {
+	LabSession    LabSession
+	Practical     Practical
+	Course        Course
+	RequestStatus string
+	Items         []PracticalItemExtended
+}
+
+type CourseExtended struct {
+	Course          Course
+	StorageUser     StorageUser
+	PracticalsCount int
+	UpcomingCount   int
+	Practicals      []PracticalExtended
+	Sessions        []LabSessionExtended
+}
+
+type CoursesRange struct {
+	Courses       []CourseExtended
+	StorageUserID uuid.UUID
+}
+
+type UpcomingSessionsRange struct {
+	Sessions      []LabSessionExtended
+	StorageUserID uuid.UUID
+	Until         time.Time
+}
+
+const practicalItemCols = "practical_item.id, practical_item.created_at, practical_item.updated_at, practical_item.practical, practical_item.reagent, practical_item.amount, practical_item.unit, practical_item.per, practical_item.container_amount, reagent.name, reagent.formula, " + availableInstances
+
+const labSessionCols = "lab_session.id, lab_session.created_at, lab_session.updated_at, lab_session.practical, lab_session.scheduled_on, lab_session.students, lab_session.group_size, lab_session.reagent_request, reagent_request.status, practical.title, course.id, course.name, course.storage_user"
+
+const labSessionJoin = "JOIN practical ON lab_session.practical = practical.id JOIN course ON practical.course = course.id LEFT JOIN reagent_request ON lab_session.reagent_request = reagent_request.id"
+
+const practicalOwned = "SELECT 1 FROM practical JOIN course ON practical.course = course.id WHERE practical.id=$1 AND course.id=$2 AND course.storage_user=$3"
+
+func (s LabSession) Groups() int {
+	return (s.Students + s.GroupSize - 1) / s.GroupSize
+}
+
+func (i PracticalItem) Total(session LabSession) float64 {
+	if i.Per == PerGroup {
+		return i.Amount * float64(session.Groups())
+	}
+	return i.Amount * float64(session.Students)
+}
+
+func scanPracticalItem(row pgx.Row) (item PracticalItemExtended, err error) {
+	err = row.Scan(
+		&item.PracticalItem.ID,
+		&item.PracticalItem.CreatedAt,
+		&item.PracticalItem.UpdatedAt,
+		&item.PracticalItem.Practical,
+		&item.PracticalItem.Reagent,
+		&item.PracticalItem.Amount,
+		&item.PracticalItem.Unit,
+		&item.PracticalItem.Per,
+		&item.PracticalItem.ContainerAmount,
+		&item.Reagent.Name,
+		&item.Reagent.Formula,
+		&item.Reagent.Instances,
+	)
+	item.Reagent.ID = item.PracticalItem.Reagent
+	return item, err
+}
+
+func scanPracticalItems(rows pgx.Rows) (items []PracticalItemExtended, err error) {
+	defer rows.Close()
+	for rows.Next() {
+		item, err := scanPracticalItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func scanLabSession(row pgx.Row) (session LabSessionExtended, err error) {
+	var request pgtype.UUID
+	var status pgtype.Text
+	err = row.Scan(
+		&session.LabSession.ID,
+		&session.LabSession.CreatedAt,
+		&session.LabSession.UpdatedAt,
+		&session.LabSession.Practical,
+		&session.LabSession.ScheduledOn,
+		&session.LabSession.Students,
+		&session.LabSession.GroupSize,
+		&request,
+		&status,
+		&session.Practical.Title,
+		&session.Course.ID,
+		&session.Course.Name,
+		&session.Course.StorageUser,
+	)
+	session.LabSession.ReagentRequest = request.Bytes
+	session.RequestStatus = status.String
+	session.Practical.ID = session.LabSession.Practical
+	session.Practical.Course = session.Course.ID
+	return session, err
+}
+
+func scanLabSessions(rows pgx.Rows, items []PracticalItemExtended) (sessions []LabSessionExtended, err error) {
+	defer rows.Close()
+	for rows.Next() {
+		session, err := scanLabSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if item.PracticalItem.Practical == session.LabSession.Practical {
+				session.Items = append(session.Items, item)
+			}
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (c Course) createQueue(
+	batch *pgx.Batch,
+) {
+	query := "INSERT INTO course(storage_user, name) VALUES($1, $2) RETURNING id, created_at, updated_at"
+	batch.Queue(query, c.StorageUser, c.Name)
+}
+
+func (c *Course) createResult(results pgx.BatchResults) error {
+	return results.QueryRow().Scan(&c.ID, &c.CreatedAt, &c.UpdatedAt)
+}
+
+func (c *Course) Create() (BatchOperation, BatchRead) {
+	return c.createQueue, c.createResult
+}
+
+func (r CoursesRange) getQueue(
+	batch *pgx.Batch,
+) {
+	cols := "course.id, course.created_at, course.updated_at, course.storage_user, course.name, storage_user.name, (SELECT COUNT(*) FROM practical WHERE practical.course = course.id), (SELECT COUNT(*) FROM lab_session JOIN practical ON lab_session.practical = practical.id WHERE practical.course = course.id AND lab_session.scheduled_on >= current_date)"
+	join := "JOIN storage_user ON course.storage_user = storage_user.id"
+	filter := "TRUE"
+	var args []any
+	if r.StorageUserID != uuid.Nil {
+		args = append(args, r.StorageUserID)
+		filter = fmt.Sprintf("course.storage_user=$%d", len(args))
+	}
+	query := fmt.Sprintf(
+		"SELECT %s FROM course %s WHERE %s ORDER BY course.name",
+		cols,
+		join,
+		filter,
+	)
+	batch.Queue(query, args...)
+}
+
+func (r *CoursesRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var course CourseExtended
+		err = rows.Scan(
+			&course.Course.ID,
+			&course.Course.CreatedAt,
+			&course.Course.UpdatedAt,
+			&course.Course.StorageUser,
+			&course.Course.Name,
+			&course.StorageUser.Name,
+			&course.PracticalsCount,
+			&course.UpcomingCount,
+		)
+		if err != nil {
+			return err
+		}
+		course.StorageUser.ID = course.Course.StorageUser
+		r.Courses = append(r.Courses, course)
+	}
+	return rows.Err()
+}
+
+func (r *CoursesRange) Get() (BatchOperation, BatchRead) {
+	return r.getQueue, r.getResult
+}
+
+func (c CourseExtended) getQueue(
+	batch *pgx.Batch,
+) {
+	query := "SELECT course.created_at, course.updated_at, course.storage_user, course.name, storage_user.name FROM course JOIN storage_user ON course.storage_user = storage_user.id WHERE course.id=$1"
+	batch.Queue(query, c.Course.ID)
+	query = "SELECT id, created_at, updated_at, title FROM practical WHERE course=$1 ORDER BY title"
+	batch.Queue(query, c.Course.ID)
+	query = fmt.Sprintf(
+		"SELECT %s FROM practical_item JOIN practical ON practical_item.practical = practical.id JOIN reagent ON practical_item.reagent = reagent.id WHERE practical.course=$1 ORDER BY reagent.name",
+		practicalItemCols,
+	)
+	batch.Queue(query, c.Course.ID)
+	query = fmt.Sprintf(
+		"SELECT %s FROM lab_session %s WHERE course.id=$1 ORDER BY lab_session.scheduled_on, lab_session.created_at",
+		labSessionCols,
+		labSessionJoin,
+	)
+	batch.Queue(query, c.Course.ID)
+}
+
+func (c *CourseExtended) getResult(results pgx.BatchResults) error {
+	err := results.QueryRow().Scan(
+		&c.Course.CreatedAt,
+		&c.Course.UpdatedAt,
+		&c.Course.StorageUser,
+		&c.Course.Name,
+		&c.StorageUser.Name,
+	)
+	if err != nil {
+		for i := 0; i < 3; i++ {
+			rows, _ := results.Query()
+			rows.Close()
+		}
+		return err
+	}
+	c.StorageUser.ID = c.Course.StorageUser
+	rows, err := results.Query()
+	if err == nil {
+		err = c.scanPracticals(rows)
+	}
+	if err != nil {
+		return err
+	}
+	rows, err = results.Query()
+	if err != nil {
+		return err
+	}
+	items, err := scanPracticalItems(rows)
+	if err != nil {
+		return err
+	}
+	for i := range c.Practicals {
+		for _, item := range items {
+			if item.PracticalItem.Practical == c.Practicals[i].Practical.ID {
+				c.Practicals[i].Items = append(c.Practicals[i].Items, item)
+			}
+		}
+	}
+	rows, err = results.Query()
+	if err != nil {
+		return err
+	}
+	c.Sessions, err = scanLabSessions(rows, items)
+	return err
+}
+
+func (c *CourseExtended) scanPracticals(rows pgx.Rows) error {
+	defer rows.Close()
+	for rows.Next() {
+		practical := PracticalExtended{
+			Practical: Practical{Course: c.Course.ID},
+			Course:    c.Course,
+		}
+		err := rows.Scan(
+			&practical.Practical.ID,
+			&practical.Practical.CreatedAt,
+			&practical.Practical.UpdatedAt,
+			&practical.Practical.Title,
+		)
+		if err != nil {
+			return err
+		}
+		c.Practicals = append(c.Practicals, practical)
+	}
+	return rows.Err()
+}
+
+func (c *CourseExtended) Get() (BatchOperation, BatchRead) {
+	return c.getQueue, c.getResult
+}
+
+func (r UpcomingSessionsRange) getQueue(
+	batch *pgx.Batch,
+) {
+	filter := "lab_session.scheduled_on >= current_date"
+	var args []any
+	if !r.Until.IsZero() {
+		args = append(args, r.Until)
+		filter = filter + fmt.Sprintf(" AND lab_session.scheduled_on < $%d", len(args))
+	}
+	if r.StorageUserID != uuid.Nil {
+		args = append(args, r.StorageUserID)
+		filter = filter + fmt.Sprintf(" AND course.storage_user=$%d", len(args))
+	}
+	query := fmt.Sprintf(
+		"SELECT %s FROM practical_item JOIN reagent ON practical_item.reagent = reagent.id WHERE practical_item.practical IN (SELECT lab_session.practical FROM lab_session %s WHERE %s)",
+		practicalItemCols,
+		labSessionJoin,
+		filter,
+	)
+	batch.Queue(query, args...)
+	query = fmt.Sprintf(
+		"SELECT %s FROM lab_session %s WHERE %s ORDER BY lab_session.scheduled_on, lab_session.created_at",
+		labSessionCols,
+		labSessionJoin,
+		filter,
+	)
+	batch.Queue(query, args...)
+}
+
+func (r *UpcomingSessionsRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		rows, _ := results.Query()
+		rows.Close()
+		return err
+	}
+	items, err := scanPracticalItems(rows)
+	if err != nil {
+		rows, _ := results.Query()
+		rows.Close()
+		return err
+	}
+	rows, err = results.Query()
+	if err != nil {
+		return err
+	}
+	r.Sessions, err = scanLabSessions(rows, items)
+	return err
+}
+
+func (r *UpcomingSessionsRange) Get() (BatchOperation, BatchRead) {
+	return r.getQueue, r.getResult
+}
+
+func (p PracticalExtended) createQueue(
+	batch *pgx.Batch,
+) {
+	query := "INSERT INTO practical(course, title) SELECT $1::uuid, $2::text WHERE EXISTS (SELECT 1 FROM course WHERE id=$1 AND storage_user=$3) RETURNING id, created_at, updated_at"
+	batch.Queue(query, p.Course.ID, p.Practical.Title, p.Course.StorageUser)
+}
+
+func (p *PracticalExtended) createResult(results pgx.BatchResults) error {
+	return results.QueryRow().Scan(
+		&p.Practical.ID,
+		&p.Practical.CreatedAt,
+		&p.Practical.UpdatedAt,
+	)
+}
+
+func (p *PracticalExtended) Create() (BatchOperation, BatchRead) {
+	return p.createQueue, p.createResult
+}
+
+func (i PracticalItemExtended) createQueue(
+	batch *pgx.Batch,
+) {
+	query := fmt.Sprintf(
+		"INSERT INTO practical_item(practical, reagent, amount, unit, per, container_amount) SELECT $1::uuid, $4::uuid, $5::numeric, $6::text, $7::text, $8::numeric WHERE EXISTS (%s) AND EXISTS (SELECT 1 FROM reagent WHERE id = $4::uuid) RETURNING id, created_at, updated_at",
+		practicalOwned,
+	)
+	batch.Queue(
+		query,
+		i.PracticalItem.Practical,
+		i.Course.ID,
+		i.Course.StorageUser,
+		i.PracticalItem.Reagent,
+		i.PracticalItem.Amount,
+		i.PracticalItem.Unit,
+		i.PracticalItem.Per,
+		i.PracticalItem.ContainerAmount,
+	)
+}
+
+func (i *PracticalItemExtended) createResult(results pgx.BatchResults) error {
+	return results.QueryRow().Scan(
+		&i.PracticalItem.ID,
+		&i.PracticalItem.CreatedAt,
+		&i.PracticalItem.UpdatedAt,
+	)
+}
+
+func (i *PracticalItemExtended) Create() (BatchOperation, BatchRead) {
+	return i.createQueue, i.createResult
+}
+
+func (i PracticalItemExtended) deleteQueue(
+	batch *pgx.Batch,
+) {
+	query := "DELETE FROM practical_item USING practical, course WHERE practical_item.id=$1 AND practical_item.practical = practical.id AND practical.course = course.id AND course.id=$2 AND course.storage_user=$3"
+	batch.Queue(query, i.PracticalItem.ID, i.Course.ID, i.Course.StorageUser)
+}
+
+func affectedRowsResult(results pgx.BatchResults) error {
+	ct, err := results.Exec()
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (i *PracticalItemExtended) Delete() (BatchOperation, BatchRead) {
+	return i.deleteQueue, affectedRowsResult
+}
+
+func (s LabSessionExtended) createQueue(
+	batch *pgx.Batch,
+) {
+	query := fmt.Sprintf(
+		"INSERT INTO lab_session(practical, scheduled_on, students, group_size) SELECT $1::uuid, $4::date, $5::smallint, $6::smallint WHERE EXISTS (%s) RETURNING id, created_at, updated_at",
+		practicalOwned,
+	)
+	batch.Queue(
+		query,
+		s.LabSession.Practical,
+		s.Course.ID,
+		s.Course.StorageUser,
+		s.LabSession.ScheduledOn,
+		s.LabSession.Students,
+		s.LabSession.GroupSize,
+	)
+}
+
+func (s *LabSessionExtended) createResult(results pgx.BatchResults) error {
+	return results.QueryRow().Scan(
+		&s.LabSession.ID,
+		&s.LabSession.CreatedAt,
+		&s.LabSession.UpdatedAt,
+	)
+}
+
+func (s *LabSessionExtended) Create() (BatchOperation, BatchRead) {
+	return s.createQueue, s.createResult
+}
+
+func (s LabSessionExtended) deleteQueue(
+	batch *pgx.Batch,
+) {
+	query := "DELETE FROM lab_session USING practical, course WHERE lab_session.id=$1 AND lab_session.practical = practical.id AND practical.course = course.id AND course.id=$2 AND course.storage_user=$3"
+	batch.Queue(query, s.LabSession.ID, s.Course.ID, s.Course.StorageUser)
+}
+
+func (s *LabSessionExtended) Delete() (BatchOperation, BatchRead) {
+	return s.deleteQueue, affectedRowsResult
+}
+
+func (s LabSessionExtended) setRequestQueue(
+	batch *pgx.Batch,
+) {
+	query := "UPDATE lab_session SET reagent_request=$4 FROM practical, course WHERE lab_session.id=$1 AND lab_session.reagent_request IS NULL AND lab_session.practical = practical.id AND practical.course = course.id AND course.id=$2 AND course.storage_user=$3"
+	batch.Queue(
+		query,
+		s.LabSession.ID,
+		s.Course.ID,
+		s.Course.StorageUser,
+		s.LabSession.ReagentRequest,
+	)
+}
+
+func (s *LabSessionExtended) SetRequest() (BatchOperation, BatchRead) {
+	return s.setRequestQueue, affectedRowsResult
+}
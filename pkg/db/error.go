@@ -17,7 +17,11 @@ const (
 	uniqueViolation           = "23505"
 	invalidTextRepresentation = "22P02"
 	outOfLimits               = "A0001"
+	cellsOccupied             = "A0002"
 	alreadySet                = "A0003"
+	invalidParent             = "A0004"
+	notEmpty                  = "A0005"
+	capacityExceeded          = "A0006"
 )
 
 type DBError struct {
@@ -47,11 +51,32 @@ type OutOfLimits struct {
 	column string
 }
 
+type CellsOccupied struct {
+	table  string
+	column string
+	cells  string
+}
+
 type AlreadySet struct {
 	table  string
 	column string
 }
 
+type InvalidParent struct {
+	table  string
+	column string
+}
+
+type CapacityExceeded struct {
+	table  string
+	column string
+}
+
+type NotEmpty struct {
+	table  string
+	column string
+}
+
 type ContextCanceled struct{}
 
 func getColumn(pgErr *pgconn.PgError) string {
@@ -76,11 +101,32 @@ func ErrorAsStruct(err error) interface{} {
 				table:  pgErr.TableName,
 				column: getColumn(pgErr),
 			}
+		case cellsOccupied:
+			return CellsOccupied{
+				table:  pgErr.TableName,
+				column: getColumn(pgErr),
+				cells:  pgErr.Detail,
+			}
 		case alreadySet:
 			return AlreadySet{
 				table:  pgErr.TableName,
 				column: getColumn(pgErr),
 			}
+		case capacityExceeded:
+			return CapacityExceeded{
+				table:  pgErr.TableName,
+				column: getColumn(pgErr),
+			}
+		case notEmpty:
+			return NotEmpty{
+				table:  pgErr.TableName,
+				column: getColumn(pgErr),
+			}
+		case invalidParent:
+			return InvalidParent{
+				table:  pgErr.TableName,
+				column: getColumn(pgErr),
+			}
 		default:
 			panic(fmt.Sprintf("unforseen case - %s code", pgErr.Code))
 		}
@@ -123,3 +169,45 @@ func (o OutOfLimits) Localize(tableStruct interface{}) error {
 	)
 	return dbErr
 }
+
+func (c CellsOccupied) Localize(tableStruct interface{}) error {
+	var dbErr DBError
+	dbErr.asMapLocal = make(map[string]string)
+	dbErr.asString = fmt.Sprintf("%s of %s blocked by occupied cells %s", c.column, c.table, c.cells)
+	dbErr.asMapLocal[c.column+"Err"] = fmt.Sprintf(
+		"Поле %s не можна зменшити, зайняті відділи: %s",
+		localColumn(c.column, tableStruct),
+		c.cells,
+	)
+	return dbErr
+}
+
+func (i InvalidParent) Localize(tableStruct interface{}) error {
+	var dbErr DBError
+	dbErr.asMapLocal = make(map[string]string)
+	dbErr.asString = fmt.Sprintf("%s is not allowed for %s", i.column, i.table)
+	dbErr.asMapLocal[i.column+"Err"] = fmt.Sprintf(
+		"%s не може містити елемент цього типу",
+		localColumn(i.column, tableStruct),
+	)
+	return dbErr
+}
+
+func (c CapacityExceeded) Localize(tableStruct interface{}) error {
+	var dbErr DBError
+	dbErr.asMapLocal = make(map[string]string)
+	dbErr.asString = fmt.Sprintf("%s capacity exceeded for %s", c.column, c.table)
+	dbErr.asMapLocal[c.column+"Err"] = fmt.Sprintf(
+		"Відділ заповнений, оберіть інший %s",
+		localColumn(c.column, tableStruct),
+	)
+	return dbErr
+}
+
+func (n NotEmpty) Localize() error {
+	var dbErr DBError
+	dbErr.asMapLocal = make(map[string]string)
+	dbErr.asString = fmt.Sprintf("%s is not empty, %s can't be set", n.table, n.column)
+	dbErr.asMapLocal[n.column+"Err"] = "Елемент містить екземпляри, перемістіть або спишіть їх"
+	return dbErr
+}
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type StorageInspection struct {
+	Storage     Storage
+	Days        int16 `json:"inspection_days" validate:"gte=0,lte=3650" uaLocal:"інтервал інспекції"`
+	InspectedAt time.Time
+	DueAt       time.Time
+}
+
+type StorageInspectionsRange struct {
+	Inspections []StorageInspection
+	UserID      uuid.UUID
+	From        time.Time
+	Until       time.Time
+}
+
+const (
+	inspectionCols  = "COALESCE(storage.inspection_days, 0), storage.inspected_at, COALESCE(storage.inspected_at, storage.created_at::date) + COALESCE(storage.inspection_days, 0)"
+	inspectionDueAt = "COALESCE(storage.inspected_at, storage.created_at::date) + storage.inspection_days"
+)
+
+func (i StorageInspection) getQueue(
+	batch *pgx.Batch,
+) {
+	query := fmt.Sprintf("SELECT %s FROM storage WHERE storage.id=$1", inspectionCols)
+	batch.Queue(query, i.Storage.ID)
+}
+
+func (i *StorageInspection) getResult(results pgx.BatchResults) error {
+	var inspectedAt pgtype.Date
+	err := results.QueryRow().Scan(&i.Days, &inspectedAt, &i.DueAt)
+	if err != nil {
+		return err
+	}
+	if inspectedAt.Valid {
+		i.InspectedAt = inspectedAt.Time
+	}
+	return nil
+}
+
+func (i *StorageInspection) Get() (BatchOperation, BatchRead) {
+	return i.getQueue, i.getResult
+}
+
+func (i StorageInspection) setIntervalQueue(
+	batch *pgx.Batch,
+) {
+	query := fmt.Sprintf(
+		"UPDATE storage SET inspection_days=NULLIF($2, 0) WHERE storage.id=$1 AND storage.archived_at IS NULL RETURNING %s",
+		inspectionCols,
+	)
+	batch.Queue(query, i.Storage.ID, i.Days)
+}
+
+func (i *StorageInspection) SetInterval() (BatchOperation, BatchRead) {
+	return i.setIntervalQueue, i.getResult
+}
+
+func (i StorageInspection) recordQueue(
+	batch *pgx.Batch,
+) {
+	query := fmt.Sprintf(
+		"UPDATE storage SET inspected_at=current_date WHERE storage.id=$1 AND storage.archived_at IS NULL AND storage.inspection_days IS NOT NULL RETURNING %s",
+		inspectionCols,
+	)
+	batch.Queue(query, i.Storage.ID)
+}
+
+func (i *StorageInspection) Record() (BatchOperation, BatchRead) {
+	return i.recordQueue, i.getResult
+}
+
+func (r StorageInspectionsRange) getQueue(
+	batch *pgx.Batch,
+) {
+	filter := fmt.Sprintf(
+		"storage.archived_at IS NULL AND storage.inspection_days IS NOT NULL AND %[1]s >= $2 AND %[1]s < $3 AND storage.id IN (SELECT id FROM allowed_storage)",
+		inspectionDueAt,
+	)
+	query := fmt.Sprintf(
+		"%s SELECT storage.id, storage.name, storage.kind, %s FROM storage WHERE %s ORDER BY %s, storage.name",
+		allowedStorages,
+		inspectionCols,
+		filter,
+		inspectionDueAt,
+	)
+	batch.Queue(query, r.UserID, r.From, r.Until)
+}
+
+func (r *StorageInspectionsRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var inspection StorageInspection
+		var inspectedAt pgtype.Date
+		err = rows.Scan(
+			&inspection.Storage.ID,
+			&inspection.Storage.Name,
+			&inspection.Storage.Kind,
+			&inspection.Days,
+			&inspectedAt,
+			&inspection.DueAt,
+		)
+		if err != nil {
+			return err
+		}
+		if inspectedAt.Valid {
+			inspection.InspectedAt = inspectedAt.Time
+		}
+		r.Inspections = append(r.Inspections, inspection)
+	}
+	return rows.Err()
+}
+
+func (r *StorageInspectionsRange) Get() (BatchOperation, BatchRead) {
+	return r.getQueue, r.getResult
+}
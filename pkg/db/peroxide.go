@@ -0,0 +1,128 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type PeroxideTest struct {
+	Instance ReagentInstanceExtended
+	Days     int16
+	TestedAt time.Time
+	DueAt    time.Time
+}
+
+type PeroxideTestsRange struct {
+	PeroxideTests []PeroxideTest
+	UserID        uuid.UUID
+	From          time.Time
+	Until         time.Time
+}
+
+const peroxideDueAt = "COALESCE(reagent_instance.peroxide_tested_at, reagent_instance.created_at::date) + reagent.peroxide_test_days"
+
+func (p PeroxideTest) getQueue(
+	batch *pgx.Batch,
+) {
+	query := fmt.Sprintf(
+		"SELECT COALESCE(reagent.peroxide_test_days, 0), reagent_instance.peroxide_tested_at, COALESCE(%s, reagent_instance.created_at::date) FROM reagent_instance JOIN reagent ON reagent_instance.reagent = reagent.id WHERE reagent_instance.id=$1 AND reagent_instance.reagent=$2",
+		peroxideDueAt,
+	)
+	batch.Queue(query, p.Instance.ReagentInstance.ID, p.Instance.ReagentInstance.Reagent)
+}
+
+func (p *PeroxideTest) getResult(results pgx.BatchResults) error {
+	var testedAt pgtype.Date
+	err := results.QueryRow().Scan(&p.Days, &testedAt, &p.DueAt)
+	if err != nil {
+		return err
+	}
+	if testedAt.Valid {
+		p.TestedAt = testedAt.Time
+	}
+	return nil
+}
+
+func (p *PeroxideTest) Get() (BatchOperation, BatchRead) {
+	return p.getQueue, p.getResult
+}
+
+func (p PeroxideTest) recordQueue(
+	batch *pgx.Batch,
+) {
+	query := fmt.Sprintf(
+		"UPDATE reagent_instance SET peroxide_tested_at=current_date FROM reagent WHERE reagent_instance.reagent = reagent.id AND reagent_instance.id=$1 AND reagent_instance.reagent=$2 AND reagent_instance.used_at IS NULL AND reagent_instance.deleted_at IS NULL AND reagent.peroxide_test_days IS NOT NULL RETURNING reagent.peroxide_test_days, reagent_instance.peroxide_tested_at, %s",
+		peroxideDueAt,
+	)
+	batch.Queue(query, p.Instance.ReagentInstance.ID, p.Instance.ReagentInstance.Reagent)
+}
+
+func (p *PeroxideTest) Record() (BatchOperation, BatchRead) {
+	return p.recordQueue, p.getResult
+}
+
+func (r PeroxideTestsRange) getQueue(
+	batch *pgx.Batch,
+) {
+	cols := fmt.Sprintf(
+		"reagent_instance.id, reagent_instance.code, reagent.id, reagent.name, reagent.formula, storage_cell.number, storage.id, storage.name, reagent.peroxide_test_days, %s",
+		peroxideDueAt,
+	)
+	join := "JOIN reagent ON reagent_instance.reagent = reagent.id LEFT JOIN storage_cell ON reagent_instance.storage_cell = storage_cell.id LEFT JOIN storage ON storage_cell.storage = storage.id"
+	filter := fmt.Sprintf(
+		"reagent_instance.used_at IS NULL AND reagent_instance.deleted_at IS NULL AND reagent.peroxide_test_days IS NOT NULL AND %[1]s >= $2 AND %[1]s < $3 AND (storage.id IS NULL OR storage.id IN (SELECT id FROM allowed_storage))",
+		peroxideDueAt,
+	)
+	query := fmt.Sprintf(
+		"%s SELECT %s FROM reagent_instance %s WHERE %s ORDER BY %s, reagent.name",
+		allowedStorages,
+		cols,
+		join,
+		filter,
+		peroxideDueAt,
+	)
+	batch.Queue(query, r.UserID, r.From, r.Until)
+}
+
+func (r *PeroxideTestsRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var test PeroxideTest
+		var cellNumber pgtype.Int2
+		var storageID pgtype.UUID
+		var storageName pgtype.Text
+		err = rows.Scan(
+			&test.Instance.ReagentInstance.ID,
+			&test.Instance.ReagentInstance.Code,
+			&test.Instance.Reagent.ID,
+			&test.Instance.Reagent.Name,
+			&test.Instance.Reagent.Formula,
+			&cellNumber,
+			&storageID,
+			&storageName,
+			&test.Days,
+			&test.DueAt,
+		)
+		if err != nil {
+			return err
+		}
+		test.Instance.ReagentInstance.Reagent = test.Instance.Reagent.ID
+		test.Instance.StorageCell.Number = cellNumber.Int16
+		test.Instance.Storage.ID = storageID.Bytes
+		test.Instance.Storage.Name = storageName.String
+		r.PeroxideTests = append(r.PeroxideTests, test)
+	}
+	return rows.Err()
+}
+
+func (r *PeroxideTestsRange) Get() (BatchOperation, BatchRead) {
+	return r.getQueue, r.getResult
+}
@@ -10,12 +10,15 @@ import (
 )
 
 type Reagent struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Name      string    `json:"name"       validate:"gte=3,lte=300" uaLocal:"назва"`
-	Formula   string    `json:"formula"    validate:"gte=1,lte=50"  uaLocal:"формула"`
-	Instances int       `json:"instances"`
+	ID               uuid.UUID `json:"id"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	Name             string    `json:"name"       validate:"gte=3,lte=300" uaLocal:"назва"`
+	Formula          string    `json:"formula"    validate:"gte=1,lte=50"  uaLocal:"формула"`
+	Cas              string    `json:"cas"        validate:"omitempty,cas" uaLocal:"CAS-номер"`
+	Hazards          []string  `json:"hazards"`
+	Instances        int       `json:"instances"`
+	PeroxideTestDays int16     `json:"peroxide_test_days" validate:"gte=0,lte=3650" uaLocal:"перевірка на пероксиди"`
 }
 
 type ReagentsRange struct {
@@ -23,13 +26,21 @@ type ReagentsRange struct {
 	Limit    int
 	Offset   int
 	Src      string
+	Location uuid.UUID
 }
 
 func (r Reagent) createQueue(
 	batch *pgx.Batch,
 ) {
-	query := "INSERT into reagent(name, formula) VALUES($1, $2) RETURNING id, created_at, updated_at"
-	batch.Queue(query, r.Name, r.Formula)
+	query := "INSERT into reagent(name, formula, hazards, cas, peroxide_test_days) VALUES($1, $2, $3, NULLIF($4, ''), NULLIF($5, 0)) RETURNING id, created_at, updated_at"
+	batch.Queue(query, r.Name, r.Formula, r.hazards(), r.Cas, r.PeroxideTestDays)
+}
+
+func (r Reagent) hazards() []string {
+	if r.Hazards == nil {
+		return []string{}
+	}
+	return r.Hazards
 }
 
 func (r *Reagent) createResult(results pgx.BatchResults) error {
@@ -44,22 +55,41 @@ func (r ReagentsRange) getQueue(
 	batch *pgx.Batch,
 ) {
 	cols := "reagent.id, reagent.created_at, reagent.updated_at, reagent.name, reagent.formula, COUNT(reagent_instance)"
-	join := "LEFT JOIN reagent_instance ON reagent.id = reagent_instance.reagent AND reagent_instance.used_at IS NULL"
-	filter := "reagent.name ILIKE $3 OR reagent.formula ILIKE $3"
+	join := "LEFT JOIN reagent_instance ON reagent.id = reagent_instance.reagent AND " + availableInstance
+	filter := "TRUE"
+	having := ""
 	order := "COUNT(reagent_instance) DESC, reagent.name"
+	args := []any{r.Limit, r.Offset}
 	if len(r.Src) >= 1 {
-		query := fmt.Sprintf(
-			"SELECT %s FROM reagent %s WHERE %s GROUP BY reagent.id ORDER BY %s LIMIT $1 OFFSET $2",
-			cols,
-			join,
-			filter,
-			order,
+		args = append(args, r.Src+"%")
+		filter = fmt.Sprintf(
+			"(reagent.name ILIKE $%d OR reagent.formula ILIKE $%d OR reagent.cas ILIKE $%d OR reagent.id IN (SELECT code_instance.reagent FROM reagent_instance AS code_instance WHERE code_instance.code ILIKE $%d))",
+			len(args),
+			len(args),
+			len(args),
+			len(args),
 		)
-		batch.Queue(query, r.Limit, r.Offset, r.Src+"%")
-	} else {
-		query := fmt.Sprintf("SELECT %s FROM reagent %s GROUP BY reagent.id ORDER BY %s LIMIT $1 OFFSET $2", cols, join, order)
-		batch.Queue(query, r.Limit, r.Offset)
 	}
+	subtree := ""
+	if r.Location != uuid.Nil {
+		args = append(args, r.Location)
+		subtree = fmt.Sprintf(
+			"WITH RECURSIVE subtree AS (SELECT id FROM storage WHERE id=$%d UNION ALL SELECT storage.id FROM storage JOIN subtree ON storage.parent = subtree.id)",
+			len(args),
+		)
+		join = join + " AND reagent_instance.storage_cell IN (SELECT storage_cell.id FROM storage_cell WHERE storage_cell.storage IN (SELECT id FROM subtree))"
+		having = "HAVING COUNT(reagent_instance) > 0"
+	}
+	query := fmt.Sprintf(
+		"%s SELECT %s FROM reagent %s WHERE %s GROUP BY reagent.id %s ORDER BY %s LIMIT $1 OFFSET $2",
+		subtree,
+		cols,
+		join,
+		filter,
+		having,
+		order,
+	)
+	batch.Queue(query, args...)
 }
 
 func (r *ReagentsRange) getResult(results pgx.BatchResults) error {
@@ -97,7 +127,7 @@ func (r *ReagentsRange) Get() (BatchOperation, BatchRead) {
 func (reagent Reagent) getQueue(
 	batch *pgx.Batch,
 ) {
-	query := "SELECT created_at, updated_at, name, formula FROM reagent WHERE id=$1"
+	query := "SELECT created_at, updated_at, name, formula, hazards, COALESCE(cas, ''), COALESCE(peroxide_test_days, 0) FROM reagent WHERE id=$1"
 	batch.Queue(query, reagent.ID)
 }
 
@@ -107,6 +137,9 @@ func (reagent *Reagent) getResult(results pgx.BatchResults) error {
 		&reagent.UpdatedAt,
 		&reagent.Name,
 		&reagent.Formula,
+		&reagent.Hazards,
+		&reagent.Cas,
+		&reagent.PeroxideTestDays,
 	)
 }
 
@@ -117,8 +150,8 @@ func (reagent *Reagent) Get() (BatchOperation, BatchRead) {
 func (r Reagent) updateQueue(
 	batch *pgx.Batch,
 ) {
-	query := "UPDATE reagent SET name=$2, formula=$3 WHERE id=$1"
-	batch.Queue(query, r.ID, r.Name, r.Formula)
+	query := "UPDATE reagent SET name=$2, formula=$3, hazards=$4, cas=NULLIF($5, ''), peroxide_test_days=NULLIF($6, 0) WHERE id=$1"
+	batch.Queue(query, r.ID, r.Name, r.Formula, r.hazards(), r.Cas, r.PeroxideTestDays)
 }
 
 func (r *Reagent) updateResult(results pgx.BatchResults) error {
@@ -147,13 +180,19 @@ type ReagentInstance struct {
 	ExpiresAt   time.Time `json:"expires_at"   validate:"gt" uaLocal:"термін придатності"`
 	StorageCell uuid.UUID `json:"storage_cell"`
 	DeletedAt   time.Time `json:"deleted_at"`
+	Lot         string    `json:"lot"          validate:"lte=50" uaLocal:"партія"`
+	Receiving   uuid.UUID `json:"receiving"`
+	Code        string    `json:"code"`
 }
 
 type ReagentInstanceExtended struct {
-	ReagentInstance ReagentInstance
-	Reagent         Reagent
-	Storage         Storage
-	StorageCell     StorageCell
+	ReagentInstance  ReagentInstance
+	Reagent          Reagent
+	Storage          Storage
+	StorageCell      StorageCell
+	Recertifications int
+	Reservation      ReservationExtended
+	Checkout         CheckoutExtended
 }
 
 type ReagentInstanceRange struct {
@@ -161,36 +200,58 @@ type ReagentInstanceRange struct {
 	ReagentID                uuid.UUID
 }
 
-func (r *ReagentInstanceExtended) createQueue(
-	batch *pgx.Batch,
-) {
-	reagentInstance := r.ReagentInstance
-	query := "INSERT INTO reagent_instance(reagent, expires_at, storage_cell) VALUES($1, $2, (SELECT id FROM storage_cell WHERE storage=$3 AND number=$4)) RETURNING id, created_at, updated_at"
-	batch.Queue(
-		query,
-		reagentInstance.Reagent,
-		reagentInstance.ExpiresAt,
-		r.Storage.ID,
-		r.StorageCell.Number,
-	)
+type instanceLocation struct {
+	instanceCell     pgtype.UUID
+	cellID           pgtype.UUID
+	cellCreatedAt    pgtype.Timestamptz
+	cellUpdatedAt    pgtype.Timestamptz
+	cellStorage      pgtype.UUID
+	cellNumber       pgtype.Int2
+	storageID        pgtype.UUID
+	storageCreatedAt pgtype.Timestamptz
+	storageUpdatedAt pgtype.Timestamptz
+	storageName      pgtype.Text
+	storageCells     pgtype.Int2
 }
 
-func (r *ReagentInstance) createResult(results pgx.BatchResults) error {
-	return results.QueryRow().Scan(
-		&r.ID,
-		&r.CreatedAt,
-		&r.UpdatedAt,
-	)
+func (l *instanceLocation) cell() []any {
+	return []any{&l.cellID, &l.cellCreatedAt, &l.cellUpdatedAt, &l.cellStorage, &l.cellNumber}
+}
+
+func (l *instanceLocation) storage() []any {
+	return []any{&l.storageID, &l.storageCreatedAt, &l.storageUpdatedAt, &l.storageName, &l.storageCells}
+}
+
+func (l instanceLocation) set(i *ReagentInstanceExtended) {
+	i.ReagentInstance.StorageCell = l.instanceCell.Bytes
+	i.StorageCell.ID = l.cellID.Bytes
+	i.StorageCell.CreatedAt = pgTypeToTime(l.cellCreatedAt)
+	i.StorageCell.UpdatedAt = pgTypeToTime(l.cellUpdatedAt)
+	i.StorageCell.Storage = l.cellStorage.Bytes
+	i.StorageCell.Number = l.cellNumber.Int16
+	i.Storage.ID = l.storageID.Bytes
+	i.Storage.CreatedAt = pgTypeToTime(l.storageCreatedAt)
+	i.Storage.UpdatedAt = pgTypeToTime(l.storageUpdatedAt)
+	i.Storage.Name = l.storageName.String
+	i.Storage.Cells = l.storageCells.Int16
 }
 
-func (r *ReagentInstanceExtended) Create() (BatchOperation, BatchRead) {
-	return r.createQueue, r.ReagentInstance.createResult
+func (r ReagentInstanceExtended) Placed() bool {
+	return r.StorageCell.ID != uuid.Nil
+}
+
+func (r ReagentInstanceExtended) Reserved() bool {
+	return r.Reservation.Reservation.ID != uuid.Nil
+}
+
+func (r ReagentInstanceExtended) CheckedOut() bool {
+	return r.Checkout.Checkout.ID != uuid.Nil
 }
 
 func (r *ReagentInstanceRange) getQueue(
 	batch *pgx.Batch,
 ) {
-	cols := "reagent_instance.id, reagent_instance.created_at, reagent_instance.updated_at, reagent_instance.reagent, reagent_instance.used_at, reagent_instance.expires_at, reagent_instance.storage_cell, reagent_instance.deleted_at, storage_cell.id, storage_cell.created_at, storage_cell.updated_at, storage_cell.storage, storage_cell.number, storage.id, storage.created_at, storage.updated_at, storage.name, storage.cells"
+	cols := "reagent_instance.id, reagent_instance.created_at, reagent_instance.updated_at, reagent_instance.reagent, reagent_instance.used_at, reagent_instance.expires_at, reagent_instance.storage_cell, reagent_instance.deleted_at, reagent_instance.code, storage_cell.id, storage_cell.created_at, storage_cell.updated_at, storage_cell.storage, storage_cell.number, storage.id, storage.created_at, storage.updated_at, storage.name, storage.cells, (SELECT COUNT(*) FROM reagent_instance_recertification WHERE reagent_instance_recertification.reagent_instance = reagent_instance.id)"
 	join := "LEFT JOIN storage_cell ON reagent_instance.storage_cell = storage_cell.id LEFT JOIN storage ON storage_cell.storage = storage.id"
 	filter := "reagent_instance.reagent=$1"
 	order := "reagent_instance.created_at"
@@ -217,29 +278,25 @@ func (r *ReagentInstanceRange) getResult(results pgx.BatchResults) error {
 		var i ReagentInstanceExtended
 		var usedAt pgtype.Timestamptz
 		var deletedAt pgtype.Timestamptz
-		err = rows.Scan(
+		var location instanceLocation
+		dest := []any{
 			&i.ReagentInstance.ID,
 			&i.ReagentInstance.CreatedAt,
 			&i.ReagentInstance.UpdatedAt,
 			&i.ReagentInstance.Reagent,
 			&usedAt,
 			&i.ReagentInstance.ExpiresAt,
-			&i.ReagentInstance.StorageCell,
+			&location.instanceCell,
 			&deletedAt,
-			&i.StorageCell.ID,
-			&i.StorageCell.CreatedAt,
-			&i.StorageCell.UpdatedAt,
-			&i.StorageCell.Storage,
-			&i.StorageCell.Number,
-			&i.Storage.ID,
-			&i.Storage.CreatedAt,
-			&i.Storage.UpdatedAt,
-			&i.Storage.Name,
-			&i.Storage.Cells,
-		)
+			&i.ReagentInstance.Code,
+		}
+		dest = append(dest, location.cell()...)
+		dest = append(dest, location.storage()...)
+		err = rows.Scan(append(dest, &i.Recertifications)...)
 		if err != nil {
 			return err
 		}
+		location.set(&i)
 		i.ReagentInstance.UsedAt = pgTypeToTime(usedAt)
 		i.ReagentInstance.DeletedAt = pgTypeToTime(deletedAt)
 		r.ReagentInstancesExtended = append(r.ReagentInstancesExtended, i)
@@ -252,54 +309,86 @@ func (r *ReagentInstanceRange) Get() (BatchOperation, BatchRead) {
 	return r.getQueue, r.getResult
 }
 
+const reagentInstanceCols = "reagent_instance.created_at, reagent_instance.updated_at, reagent_instance.used_at, reagent_instance.expires_at, reagent_instance.storage_cell, reagent_instance.deleted_at, reagent_instance.lot, reagent_instance.receiving, reagent_instance.code, reagent.id, reagent.created_at, reagent.updated_at, reagent.name, reagent.formula, storage_cell.id, storage_cell.created_at, storage_cell.updated_at, storage_cell.storage, storage_cell.number, storage.id, storage.created_at, storage.updated_at, storage.name, storage.cells"
+
+const reagentInstanceJoin = "LEFT JOIN storage_cell ON reagent_instance.storage_cell = storage_cell.id LEFT JOIN storage ON storage_cell.storage = storage.id LEFT JOIN reagent ON reagent_instance.reagent = reagent.id"
+
 func (r ReagentInstance) getQueue(
 	batch *pgx.Batch,
 ) {
-	cols := "reagent_instance.created_at, reagent_instance.updated_at, reagent_instance.used_at, reagent_instance.expires_at, reagent_instance.storage_cell, reagent_instance.deleted_at, reagent.id, reagent.created_at, reagent.updated_at, reagent.name, reagent.formula, storage_cell.id, storage_cell.created_at, storage_cell.updated_at, storage_cell.storage, storage_cell.number, storage.id, storage.created_at, storage.updated_at, storage.name, storage.cells"
-	join := "LEFT JOIN storage_cell ON reagent_instance.storage_cell = storage_cell.id LEFT JOIN storage ON storage_cell.storage = storage.id LEFT JOIN reagent ON reagent_instance.reagent = reagent.id"
 	filter := "reagent_instance.id=$1 AND reagent_instance.reagent=$2"
-	query := fmt.Sprintf("SELECT %s FROM reagent_instance %s WHERE %s", cols, join, filter)
+	query := fmt.Sprintf(
+		"SELECT %s FROM reagent_instance %s WHERE %s",
+		reagentInstanceCols,
+		reagentInstanceJoin,
+		filter,
+	)
 	batch.Queue(query, r.ID, r.Reagent)
 }
 
-func (r *ReagentInstanceExtended) getResult(results pgx.BatchResults) error {
+func (r *ReagentInstanceExtended) scan(row pgx.Row, dest ...any) error {
 	var usedAt pgtype.Timestamptz
 	var deletedAt pgtype.Timestamptz
-	err := results.QueryRow().Scan(
+	var receiving pgtype.UUID
+	var location instanceLocation
+	dest = append(
+		dest,
 		&r.ReagentInstance.CreatedAt,
 		&r.ReagentInstance.UpdatedAt,
 		&usedAt,
 		&r.ReagentInstance.ExpiresAt,
-		&r.ReagentInstance.StorageCell,
+		&location.instanceCell,
 		&deletedAt,
+		&r.ReagentInstance.Lot,
+		&receiving,
+		&r.ReagentInstance.Code,
 		&r.Reagent.ID,
 		&r.Reagent.CreatedAt,
 		&r.Reagent.UpdatedAt,
 		&r.Reagent.Name,
 		&r.Reagent.Formula,
-		&r.StorageCell.ID,
-		&r.StorageCell.CreatedAt,
-		&r.StorageCell.UpdatedAt,
-		&r.StorageCell.Storage,
-		&r.StorageCell.Number,
-		&r.Storage.ID,
-		&r.Storage.CreatedAt,
-		&r.Storage.UpdatedAt,
-		&r.Storage.Name,
-		&r.Storage.Cells,
 	)
+	dest = append(dest, location.cell()...)
+	err := row.Scan(append(dest, location.storage()...)...)
 	if err != nil {
 		return err
 	}
+	location.set(r)
 	r.ReagentInstance.UsedAt = pgTypeToTime(usedAt)
 	r.ReagentInstance.DeletedAt = pgTypeToTime(deletedAt)
+	r.ReagentInstance.Receiving = receiving.Bytes
 	return nil
 }
 
+func (r *ReagentInstanceExtended) getResult(results pgx.BatchResults) error {
+	return r.scan(results.QueryRow())
+}
+
 func (r *ReagentInstanceExtended) Get() (BatchOperation, BatchRead) {
 	return r.ReagentInstance.getQueue, r.getResult
 }
 
+func (r ReagentInstance) getByCodeQueue(
+	batch *pgx.Batch,
+) {
+	filter := "reagent_instance.code=upper($1)"
+	query := fmt.Sprintf(
+		"SELECT reagent_instance.id, reagent_instance.reagent, %s FROM reagent_instance %s WHERE %s",
+		reagentInstanceCols,
+		reagentInstanceJoin,
+		filter,
+	)
+	batch.Queue(query, r.Code)
+}
+
+func (r *ReagentInstanceExtended) getByCodeResult(results pgx.BatchResults) error {
+	return r.scan(results.QueryRow(), &r.ReagentInstance.ID, &r.ReagentInstance.Reagent)
+}
+
+func (r *ReagentInstanceExtended) GetByCode() (BatchOperation, BatchRead) {
+	return r.ReagentInstance.getByCodeQueue, r.getByCodeResult
+}
+
 func (r ReagentInstanceExtended) updateQueue(
 	batch *pgx.Batch,
 ) {
@@ -311,12 +400,9 @@ func (r ReagentInstanceExtended) updateQueue(
 		args = append(args, r.ReagentInstance.UsedAt)
 		argNum++
 	}
+	cellArg := argNum
 	if r.StorageCell.Number != 0 {
-		arg := fmt.Sprintf(
-			"storage_cell=(SELECT id FROM storage_cell WHERE storage=$%d AND number=$%d)",
-			argNum,
-			argNum+1,
-		)
+		arg := fmt.Sprintf("storage_cell=(%s)", activeCell(argNum, argNum+1))
 		if colsToUpdate != "" {
 			arg = ", " + arg
 		}
@@ -332,7 +418,11 @@ func (r ReagentInstanceExtended) updateQueue(
 		colsToUpdate = colsToUpdate + arg
 		args = append(args, r.ReagentInstance.DeletedAt)
 	}
-	query := fmt.Sprintf("UPDATE reagent_instance SET %s WHERE id=$1 AND reagent=$2", colsToUpdate)
+	filter := "id=$1 AND reagent=$2"
+	if r.StorageCell.Number != 0 {
+		filter = filter + fmt.Sprintf(" AND EXISTS (%s)", activeCell(cellArg, cellArg+1))
+	}
+	query := fmt.Sprintf("UPDATE reagent_instance SET %s WHERE %s", colsToUpdate, filter)
 	batch.Queue(query, args...)
 }
 
@@ -352,3 +442,247 @@ func (r *ReagentInstanceExtended) updateResult(results pgx.BatchResults) error {
 func (r *ReagentInstanceExtended) Update() (BatchOperation, BatchRead) {
 	return r.updateQueue, r.updateResult
 }
+
+type ReagentInstanceUse struct {
+	ReagentInstance    ReagentInstance
+	StorageUser        uuid.UUID
+	IgnoreReservations bool
+}
+
+func (u ReagentInstanceUse) useQueue(
+	batch *pgx.Batch,
+) {
+	query := fmt.Sprintf(
+		"UPDATE reagent_instance SET used_at=$3 WHERE id=$1 AND reagent=$2 AND ($5 OR NOT %s)",
+		reservedForOthers(4),
+	)
+	batch.Queue(
+		query,
+		u.ReagentInstance.ID,
+		u.ReagentInstance.Reagent,
+		u.ReagentInstance.UsedAt,
+		u.StorageUser,
+		u.IgnoreReservations,
+	)
+}
+
+func (u *ReagentInstanceUse) useResult(results pgx.BatchResults) error {
+	result, err := results.Exec()
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (u *ReagentInstanceUse) Use() (BatchOperation, BatchRead) {
+	return u.useQueue, u.useResult
+}
+
+type ExpiringInstancesRange struct {
+	ReagentInstancesExtended []ReagentInstanceExtended
+	UserID                   uuid.UUID
+	From                     time.Time
+	Until                    time.Time
+}
+
+func (r ExpiringInstancesRange) getQueue(
+	batch *pgx.Batch,
+) {
+	cols := "reagent_instance.id, reagent_instance.expires_at, reagent.id, reagent.name, reagent.formula, storage_cell.number, storage.id, storage.name"
+	join := "JOIN reagent ON reagent_instance.reagent = reagent.id LEFT JOIN storage_cell ON reagent_instance.storage_cell = storage_cell.id LEFT JOIN storage ON storage_cell.storage = storage.id"
+	filter := "reagent_instance.used_at IS NULL AND reagent_instance.deleted_at IS NULL AND reagent_instance.expires_at >= $2 AND reagent_instance.expires_at < $3 AND (storage.id IS NULL OR storage.id IN (SELECT id FROM allowed_storage))"
+	order := "reagent_instance.expires_at, reagent.name"
+	query := fmt.Sprintf("%s SELECT %s FROM reagent_instance %s WHERE %s ORDER BY %s", allowedStorages, cols, join, filter, order)
+	batch.Queue(query, r.UserID, r.From, r.Until)
+}
+
+func (r *ExpiringInstancesRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	next := rows.Next()
+	if !next {
+		return nil
+	}
+	for next {
+		var i ReagentInstanceExtended
+		var cellNumber pgtype.Int2
+		var storageID pgtype.UUID
+		var storageName pgtype.Text
+		err = rows.Scan(
+			&i.ReagentInstance.ID,
+			&i.ReagentInstance.ExpiresAt,
+			&i.Reagent.ID,
+			&i.Reagent.Name,
+			&i.Reagent.Formula,
+			&cellNumber,
+			&storageID,
+			&storageName,
+		)
+		if err != nil {
+			return err
+		}
+		i.ReagentInstance.Reagent = i.Reagent.ID
+		i.StorageCell.Number = cellNumber.Int16
+		i.Storage.ID = storageID.Bytes
+		i.Storage.Name = storageName.String
+		r.ReagentInstancesExtended = append(r.ReagentInstancesExtended, i)
+		next = rows.Next()
+	}
+	return nil
+}
+
+func (r *ExpiringInstancesRange) Get() (BatchOperation, BatchRead) {
+	return r.getQueue, r.getResult
+}
+
+type StorageInstancesRange struct {
+	ReagentInstancesExtended []ReagentInstanceExtended
+	StorageID                uuid.UUID
+}
+
+func (r StorageInstancesRange) getQueue(
+	batch *pgx.Batch,
+) {
+	cols := "reagent_instance.id, reagent_instance.expires_at, reagent.id, reagent.name, reagent.formula, storage_cell.id, storage_cell.number, storage.id, storage.name"
+	join := "JOIN reagent ON reagent_instance.reagent = reagent.id JOIN storage_cell ON reagent_instance.storage_cell = storage_cell.id JOIN storage ON storage_cell.storage = storage.id"
+	filter := "storage.id IN (SELECT id FROM subtree) AND reagent_instance.used_at IS NULL AND reagent_instance.deleted_at IS NULL"
+	order := "storage.name, storage_cell.number, reagent_instance.expires_at"
+	query := fmt.Sprintf("%s SELECT %s FROM reagent_instance %s WHERE %s ORDER BY %s", storageSubtree, cols, join, filter, order)
+	batch.Queue(query, r.StorageID)
+}
+
+func scanStorageInstances(rows pgx.Rows) (instances []ReagentInstanceExtended, err error) {
+	for rows.Next() {
+		var i ReagentInstanceExtended
+		err = rows.Scan(
+			&i.ReagentInstance.ID,
+			&i.ReagentInstance.ExpiresAt,
+			&i.Reagent.ID,
+			&i.Reagent.Name,
+			&i.Reagent.Formula,
+			&i.StorageCell.ID,
+			&i.StorageCell.Number,
+			&i.Storage.ID,
+			&i.Storage.Name,
+		)
+		if err != nil {
+			return nil, err
+		}
+		i.ReagentInstance.Reagent = i.Reagent.ID
+		i.ReagentInstance.StorageCell = i.StorageCell.ID
+		i.StorageCell.Storage = i.Storage.ID
+		instances = append(instances, i)
+	}
+	return instances, rows.Err()
+}
+
+func (r *StorageInstancesRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	r.ReagentInstancesExtended, err = scanStorageInstances(rows)
+	return err
+}
+
+func (r *StorageInstancesRange) Get() (BatchOperation, BatchRead) {
+	return r.getQueue, r.getResult
+}
+
+type UnplacedInstance struct {
+	Instance         ReagentInstanceExtended
+	SuggestedStorage Storage
+}
+
+type UnplacedInstancesRange struct {
+	UnplacedInstances []UnplacedInstance
+}
+
+func (r UnplacedInstancesRange) getQueue(
+	batch *pgx.Batch,
+) {
+	cols := "reagent_instance.id, reagent_instance.expires_at, reagent.id, reagent.name, reagent.formula, suggested.id, suggested.name"
+	suggested := "SELECT storage.id, storage.name FROM reagent_instance placed JOIN storage_cell ON placed.storage_cell = storage_cell.id JOIN storage ON storage_cell.storage = storage.id WHERE placed.reagent = reagent_instance.reagent AND placed.used_at IS NULL AND placed.deleted_at IS NULL AND storage.archived_at IS NULL GROUP BY storage.id ORDER BY COUNT(*) DESC LIMIT 1"
+	join := fmt.Sprintf(
+		"JOIN reagent ON reagent_instance.reagent = reagent.id LEFT JOIN LATERAL (%s) suggested ON TRUE",
+		suggested,
+	)
+	filter := "reagent_instance.storage_cell IS NULL AND reagent_instance.used_at IS NULL AND reagent_instance.deleted_at IS NULL"
+	order := "reagent.name, reagent_instance.expires_at"
+	query := fmt.Sprintf("SELECT %s FROM reagent_instance %s WHERE %s ORDER BY %s", cols, join, filter, order)
+	batch.Queue(query)
+}
+
+func (r *UnplacedInstancesRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	next := rows.Next()
+	if !next {
+		return nil
+	}
+	for next {
+		var u UnplacedInstance
+		var suggestedID pgtype.UUID
+		var suggestedName pgtype.Text
+		err = rows.Scan(
+			&u.Instance.ReagentInstance.ID,
+			&u.Instance.ReagentInstance.ExpiresAt,
+			&u.Instance.Reagent.ID,
+			&u.Instance.Reagent.Name,
+			&u.Instance.Reagent.Formula,
+			&suggestedID,
+			&suggestedName,
+		)
+		if err != nil {
+			return err
+		}
+		u.Instance.ReagentInstance.Reagent = u.Instance.Reagent.ID
+		u.SuggestedStorage.ID = suggestedID.Bytes
+		u.SuggestedStorage.Name = suggestedName.String
+		r.UnplacedInstances = append(r.UnplacedInstances, u)
+		next = rows.Next()
+	}
+	return nil
+}
+
+func (r *UnplacedInstancesRange) Get() (BatchOperation, BatchRead) {
+	return r.getQueue, r.getResult
+}
+
+func (r ReagentInstanceExtended) placeQueue(
+	batch *pgx.Batch,
+) {
+	filter := "reagent_instance.id=$1 AND reagent_instance.reagent=$2 AND reagent_instance.storage_cell IS NULL AND reagent_instance.used_at IS NULL AND reagent_instance.deleted_at IS NULL"
+	query := fmt.Sprintf(
+		"WITH target AS (%s) UPDATE reagent_instance SET storage_cell=target.id FROM target WHERE %s RETURNING reagent_instance.storage_cell",
+		activeCell(3, 4),
+		filter,
+	)
+	batch.Queue(
+		query,
+		r.ReagentInstance.ID,
+		r.ReagentInstance.Reagent,
+		r.Storage.ID,
+		r.StorageCell.Number,
+	)
+}
+
+func (r *ReagentInstanceExtended) placeResult(results pgx.BatchResults) error {
+	err := results.QueryRow().Scan(&r.ReagentInstance.StorageCell)
+	if err != nil {
+		return err
+	}
+	r.StorageCell.ID = r.ReagentInstance.StorageCell
+	return nil
+}
+
+func (r *ReagentInstanceExtended) Place() (BatchOperation, BatchRead) {
+	return r.placeQueue, r.placeResult
+}
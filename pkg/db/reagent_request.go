@@ -0,0 +1,350 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	RequestPending  = "pending"
+	RequestApproved = "approved"
+	RequestPartial  = "partial"
+	RequestRejected = "rejected"
+)
+
+type ReagentRequest struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	StorageUser uuid.UUID `json:"storage_user"`
+	Title       string    `json:"title"        validate:"gte=3,lte=200" uaLocal:"назва"`
+	NeededBy    time.Time `json:"needed_by"                             uaLocal:"потрібно до"`
+	Status      string    `json:"status"`
+	Reviewer    uuid.UUID `json:"reviewer"`
+	ReviewedAt  time.Time `json:"reviewed_at"`
+	Comment     string    `json:"comment"      validate:"lte=500"       uaLocal:"коментар"`
+}
+
+type ReagentRequestItem struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	ReagentRequest uuid.UUID `json:"reagent_request"`
+	Reagent        uuid.UUID `json:"reagent"`
+	Amount         string    `json:"amount"          validate:"lte=50" uaLocal:"кількість"`
+}
+
+type ReagentRequestInstance struct {
+	ID                 uuid.UUID `json:"id"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+	ReagentRequestItem uuid.UUID `json:"reagent_request_item"`
+	ReagentInstance    uuid.UUID `json:"reagent_instance"`
+}
+
+type ReagentRequestItemExtended struct {
+	ReagentRequestItem ReagentRequestItem
+	Reagent            Reagent
+	Instances          []ReagentInstanceExtended
+	Candidates         []ReagentInstanceExtended
+}
+
+type ReagentRequestExtended struct {
+	ReagentRequest ReagentRequest
+	StorageUser    StorageUser
+	Reviewer       StorageUser
+	ItemsCount     int
+	Items          []ReagentRequestItemExtended
+	Picks          []ReagentRequestInstance
+}
+
+type ReagentRequestsRange struct {
+	ReagentRequests []ReagentRequestExtended
+	StorageUserID   uuid.UUID
+	Limit           int
+}
+
+func (r ReagentRequestExtended) createQueue(
+	batch *pgx.Batch,
+) {
+	reagents := make([]uuid.UUID, 0, len(r.Items))
+	amounts := make([]string, 0, len(r.Items))
+	for _, item := range r.Items {
+		reagents = append(reagents, item.ReagentRequestItem.Reagent)
+		amounts = append(amounts, item.ReagentRequestItem.Amount)
+	}
+	request := "INSERT INTO reagent_request(id, storage_user, title, needed_by) SELECT $1::uuid, $2::uuid, $3::text, $4::date WHERE EXISTS (SELECT 1 FROM reagent WHERE id = ANY($5::uuid[])) RETURNING id, created_at, updated_at, status"
+	items := "INSERT INTO reagent_request_item(reagent_request, reagent, amount) SELECT request.id, item.reagent, item.amount FROM request, unnest($5::uuid[], $6::text[]) AS item(reagent, amount) JOIN reagent ON item.reagent = reagent.id RETURNING id"
+	query := fmt.Sprintf(
+		"WITH request AS (%s), items AS (%s) SELECT request.created_at, request.updated_at, request.status, (SELECT COUNT(*) FROM items) FROM request",
+		request,
+		items,
+	)
+	batch.Queue(
+		query,
+		r.ReagentRequest.ID,
+		r.ReagentRequest.StorageUser,
+		r.ReagentRequest.Title,
+		r.ReagentRequest.NeededBy,
+		reagents,
+		amounts,
+	)
+}
+
+func (r *ReagentRequestExtended) createResult(results pgx.BatchResults) error {
+	return results.QueryRow().Scan(
+		&r.ReagentRequest.CreatedAt,
+		&r.ReagentRequest.UpdatedAt,
+		&r.ReagentRequest.Status,
+		&r.ItemsCount,
+	)
+}
+
+func (r *ReagentRequestExtended) Create() (BatchOperation, BatchRead) {
+	return r.createQueue, r.createResult
+}
+
+func (r ReagentRequestExtended) getQueue(
+	batch *pgx.Batch,
+) {
+	cols := "reagent_request.created_at, reagent_request.updated_at, reagent_request.storage_user, reagent_request.title, reagent_request.needed_by, reagent_request.status, reagent_request.reviewer, reagent_request.reviewed_at, reagent_request.comment, lecturer.name, reviewer.name"
+	join := "JOIN storage_user AS lecturer ON reagent_request.storage_user = lecturer.id LEFT JOIN storage_user AS reviewer ON reagent_request.reviewer = reviewer.id"
+	query := fmt.Sprintf("SELECT %s FROM reagent_request %s WHERE reagent_request.id=$1", cols, join)
+	batch.Queue(query, r.ReagentRequest.ID)
+	cols = "reagent_request_item.id, reagent_request_item.created_at, reagent_request_item.updated_at, reagent_request_item.amount, reagent.id, reagent.name, reagent.formula, " + availableInstances
+	query = fmt.Sprintf(
+		"SELECT %s FROM reagent_request_item JOIN reagent ON reagent_request_item.reagent = reagent.id WHERE reagent_request_item.reagent_request=$1 ORDER BY reagent.name",
+		cols,
+	)
+	batch.Queue(query, r.ReagentRequest.ID)
+	query = fmt.Sprintf(
+		"SELECT reagent_request_item.id, reagent_instance.id, reagent_instance.reagent, %s FROM reagent_request_instance JOIN reagent_request_item ON reagent_request_instance.reagent_request_item = reagent_request_item.id JOIN reagent_instance ON reagent_request_instance.reagent_instance = reagent_instance.id %s WHERE reagent_request_item.reagent_request=$1 ORDER BY reagent_instance.expires_at",
+		reagentInstanceCols,
+		reagentInstanceJoin,
+	)
+	batch.Queue(query, r.ReagentRequest.ID)
+	query = fmt.Sprintf(
+		"SELECT reagent_request_item.id, reagent_instance.id, reagent_instance.reagent, %s FROM reagent_request_item JOIN reagent_request ON reagent_request_item.reagent_request = reagent_request.id JOIN reagent_instance ON reagent_instance.reagent = reagent_request_item.reagent AND %s AND NOT %s %s WHERE reagent_request_item.reagent_request=$1 ORDER BY reagent_instance.expires_at, reagent_instance.code",
+		reagentInstanceCols,
+		usableInstance,
+		reservedByOthers,
+		reagentInstanceJoin,
+	)
+	batch.Queue(query, r.ReagentRequest.ID)
+}
+
+func (r *ReagentRequestExtended) getResult(results pgx.BatchResults) error {
+	var reviewer pgtype.UUID
+	var reviewedAt pgtype.Timestamptz
+	var reviewerName pgtype.Text
+	err := results.QueryRow().Scan(
+		&r.ReagentRequest.CreatedAt,
+		&r.ReagentRequest.UpdatedAt,
+		&r.ReagentRequest.StorageUser,
+		&r.ReagentRequest.Title,
+		&r.ReagentRequest.NeededBy,
+		&r.ReagentRequest.Status,
+		&reviewer,
+		&reviewedAt,
+		&r.ReagentRequest.Comment,
+		&r.StorageUser.Name,
+		&reviewerName,
+	)
+	if err != nil {
+		for i := 0; i < 3; i++ {
+			rows, _ := results.Query()
+			rows.Close()
+		}
+		return err
+	}
+	r.ReagentRequest.Reviewer = reviewer.Bytes
+	r.ReagentRequest.ReviewedAt = pgTypeToTime(reviewedAt)
+	r.StorageUser.ID = r.ReagentRequest.StorageUser
+	r.Reviewer.ID = reviewer.Bytes
+	r.Reviewer.Name = reviewerName.String
+	rows, err := results.Query()
+	if err == nil {
+		err = r.scanItems(rows)
+	}
+	if err != nil {
+		return err
+	}
+	for _, candidates := range []bool{false, true} {
+		rows, err := results.Query()
+		if err == nil {
+			err = r.scanInstances(rows, candidates)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ReagentRequestExtended) scanItems(rows pgx.Rows) error {
+	defer rows.Close()
+	for rows.Next() {
+		var item ReagentRequestItemExtended
+		err := rows.Scan(
+			&item.ReagentRequestItem.ID,
+			&item.ReagentRequestItem.CreatedAt,
+			&item.ReagentRequestItem.UpdatedAt,
+			&item.ReagentRequestItem.Amount,
+			&item.Reagent.ID,
+			&item.Reagent.Name,
+			&item.Reagent.Formula,
+			&item.Reagent.Instances,
+		)
+		if err != nil {
+			return err
+		}
+		item.ReagentRequestItem.ReagentRequest = r.ReagentRequest.ID
+		item.ReagentRequestItem.Reagent = item.Reagent.ID
+		r.Items = append(r.Items, item)
+	}
+	r.ItemsCount = len(r.Items)
+	return rows.Err()
+}
+
+func (r *ReagentRequestExtended) scanInstances(rows pgx.Rows, candidates bool) error {
+	defer rows.Close()
+	for rows.Next() {
+		var itemID uuid.UUID
+		var instance ReagentInstanceExtended
+		err := instance.scan(
+			rows,
+			&itemID,
+			&instance.ReagentInstance.ID,
+			&instance.ReagentInstance.Reagent,
+		)
+		if err != nil {
+			return err
+		}
+		for i := range r.Items {
+			if r.Items[i].ReagentRequestItem.ID != itemID {
+				continue
+			}
+			if candidates {
+				r.Items[i].Candidates = append(r.Items[i].Candidates, instance)
+			} else {
+				r.Items[i].Instances = append(r.Items[i].Instances, instance)
+			}
+		}
+	}
+	return rows.Err()
+}
+
+func (r *ReagentRequestExtended) Get() (BatchOperation, BatchRead) {
+	return r.getQueue, r.getResult
+}
+
+func (r ReagentRequestExtended) approveQueue(
+	batch *pgx.Batch,
+) {
+	items := make([]uuid.UUID, 0, len(r.Picks))
+	instances := make([]uuid.UUID, 0, len(r.Picks))
+	for _, pick := range r.Picks {
+		items = append(items, pick.ReagentRequestItem)
+		instances = append(instances, pick.ReagentInstance)
+	}
+	picked := fmt.Sprintf(
+		"INSERT INTO reagent_request_instance(reagent_request_item, reagent_instance) SELECT reagent_request_item.id, reagent_instance.id FROM unnest($4::uuid[], $5::uuid[]) AS pick(item, instance) JOIN reagent_request_item ON pick.item = reagent_request_item.id JOIN reagent_request ON reagent_request_item.reagent_request = reagent_request.id JOIN reagent_instance ON pick.instance = reagent_instance.id AND reagent_instance.reagent = reagent_request_item.reagent WHERE reagent_request.id=$1 AND reagent_request.status='pending' AND reagent_instance.used_at IS NULL AND reagent_instance.deleted_at IS NULL AND NOT %s ON CONFLICT ON CONSTRAINT reagent_request_instance_reagent_instance_key DO NOTHING RETURNING reagent_request_item, reagent_instance",
+		reservedByOthers,
+	)
+	reserved := "INSERT INTO reservation(reagent_instance, storage_user, purpose, reserved_from, reserved_until, reagent_request) SELECT DISTINCT picked.reagent_instance, reagent_request.storage_user, reagent_request.title, current_date, GREATEST(reagent_request.needed_by, current_date), reagent_request.id FROM picked JOIN reagent_request ON reagent_request.id=$1"
+	covered := "SELECT COUNT(DISTINCT reagent_request_item) AS items FROM picked"
+	status := "CASE WHEN covered.items = (SELECT COUNT(*) FROM reagent_request_item WHERE reagent_request=$1) THEN 'approved' ELSE 'partial' END"
+	query := fmt.Sprintf(
+		"WITH picked AS (%s), reserved AS (%s), covered AS (%s) UPDATE reagent_request SET status=%s, reviewer=$2, reviewed_at=now(), comment=$3 FROM covered WHERE reagent_request.id=$1 AND reagent_request.status='pending' AND covered.items > 0 RETURNING reagent_request.status, reagent_request.reviewed_at",
+		picked,
+		reserved,
+		covered,
+		status,
+	)
+	batch.Queue(
+		query,
+		r.ReagentRequest.ID,
+		r.ReagentRequest.Reviewer,
+		r.ReagentRequest.Comment,
+		items,
+		instances,
+	)
+}
+
+func (r *ReagentRequestExtended) reviewResult(results pgx.BatchResults) error {
+	return results.QueryRow().Scan(&r.ReagentRequest.Status, &r.ReagentRequest.ReviewedAt)
+}
+
+func (r *ReagentRequestExtended) Approve() (BatchOperation, BatchRead) {
+	return r.approveQueue, r.reviewResult
+}
+
+func (r ReagentRequestExtended) rejectQueue(
+	batch *pgx.Batch,
+) {
+	query := "UPDATE reagent_request SET status='rejected', reviewer=$2, reviewed_at=now(), comment=$3 WHERE id=$1 AND status='pending' RETURNING status, reviewed_at"
+	batch.Queue(query, r.ReagentRequest.ID, r.ReagentRequest.Reviewer, r.ReagentRequest.Comment)
+}
+
+func (r *ReagentRequestExtended) Reject() (BatchOperation, BatchRead) {
+	return r.rejectQueue, r.reviewResult
+}
+
+func (r ReagentRequestsRange) getQueue(
+	batch *pgx.Batch,
+) {
+	cols := "reagent_request.id, reagent_request.created_at, reagent_request.updated_at, reagent_request.storage_user, reagent_request.title, reagent_request.needed_by, reagent_request.status, reagent_request.reviewed_at, lecturer.name, (SELECT COUNT(*) FROM reagent_request_item WHERE reagent_request_item.reagent_request = reagent_request.id)"
+	join := "JOIN storage_user AS lecturer ON reagent_request.storage_user = lecturer.id"
+	filter := "TRUE"
+	args := []any{r.Limit}
+	if r.StorageUserID != uuid.Nil {
+		args = append(args, r.StorageUserID)
+		filter = fmt.Sprintf("reagent_request.storage_user=$%d", len(args))
+	}
+	query := fmt.Sprintf(
+		"SELECT %s FROM reagent_request %s WHERE %s ORDER BY reagent_request.status='pending' DESC, reagent_request.needed_by, reagent_request.created_at DESC LIMIT $1",
+		cols,
+		join,
+		filter,
+	)
+	batch.Queue(query, args...)
+}
+
+func (r *ReagentRequestsRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var request ReagentRequestExtended
+		var reviewedAt pgtype.Timestamptz
+		err = rows.Scan(
+			&request.ReagentRequest.ID,
+			&request.ReagentRequest.CreatedAt,
+			&request.ReagentRequest.UpdatedAt,
+			&request.ReagentRequest.StorageUser,
+			&request.ReagentRequest.Title,
+			&request.ReagentRequest.NeededBy,
+			&request.ReagentRequest.Status,
+			&reviewedAt,
+			&request.StorageUser.Name,
+			&request.ItemsCount,
+		)
+		if err != nil {
+			return err
+		}
+		request.ReagentRequest.ReviewedAt = pgTypeToTime(reviewedAt)
+		request.StorageUser.ID = request.ReagentRequest.StorageUser
+		r.ReagentRequests = append(r.ReagentRequests, request)
+	}
+	return rows.Err()
+}
+
+func (r *ReagentRequestsRange) Get() (BatchOperation, BatchRead) {
+	return r.getQueue, r.getResult
+}
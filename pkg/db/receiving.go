@@ -0,0 +1,226 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type Receiving struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	StorageUser uuid.UUID `json:"storage_user"`
+	Reagent     uuid.UUID `json:"reagent"`
+	Supplier    string    `json:"supplier"`
+	Grade       string    `json:"grade"`
+	Size        string    `json:"size"`
+}
+
+type ReceivingExtended struct {
+	Receiving   Receiving
+	StorageUser StorageUser
+	Reagent     Reagent
+	Storage     Storage
+	StorageCell StorageCell
+	ExpiresAt   time.Time
+	Lot         string
+	Quantity    int
+	Instances   []ReagentInstance
+}
+
+type InstanceLabelsRange struct {
+	ReagentInstancesExtended []ReagentInstanceExtended
+	ReagentID                uuid.UUID
+	ReceivingID              uuid.UUID
+}
+
+func (r ReceivingExtended) createQueue(
+	batch *pgx.Batch,
+) {
+	query := fmt.Sprintf(
+		"INSERT INTO receiving(id, storage_user, reagent, supplier, grade, size) SELECT $1, $2, $3, $4, $5, $6 WHERE EXISTS (SELECT 1 FROM reagent WHERE reagent.id=$3) AND EXISTS (%s) RETURNING created_at, updated_at",
+		activeCell(7, 8),
+	)
+	batch.Queue(
+		query,
+		r.Receiving.ID,
+		uuidToPgType(r.Receiving.StorageUser),
+		r.Receiving.Reagent,
+		r.Receiving.Supplier,
+		r.Receiving.Grade,
+		r.Receiving.Size,
+		r.Storage.ID,
+		r.StorageCell.Number,
+	)
+	query = fmt.Sprintf(
+		"WITH target AS (%s) INSERT INTO reagent_instance(reagent, expires_at, storage_cell, lot, receiving) SELECT $1, $2, target.id, $5, $6 FROM target CROSS JOIN generate_series(1, $7) WHERE EXISTS (SELECT 1 FROM receiving WHERE receiving.id=$6) RETURNING id, created_at, updated_at, code",
+		activeCell(3, 4),
+	)
+	batch.Queue(
+		query,
+		r.Receiving.Reagent,
+		r.ExpiresAt,
+		r.Storage.ID,
+		r.StorageCell.Number,
+		r.Lot,
+		r.Receiving.ID,
+		r.Quantity,
+	)
+}
+
+func (r *ReceivingExtended) createResult(results pgx.BatchResults) error {
+	err := results.QueryRow().Scan(&r.Receiving.CreatedAt, &r.Receiving.UpdatedAt)
+	if err != nil {
+		rows, _ := results.Query()
+		rows.Close()
+		return err
+	}
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		instance := ReagentInstance{
+			Reagent:   r.Receiving.Reagent,
+			ExpiresAt: r.ExpiresAt,
+			Lot:       r.Lot,
+			Receiving: r.Receiving.ID,
+		}
+		err = rows.Scan(&instance.ID, &instance.CreatedAt, &instance.UpdatedAt, &instance.Code)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		r.Instances = append(r.Instances, instance)
+	}
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+	if len(r.Instances) == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (r *ReceivingExtended) Create() (BatchOperation, BatchRead) {
+	return r.createQueue, r.createResult
+}
+
+func (r ReceivingExtended) getQueue(
+	batch *pgx.Batch,
+) {
+	cols := "receiving.created_at, receiving.updated_at, receiving.storage_user, receiving.reagent, receiving.supplier, receiving.grade, receiving.size, storage_user.name, reagent.name, reagent.formula"
+	join := "LEFT JOIN storage_user ON receiving.storage_user = storage_user.id JOIN reagent ON receiving.reagent = reagent.id"
+	query := fmt.Sprintf("SELECT %s FROM receiving %s WHERE receiving.id=$1", cols, join)
+	batch.Queue(query, r.Receiving.ID)
+}
+
+func (r *ReceivingExtended) getResult(results pgx.BatchResults) error {
+	var storageUser pgtype.UUID
+	var storageUserName pgtype.Text
+	err := results.QueryRow().Scan(
+		&r.Receiving.CreatedAt,
+		&r.Receiving.UpdatedAt,
+		&storageUser,
+		&r.Receiving.Reagent,
+		&r.Receiving.Supplier,
+		&r.Receiving.Grade,
+		&r.Receiving.Size,
+		&storageUserName,
+		&r.Reagent.Name,
+		&r.Reagent.Formula,
+	)
+	if err != nil {
+		return err
+	}
+	r.Receiving.StorageUser = storageUser.Bytes
+	r.StorageUser.ID = storageUser.Bytes
+	r.StorageUser.Name = storageUserName.String
+	r.Reagent.ID = r.Receiving.Reagent
+	return nil
+}
+
+func (r *ReceivingExtended) Get() (BatchOperation, BatchRead) {
+	return r.getQueue, r.getResult
+}
+
+func (r InstanceLabelsRange) getQueue(
+	batch *pgx.Batch,
+) {
+	cols := "reagent_instance.id, reagent_instance.created_at, reagent_instance.expires_at, reagent_instance.lot, reagent_instance.code, reagent.id, reagent.name, reagent.formula, reagent.hazards, storage_cell.id, storage_cell.number, storage_cell.label, storage.id, storage.name"
+	join := "JOIN reagent ON reagent_instance.reagent = reagent.id LEFT JOIN storage_cell ON reagent_instance.storage_cell = storage_cell.id LEFT JOIN storage ON storage_cell.storage = storage.id"
+	filters := []string{"reagent_instance.used_at IS NULL", "reagent_instance.deleted_at IS NULL"}
+	var args []any
+	if r.ReagentID != uuid.Nil {
+		args = append(args, r.ReagentID)
+		filters = append(filters, fmt.Sprintf("reagent_instance.reagent=$%d", len(args)))
+	}
+	if r.ReceivingID != uuid.Nil {
+		args = append(args, r.ReceivingID)
+		filters = append(filters, fmt.Sprintf("reagent_instance.receiving=$%d", len(args)))
+	}
+	query := fmt.Sprintf(
+		"SELECT %s FROM reagent_instance %s WHERE %s ORDER BY reagent_instance.created_at, reagent_instance.id",
+		cols,
+		join,
+		strings.Join(filters, " AND "),
+	)
+	batch.Queue(query, args...)
+}
+
+func (r *InstanceLabelsRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	next := rows.Next()
+	if !next {
+		return nil
+	}
+	for next {
+		var i ReagentInstanceExtended
+		var cellID, storageID pgtype.UUID
+		var cellNumber pgtype.Int2
+		var cellLabel, storageName pgtype.Text
+		err = rows.Scan(
+			&i.ReagentInstance.ID,
+			&i.ReagentInstance.CreatedAt,
+			&i.ReagentInstance.ExpiresAt,
+			&i.ReagentInstance.Lot,
+			&i.ReagentInstance.Code,
+			&i.Reagent.ID,
+			&i.Reagent.Name,
+			&i.Reagent.Formula,
+			&i.Reagent.Hazards,
+			&cellID,
+			&cellNumber,
+			&cellLabel,
+			&storageID,
+			&storageName,
+		)
+		if err != nil {
+			return err
+		}
+		i.ReagentInstance.Reagent = i.Reagent.ID
+		i.ReagentInstance.StorageCell = cellID.Bytes
+		i.StorageCell.ID = cellID.Bytes
+		i.StorageCell.Number = cellNumber.Int16
+		i.StorageCell.Label = cellLabel.String
+		i.StorageCell.Storage = storageID.Bytes
+		i.Storage.ID = storageID.Bytes
+		i.Storage.Name = storageName.String
+		r.ReagentInstancesExtended = append(r.ReagentInstancesExtended, i)
+		next = rows.Next()
+	}
+	return nil
+}
+
+func (r *InstanceLabelsRange) Get() (BatchOperation, BatchRead) {
+	return r.getQueue, r.getResult
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type Recertification struct {
+	ID              uuid.UUID `json:"id"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	ReagentInstance uuid.UUID `json:"reagent_instance"`
+	Reagent         uuid.UUID `json:"reagent"`
+	OldExpiresAt    time.Time `json:"old_expires_at"`
+	NewExpiresAt    time.Time `json:"new_expires_at" validate:"gt"           uaLocal:"новий термін придатності"`
+	StorageUser     uuid.UUID `json:"storage_user"`
+	Justification   string    `json:"justification"  validate:"gte=5,lte=500" uaLocal:"обґрунтування"`
+	Attachment      []byte    `json:"-"`
+	AttachmentName  string    `json:"attachment_name"`
+	AttachmentType  string    `json:"attachment_type"`
+}
+
+type RecertificationExtended struct {
+	Recertification Recertification
+	StorageUser     StorageUser
+}
+
+type RecertificationRange struct {
+	RecertificationsExtended []RecertificationExtended
+	ReagentInstanceID        uuid.UUID
+}
+
+func (r Recertification) createQueue(
+	batch *pgx.Batch,
+) {
+	var attachment []byte
+	if len(r.Attachment) > 0 {
+		attachment = r.Attachment
+	}
+	old := "SELECT id, expires_at FROM reagent_instance WHERE id=$1 AND reagent=$2 AND used_at IS NULL AND deleted_at IS NULL FOR UPDATE"
+	upd := "UPDATE reagent_instance SET expires_at=$3 FROM old WHERE reagent_instance.id = old.id RETURNING reagent_instance.id"
+	cols := "reagent_instance, old_expires_at, new_expires_at, storage_user, justification, attachment, attachment_name, attachment_type"
+	query := fmt.Sprintf(
+		"WITH old AS (%s), upd AS (%s) INSERT INTO reagent_instance_recertification(%s) SELECT upd.id, old.expires_at, $3, $4, $5, $6, $7, $8 FROM upd JOIN old ON upd.id = old.id RETURNING id, created_at, updated_at, old_expires_at",
+		old,
+		upd,
+		cols,
+	)
+	batch.Queue(
+		query,
+		r.ReagentInstance,
+		r.Reagent,
+		r.NewExpiresAt,
+		r.StorageUser,
+		r.Justification,
+		attachment,
+		r.AttachmentName,
+		r.AttachmentType,
+	)
+}
+
+func (r *Recertification) createResult(results pgx.BatchResults) error {
+	return results.QueryRow().Scan(&r.ID, &r.CreatedAt, &r.UpdatedAt, &r.OldExpiresAt)
+}
+
+func (r *Recertification) Create() (BatchOperation, BatchRead) {
+	return r.createQueue, r.createResult
+}
+
+func (r RecertificationRange) getQueue(
+	batch *pgx.Batch,
+) {
+	query := "SELECT reagent_instance_recertification.id, reagent_instance_recertification.created_at, reagent_instance_recertification.updated_at, reagent_instance_recertification.old_expires_at, reagent_instance_recertification.new_expires_at, reagent_instance_recertification.justification, reagent_instance_recertification.attachment_name, reagent_instance_recertification.attachment_type, storage_user.id, storage_user.name FROM reagent_instance_recertification LEFT JOIN storage_user ON reagent_instance_recertification.storage_user = storage_user.id WHERE reagent_instance_recertification.reagent_instance=$1 ORDER BY reagent_instance_recertification.created_at DESC"
+	batch.Queue(query, r.ReagentInstanceID)
+}
+
+func (r *RecertificationRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	next := rows.Next()
+	if !next {
+		return nil
+	}
+	for next {
+		var i RecertificationExtended
+		var userID pgtype.UUID
+		var userName pgtype.Text
+		err = rows.Scan(
+			&i.Recertification.ID,
+			&i.Recertification.CreatedAt,
+			&i.Recertification.UpdatedAt,
+			&i.Recertification.OldExpiresAt,
+			&i.Recertification.NewExpiresAt,
+			&i.Recertification.Justification,
+			&i.Recertification.AttachmentName,
+			&i.Recertification.AttachmentType,
+			&userID,
+			&userName,
+		)
+		if err != nil {
+			return err
+		}
+		i.Recertification.ReagentInstance = r.ReagentInstanceID
+		i.StorageUser.ID = userID.Bytes
+		i.StorageUser.Name = userName.String
+		r.RecertificationsExtended = append(r.RecertificationsExtended, i)
+		next = rows.Next()
+	}
+	return nil
+}
+
+func (r *RecertificationRange) Get() (BatchOperation, BatchRead) {
+	return r.getQueue, r.getResult
+}
+
+func (r Recertification) getAttachmentQueue(
+	batch *pgx.Batch,
+) {
+	query := "SELECT reagent_instance_recertification.attachment, reagent_instance_recertification.attachment_name, reagent_instance_recertification.attachment_type FROM reagent_instance_recertification JOIN reagent_instance ON reagent_instance_recertification.reagent_instance = reagent_instance.id WHERE reagent_instance_recertification.id=$1 AND reagent_instance.id=$2 AND reagent_instance.reagent=$3 AND reagent_instance_recertification.attachment IS NOT NULL"
+	batch.Queue(query, r.ID, r.ReagentInstance, r.Reagent)
+}
+
+func (r *Recertification) getAttachmentResult(results pgx.BatchResults) error {
+	return results.QueryRow().Scan(&r.Attachment, &r.AttachmentName, &r.AttachmentType)
+}
+
+func (r *Recertification) GetAttachment() (BatchOperation, BatchRead) {
+	return r.getAttachmentQueue, r.getAttachmentResult
+}
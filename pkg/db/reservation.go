@@ -0,0 +1,179 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const reservedNow = "EXISTS (SELECT 1 FROM reservation WHERE reservation.reagent_instance = reagent_instance.id AND current_date BETWEEN reservation.reserved_from AND reservation.reserved_until)"
+
+const usableInstance = "reagent_instance.used_at IS NULL AND reagent_instance.deleted_at IS NULL AND (reagent_instance.expires_at IS NULL OR reagent_instance.expires_at >= current_date) AND NOT " + checkedOut
+
+const availableInstance = usableInstance + " AND NOT " + reservedNow
+
+const availableInstances = "(SELECT COUNT(*) FROM reagent_instance WHERE reagent_instance.reagent = reagent.id AND " + availableInstance + ")"
+
+const reservedByOthers = "EXISTS (SELECT 1 FROM reservation WHERE reservation.reagent_instance = reagent_instance.id AND reservation.storage_user <> reagent_request.storage_user AND reservation.reserved_from <= GREATEST(reagent_request.needed_by, current_date) AND reservation.reserved_until >= current_date)"
+
+func reservedForOthers(userArg int) string {
+	return fmt.Sprintf(
+		"EXISTS (SELECT 1 FROM reservation WHERE reservation.reagent_instance = reagent_instance.id AND reservation.storage_user <> $%d AND current_date BETWEEN reservation.reserved_from AND reservation.reserved_until)",
+		userArg,
+	)
+}
+
+type Reservation struct {
+	ID              uuid.UUID `json:"id"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	ReagentInstance uuid.UUID `json:"reagent_instance"`
+	StorageUser     uuid.UUID `json:"storage_user"`
+	Purpose         string    `json:"purpose"          validate:"gte=3,lte=200" uaLocal:"мета"`
+	ReservedFrom    time.Time `json:"reserved_from"`
+	ReservedUntil   time.Time `json:"reserved_until"`
+	ReagentRequest  uuid.UUID `json:"reagent_request"`
+}
+
+type ReservationExtended struct {
+	Reservation Reservation
+	StorageUser StorageUser
+	Active      bool
+}
+
+type ReservationsRange struct {
+	Reservations []ReservationExtended
+	ReagentID    uuid.UUID
+	InstanceID   uuid.UUID
+	InstanceCode string
+}
+
+func (r Reservation) createQueue(
+	batch *pgx.Batch,
+) {
+	instance := "SELECT 1 FROM reagent_instance WHERE id=$1 AND used_at IS NULL AND deleted_at IS NULL"
+	overlap := "SELECT 1 FROM reservation WHERE reagent_instance=$1 AND reserved_from <= $5 AND reserved_until >= $4"
+	query := fmt.Sprintf(
+		"INSERT INTO reservation(reagent_instance, storage_user, purpose, reserved_from, reserved_until) SELECT $1::uuid, $2::uuid, $3::text, $4::date, $5::date WHERE EXISTS (%s) AND NOT EXISTS (%s) RETURNING id, created_at, updated_at",
+		instance,
+		overlap,
+	)
+	batch.Queue(
+		query,
+		r.ReagentInstance,
+		r.StorageUser,
+		r.Purpose,
+		r.ReservedFrom,
+		r.ReservedUntil,
+	)
+}
+
+func (r *Reservation) createResult(results pgx.BatchResults) error {
+	return results.QueryRow().Scan(&r.ID, &r.CreatedAt, &r.UpdatedAt)
+}
+
+func (r *Reservation) Create() (BatchOperation, BatchRead) {
+	return r.createQueue, r.createResult
+}
+
+func (r Reservation) deleteQueue(
+	batch *pgx.Batch,
+) {
+	query := "DELETE FROM reservation WHERE id=$1 AND reagent_instance=$2 AND ($3::uuid IS NULL OR storage_user=$3)"
+	batch.Queue(query, r.ID, r.ReagentInstance, uuidToPgType(r.StorageUser))
+}
+
+func (r *Reservation) deleteResult(results pgx.BatchResults) error {
+	ct, err := results.Exec()
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (r *Reservation) Delete() (BatchOperation, BatchRead) {
+	return r.deleteQueue, r.deleteResult
+}
+
+func (r ReservationsRange) getQueue(
+	batch *pgx.Batch,
+) {
+	cols := "reservation.id, reservation.created_at, reservation.updated_at, reservation.reagent_instance, reservation.storage_user, reservation.purpose, reservation.reserved_from, reservation.reserved_until, reservation.reagent_request, current_date >= reservation.reserved_from, storage_user.name"
+	join := "JOIN reagent_instance ON reservation.reagent_instance = reagent_instance.id JOIN storage_user ON reservation.storage_user = storage_user.id"
+	filter := "reservation.reserved_until >= current_date AND reagent_instance.used_at IS NULL AND reagent_instance.deleted_at IS NULL"
+	var args []any
+	if r.ReagentID != uuid.Nil {
+		args = append(args, r.ReagentID)
+		filter = filter + fmt.Sprintf(" AND reagent_instance.reagent=$%d", len(args))
+	}
+	if r.InstanceID != uuid.Nil {
+		args = append(args, r.InstanceID)
+		filter = filter + fmt.Sprintf(" AND reagent_instance.id=$%d", len(args))
+	}
+	if r.InstanceCode != "" {
+		args = append(args, r.InstanceCode)
+		filter = filter + fmt.Sprintf(" AND reagent_instance.code=upper($%d)", len(args))
+	}
+	query := fmt.Sprintf(
+		"SELECT %s FROM reservation %s WHERE %s ORDER BY reservation.reserved_from, reservation.created_at",
+		cols,
+		join,
+		filter,
+	)
+	batch.Queue(query, args...)
+}
+
+func (r *ReservationsRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var reservation ReservationExtended
+		var request pgtype.UUID
+		err = rows.Scan(
+			&reservation.Reservation.ID,
+			&reservation.Reservation.CreatedAt,
+			&reservation.Reservation.UpdatedAt,
+			&reservation.Reservation.ReagentInstance,
+			&reservation.Reservation.StorageUser,
+			&reservation.Reservation.Purpose,
+			&reservation.Reservation.ReservedFrom,
+			&reservation.Reservation.ReservedUntil,
+			&request,
+			&reservation.Active,
+			&reservation.StorageUser.Name,
+		)
+		if err != nil {
+			return err
+		}
+		reservation.Reservation.ReagentRequest = request.Bytes
+		reservation.StorageUser.ID = reservation.Reservation.StorageUser
+		r.Reservations = append(r.Reservations, reservation)
+	}
+	return rows.Err()
+}
+
+func (r *ReservationsRange) Get() (BatchOperation, BatchRead) {
+	return r.getQueue, r.getResult
+}
+
+func (r ReservationExtended) FromRequest() bool {
+	return r.Reservation.ReagentRequest != uuid.Nil
+}
+
+func (r ReservationsRange) ByInstance(instanceID uuid.UUID) (reservations []ReservationExtended) {
+	for _, reservation := range r.Reservations {
+		if reservation.Reservation.ReagentInstance == instanceID {
+			reservations = append(reservations, reservation)
+		}
+	}
+	return reservations
+}
@@ -0,0 +1,484 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	StocktakeTransfer = "transfer"
+	StocktakeLost     = "lost"
+)
+
+type Stocktake struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Storage     uuid.UUID `json:"storage"      uaLocal:"склад"`
+	StorageUser uuid.UUID `json:"storage_user"`
+	FinishedAt  time.Time `json:"finished_at"`
+}
+
+type StocktakeScan struct {
+	ID              uuid.UUID `json:"id"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	Stocktake       uuid.UUID `json:"stocktake"`
+	Code            string    `json:"code"             validate:"required,lte=50" uaLocal:"код"`
+	StorageCell     uuid.UUID `json:"storage_cell"`
+	ReagentInstance uuid.UUID `json:"reagent_instance"`
+}
+
+type StocktakeScanExtended struct {
+	StocktakeScan StocktakeScan
+	StorageCell   StorageCell
+	InstanceID    uuid.UUID
+	Instance      ReagentInstanceExtended
+}
+
+type StocktakeAction struct {
+	ID              uuid.UUID `json:"id"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	Stocktake       uuid.UUID `json:"stocktake"`
+	ReagentInstance uuid.UUID `json:"reagent_instance"`
+	StorageUser     uuid.UUID `json:"storage_user"`
+	Action          string    `json:"action"            validate:"oneof=transfer lost"`
+	FromStorageCell uuid.UUID `json:"from_storage_cell"`
+	ToStorageCell   uuid.UUID `json:"to_storage_cell"`
+}
+
+type StocktakeActionExtended struct {
+	StocktakeAction StocktakeAction
+	StorageUser     StorageUser
+	Reagent         Reagent
+	Code            string
+	FromStorageCell StorageCell
+	ToStorage       Storage
+	ToStorageCell   StorageCell
+}
+
+type StocktakeExtended struct {
+	Stocktake   Stocktake
+	Storage     Storage
+	StorageUser StorageUser
+	Scanned     int
+	Scans       []StocktakeScanExtended
+	Missing     []ReagentInstanceExtended
+	Actions     []StocktakeActionExtended
+}
+
+type StocktakesRange struct {
+	Stocktakes []StocktakeExtended
+	StorageID  uuid.UUID
+	Limit      int
+}
+
+func (s StocktakeExtended) createQueue(
+	batch *pgx.Batch,
+) {
+	query := "INSERT INTO stocktake(id, storage, storage_user) SELECT $1, id, $3 FROM storage WHERE id=$2 AND archived_at IS NULL RETURNING created_at, updated_at"
+	batch.Queue(query, s.Stocktake.ID, s.Stocktake.Storage, uuidToPgType(s.Stocktake.StorageUser))
+}
+
+func (s *StocktakeExtended) createResult(results pgx.BatchResults) error {
+	return results.QueryRow().Scan(&s.Stocktake.CreatedAt, &s.Stocktake.UpdatedAt)
+}
+
+func (s *StocktakeExtended) Create() (BatchOperation, BatchRead) {
+	return s.createQueue, s.createResult
+}
+
+func (s StocktakeExtended) getQueue(
+	batch *pgx.Batch,
+) {
+	cols := "stocktake.created_at, stocktake.updated_at, stocktake.storage, stocktake.storage_user, stocktake.finished_at, storage.name, storage.cells, storage_user.name"
+	join := "JOIN storage ON stocktake.storage = storage.id LEFT JOIN storage_user ON stocktake.storage_user = storage_user.id"
+	query := fmt.Sprintf("SELECT %s FROM stocktake %s WHERE stocktake.id=$1", cols, join)
+	batch.Queue(query, s.Stocktake.ID)
+	cols = "stocktake_scan.id, stocktake_scan.created_at, stocktake_scan.updated_at, stocktake_scan.code, found.id, found.number, found.label, reagent_instance.id, reagent_instance.used_at, reagent_instance.deleted_at, reagent_instance.expires_at, reagent.id, reagent.name, reagent.formula, storage_cell.id, storage_cell.number, storage_cell.label, storage.id, storage.name"
+	join = "LEFT JOIN storage_cell AS found ON stocktake_scan.storage_cell = found.id LEFT JOIN reagent_instance ON stocktake_scan.reagent_instance = reagent_instance.id LEFT JOIN reagent ON reagent_instance.reagent = reagent.id LEFT JOIN storage_cell ON reagent_instance.storage_cell = storage_cell.id LEFT JOIN storage ON storage_cell.storage = storage.id"
+	query = fmt.Sprintf(
+		"SELECT %s FROM stocktake_scan %s WHERE stocktake_scan.stocktake=$1 ORDER BY stocktake_scan.updated_at DESC",
+		cols,
+		join,
+	)
+	batch.Queue(query, s.Stocktake.ID)
+	cols = "reagent_instance.id, reagent_instance.expires_at, reagent_instance.code, reagent.id, reagent.name, reagent.formula, storage_cell.id, storage_cell.number, storage_cell.label, storage.id, storage.name"
+	join = "JOIN reagent ON reagent_instance.reagent = reagent.id JOIN storage_cell ON reagent_instance.storage_cell = storage_cell.id JOIN storage ON storage_cell.storage = storage.id JOIN stocktake ON storage.id = stocktake.storage"
+	filter := "stocktake.id=$1 AND reagent_instance.used_at IS NULL AND reagent_instance.deleted_at IS NULL AND NOT " + checkedOut + " AND NOT EXISTS (SELECT 1 FROM stocktake_scan WHERE stocktake_scan.stocktake = stocktake.id AND stocktake_scan.reagent_instance = reagent_instance.id)"
+	query = fmt.Sprintf(
+		"SELECT %s FROM reagent_instance %s WHERE %s ORDER BY storage_cell.number, reagent.name",
+		cols,
+		join,
+		filter,
+	)
+	batch.Queue(query, s.Stocktake.ID)
+	cols = "stocktake_action.id, stocktake_action.created_at, stocktake_action.reagent_instance, stocktake_action.storage_user, stocktake_action.action, reagent_instance.code, reagent.id, reagent.name, storage_user.name, from_cell.id, from_cell.number, to_cell.id, to_cell.number, to_storage.id, to_storage.name"
+	join = "JOIN reagent_instance ON stocktake_action.reagent_instance = reagent_instance.id JOIN reagent ON reagent_instance.reagent = reagent.id LEFT JOIN storage_user ON stocktake_action.storage_user = storage_user.id LEFT JOIN storage_cell AS from_cell ON stocktake_action.from_storage_cell = from_cell.id LEFT JOIN storage_cell AS to_cell ON stocktake_action.to_storage_cell = to_cell.id LEFT JOIN storage AS to_storage ON to_cell.storage = to_storage.id"
+	query = fmt.Sprintf(
+		"SELECT %s FROM stocktake_action %s WHERE stocktake_action.stocktake=$1 ORDER BY stocktake_action.created_at",
+		cols,
+		join,
+	)
+	batch.Queue(query, s.Stocktake.ID)
+}
+
+func (s *StocktakeExtended) getResult(results pgx.BatchResults) error {
+	var storageUser pgtype.UUID
+	var storageUserName pgtype.Text
+	var finishedAt pgtype.Timestamptz
+	err := results.QueryRow().Scan(
+		&s.Stocktake.CreatedAt,
+		&s.Stocktake.UpdatedAt,
+		&s.Stocktake.Storage,
+		&storageUser,
+		&finishedAt,
+		&s.Storage.Name,
+		&s.Storage.Cells,
+		&storageUserName,
+	)
+	if err != nil {
+		for i := 0; i < 3; i++ {
+			rows, _ := results.Query()
+			rows.Close()
+		}
+		return err
+	}
+	s.Stocktake.StorageUser = storageUser.Bytes
+	s.Stocktake.FinishedAt = pgTypeToTime(finishedAt)
+	s.Storage.ID = s.Stocktake.Storage
+	s.StorageUser.ID = storageUser.Bytes
+	s.StorageUser.Name = storageUserName.String
+	for _, read := range []func(pgx.Rows) error{s.scanScans, s.scanMissing, s.scanActions} {
+		rows, err := results.Query()
+		if err == nil {
+			err = read(rows)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	s.Scanned = len(s.Scans)
+	return nil
+}
+
+func (s *StocktakeExtended) scanScans(rows pgx.Rows) error {
+	defer rows.Close()
+	for rows.Next() {
+		var i StocktakeScanExtended
+		var foundID, instanceID, reagentID, cellID, storageID pgtype.UUID
+		var foundNumber, cellNumber pgtype.Int2
+		var foundLabel, reagentName, reagentFormula, cellLabel, storageName pgtype.Text
+		var usedAt, deletedAt, expiresAt pgtype.Timestamptz
+		err := rows.Scan(
+			&i.StocktakeScan.ID,
+			&i.StocktakeScan.CreatedAt,
+			&i.StocktakeScan.UpdatedAt,
+			&i.StocktakeScan.Code,
+			&foundID,
+			&foundNumber,
+			&foundLabel,
+			&instanceID,
+			&usedAt,
+			&deletedAt,
+			&expiresAt,
+			&reagentID,
+			&reagentName,
+			&reagentFormula,
+			&cellID,
+			&cellNumber,
+			&cellLabel,
+			&storageID,
+			&storageName,
+		)
+		if err != nil {
+			return err
+		}
+		i.StocktakeScan.Stocktake = s.Stocktake.ID
+		i.StocktakeScan.StorageCell = foundID.Bytes
+		i.StocktakeScan.ReagentInstance = instanceID.Bytes
+		i.StorageCell.ID = foundID.Bytes
+		i.StorageCell.Storage = s.Stocktake.Storage
+		i.StorageCell.Number = foundNumber.Int16
+		i.StorageCell.Label = foundLabel.String
+		i.Instance.ReagentInstance.ID = instanceID.Bytes
+		i.Instance.ReagentInstance.Code = i.StocktakeScan.Code
+		i.Instance.ReagentInstance.Reagent = reagentID.Bytes
+		i.Instance.ReagentInstance.UsedAt = pgTypeToTime(usedAt)
+		i.Instance.ReagentInstance.DeletedAt = pgTypeToTime(deletedAt)
+		i.Instance.ReagentInstance.ExpiresAt = pgTypeToTime(expiresAt)
+		i.Instance.ReagentInstance.StorageCell = cellID.Bytes
+		i.Instance.Reagent.ID = reagentID.Bytes
+		i.Instance.Reagent.Name = reagentName.String
+		i.Instance.Reagent.Formula = reagentFormula.String
+		i.Instance.StorageCell.ID = cellID.Bytes
+		i.Instance.StorageCell.Storage = storageID.Bytes
+		i.Instance.StorageCell.Number = cellNumber.Int16
+		i.Instance.StorageCell.Label = cellLabel.String
+		i.Instance.Storage.ID = storageID.Bytes
+		i.Instance.Storage.Name = storageName.String
+		s.Scans = append(s.Scans, i)
+	}
+	return rows.Err()
+}
+
+func (s *StocktakeExtended) scanMissing(rows pgx.Rows) error {
+	defer rows.Close()
+	for rows.Next() {
+		var i ReagentInstanceExtended
+		err := rows.Scan(
+			&i.ReagentInstance.ID,
+			&i.ReagentInstance.ExpiresAt,
+			&i.ReagentInstance.Code,
+			&i.Reagent.ID,
+			&i.Reagent.Name,
+			&i.Reagent.Formula,
+			&i.StorageCell.ID,
+			&i.StorageCell.Number,
+			&i.StorageCell.Label,
+			&i.Storage.ID,
+			&i.Storage.Name,
+		)
+		if err != nil {
+			return err
+		}
+		i.ReagentInstance.Reagent = i.Reagent.ID
+		i.ReagentInstance.StorageCell = i.StorageCell.ID
+		i.StorageCell.Storage = i.Storage.ID
+		s.Missing = append(s.Missing, i)
+	}
+	return rows.Err()
+}
+
+func (s *StocktakeExtended) scanActions(rows pgx.Rows) error {
+	defer rows.Close()
+	for rows.Next() {
+		var a StocktakeActionExtended
+		var storageUser, fromCell, toCell, toStorage pgtype.UUID
+		var fromNumber, toNumber pgtype.Int2
+		var storageUserName, toStorageName pgtype.Text
+		err := rows.Scan(
+			&a.StocktakeAction.ID,
+			&a.StocktakeAction.CreatedAt,
+			&a.StocktakeAction.ReagentInstance,
+			&storageUser,
+			&a.StocktakeAction.Action,
+			&a.Code,
+			&a.Reagent.ID,
+			&a.Reagent.Name,
+			&storageUserName,
+			&fromCell,
+			&fromNumber,
+			&toCell,
+			&toNumber,
+			&toStorage,
+			&toStorageName,
+		)
+		if err != nil {
+			return err
+		}
+		a.StocktakeAction.Stocktake = s.Stocktake.ID
+		a.StocktakeAction.StorageUser = storageUser.Bytes
+		a.StocktakeAction.FromStorageCell = fromCell.Bytes
+		a.StocktakeAction.ToStorageCell = toCell.Bytes
+		a.StorageUser.ID = storageUser.Bytes
+		a.StorageUser.Name = storageUserName.String
+		a.FromStorageCell.ID = fromCell.Bytes
+		a.FromStorageCell.Number = fromNumber.Int16
+		a.ToStorageCell.ID = toCell.Bytes
+		a.ToStorageCell.Number = toNumber.Int16
+		a.ToStorage.ID = toStorage.Bytes
+		a.ToStorage.Name = toStorageName.String
+		s.Actions = append(s.Actions, a)
+	}
+	return rows.Err()
+}
+
+func (s *StocktakeExtended) Get() (BatchOperation, BatchRead) {
+	return s.getQueue, s.getResult
+}
+
+func (s StocktakeExtended) finishQueue(
+	batch *pgx.Batch,
+) {
+	query := "UPDATE stocktake SET finished_at=now() WHERE id=$1 AND finished_at IS NULL RETURNING finished_at"
+	batch.Queue(query, s.Stocktake.ID)
+}
+
+func (s *StocktakeExtended) finishResult(results pgx.BatchResults) error {
+	return results.QueryRow().Scan(&s.Stocktake.FinishedAt)
+}
+
+func (s *StocktakeExtended) Finish() (BatchOperation, BatchRead) {
+	return s.finishQueue, s.finishResult
+}
+
+func (s StocktakeScanExtended) createQueue(
+	batch *pgx.Batch,
+) {
+	target := "SELECT id, code FROM reagent_instance WHERE code=upper($2) OR id=$4 LIMIT 1"
+	insert := "INSERT INTO stocktake_scan(stocktake, code, storage_cell, reagent_instance) SELECT stocktake.id, COALESCE((SELECT code FROM target), $2), storage_cell.id, (SELECT id FROM target) FROM stocktake JOIN storage_cell ON storage_cell.storage = stocktake.storage AND storage_cell.number=$3 WHERE stocktake.id=$1 AND stocktake.finished_at IS NULL"
+	conflict := "ON CONFLICT ON CONSTRAINT stocktake_scan_code_key DO UPDATE SET storage_cell=EXCLUDED.storage_cell"
+	query := fmt.Sprintf(
+		"WITH target AS (%s) %s %s RETURNING id, created_at, updated_at, code, storage_cell, reagent_instance",
+		target,
+		insert,
+		conflict,
+	)
+	batch.Queue(
+		query,
+		s.StocktakeScan.Stocktake,
+		s.StocktakeScan.Code,
+		s.StorageCell.Number,
+		uuidToPgType(s.InstanceID),
+	)
+}
+
+func (s *StocktakeScanExtended) createResult(results pgx.BatchResults) error {
+	var instance pgtype.UUID
+	err := results.QueryRow().Scan(
+		&s.StocktakeScan.ID,
+		&s.StocktakeScan.CreatedAt,
+		&s.StocktakeScan.UpdatedAt,
+		&s.StocktakeScan.Code,
+		&s.StocktakeScan.StorageCell,
+		&instance,
+	)
+	if err != nil {
+		return err
+	}
+	s.StocktakeScan.ReagentInstance = instance.Bytes
+	s.StorageCell.ID = s.StocktakeScan.StorageCell
+	return nil
+}
+
+func (s *StocktakeScanExtended) Create() (BatchOperation, BatchRead) {
+	return s.createQueue, s.createResult
+}
+
+func (a StocktakeActionExtended) createQueue(
+	batch *pgx.Batch,
+) {
+	var old, update, target string
+	switch a.StocktakeAction.Action {
+	case StocktakeTransfer:
+		old = "SELECT reagent_instance.id, reagent_instance.storage_cell, stocktake_scan.storage_cell AS target_cell FROM reagent_instance JOIN stocktake_scan ON stocktake_scan.reagent_instance = reagent_instance.id JOIN stocktake ON stocktake_scan.stocktake = stocktake.id WHERE stocktake.id=$1 AND stocktake.finished_at IS NOT NULL AND reagent_instance.id=$2 AND reagent_instance.used_at IS NULL AND reagent_instance.deleted_at IS NULL AND stocktake_scan.storage_cell IS NOT NULL AND reagent_instance.storage_cell IS DISTINCT FROM stocktake_scan.storage_cell FOR UPDATE OF reagent_instance"
+		update = "storage_cell=old.target_cell"
+		target = "old.target_cell"
+	default:
+		old = "SELECT reagent_instance.id, reagent_instance.storage_cell FROM reagent_instance JOIN storage_cell ON reagent_instance.storage_cell = storage_cell.id JOIN stocktake ON storage_cell.storage = stocktake.storage WHERE stocktake.id=$1 AND stocktake.finished_at IS NOT NULL AND reagent_instance.id=$2 AND reagent_instance.used_at IS NULL AND reagent_instance.deleted_at IS NULL AND NOT EXISTS (SELECT 1 FROM stocktake_scan WHERE stocktake_scan.stocktake = stocktake.id AND stocktake_scan.reagent_instance = reagent_instance.id) FOR UPDATE OF reagent_instance"
+		update = "deleted_at=now()"
+		target = "NULL::uuid"
+	}
+	upd := fmt.Sprintf(
+		"UPDATE reagent_instance SET %s FROM old WHERE reagent_instance.id = old.id RETURNING reagent_instance.id",
+		update,
+	)
+	action := fmt.Sprintf(
+		"INSERT INTO stocktake_action(stocktake, reagent_instance, storage_user, action, from_storage_cell, to_storage_cell) SELECT $1, old.id, $3, $4, old.storage_cell, %s FROM upd JOIN old ON upd.id = old.id RETURNING id, created_at, updated_at, reagent_instance, from_storage_cell, to_storage_cell",
+		target,
+	)
+	query := fmt.Sprintf(
+		"WITH old AS (%s), upd AS (%s), action AS (%s) SELECT action.id, action.created_at, action.updated_at, action.from_storage_cell, action.to_storage_cell, reagent_instance.reagent, to_cell.storage, to_cell.number FROM action JOIN reagent_instance ON action.reagent_instance = reagent_instance.id LEFT JOIN storage_cell AS to_cell ON action.to_storage_cell = to_cell.id",
+		old,
+		upd,
+		action,
+	)
+	batch.Queue(
+		query,
+		a.StocktakeAction.Stocktake,
+		a.StocktakeAction.ReagentInstance,
+		uuidToPgType(a.StocktakeAction.StorageUser),
+		a.StocktakeAction.Action,
+	)
+}
+
+func (a *StocktakeActionExtended) createResult(results pgx.BatchResults) error {
+	var fromCell, toCell, toStorage pgtype.UUID
+	var toNumber pgtype.Int2
+	err := results.QueryRow().Scan(
+		&a.StocktakeAction.ID,
+		&a.StocktakeAction.CreatedAt,
+		&a.StocktakeAction.UpdatedAt,
+		&fromCell,
+		&toCell,
+		&a.Reagent.ID,
+		&toStorage,
+		&toNumber,
+	)
+	if err != nil {
+		return err
+	}
+	a.StocktakeAction.FromStorageCell = fromCell.Bytes
+	a.StocktakeAction.ToStorageCell = toCell.Bytes
+	a.FromStorageCell.ID = fromCell.Bytes
+	a.ToStorageCell.ID = toCell.Bytes
+	a.ToStorageCell.Storage = toStorage.Bytes
+	a.ToStorageCell.Number = toNumber.Int16
+	a.ToStorage.ID = toStorage.Bytes
+	return nil
+}
+
+func (a *StocktakeActionExtended) Create() (BatchOperation, BatchRead) {
+	return a.createQueue, a.createResult
+}
+
+func (r StocktakesRange) getQueue(
+	batch *pgx.Batch,
+) {
+	cols := "stocktake.id, stocktake.created_at, stocktake.updated_at, stocktake.storage_user, stocktake.finished_at, storage_user.name, (SELECT COUNT(*) FROM stocktake_scan WHERE stocktake_scan.stocktake = stocktake.id)"
+	join := "LEFT JOIN storage_user ON stocktake.storage_user = storage_user.id"
+	query := fmt.Sprintf(
+		"SELECT %s FROM stocktake %s WHERE stocktake.storage=$1 ORDER BY stocktake.created_at DESC LIMIT $2",
+		cols,
+		join,
+	)
+	batch.Queue(query, r.StorageID, r.Limit)
+}
+
+func (r *StocktakesRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	next := rows.Next()
+	if !next {
+		return nil
+	}
+	for next {
+		var s StocktakeExtended
+		var storageUser pgtype.UUID
+		var storageUserName pgtype.Text
+		var finishedAt pgtype.Timestamptz
+		err = rows.Scan(
+			&s.Stocktake.ID,
+			&s.Stocktake.CreatedAt,
+			&s.Stocktake.UpdatedAt,
+			&storageUser,
+			&finishedAt,
+			&storageUserName,
+			&s.Scanned,
+		)
+		if err != nil {
+			return err
+		}
+		s.Stocktake.Storage = r.StorageID
+		s.Stocktake.StorageUser = storageUser.Bytes
+		s.Stocktake.FinishedAt = pgTypeToTime(finishedAt)
+		s.Storage.ID = r.StorageID
+		s.StorageUser.ID = storageUser.Bytes
+		s.StorageUser.Name = storageUserName.String
+		r.Stocktakes = append(r.Stocktakes, s)
+		next = rows.Next()
+	}
+	return nil
+}
+
+func (r *StocktakesRange) Get() (BatchOperation, BatchRead) {
+	return r.getQueue, r.getResult
+}
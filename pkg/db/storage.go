@@ -1,34 +1,88 @@
 package db
 
 import (
+	"fmt"
 	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type StorageInput struct {
-	ID        string `json:"id"`
-	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at"`
-	Name      string `json:"name"`
-	Cells     string `json:"cells"`
+	ID          string `json:"id"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+	Name        string `json:"name"`
+	Cells       string `json:"cells"`
+	Rows        string `json:"rows"`
+	Columns     string `json:"columns"`
+	Kind        string `json:"kind"`
+	Parent      string `json:"parent"`
+	Description string `json:"description"`
 }
 
 type Storage struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Name      string    `json:"name"       validate:"gte=3,lte=100"  uaLocal:"назва"`
-	Cells     int16     `json:"cells"      validate:"gte=1,lte=1000" uaLocal:"відділи"`
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Name        string    `json:"name"        validate:"gte=3,lte=100"                     uaLocal:"назва"`
+	Cells       int16     `json:"cells"       validate:"gte=1,lte=1000"                    uaLocal:"відділи"`
+	Rows        int16     `json:"rows"        validate:"gte=0,lte=100"                     uaLocal:"ряди"`
+	Columns     int16     `json:"columns"     validate:"gte=0,lte=100"                     uaLocal:"місця в ряду"`
+	Kind        string    `json:"kind"        validate:"oneof=building room storage shelf" uaLocal:"тип"`
+	Parent      uuid.UUID `json:"parent"                                                   uaLocal:"батьківський елемент"`
+	Description string    `json:"description" validate:"lte=1000"                          uaLocal:"опис"`
+	Responsible uuid.UUID `json:"responsible"`
+	ArchivedAt  time.Time `json:"archived_at"`
+}
+
+const (
+	KindBuilding = "building"
+	KindRoom     = "room"
+	KindStorage  = "storage"
+	KindShelf    = "shelf"
+)
+
+var StorageKinds = []string{KindBuilding, KindRoom, KindStorage, KindShelf}
+
+func (s Storage) HasCells() bool {
+	return s.Kind == KindStorage || s.Kind == KindShelf
+}
+
+func (s Storage) HasLayout() bool {
+	return s.Rows > 0 && s.Columns > 0
+}
+
+func (s Storage) CellNumber(row, column int16) int16 {
+	return (row-1)*s.Columns + column
+}
+
+func (s Storage) CellPosition(number int16) (row, column int16) {
+	if !s.HasLayout() {
+		return 0, 0
+	}
+	return (number-1)/s.Columns + 1, (number-1)%s.Columns + 1
 }
 
 type StoragesRange struct {
+	Storages  []Storage
+	Limit     int
+	Offset    int
+	Src       string
+	Placeable bool
+}
+
+type StoragePath struct {
+	Storages   []Storage
+	StorageID  uuid.UUID
+	InstanceID uuid.UUID
+}
+
+type StorageChildrenRange struct {
 	Storages []Storage
-	Limit    int
-	Offset   int
-	Src      string
+	ParentID uuid.UUID
 }
 
 func (input StorageInput) Bind() (output Storage, err error) {
@@ -61,14 +115,37 @@ func (input StorageInput) Bind() (output Storage, err error) {
 		}
 		output.Cells = int16(cells)
 	}
+	if input.Rows != "" {
+		rows, err := strconv.Atoi(input.Rows)
+		if err != nil {
+			return Storage{}, err
+		}
+		output.Rows = int16(rows)
+	}
+	if input.Columns != "" {
+		columns, err := strconv.Atoi(input.Columns)
+		if err != nil {
+			return Storage{}, err
+		}
+		output.Columns = int16(columns)
+	}
+	output.Kind = input.Kind
+	output.Description = input.Description
+	if input.Parent != "" {
+		parent, err := uuid.Parse(input.Parent)
+		if err != nil {
+			return Storage{}, err
+		}
+		output.Parent = parent
+	}
 	return output, nil
 }
 
 func (s Storage) createQueue(
 	batch *pgx.Batch,
 ) {
-	query := "INSERT INTO storage(name, cells) VALUES($1, $2) RETURNING id, created_at, updated_at"
-	batch.Queue(query, s.Name, s.Cells)
+	query := "INSERT INTO storage(name, cells, rows, columns, kind, parent) VALUES($1, $2, $3, $4, $5, $6) RETURNING id, created_at, updated_at"
+	batch.Queue(query, s.Name, s.Cells, s.Rows, s.Columns, s.Kind, uuidToPgType(s.Parent))
 }
 
 func (s *Storage) createResult(results pgx.BatchResults) error {
@@ -82,40 +159,60 @@ func (s *Storage) Create() (BatchOperation, BatchRead) {
 func (s StoragesRange) getQueue(
 	batch *pgx.Batch,
 ) {
+	cols := "id, created_at, updated_at, name, cells, kind, parent, archived_at"
+	filter := "archived_at IS NULL"
+	if s.Placeable {
+		filter = filter + " AND cells > 0"
+	}
 	if len(s.Src) >= 1 {
-		query := "SELECT * FROM storage WHERE name ILIKE=$3 ORDER BY created_at DESC LIMIT $1 OFFSET $2"
-		batch.Queue(query, s.Limit, s.Offset, s.Src+"%")
+		query := fmt.Sprintf(
+			"SELECT %s FROM storage WHERE %s AND name ILIKE $3 ORDER BY created_at DESC LIMIT $1 OFFSET $2",
+			cols,
+			filter,
+		)
+		batch.Queue(query, s.Limit, s.Offset, "%"+s.Src+"%")
 	} else {
-		query := "SELECT * FROM storage ORDER BY created_at DESC LIMIT $1 OFFSET $2"
+		query := fmt.Sprintf(
+			"SELECT %s FROM storage WHERE %s ORDER BY created_at DESC LIMIT $1 OFFSET $2",
+			cols,
+			filter,
+		)
 		batch.Queue(query, s.Limit, s.Offset)
 	}
 }
 
-func (s *StoragesRange) getResult(results pgx.BatchResults) error {
-	rows, err := results.Query()
-	if err != nil {
-		return err
-	}
-	next := rows.Next()
-	if !next {
-		return nil
-	}
-	for next {
+func scanStorages(rows pgx.Rows) (storages []Storage, err error) {
+	for rows.Next() {
 		var storage Storage
+		var parent pgtype.UUID
+		var archivedAt pgtype.Timestamptz
 		err = rows.Scan(
 			&storage.ID,
 			&storage.CreatedAt,
 			&storage.UpdatedAt,
 			&storage.Name,
 			&storage.Cells,
+			&storage.Kind,
+			&parent,
+			&archivedAt,
 		)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		s.Storages = append(s.Storages, storage)
-		next = rows.Next()
+		storage.Parent = parent.Bytes
+		storage.ArchivedAt = pgTypeToTime(archivedAt)
+		storages = append(storages, storage)
 	}
-	return nil
+	return storages, rows.Err()
+}
+
+func (s *StoragesRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	s.Storages, err = scanStorages(rows)
+	return err
 }
 
 func (s *StoragesRange) Get() (BatchOperation, BatchRead) {
@@ -125,24 +222,190 @@ func (s *StoragesRange) Get() (BatchOperation, BatchRead) {
 func (s Storage) getQueue(
 	batch *pgx.Batch,
 ) {
-	query := "SELECT created_at, updated_at, name FROM storage WHERE id=$1"
+	query := "SELECT created_at, updated_at, name, cells, rows, columns, kind, parent, description, responsible, archived_at FROM storage WHERE id=$1"
 	batch.Queue(query, s.ID)
 }
 
 func (s *Storage) getResult(results pgx.BatchResults) error {
-	return results.QueryRow().Scan(&s.CreatedAt, &s.UpdatedAt, &s.Name)
+	var parent, responsible pgtype.UUID
+	var archivedAt pgtype.Timestamptz
+	err := results.QueryRow().Scan(
+		&s.CreatedAt,
+		&s.UpdatedAt,
+		&s.Name,
+		&s.Cells,
+		&s.Rows,
+		&s.Columns,
+		&s.Kind,
+		&parent,
+		&s.Description,
+		&responsible,
+		&archivedAt,
+	)
+	if err != nil {
+		return err
+	}
+	s.Parent = parent.Bytes
+	s.Responsible = responsible.Bytes
+	s.ArchivedAt = pgTypeToTime(archivedAt)
+	return nil
 }
 
 func (s *Storage) Get() (BatchOperation, BatchRead) {
 	return s.getQueue, s.getResult
 }
 
+func (s Storage) updateQueue(
+	batch *pgx.Batch,
+) {
+	cols := "name=$2, cells=CASE WHEN kind IN ('storage', 'shelf') THEN COALESCE($3, cells) ELSE 0 END, rows=CASE WHEN kind IN ('storage', 'shelf') THEN COALESCE($4, rows) ELSE 0 END, columns=CASE WHEN kind IN ('storage', 'shelf') THEN COALESCE($5, columns) ELSE 0 END, description=$6"
+	query := fmt.Sprintf(
+		"WITH updated AS (UPDATE storage SET %s WHERE id=$1 RETURNING id, updated_at, cells, rows, columns, kind), trimmed AS (DELETE FROM storage_cell USING updated WHERE storage_cell.storage = updated.id AND storage_cell.number > updated.cells AND NOT EXISTS (SELECT 1 FROM reagent_instance WHERE reagent_instance.storage_cell = storage_cell.id)) SELECT updated_at, cells, rows, columns, kind FROM updated",
+		cols,
+	)
+	cells := pgtype.Int2{Int16: s.Cells, Valid: s.Cells != 0}
+	rows := pgtype.Int2{Int16: s.Rows, Valid: cells.Valid}
+	columns := pgtype.Int2{Int16: s.Columns, Valid: cells.Valid}
+	batch.Queue(query, s.ID, s.Name, cells, rows, columns, s.Description)
+}
+
+func (s *Storage) updateResult(results pgx.BatchResults) error {
+	return results.QueryRow().Scan(&s.UpdatedAt, &s.Cells, &s.Rows, &s.Columns, &s.Kind)
+}
+
+func (s *Storage) Update() (BatchOperation, BatchRead) {
+	return s.updateQueue, s.updateResult
+}
+
+const storageSubtree = "WITH RECURSIVE subtree AS (SELECT id FROM storage WHERE id=$1 UNION ALL SELECT storage.id FROM storage JOIN subtree ON storage.parent = subtree.id)"
+
+func activeCell(storageArg, numberArg int) string {
+	return fmt.Sprintf(
+		"SELECT storage_cell.id FROM storage_cell JOIN storage ON storage_cell.storage = storage.id WHERE storage_cell.storage=$%d AND storage_cell.number=$%d AND storage_cell.number <= storage.cells AND storage.archived_at IS NULL",
+		storageArg,
+		numberArg,
+	)
+}
+
+func (s Storage) archiveQueue(
+	batch *pgx.Batch,
+) {
+	query := fmt.Sprintf(
+		"%s UPDATE storage SET archived_at=now() WHERE id IN (SELECT id FROM subtree) AND archived_at IS NULL",
+		storageSubtree,
+	)
+	batch.Queue(query, s.ID)
+}
+
+func (s *Storage) archiveResult(results pgx.BatchResults) error {
+	result, err := results.Exec()
+	if err != nil {
+		return err
+	} else if result.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (s *Storage) Archive() (BatchOperation, BatchRead) {
+	return s.archiveQueue, s.archiveResult
+}
+
+type StorageRelocation struct {
+	StorageID uuid.UUID
+	Target    StorageCell
+	Moved     int64
+}
+
+func (s StorageRelocation) relocateQueue(
+	batch *pgx.Batch,
+) {
+	query := fmt.Sprintf(
+		"%s, target AS (%s) UPDATE reagent_instance SET storage_cell=target.id FROM target WHERE storage_cell IN (SELECT storage_cell.id FROM storage_cell WHERE storage_cell.storage IN (SELECT id FROM subtree)) AND used_at IS NULL AND deleted_at IS NULL AND $2 NOT IN (SELECT id FROM subtree)",
+		storageSubtree,
+		activeCell(2, 3),
+	)
+	batch.Queue(query, s.StorageID, s.Target.Storage, s.Target.Number)
+}
+
+func (s *StorageRelocation) relocateResult(results pgx.BatchResults) error {
+	result, err := results.Exec()
+	if err != nil {
+		return err
+	}
+	s.Moved = result.RowsAffected()
+	return nil
+}
+
+func (s *StorageRelocation) Relocate() (BatchOperation, BatchRead) {
+	return s.relocateQueue, s.relocateResult
+}
+
+func (s StoragePath) getQueue(
+	batch *pgx.Batch,
+) {
+	cols := "storage.id, storage.created_at, storage.updated_at, storage.name, storage.cells, storage.kind, storage.parent, storage.archived_at"
+	start := "SELECT %s, 0 AS depth FROM storage WHERE storage.id=$1"
+	arg := s.StorageID
+	if s.InstanceID != uuid.Nil {
+		start = "SELECT %s, 0 AS depth FROM reagent_instance JOIN storage_cell ON reagent_instance.storage_cell = storage_cell.id JOIN storage ON storage_cell.storage = storage.id WHERE reagent_instance.id=$1"
+		arg = s.InstanceID
+	}
+	query := fmt.Sprintf(
+		"WITH RECURSIVE path AS (%s UNION ALL SELECT %s, path.depth + 1 FROM storage JOIN path ON storage.id = path.parent) SELECT id, created_at, updated_at, name, cells, kind, parent, archived_at FROM path ORDER BY depth DESC",
+		fmt.Sprintf(start, cols),
+		cols,
+	)
+	batch.Queue(query, arg)
+}
+
+func (s *StoragePath) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	s.Storages, err = scanStorages(rows)
+	return err
+}
+
+func (s *StoragePath) Get() (BatchOperation, BatchRead) {
+	return s.getQueue, s.getResult
+}
+
+func (s StorageChildrenRange) getQueue(
+	batch *pgx.Batch,
+) {
+	query := "SELECT id, created_at, updated_at, name, cells, kind, parent, archived_at FROM storage WHERE parent=$1 ORDER BY archived_at DESC NULLS FIRST, kind, name"
+	batch.Queue(query, s.ParentID)
+}
+
+func (s *StorageChildrenRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	s.Storages, err = scanStorages(rows)
+	return err
+}
+
+func (s *StorageChildrenRange) Get() (BatchOperation, BatchRead) {
+	return s.getQueue, s.getResult
+}
+
 type StorageCell struct {
 	ID        uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Storage   uuid.UUID `json:"storage"`
-	Number    int16     `json:"number"     uaLocal:"номер"`
+	Number    int16     `json:"number"     validate:"gte=1"                   uaLocal:"номер"`
+	Label     string    `json:"label"      validate:"lte=50"                  uaLocal:"мітка"`
+	Capacity  int16     `json:"capacity"   validate:"omitempty,gte=1,lte=1000" uaLocal:"місткість"`
+	Occupied  int       `json:"occupied"`
+}
+
+type StorageCellsRange struct {
+	StorageCells []StorageCell
+	StorageID    uuid.UUID
 }
 
 func (storageCell StorageCell) tryCreateQueue(
@@ -160,3 +423,68 @@ func (storageCell *StorageCell) tryCreateResult(results pgx.BatchResults) error
 func (storageCell *StorageCell) TryCreate() (BatchOperation, BatchRead) {
 	return storageCell.tryCreateQueue, storageCell.tryCreateResult
 }
+
+func (storageCell StorageCell) upsertQueue(
+	batch *pgx.Batch,
+) {
+	query := "INSERT INTO storage_cell(storage, number, label, capacity) VALUES($1, $2, $3, $4) ON CONFLICT ON CONSTRAINT storage_cell_storage_number_key DO UPDATE SET label=EXCLUDED.label, capacity=EXCLUDED.capacity RETURNING id, created_at, updated_at"
+	capacity := pgtype.Int2{Int16: storageCell.Capacity, Valid: storageCell.Capacity != 0}
+	batch.Queue(query, storageCell.Storage, storageCell.Number, storageCell.Label, capacity)
+}
+
+func (storageCell *StorageCell) upsertResult(results pgx.BatchResults) error {
+	return results.QueryRow().Scan(&storageCell.ID, &storageCell.CreatedAt, &storageCell.UpdatedAt)
+}
+
+func (storageCell *StorageCell) Upsert() (BatchOperation, BatchRead) {
+	return storageCell.upsertQueue, storageCell.upsertResult
+}
+
+func (s StorageCellsRange) getQueue(
+	batch *pgx.Batch,
+) {
+	cols := "storage_cell.id, storage_cell.created_at, storage_cell.updated_at, storage_cell.number, storage_cell.label, storage_cell.capacity, COUNT(reagent_instance)"
+	join := "LEFT JOIN reagent_instance ON reagent_instance.storage_cell = storage_cell.id AND reagent_instance.used_at IS NULL AND reagent_instance.deleted_at IS NULL"
+	query := fmt.Sprintf(
+		"SELECT %s FROM storage_cell %s WHERE storage_cell.storage=$1 AND storage_cell.number <= (SELECT cells FROM storage WHERE id=$1) GROUP BY storage_cell.id ORDER BY storage_cell.number",
+		cols,
+		join,
+	)
+	batch.Queue(query, s.StorageID)
+}
+
+func (s *StorageCellsRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	next := rows.Next()
+	if !next {
+		return nil
+	}
+	for next {
+		var storageCell StorageCell
+		var capacity pgtype.Int2
+		err = rows.Scan(
+			&storageCell.ID,
+			&storageCell.CreatedAt,
+			&storageCell.UpdatedAt,
+			&storageCell.Number,
+			&storageCell.Label,
+			&capacity,
+			&storageCell.Occupied,
+		)
+		if err != nil {
+			return err
+		}
+		storageCell.Storage = s.StorageID
+		storageCell.Capacity = capacity.Int16
+		s.StorageCells = append(s.StorageCells, storageCell)
+		next = rows.Next()
+	}
+	return nil
+}
+
+func (s *StorageCellsRange) Get() (BatchOperation, BatchRead) {
+	return s.getQueue, s.getResult
+}
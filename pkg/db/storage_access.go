@@ -0,0 +1,155 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type StorageAccess struct {
+	Storage     uuid.UUID `json:"storage"`
+	StorageUser uuid.UUID `json:"storage_user"`
+}
+
+type StorageAccessRange struct {
+	StorageUsers []StorageUser
+	StorageID    uuid.UUID
+}
+
+type StoragePermission struct {
+	StorageID   uuid.UUID
+	InstanceID  uuid.UUID
+	UserID      uuid.UUID
+	Owner       Storage
+	Responsible StorageUser
+	Allowed     bool
+}
+
+func (s Storage) setResponsibleQueue(
+	batch *pgx.Batch,
+) {
+	query := "UPDATE storage SET responsible=$2 WHERE id=$1 RETURNING updated_at"
+	batch.Queue(query, s.ID, uuidToPgType(s.Responsible))
+}
+
+func (s *Storage) setResponsibleResult(results pgx.BatchResults) error {
+	return results.QueryRow().Scan(&s.UpdatedAt)
+}
+
+func (s *Storage) SetResponsible() (BatchOperation, BatchRead) {
+	return s.setResponsibleQueue, s.setResponsibleResult
+}
+
+func (a StorageAccess) createQueue(
+	batch *pgx.Batch,
+) {
+	query := "INSERT INTO storage_access(storage, storage_user) SELECT $1, id FROM storage_user WHERE id=$2 AND role IN ('assistant', 'lecturer') AND active=true ON CONFLICT ON CONSTRAINT storage_access_storage_user_key DO NOTHING"
+	batch.Queue(query, a.Storage, a.StorageUser)
+}
+
+func (a *StorageAccess) createResult(results pgx.BatchResults) error {
+	_, err := results.Exec()
+	return err
+}
+
+func (a *StorageAccess) Create() (BatchOperation, BatchRead) {
+	return a.createQueue, a.createResult
+}
+
+func (a StorageAccess) deleteQueue(
+	batch *pgx.Batch,
+) {
+	query := "DELETE FROM storage_access WHERE storage=$1 AND storage_user=$2"
+	batch.Queue(query, a.Storage, a.StorageUser)
+}
+
+func (a *StorageAccess) deleteResult(results pgx.BatchResults) error {
+	ct, err := results.Exec()
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (a *StorageAccess) Delete() (BatchOperation, BatchRead) {
+	return a.deleteQueue, a.deleteResult
+}
+
+func (s StorageAccessRange) getQueue(
+	batch *pgx.Batch,
+) {
+	query := "SELECT storage_user.id, storage_user.name FROM storage_access JOIN storage_user ON storage_access.storage_user = storage_user.id WHERE storage_access.storage=$1 ORDER BY storage_user.name"
+	batch.Queue(query, s.StorageID)
+}
+
+func (s *StorageAccessRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	next := rows.Next()
+	if !next {
+		return nil
+	}
+	for next {
+		var storageUser StorageUser
+		err = rows.Scan(&storageUser.ID, &storageUser.Name)
+		if err != nil {
+			return err
+		}
+		s.StorageUsers = append(s.StorageUsers, storageUser)
+		next = rows.Next()
+	}
+	return nil
+}
+
+func (s *StorageAccessRange) Get() (BatchOperation, BatchRead) {
+	return s.getQueue, s.getResult
+}
+
+func (p StoragePermission) getQueue(
+	batch *pgx.Batch,
+) {
+	start := "SELECT id, name, parent, responsible, 0 AS depth FROM storage WHERE id = COALESCE($1, (SELECT storage_cell.storage FROM reagent_instance JOIN storage_cell ON reagent_instance.storage_cell = storage_cell.id WHERE reagent_instance.id=$2))"
+	step := "SELECT storage.id, storage.name, storage.parent, storage.responsible, ancestors.depth + 1 FROM storage JOIN ancestors ON storage.id = ancestors.parent"
+	owner := "SELECT id, name, responsible FROM ancestors WHERE responsible IS NOT NULL ORDER BY depth LIMIT 1"
+	access := "EXISTS (SELECT 1 FROM storage_access WHERE storage_access.storage = owner.id AND storage_access.storage_user=$3)"
+	query := fmt.Sprintf(
+		"WITH RECURSIVE ancestors AS (%s UNION ALL %s), owner AS (%s) SELECT owner.id, owner.name, storage_user.id, storage_user.name, owner.responsible=$3 OR %s FROM owner JOIN storage_user ON owner.responsible = storage_user.id",
+		start,
+		step,
+		owner,
+		access,
+	)
+	batch.Queue(query, uuidToPgType(p.StorageID), uuidToPgType(p.InstanceID), p.UserID)
+}
+
+func (p *StoragePermission) getResult(results pgx.BatchResults) error {
+	err := results.QueryRow().Scan(
+		&p.Owner.ID,
+		&p.Owner.Name,
+		&p.Responsible.ID,
+		&p.Responsible.Name,
+		&p.Allowed,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		p.Allowed = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	p.Owner.Responsible = p.Responsible.ID
+	return nil
+}
+
+func (p *StoragePermission) Get() (BatchOperation, BatchRead) {
+	return p.getQueue, p.getResult
+}
+
+const allowedStorages = "WITH RECURSIVE ancestry AS (SELECT id AS storage, id AS ancestor, responsible, 0 AS depth FROM storage UNION ALL SELECT ancestry.storage, parent.id, parent.responsible, ancestry.depth + 1 FROM ancestry JOIN storage AS child ON child.id = ancestry.ancestor JOIN storage AS parent ON parent.id = child.parent), owner AS (SELECT DISTINCT ON (storage) storage, ancestor, responsible FROM ancestry WHERE responsible IS NOT NULL ORDER BY storage, depth), allowed_storage AS (SELECT storage.id FROM storage LEFT JOIN owner ON owner.storage = storage.id WHERE owner.storage IS NULL OR owner.responsible=$1 OR EXISTS (SELECT 1 FROM storage_access WHERE storage_access.storage = owner.ancestor AND storage_access.storage_user=$1))"
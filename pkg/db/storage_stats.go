@@ -0,0 +1,133 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var StorageStatsSorts = map[string]string{
+	"name":        "storage.name",
+	"instances":   "instances",
+	"expired":     "expired",
+	"occupied":    "occupied",
+	"free":        "free",
+	"responsible": "responsible_name",
+}
+
+type StorageStats struct {
+	Storage     Storage
+	ParentName  string
+	Responsible StorageUser
+	Instances   int
+	Expired     int
+	Occupied    int
+	Free        int
+}
+
+type StorageStatsRange struct {
+	StoragesStats []StorageStats
+	Limit         int
+	Offset        int
+	Src           string
+	Location      uuid.UUID
+	Sort          string
+	Desc          bool
+}
+
+func (s StorageStatsRange) getQueue(
+	batch *pgx.Batch,
+) {
+	tree := "SELECT id AS root, id FROM storage UNION ALL SELECT tree.root, storage.id FROM storage JOIN tree ON storage.parent = tree.id"
+	ancestry := "SELECT id AS root, parent, responsible, 0 AS depth FROM storage UNION ALL SELECT ancestry.root, storage.parent, storage.responsible, ancestry.depth + 1 FROM storage JOIN ancestry ON storage.id = ancestry.parent"
+	owner := "SELECT DISTINCT ON (root) root, responsible FROM ancestry WHERE responsible IS NOT NULL ORDER BY root, depth"
+	instances := "SELECT tree.root, COUNT(reagent_instance.id) AS instances, COUNT(reagent_instance.id) FILTER (WHERE reagent_instance.expires_at < now()) AS expired FROM tree JOIN storage_cell ON storage_cell.storage = tree.id JOIN reagent_instance ON reagent_instance.storage_cell = storage_cell.id WHERE reagent_instance.used_at IS NULL AND reagent_instance.deleted_at IS NULL GROUP BY tree.root"
+	occupied := "SELECT storage_cell.storage, COUNT(DISTINCT storage_cell.number) AS occupied FROM storage_cell JOIN reagent_instance ON reagent_instance.storage_cell = storage_cell.id WHERE reagent_instance.used_at IS NULL AND reagent_instance.deleted_at IS NULL GROUP BY storage_cell.storage"
+	cols := "storage.id, storage.name, storage.kind, storage.cells, storage.parent, parent.name, storage_user.id, storage_user.name AS responsible_name, COALESCE(instances.instances, 0) AS instances, COALESCE(instances.expired, 0) AS expired, COALESCE(occupied.occupied, 0) AS occupied, GREATEST(storage.cells - COALESCE(occupied.occupied, 0), 0) AS free"
+	join := "LEFT JOIN storage parent ON storage.parent = parent.id LEFT JOIN owner ON storage.id = owner.root LEFT JOIN storage_user ON owner.responsible = storage_user.id LEFT JOIN instances ON storage.id = instances.root LEFT JOIN occupied ON storage.id = occupied.storage"
+	filters := []string{"storage.archived_at IS NULL"}
+	args := []any{s.Limit, s.Offset}
+	if len(s.Src) >= 1 {
+		args = append(args, "%"+s.Src+"%")
+		filters = append(
+			filters,
+			fmt.Sprintf("(storage.name ILIKE $%d OR storage_user.name ILIKE $%d)", len(args), len(args)),
+		)
+	}
+	if s.Location != uuid.Nil {
+		args = append(args, s.Location)
+		filters = append(
+			filters,
+			fmt.Sprintf("storage.id != $%d AND storage.id IN (SELECT id FROM tree WHERE root=$%d)", len(args), len(args)),
+		)
+	}
+	sort, ok := StorageStatsSorts[s.Sort]
+	if !ok {
+		sort = StorageStatsSorts["name"]
+	}
+	direction := "ASC"
+	if s.Desc {
+		direction = "DESC"
+	}
+	query := fmt.Sprintf(
+		"WITH RECURSIVE tree AS (%s), ancestry AS (%s), owner AS (%s), instances AS (%s), occupied AS (%s) SELECT %s FROM storage %s WHERE %s ORDER BY %s %s NULLS LAST, storage.name, storage.id LIMIT $1 OFFSET $2",
+		tree,
+		ancestry,
+		owner,
+		instances,
+		occupied,
+		cols,
+		join,
+		strings.Join(filters, " AND "),
+		sort,
+		direction,
+	)
+	batch.Queue(query, args...)
+}
+
+func (s *StorageStatsRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	next := rows.Next()
+	if !next {
+		return nil
+	}
+	for next {
+		var stats StorageStats
+		var parent, responsible pgtype.UUID
+		var parentName, responsibleName pgtype.Text
+		err = rows.Scan(
+			&stats.Storage.ID,
+			&stats.Storage.Name,
+			&stats.Storage.Kind,
+			&stats.Storage.Cells,
+			&parent,
+			&parentName,
+			&responsible,
+			&responsibleName,
+			&stats.Instances,
+			&stats.Expired,
+			&stats.Occupied,
+			&stats.Free,
+		)
+		if err != nil {
+			return err
+		}
+		stats.Storage.Parent = parent.Bytes
+		stats.ParentName = parentName.String
+		stats.Responsible.ID = responsible.Bytes
+		stats.Responsible.Name = responsibleName.String
+		s.StoragesStats = append(s.StoragesStats, stats)
+		next = rows.Next()
+	}
+	return nil
+}
+
+func (s *StorageStatsRange) Get() (BatchOperation, BatchRead) {
+	return s.getQueue, s.getResult
+}
@@ -2,11 +2,13 @@ package db
 
 import (
 	"errors"
+	"fmt"
 	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type Role struct {
@@ -56,13 +58,18 @@ type StorageUserInput struct {
 }
 
 type StorageUser struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Name      string    `json:"name"       validate:"gte=3,lte=50" uaLocal:"логін"`
-	Role      Role      `json:"role"                               uaLocal:"роль"`
-	Password  string    `json:"password"   validate:"gte=6,lte=20" uaLocal:"пароль"`
-	Active    bool      `json:"active"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Name          string    `json:"name"        validate:"gte=3,lte=50" uaLocal:"логін"`
+	Role          Role      `json:"role"                                uaLocal:"роль"`
+	Password      string    `json:"password"    validate:"gte=6,lte=20" uaLocal:"пароль"`
+	Active        bool      `json:"active"`
+	ReviewedAt    time.Time `json:"reviewed_at"`
+	ReviewedBy    uuid.UUID `json:"reviewed_by"`
+	Rejected      bool      `json:"rejected"`
+	ReviewNote    string    `json:"review_note" validate:"lte=500"         uaLocal:"коментар"`
+	CalendarToken string    `json:"-"`
 }
 
 type StorageUsersRange struct {
@@ -71,6 +78,9 @@ type StorageUsersRange struct {
 	Offset       int
 	Src          string
 	ExcludeID    uuid.UUID
+	Pending      bool
+	Assistants   bool
+	Staff        bool
 }
 
 func (input StorageUserInput) Bind() (output StorageUser, err error) {
@@ -136,11 +146,36 @@ func (s *StorageUser) Create() (BatchOperation, BatchRead) {
 func (s StorageUsersRange) getQueue(
 	batch *pgx.Batch,
 ) {
+	cols := "id, created_at, updated_at, name, role, password, active, reviewed_at, rejected, review_note"
+	filter := "id!=$3"
+	if s.Pending {
+		filter = filter + " AND role='unconfirmed' AND rejected=false AND active=true"
+	}
+	if s.Assistants {
+		filter = filter + " AND role='assistant' AND active=true"
+	}
+	if s.Staff {
+		filter = filter + " AND role IN ('assistant', 'lecturer') AND active=true"
+	}
+	order := "created_at DESC"
+	if s.Pending {
+		order = "created_at"
+	}
 	if len(s.Src) >= 1 {
-		query := "SELECT * FROM storage_user WHERE name ILIKE $3 AND id!=$4 ORDER BY created_at DESC LIMIT $1 OFFSET $2"
-		batch.Queue(query, s.Limit, s.Offset, s.Src+"%", s.ExcludeID)
+		query := fmt.Sprintf(
+			"SELECT %s FROM storage_user WHERE %s AND name ILIKE $4 ORDER BY %s LIMIT $1 OFFSET $2",
+			cols,
+			filter,
+			order,
+		)
+		batch.Queue(query, s.Limit, s.Offset, s.ExcludeID, s.Src+"%")
 	} else {
-		query := "SELECT * FROM storage_user WHERE id!=$3 ORDER BY created_at DESC LIMIT $1 OFFSET $2"
+		query := fmt.Sprintf(
+			"SELECT %s FROM storage_user WHERE %s ORDER BY %s LIMIT $1 OFFSET $2",
+			cols,
+			filter,
+			order,
+		)
 		batch.Queue(query, s.Limit, s.Offset, s.ExcludeID)
 	}
 }
@@ -156,6 +191,7 @@ func (s *StorageUsersRange) getResult(result pgx.BatchResults) error {
 	}
 	for next {
 		var roleStr string
+		var reviewedAt pgtype.Timestamptz
 		var storageUser StorageUser
 		err = rows.Scan(
 			&storageUser.ID,
@@ -165,6 +201,9 @@ func (s *StorageUsersRange) getResult(result pgx.BatchResults) error {
 			&roleStr,
 			&storageUser.Password,
 			&storageUser.Active,
+			&reviewedAt,
+			&storageUser.Rejected,
+			&storageUser.ReviewNote,
 		)
 		if err != nil {
 			return err
@@ -175,6 +214,7 @@ func (s *StorageUsersRange) getResult(result pgx.BatchResults) error {
 		} else {
 			storageUser.Role = role
 		}
+		storageUser.ReviewedAt = pgTypeToTime(reviewedAt)
 		s.StorageUsers = append(s.StorageUsers, storageUser)
 		next = rows.Next()
 	}
@@ -188,12 +228,14 @@ func (s *StorageUsersRange) Get() (BatchOperation, BatchRead) {
 func (s StorageUser) getByIDQueue(
 	batch *pgx.Batch,
 ) {
-	query := "SELECT created_at, updated_at, name, role, password, active FROM storage_user WHERE id=$1"
+	query := "SELECT created_at, updated_at, name, role, password, active, reviewed_at, rejected, review_note, calendar_token FROM storage_user WHERE id=$1"
 	batch.Queue(query, s.ID)
 }
 
 func (s *StorageUser) getByIDResult(results pgx.BatchResults) (err error) {
 	var roleStr string
+	var reviewedAt pgtype.Timestamptz
+	var calendarToken pgtype.Text
 	err = results.QueryRow().Scan(
 		&s.CreatedAt,
 		&s.UpdatedAt,
@@ -201,6 +243,10 @@ func (s *StorageUser) getByIDResult(results pgx.BatchResults) (err error) {
 		&roleStr,
 		&s.Password,
 		&s.Active,
+		&reviewedAt,
+		&s.Rejected,
+		&s.ReviewNote,
+		&calendarToken,
 	)
 	if err != nil {
 		return err
@@ -210,6 +256,8 @@ func (s *StorageUser) getByIDResult(results pgx.BatchResults) (err error) {
 		return err
 	}
 	s.Role = role
+	s.ReviewedAt = pgTypeToTime(reviewedAt)
+	s.CalendarToken = calendarToken.String
 	return nil
 }
 
@@ -272,3 +320,75 @@ func (s *StorageUser) updateResult(results pgx.BatchResults) (err error) {
 func (s *StorageUser) Update() (BatchOperation, BatchRead) {
 	return s.updateQueue, s.updateResult
 }
+
+func (s StorageUser) reviewQueue(
+	batch *pgx.Batch,
+) {
+	query := "UPDATE storage_user SET role=$2, rejected=$3, review_note=$4, reviewed_by=$5, reviewed_at=now() WHERE id=$1 AND role='unconfirmed' RETURNING created_at, name, reviewed_at"
+	batch.Queue(query, s.ID, s.Role.Name, s.Rejected, s.ReviewNote, s.ReviewedBy)
+}
+
+func (s *StorageUser) reviewResult(results pgx.BatchResults) error {
+	return results.QueryRow().Scan(&s.CreatedAt, &s.Name, &s.ReviewedAt)
+}
+
+func (s *StorageUser) Review() (BatchOperation, BatchRead) {
+	return s.reviewQueue, s.reviewResult
+}
+
+func (s StorageUser) getByCalendarTokenQueue(
+	batch *pgx.Batch,
+) {
+	query := "SELECT id, created_at, updated_at, name, role, active FROM storage_user WHERE calendar_token=$1"
+	batch.Queue(query, s.CalendarToken)
+}
+
+func (s *StorageUser) getByCalendarTokenResult(results pgx.BatchResults) (err error) {
+	var roleStr string
+	err = results.QueryRow().Scan(
+		&s.ID,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+		&s.Name,
+		&roleStr,
+		&s.Active,
+	)
+	if err != nil {
+		return err
+	}
+	role, err := StringToRole(roleStr)
+	if err != nil {
+		return err
+	}
+	s.Role = role
+	return nil
+}
+
+func (s *StorageUser) GetByCalendarToken() (BatchOperation, BatchRead) {
+	return s.getByCalendarTokenQueue, s.getByCalendarTokenResult
+}
+
+func (s StorageUser) setCalendarTokenQueue(
+	batch *pgx.Batch,
+) {
+	calendarToken := pgtype.Text{String: s.CalendarToken, Valid: s.CalendarToken != ""}
+	query := "UPDATE storage_user SET calendar_token=$2 WHERE id=$1"
+	batch.Queue(query, s.ID, calendarToken)
+}
+
+func (s *StorageUser) setCalendarTokenResult(results pgx.BatchResults) error {
+	result, err := results.Exec()
+	affectedRows := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affectedRows != 1 {
+		if affectedRows == 0 {
+			return pgx.ErrNoRows
+		}
+	}
+	return nil
+}
+
+func (s *StorageUser) SetCalendarToken() (BatchOperation, BatchRead) {
+	return s.setCalendarTokenQueue, s.setCalendarTokenResult
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type SupplierBarcode struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Barcode   string    `json:"barcode"    validate:"required,lte=50" uaLocal:"штрихкод"`
+	Reagent   uuid.UUID `json:"reagent"`
+	Supplier  string    `json:"supplier"   validate:"lte=100"         uaLocal:"постачальник"`
+	Grade     string    `json:"grade"      validate:"lte=50"          uaLocal:"кваліфікація"`
+	Size      string    `json:"size"       validate:"lte=50"          uaLocal:"фасування"`
+}
+
+type SupplierBarcodesRange struct {
+	SupplierBarcodes []SupplierBarcode
+	ReagentID        uuid.UUID
+}
+
+func (b SupplierBarcode) createQueue(
+	batch *pgx.Batch,
+) {
+	query := "INSERT INTO supplier_barcode(barcode, reagent, supplier, grade, size) SELECT $1::text, $2::uuid, $3::text, $4::text, $5::text WHERE EXISTS (SELECT 1 FROM reagent WHERE id = $2::uuid) RETURNING id, created_at, updated_at"
+	batch.Queue(query, b.Barcode, b.Reagent, b.Supplier, b.Grade, b.Size)
+}
+
+func (b *SupplierBarcode) createResult(results pgx.BatchResults) error {
+	return results.QueryRow().Scan(&b.ID, &b.CreatedAt, &b.UpdatedAt)
+}
+
+func (b *SupplierBarcode) Create() (BatchOperation, BatchRead) {
+	return b.createQueue, b.createResult
+}
+
+func (b SupplierBarcode) getByBarcodeQueue(
+	batch *pgx.Batch,
+) {
+	query := "SELECT id, created_at, updated_at, reagent, supplier, grade, size FROM supplier_barcode WHERE barcode=$1"
+	batch.Queue(query, b.Barcode)
+}
+
+func (b *SupplierBarcode) getByBarcodeResult(results pgx.BatchResults) error {
+	return results.QueryRow().Scan(
+		&b.ID,
+		&b.CreatedAt,
+		&b.UpdatedAt,
+		&b.Reagent,
+		&b.Supplier,
+		&b.Grade,
+		&b.Size,
+	)
+}
+
+func (b *SupplierBarcode) GetByBarcode() (BatchOperation, BatchRead) {
+	return b.getByBarcodeQueue, b.getByBarcodeResult
+}
+
+func (b SupplierBarcode) deleteQueue(
+	batch *pgx.Batch,
+) {
+	query := "DELETE FROM supplier_barcode WHERE id=$1 AND reagent=$2"
+	batch.Queue(query, b.ID, b.Reagent)
+}
+
+func (b *SupplierBarcode) deleteResult(results pgx.BatchResults) error {
+	ct, err := results.Exec()
+	if err != nil {
+		return err
+	}
+	if ct.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+func (b *SupplierBarcode) Delete() (BatchOperation, BatchRead) {
+	return b.deleteQueue, b.deleteResult
+}
+
+func (r SupplierBarcodesRange) getQueue(
+	batch *pgx.Batch,
+) {
+	query := "SELECT id, created_at, updated_at, barcode, supplier, grade, size FROM supplier_barcode WHERE reagent=$1 ORDER BY supplier, barcode"
+	batch.Queue(query, r.ReagentID)
+}
+
+func (r *SupplierBarcodesRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		barcode := SupplierBarcode{Reagent: r.ReagentID}
+		err = rows.Scan(
+			&barcode.ID,
+			&barcode.CreatedAt,
+			&barcode.UpdatedAt,
+			&barcode.Barcode,
+			&barcode.Supplier,
+			&barcode.Grade,
+			&barcode.Size,
+		)
+		if err != nil {
+			return err
+		}
+		r.SupplierBarcodes = append(r.SupplierBarcodes, barcode)
+	}
+	return rows.Err()
+}
+
+func (r *SupplierBarcodesRange) Get() (BatchOperation, BatchRead) {
+	return r.getQueue, r.getResult
+}
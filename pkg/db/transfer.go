@@ -0,0 +1,270 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type InstancesSelection struct {
+	ReagentInstancesExtended []ReagentInstanceExtended
+	IDs                      []uuid.UUID
+	StorageID                uuid.UUID
+	Cell                     int16
+	ReagentID                uuid.UUID
+}
+
+type BulkTransfer struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	StorageUser uuid.UUID `json:"storage_user"`
+	StorageCell uuid.UUID `json:"storage_cell"`
+	Moved       int       `json:"moved"`
+	Skipped     int       `json:"skipped"`
+}
+
+type BulkTransferItem struct {
+	ID              uuid.UUID `json:"id"`
+	BulkTransfer    uuid.UUID `json:"bulk_transfer"`
+	ReagentInstance uuid.UUID `json:"reagent_instance"`
+	FromStorageCell uuid.UUID `json:"from_storage_cell"`
+	Moved           bool      `json:"moved"`
+	Reason          string    `json:"reason"`
+}
+
+type BulkTransferItemExtended struct {
+	BulkTransferItem BulkTransferItem
+	Reagent          Reagent
+	Storage          Storage
+	StorageCell      StorageCell
+}
+
+type BulkTransferExtended struct {
+	BulkTransfer BulkTransfer
+	StorageUser  StorageUser
+	Storage      Storage
+	StorageCell  StorageCell
+	Items        []BulkTransferItemExtended
+	SkippedIDs   []uuid.UUID
+}
+
+const bulkTransferLostReason = "Використано або видалено під час переміщення"
+
+func (s InstancesSelection) getQueue(
+	batch *pgx.Batch,
+) {
+	cols := "reagent_instance.id, reagent_instance.expires_at, reagent.id, reagent.name, reagent.formula, storage_cell.id, storage_cell.number, storage.id, storage.name"
+	join := "JOIN reagent ON reagent_instance.reagent = reagent.id JOIN storage_cell ON reagent_instance.storage_cell = storage_cell.id JOIN storage ON storage_cell.storage = storage.id"
+	filters := []string{"reagent_instance.used_at IS NULL", "reagent_instance.deleted_at IS NULL"}
+	order := "storage.name, storage_cell.number, reagent.name, reagent_instance.expires_at"
+	var args []any
+	subtree := ""
+	if len(s.IDs) > 0 {
+		args = append(args, s.IDs)
+		filters = append(filters, fmt.Sprintf("reagent_instance.id = ANY($%d)", len(args)))
+	}
+	if s.StorageID != uuid.Nil {
+		args = append(args, s.StorageID)
+		if s.Cell > 0 {
+			filters = append(filters, fmt.Sprintf("storage.id=$%d", len(args)))
+			args = append(args, s.Cell)
+			filters = append(filters, fmt.Sprintf("storage_cell.number=$%d", len(args)))
+		} else {
+			subtree = fmt.Sprintf(
+				"WITH RECURSIVE subtree AS (SELECT id FROM storage WHERE id=$%d UNION ALL SELECT storage.id FROM storage JOIN subtree ON storage.parent = subtree.id)",
+				len(args),
+			)
+			filters = append(filters, "storage.id IN (SELECT id FROM subtree)")
+		}
+	}
+	if s.ReagentID != uuid.Nil {
+		args = append(args, s.ReagentID)
+		filters = append(filters, fmt.Sprintf("reagent.id=$%d", len(args)))
+	}
+	query := fmt.Sprintf(
+		"%s SELECT %s FROM reagent_instance %s WHERE %s ORDER BY %s",
+		subtree,
+		cols,
+		join,
+		strings.Join(filters, " AND "),
+		order,
+	)
+	batch.Queue(query, args...)
+}
+
+func (s *InstancesSelection) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	s.ReagentInstancesExtended, err = scanStorageInstances(rows)
+	return err
+}
+
+func (s *InstancesSelection) Get() (BatchOperation, BatchRead) {
+	return s.getQueue, s.getResult
+}
+
+func (b BulkTransferExtended) createQueue(
+	batch *pgx.Batch,
+) {
+	query := fmt.Sprintf(
+		"WITH target AS (%s) INSERT INTO bulk_transfer(id, storage_user, storage_cell) SELECT $1, $2, target.id FROM target RETURNING created_at, updated_at",
+		activeCell(3, 4),
+	)
+	batch.Queue(
+		query,
+		b.BulkTransfer.ID,
+		uuidToPgType(b.BulkTransfer.StorageUser),
+		b.StorageCell.Storage,
+		b.StorageCell.Number,
+	)
+	var toMove, skipped, skippedFrom []uuid.UUID
+	var reasons []string
+	for _, item := range b.Items {
+		if item.BulkTransferItem.Moved {
+			toMove = append(toMove, item.BulkTransferItem.ReagentInstance)
+			continue
+		}
+		skipped = append(skipped, item.BulkTransferItem.ReagentInstance)
+		skippedFrom = append(skippedFrom, item.BulkTransferItem.FromStorageCell)
+		reasons = append(reasons, item.BulkTransferItem.Reason)
+	}
+	old := "SELECT id, storage_cell FROM reagent_instance WHERE id = ANY($2) AND used_at IS NULL AND deleted_at IS NULL FOR UPDATE"
+	upd := "UPDATE reagent_instance SET storage_cell=bulk_transfer.storage_cell FROM old, bulk_transfer WHERE reagent_instance.id = old.id AND bulk_transfer.id=$1 RETURNING reagent_instance.id"
+	items := "INSERT INTO bulk_transfer_item(bulk_transfer, reagent_instance, from_storage_cell, moved) SELECT $1, old.id, old.storage_cell, TRUE FROM upd JOIN old ON upd.id = old.id RETURNING id"
+	lost := "INSERT INTO bulk_transfer_item(bulk_transfer, reagent_instance, from_storage_cell, moved, reason) SELECT $1, reagent_instance.id, reagent_instance.storage_cell, FALSE, $4 FROM reagent_instance WHERE reagent_instance.id = ANY($2) AND reagent_instance.id NOT IN (SELECT id FROM upd) AND EXISTS (SELECT 1 FROM bulk_transfer WHERE id=$1) RETURNING reagent_instance"
+	query = fmt.Sprintf(
+		"WITH old AS (%s), upd AS (%s), items AS (%s), lost AS (%s) UPDATE bulk_transfer SET moved=(SELECT COUNT(*) FROM items), skipped=$3 + (SELECT COUNT(*) FROM lost) WHERE id=$1 RETURNING moved, skipped, ARRAY(SELECT id FROM upd)",
+		old,
+		upd,
+		items,
+		lost,
+	)
+	batch.Queue(query, b.BulkTransfer.ID, toMove, len(skipped), bulkTransferLostReason)
+	query = "INSERT INTO bulk_transfer_item(bulk_transfer, reagent_instance, from_storage_cell, moved, reason) SELECT $1, skipped.instance, skipped.cell, FALSE, skipped.reason FROM unnest($2::uuid[], $3::uuid[], $4::text[]) AS skipped(instance, cell, reason) WHERE EXISTS (SELECT 1 FROM bulk_transfer WHERE id=$1)"
+	batch.Queue(query, b.BulkTransfer.ID, skipped, skippedFrom, reasons)
+}
+
+func (b *BulkTransferExtended) createResult(results pgx.BatchResults) error {
+	transferErr := results.QueryRow().Scan(&b.BulkTransfer.CreatedAt, &b.BulkTransfer.UpdatedAt)
+	var moved []uuid.UUID
+	moveErr := results.QueryRow().Scan(&b.BulkTransfer.Moved, &b.BulkTransfer.Skipped, &moved)
+	_, skipErr := results.Exec()
+	for _, err := range []error{transferErr, moveErr, skipErr} {
+		if err != nil {
+			return err
+		}
+	}
+	movedSet := make(map[uuid.UUID]bool, len(moved))
+	for _, id := range moved {
+		movedSet[id] = true
+	}
+	for i := range b.Items {
+		item := &b.Items[i].BulkTransferItem
+		if item.Moved && !movedSet[item.ReagentInstance] {
+			item.Moved = false
+			item.Reason = bulkTransferLostReason
+		}
+		if !item.Moved {
+			b.SkippedIDs = append(b.SkippedIDs, item.ReagentInstance)
+		}
+	}
+	return nil
+}
+
+func (b *BulkTransferExtended) Create() (BatchOperation, BatchRead) {
+	return b.createQueue, b.createResult
+}
+
+func (b BulkTransferExtended) getQueue(
+	batch *pgx.Batch,
+) {
+	cols := "bulk_transfer.created_at, bulk_transfer.updated_at, bulk_transfer.storage_user, bulk_transfer.storage_cell, bulk_transfer.moved, bulk_transfer.skipped, storage_user.name, storage_cell.number, storage_cell.label, storage.id, storage.name"
+	join := "LEFT JOIN storage_user ON bulk_transfer.storage_user = storage_user.id JOIN storage_cell ON bulk_transfer.storage_cell = storage_cell.id JOIN storage ON storage_cell.storage = storage.id"
+	query := fmt.Sprintf("SELECT %s FROM bulk_transfer %s WHERE bulk_transfer.id=$1", cols, join)
+	batch.Queue(query, b.BulkTransfer.ID)
+	cols = "bulk_transfer_item.id, bulk_transfer_item.reagent_instance, bulk_transfer_item.from_storage_cell, bulk_transfer_item.moved, bulk_transfer_item.reason, reagent.id, reagent.name, storage_cell.number, storage.id, storage.name"
+	join = "JOIN reagent_instance ON bulk_transfer_item.reagent_instance = reagent_instance.id JOIN reagent ON reagent_instance.reagent = reagent.id LEFT JOIN storage_cell ON bulk_transfer_item.from_storage_cell = storage_cell.id LEFT JOIN storage ON storage_cell.storage = storage.id"
+	query = fmt.Sprintf(
+		"SELECT %s FROM bulk_transfer_item %s WHERE bulk_transfer_item.bulk_transfer=$1 ORDER BY bulk_transfer_item.moved DESC, reagent.name",
+		cols,
+		join,
+	)
+	batch.Queue(query, b.BulkTransfer.ID)
+}
+
+func (b *BulkTransferExtended) getResult(results pgx.BatchResults) error {
+	var storageUser pgtype.UUID
+	var storageUserName pgtype.Text
+	err := results.QueryRow().Scan(
+		&b.BulkTransfer.CreatedAt,
+		&b.BulkTransfer.UpdatedAt,
+		&storageUser,
+		&b.BulkTransfer.StorageCell,
+		&b.BulkTransfer.Moved,
+		&b.BulkTransfer.Skipped,
+		&storageUserName,
+		&b.StorageCell.Number,
+		&b.StorageCell.Label,
+		&b.Storage.ID,
+		&b.Storage.Name,
+	)
+	if err != nil {
+		rows, _ := results.Query()
+		rows.Close()
+		return err
+	}
+	b.BulkTransfer.StorageUser = storageUser.Bytes
+	b.StorageUser.ID = storageUser.Bytes
+	b.StorageUser.Name = storageUserName.String
+	b.StorageCell.ID = b.BulkTransfer.StorageCell
+	b.StorageCell.Storage = b.Storage.ID
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	next := rows.Next()
+	if !next {
+		return nil
+	}
+	for next {
+		var i BulkTransferItemExtended
+		var fromCell, fromStorage pgtype.UUID
+		var fromNumber pgtype.Int2
+		var fromName pgtype.Text
+		err = rows.Scan(
+			&i.BulkTransferItem.ID,
+			&i.BulkTransferItem.ReagentInstance,
+			&fromCell,
+			&i.BulkTransferItem.Moved,
+			&i.BulkTransferItem.Reason,
+			&i.Reagent.ID,
+			&i.Reagent.Name,
+			&fromNumber,
+			&fromStorage,
+			&fromName,
+		)
+		if err != nil {
+			return err
+		}
+		i.BulkTransferItem.BulkTransfer = b.BulkTransfer.ID
+		i.BulkTransferItem.FromStorageCell = fromCell.Bytes
+		i.StorageCell.ID = fromCell.Bytes
+		i.StorageCell.Number = fromNumber.Int16
+		i.Storage.ID = fromStorage.Bytes
+		i.Storage.Name = fromName.String
+		b.Items = append(b.Items, i)
+		next = rows.Next()
+	}
+	return nil
+}
+
+func (b *BulkTransferExtended) Get() (BatchOperation, BatchRead) {
+	return b.getQueue, b.getResult
+}
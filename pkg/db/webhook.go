@@ -0,0 +1,308 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type Webhook struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	URL       string    `json:"url"        validate:"url,lte=500" uaLocal:"адреса"`
+	Secret    string    `json:"secret"`
+	Events    []string  `json:"events"     validate:"required"    uaLocal:"події"`
+	Active    bool      `json:"active"`
+}
+
+type WebhooksRange struct {
+	Webhooks []Webhook
+	Limit    int
+	Offset   int
+}
+
+func (w Webhook) createQueue(
+	batch *pgx.Batch,
+) {
+	query := "INSERT INTO webhook(url, secret, events) VALUES($1, $2, $3) RETURNING id, created_at, updated_at, active"
+	batch.Queue(query, w.URL, w.Secret, w.Events)
+}
+
+func (w *Webhook) createResult(results pgx.BatchResults) error {
+	return results.QueryRow().Scan(&w.ID, &w.CreatedAt, &w.UpdatedAt, &w.Active)
+}
+
+func (w *Webhook) Create() (BatchOperation, BatchRead) {
+	return w.createQueue, w.createResult
+}
+
+func (w Webhook) getQueue(
+	batch *pgx.Batch,
+) {
+	query := "SELECT created_at, updated_at, url, secret, events, active FROM webhook WHERE id=$1"
+	batch.Queue(query, w.ID)
+}
+
+func (w *Webhook) getResult(results pgx.BatchResults) error {
+	return results.QueryRow().Scan(
+		&w.CreatedAt,
+		&w.UpdatedAt,
+		&w.URL,
+		&w.Secret,
+		&w.Events,
+		&w.Active,
+	)
+}
+
+func (w *Webhook) Get() (BatchOperation, BatchRead) {
+	return w.getQueue, w.getResult
+}
+
+func (w Webhook) updateQueue(
+	batch *pgx.Batch,
+) {
+	query := "UPDATE webhook SET url=$2, events=$3, active=$4 WHERE id=$1"
+	batch.Queue(query, w.ID, w.URL, w.Events, w.Active)
+}
+
+func (w *Webhook) updateResult(results pgx.BatchResults) error {
+	result, err := results.Exec()
+	affectedRows := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affectedRows != 1 {
+		if affectedRows == 0 {
+			return pgx.ErrNoRows
+		}
+	}
+	return nil
+}
+
+func (w *Webhook) Update() (BatchOperation, BatchRead) {
+	return w.updateQueue, w.updateResult
+}
+
+func (w WebhooksRange) getQueue(
+	batch *pgx.Batch,
+) {
+	query := "SELECT id, created_at, updated_at, url, secret, events, active FROM webhook ORDER BY created_at DESC LIMIT $1 OFFSET $2"
+	batch.Queue(query, w.Limit, w.Offset)
+}
+
+func (w *WebhooksRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	next := rows.Next()
+	if !next {
+		return nil
+	}
+	for next {
+		var webhook Webhook
+		err = rows.Scan(
+			&webhook.ID,
+			&webhook.CreatedAt,
+			&webhook.UpdatedAt,
+			&webhook.URL,
+			&webhook.Secret,
+			&webhook.Events,
+			&webhook.Active,
+		)
+		if err != nil {
+			return err
+		}
+		w.Webhooks = append(w.Webhooks, webhook)
+		next = rows.Next()
+	}
+	return nil
+}
+
+func (w *WebhooksRange) Get() (BatchOperation, BatchRead) {
+	return w.getQueue, w.getResult
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+type WebhookDelivery struct {
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Webhook       uuid.UUID `json:"webhook"`
+	Event         string    `json:"event"`
+	Payload       []byte    `json:"payload"`
+	Status        string    `json:"status"`
+	Attempts      int16     `json:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	ResponseCode  int16     `json:"response_code"`
+	Error         string    `json:"error"`
+}
+
+type WebhookDeliveryExtended struct {
+	WebhookDelivery WebhookDelivery
+	Webhook         Webhook
+}
+
+type WebhookDeliveriesRange struct {
+	WebhookDeliveries []WebhookDelivery
+	WebhookID         uuid.UUID
+	Limit             int
+}
+
+func (w WebhookDeliveriesRange) getQueue(
+	batch *pgx.Batch,
+) {
+	query := "SELECT id, created_at, updated_at, webhook, event, payload, status, attempts, next_attempt_at, response_code, error FROM webhook_delivery WHERE webhook=$1 ORDER BY created_at DESC LIMIT $2"
+	batch.Queue(query, w.WebhookID, w.Limit)
+}
+
+func (w *WebhookDeliveriesRange) getResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	next := rows.Next()
+	if !next {
+		return nil
+	}
+	for next {
+		var delivery WebhookDelivery
+		var responseCode pgtype.Int2
+		err = rows.Scan(
+			&delivery.ID,
+			&delivery.CreatedAt,
+			&delivery.UpdatedAt,
+			&delivery.Webhook,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&responseCode,
+			&delivery.Error,
+		)
+		if err != nil {
+			return err
+		}
+		delivery.ResponseCode = responseCode.Int16
+		w.WebhookDeliveries = append(w.WebhookDeliveries, delivery)
+		next = rows.Next()
+	}
+	return nil
+}
+
+func (w *WebhookDeliveriesRange) Get() (BatchOperation, BatchRead) {
+	return w.getQueue, w.getResult
+}
+
+type WebhookDueDeliveries struct {
+	WebhookDeliveriesExtended []WebhookDeliveryExtended
+	Limit                     int
+	Lease                     time.Duration
+}
+
+func (w WebhookDueDeliveries) claimQueue(
+	batch *pgx.Batch,
+) {
+	due := "SELECT id FROM webhook_delivery WHERE status='pending' AND next_attempt_at <= now() ORDER BY next_attempt_at LIMIT $1 FOR UPDATE SKIP LOCKED"
+	query := "UPDATE webhook_delivery SET next_attempt_at = now() + $2::interval FROM webhook WHERE webhook_delivery.webhook = webhook.id AND webhook_delivery.id IN (" + due + ") RETURNING webhook_delivery.id, webhook_delivery.event, webhook_delivery.payload, webhook_delivery.attempts, webhook.id, webhook.url, webhook.secret"
+	batch.Queue(query, w.Limit, w.Lease)
+}
+
+func (w *WebhookDueDeliveries) claimResult(results pgx.BatchResults) error {
+	rows, err := results.Query()
+	if err != nil {
+		return err
+	}
+	next := rows.Next()
+	if !next {
+		return nil
+	}
+	for next {
+		var d WebhookDeliveryExtended
+		err = rows.Scan(
+			&d.WebhookDelivery.ID,
+			&d.WebhookDelivery.Event,
+			&d.WebhookDelivery.Payload,
+			&d.WebhookDelivery.Attempts,
+			&d.Webhook.ID,
+			&d.Webhook.URL,
+			&d.Webhook.Secret,
+		)
+		if err != nil {
+			return err
+		}
+		d.WebhookDelivery.Webhook = d.Webhook.ID
+		w.WebhookDeliveriesExtended = append(w.WebhookDeliveriesExtended, d)
+		next = rows.Next()
+	}
+	return nil
+}
+
+func (w *WebhookDueDeliveries) Claim() (BatchOperation, BatchRead) {
+	return w.claimQueue, w.claimResult
+}
+
+func (w WebhookDelivery) updateQueue(
+	batch *pgx.Batch,
+) {
+	var responseCode pgtype.Int2
+	if w.ResponseCode != 0 {
+		responseCode = pgtype.Int2{Int16: w.ResponseCode, Valid: true}
+	}
+	query := "UPDATE webhook_delivery SET status=$2, attempts=$3, next_attempt_at=$4, response_code=$5, error=$6 WHERE id=$1"
+	batch.Queue(query, w.ID, w.Status, w.Attempts, w.NextAttemptAt, responseCode, w.Error)
+}
+
+func (w *WebhookDelivery) updateResult(results pgx.BatchResults) error {
+	_, err := results.Exec()
+	return err
+}
+
+func (w *WebhookDelivery) Update() (BatchOperation, BatchRead) {
+	return w.updateQueue, w.updateResult
+}
+
+type WebhookEvent struct {
+	Name    string
+	Payload []byte
+	Source  string
+	Rows    []uuid.UUID
+}
+
+var webhookSources = map[string]string{
+	"reagent":          "SELECT written.id, jsonb_build_object('id', written.id, 'name', written.name, 'formula', written.formula, 'cas', written.cas, 'hazards', written.hazards) AS data FROM reagent AS written",
+	"reagent_instance": "SELECT written.id, jsonb_build_object('id', written.id, 'reagent', written.reagent, 'storage', storage_cell.storage, 'cell', storage_cell.number, 'expires_at', written.expires_at, 'lot', written.lot) AS data FROM reagent_instance AS written LEFT JOIN storage_cell ON written.storage_cell = storage_cell.id",
+	"storage_user":     "SELECT written.id, jsonb_build_object('id', written.id, 'name', written.name, 'role', written.role) AS data FROM storage_user AS written",
+}
+
+func (w WebhookEvent) enqueueQueue(
+	batch *pgx.Batch,
+) {
+	written := fmt.Sprintf(
+		"%s WHERE written.xmin = pg_current_xact_id()::xid AND ($3::uuid[] IS NULL OR written.id = ANY($3::uuid[]))",
+		webhookSources[w.Source],
+	)
+	query := fmt.Sprintf(
+		"WITH written_row AS (%s) INSERT INTO webhook_delivery(webhook, event, payload) SELECT webhook.id, $1::varchar, jsonb_set($2::jsonb, '{data}', written_row.data || ($2::jsonb -> 'data')) FROM webhook CROSS JOIN written_row WHERE webhook.active AND $1::varchar = ANY(webhook.events)",
+		written,
+	)
+	batch.Queue(query, w.Name, w.Payload, w.Rows)
+}
+
+func (w *WebhookEvent) enqueueResult(results pgx.BatchResults) error {
+	_, err := results.Exec()
+	return err
+}
+
+func (w *WebhookEvent) Enqueue() (BatchOperation, BatchRead) {
+	return w.enqueueQueue, w.enqueueResult
+}
@@ -3,8 +3,10 @@ package env
 import (
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -21,6 +23,7 @@ type Config struct {
 	LogLevel     slog.Level
 	DatabaseUrl  string
 	AllowedHosts string
+	PublicURL    string
 	Jwt          Jwt
 }
 
@@ -79,6 +82,18 @@ func setAllowedHosts(logger *slog.Logger) {
 	Env.AllowedHosts = allowedHosts
 }
 
+func setPublicURL(logger *slog.Logger) {
+	envKey := "PUBLIC_URL"
+	publicURL := strings.TrimRight(os.Getenv(envKey), "/")
+	ensureValueExists(envKey, publicURL, logger)
+	parsed, err := url.Parse(publicURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		logger.Error(fmt.Sprintf("Invalid '%s'", envKey))
+		os.Exit(1)
+	}
+	Env.PublicURL = publicURL
+}
+
 func setJwt(logger *slog.Logger) {
 	secure, err := strconv.ParseBool(os.Getenv("JWT_SECURE_COOKIES"))
 	if err != nil {
@@ -112,5 +127,6 @@ func InitEnv() {
 	setLogLevel(logger)
 	setDatabaseUrl(logger)
 	setAllowedHosts(logger)
+	setPublicURL(logger)
 	setJwt(logger)
 }
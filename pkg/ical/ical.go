@@ -0,0 +1,100 @@
+package ical
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	dateFormat     = "20060102"
+	datetimeFormat = "20060102T150405Z"
+	lineLimit      = 75
+)
+
+type Event struct {
+	UID         string
+	Date        time.Time
+	Summary     string
+	Description string
+	URL         string
+}
+
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+var textEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func fold(line string) string {
+	if len(line) <= lineLimit {
+		return line
+	}
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > lineLimit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
+
+func writeLine(w io.Writer, format string, args ...any) error {
+	_, err := io.WriteString(w, fold(fmt.Sprintf(format, args...))+"\r\n")
+	return err
+}
+
+func (c Calendar) Write(w io.Writer) error {
+	stamp := time.Now().UTC().Format(datetimeFormat)
+	lines := [][]any{
+		{"BEGIN:VCALENDAR"},
+		{"VERSION:2.0"},
+		{"PRODID:-//ChemicalStorage//UK"},
+		{"CALSCALE:GREGORIAN"},
+		{"METHOD:PUBLISH"},
+		{"X-WR-CALNAME:%s", escapeText(c.Name)},
+	}
+	for _, event := range c.Events {
+		day := event.Date.Format(dateFormat)
+		nextDay := event.Date.AddDate(0, 0, 1).Format(dateFormat)
+		lines = append(lines,
+			[]any{"BEGIN:VEVENT"},
+			[]any{"UID:%s", event.UID},
+			[]any{"DTSTAMP:%s", stamp},
+			[]any{"DTSTART;VALUE=DATE:%s", day},
+			[]any{"DTEND;VALUE=DATE:%s", nextDay},
+			[]any{"SUMMARY:%s", escapeText(event.Summary)},
+			[]any{"DESCRIPTION:%s", escapeText(event.Description)},
+			[]any{"TRANSP:TRANSPARENT"},
+		)
+		if event.URL != "" {
+			lines = append(lines, []any{"URL:%s", event.URL})
+		}
+		lines = append(lines, []any{"END:VEVENT"})
+	}
+	lines = append(lines, []any{"END:VCALENDAR"})
+	for _, line := range lines {
+		err := writeLine(w, line[0].(string), line[1:]...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
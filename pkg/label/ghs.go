@@ -0,0 +1,96 @@
+package label
+
+import "image/color"
+
+type pictogramShape struct {
+	fill color.Color
+	path string
+}
+
+var pathArity = map[string]int{"M": 2, "L": 2, "C": 6, "Z": 0}
+
+var pictogramShapes = map[string][]pictogramShape{
+	"GHS01": {
+		{black, "M 52 27 L 54.5 36.4 L 60 33 L 58.5 39.3 L 69.8 38.2 L 60 44 L 65.7 48.5 L 58.5 48.7 L 61.5 57.1 L 54.5 51.6 L 52 61 L 49.5 51.6 L 44 55 L 45.5 48.7 L 34.2 49.8 L 44 44 L 38.3 39.5 L 45.5 39.3 L 42.5 30.9 L 49.5 36.4 Z"},
+		{white, "M 57 61 C 57 67.1 52.1 72 46 72 C 39.9 72 35 67.1 35 61 C 35 54.9 39.9 50 46 50 C 52.1 50 57 54.9 57 61 Z"},
+		{black, "M 55 61 C 55 66 51 70 46 70 C 41 70 37 66 37 61 C 37 56 41 52 46 52 C 51 52 55 56 55 61 Z"},
+		{black, "M 31 34 L 36 36 L 32 39 Z"},
+		{black, "M 70 50 L 74 53 L 69 55 Z"},
+		{black, "M 29 53 L 33 51 L 32 56 Z"},
+		{black, "M 62 66 L 66 64 L 65 69 Z"},
+		{black, "M 66 29 L 70 32 L 65 34 Z"},
+	},
+	"GHS02": {
+		{black, "M 40 68 C 30 60 33 48 40 40 C 40 46 42 49 45 50 C 43 40 46 30 54 24 C 52 34 58 40 60 46 C 61 42 61 38 60 36 C 68 44 70 58 62 68 Z"},
+		{white, "M 45 68 C 41 63 43 57 47 53 C 47 57 49 59 51 60 C 51 55 53 52 55 50 C 57 55 60 62 56 68 Z"},
+		{black, "M 37 71 L 63 71 L 63 74 L 37 74 Z"},
+	},
+	"GHS03": {
+		{black, "M 42.8 56.7 C 35.6 50.9 37.8 42.3 42.8 36.5 C 42.8 40.8 44.2 43 46.4 43.7 C 45 36.5 47.1 29.3 52.9 25 C 51.4 32.2 55.8 36.5 57.2 40.8 C 57.9 38 57.9 35.1 57.2 33.6 C 63 39.4 64.4 49.5 58.6 56.7 Z"},
+		{white, "M 62.5 59 C 62.5 65.9 56.9 71.5 50 71.5 C 43.1 71.5 37.5 65.9 37.5 59 C 37.5 52.1 43.1 46.5 50 46.5 C 56.9 46.5 62.5 52.1 62.5 59 Z"},
+		{black, "M 60.5 59 C 60.5 64.8 55.8 69.5 50 69.5 C 44.2 69.5 39.5 64.8 39.5 59 C 39.5 53.2 44.2 48.5 50 48.5 C 55.8 48.5 60.5 53.2 60.5 59 Z"},
+		{white, "M 55.5 59 C 55.5 62 53 64.5 50 64.5 C 47 64.5 44.5 62 44.5 59 C 44.5 56 47 53.5 50 53.5 C 53 53.5 55.5 56 55.5 59 Z"},
+		{black, "M 38 72 L 62 72 L 62 75 L 38 75 Z"},
+	},
+	"GHS04": {
+		{black, "M 28.8 56.3 L 60.8 44.6 L 65.5 57.8 L 33.6 69.4 Z"},
+		{black, "M 38.2 62.8 C 38.2 66.7 35.1 69.8 31.2 69.8 C 27.3 69.8 24.2 66.7 24.2 62.8 C 24.2 59 27.3 55.8 31.2 55.8 C 35.1 55.8 38.2 59 38.2 62.8 Z"},
+		{black, "M 61.8 47.5 L 65.5 46.1 L 68.3 53.6 L 64.5 55 Z"},
+		{black, "M 64.9 44.2 L 68.6 42.8 L 72.7 54.1 L 69 55.5 Z"},
+		{white, "M 35.5 57 L 56.1 49.5 L 56.8 51.4 L 36.2 58.9 Z"},
+	},
+	"GHS05": {
+		{black, "M 34.4 30.1 L 38.2 26.9 L 46.6 36.9 L 42.8 40.1 Z"},
+		{black, "M 61.8 26.9 L 65.6 30.1 L 57.2 40.1 L 53.4 36.9 Z"},
+		{black, "M 45 43 C 48 47 47 50 45 50 C 43 50 42 47 45 43 Z"},
+		{black, "M 55 43 C 58 47 57 50 55 50 C 53 50 52 47 55 43 Z"},
+		{black, "M 30 58 L 47 58 L 47 65.5 L 30 65.5 Z"},
+		{white, "M 47 58 C 47 59.7 45.7 61 44 61 C 42.3 61 41 59.7 41 58 C 41 56.3 42.3 55 44 55 C 45.7 55 47 56.3 47 58 Z"},
+		{black, "M 52 58 L 66 58 C 70 58 70 60.5 66 60.5 L 68 60.5 C 72 60.5 72 63 68 63 L 67 63 C 70.5 63 70.5 65.5 67 65.5 L 52 65.5 Z"},
+		{white, "M 58.5 58 C 58.5 59.4 57.4 60.5 56 60.5 C 54.6 60.5 53.5 59.4 53.5 58 C 53.5 56.6 54.6 55.5 56 55.5 C 57.4 55.5 58.5 56.6 58.5 58 Z"},
+		{black, "M 34 68 L 66 68 L 66 70.5 L 34 70.5 Z"},
+	},
+	"GHS06": {
+		{black, "M 36.2 59.8 L 62.2 71.8 L 63.8 68.2 L 37.8 56.2 Z"},
+		{black, "M 62.2 56.2 L 36.2 68.2 L 37.8 71.8 L 63.8 59.8 Z"},
+		{black, "M 38 56.5 C 38 57.9 36.9 59 35.5 59 C 34.1 59 33 57.9 33 56.5 C 33 55.1 34.1 54 35.5 54 C 36.9 54 38 55.1 38 56.5 Z"},
+		{black, "M 38 59.5 C 38 60.9 36.8 62 35.5 62 C 34.1 62 33 60.9 33 59.5 C 33 58.1 34.1 57 35.5 57 C 36.8 57 38 58.1 38 59.5 Z"},
+		{black, "M 67 56.5 C 67 57.9 65.9 59 64.5 59 C 63.1 59 62 57.9 62 56.5 C 62 55.1 63.1 54 64.5 54 C 65.9 54 67 55.1 67 56.5 Z"},
+		{black, "M 67 59.5 C 67 60.9 65.9 62 64.5 62 C 63.2 62 62 60.9 62 59.5 C 62 58.1 63.2 57 64.5 57 C 65.9 57 67 58.1 67 59.5 Z"},
+		{black, "M 38 68.5 C 38 69.9 36.9 71 35.5 71 C 34.1 71 33 69.9 33 68.5 C 33 67.1 34.1 66 35.5 66 C 36.9 66 38 67.1 38 68.5 Z"},
+		{black, "M 38 71.5 C 38 72.9 36.8 74 35.5 74 C 34.1 74 33 72.9 33 71.5 C 33 70.1 34.1 69 35.5 69 C 36.8 69 38 70.1 38 71.5 Z"},
+		{black, "M 67 68.5 C 67 69.9 65.9 71 64.5 71 C 63.1 71 62 69.9 62 68.5 C 62 67.1 63.1 66 64.5 66 C 65.9 66 67 67.1 67 68.5 Z"},
+		{black, "M 67 71.5 C 67 72.9 65.9 74 64.5 74 C 63.2 74 62 72.9 62 71.5 C 62 70.1 63.2 69 64.5 69 C 65.9 69 67 70.1 67 71.5 Z"},
+		{white, "M 65 42 C 65 50.3 58.3 57 50 57 C 41.7 57 35 50.3 35 42 C 35 33.7 41.7 27 50 27 C 58.3 27 65 33.7 65 42 Z"},
+		{white, "M 41 48 L 59 48 L 59 62 L 41 62 Z"},
+		{black, "M 63 42 C 63 49.2 57.2 55 50 55 C 42.8 55 37 49.2 37 42 C 37 34.8 42.8 29 50 29 C 57.2 29 63 34.8 63 42 Z"},
+		{black, "M 43 48 L 57 48 L 57 60 L 43 60 Z"},
+		{white, "M 48.5 43 C 48.5 44.9 46.9 46.5 45 46.5 C 43.1 46.5 41.5 44.9 41.5 43 C 41.5 41.1 43.1 39.5 45 39.5 C 46.9 39.5 48.5 41.1 48.5 43 Z"},
+		{white, "M 58.5 43 C 58.5 44.9 56.9 46.5 55 46.5 C 53.1 46.5 51.5 44.9 51.5 43 C 51.5 41.1 53.1 39.5 55 39.5 C 56.9 39.5 58.5 41.1 58.5 43 Z"},
+		{white, "M 50 47 L 48 51.5 L 52 51.5 Z"},
+		{white, "M 46 55.5 L 47 55.5 L 47 60 L 46 60 Z"},
+		{white, "M 49.5 55.5 L 50.5 55.5 L 50.5 60 L 49.5 60 Z"},
+		{white, "M 53 55.5 L 54 55.5 L 54 60 L 53 60 Z"},
+	},
+	"GHS07": {
+		{black, "M 45 29 C 45 22 55 22 55 29 L 52.5 60 L 47.5 60 Z"},
+		{black, "M 54.5 67 C 54.5 69.5 52.5 71.5 50 71.5 C 47.5 71.5 45.5 69.5 45.5 67 C 45.5 64.5 47.5 62.5 50 62.5 C 52.5 62.5 54.5 64.5 54.5 67 Z"},
+	},
+	"GHS08": {
+		{black, "M 57 34 C 57 37.9 53.9 41 50 41 C 46.1 41 43 37.9 43 34 C 43 30.1 46.1 27 50 27 C 53.9 27 57 30.1 57 34 Z"},
+		{black, "M 35 70 C 35 55 40 45 50 45 C 60 45 65 55 65 70 Z"},
+		{white, "M 50 51 L 51.2 56 L 55.7 53.3 L 53 57.8 L 58 59 L 53 60.2 L 55.7 64.7 L 51.2 62 L 50 67 L 48.8 62 L 44.3 64.7 L 47 60.2 L 42 59 L 47 57.8 L 44.3 53.3 L 48.8 56 Z"},
+	},
+	"GHS09": {
+		{black, "M 38 67 L 39.5 34 L 41.5 34 L 43 67 Z"},
+		{black, "M 41.2 47.3 L 32.7 39.3 L 31.3 40.7 L 39.8 48.7 Z"},
+		{black, "M 41.3 42.6 L 47.8 34.6 L 46.2 33.4 L 39.7 41.4 Z"},
+		{black, "M 41.2 55.7 L 48.7 47.7 L 47.3 46.3 L 39.8 54.3 Z"},
+		{black, "M 34.3 41.4 L 33.8 34.9 L 32.2 35.1 L 32.7 41.6 Z"},
+		{black, "M 45.5 36.8 L 50 36.8 L 50 35.2 L 45.5 35.2 Z"},
+		{black, "M 67.5 61 C 67.5 63.2 63.7 65 59 65 C 54.3 65 50.5 63.2 50.5 61 C 50.5 58.8 54.3 57 59 57 C 63.7 57 67.5 58.8 67.5 61 Z"},
+		{black, "M 66 61 L 72 57 L 72 65 Z"},
+		{white, "M 54.8 60.5 C 54.8 61.2 54.2 61.8 53.5 61.8 C 52.8 61.8 52.2 61.2 52.2 60.5 C 52.2 59.8 52.8 59.2 53.5 59.2 C 54.2 59.2 54.8 59.8 54.8 60.5 Z"},
+		{black, "M 32 66 L 70 66 L 70 68.5 L 32 68.5 Z"},
+	},
+}
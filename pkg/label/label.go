@@ -0,0 +1,370 @@
+package label
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/pdf"
+	"github.com/Kelvedler/ChemicalStorage/pkg/qr"
+)
+
+const (
+	padding      = 2.0
+	minFontScale = 0.6
+	maxFontSize  = 12.0
+	ellipsis     = "…"
+)
+
+var ErrNoLabels = errors.New("no labels to render")
+
+var (
+	black = color.RGBA{0, 0, 0, 255}
+	white = color.RGBA{255, 255, 255, 255}
+	red   = color.RGBA{230, 0, 0, 255}
+)
+
+type Layout struct {
+	Key        string
+	Name       string
+	PageWidth  float64
+	PageHeight float64
+	Columns    int
+	Rows       int
+	Width      float64
+	Height     float64
+	Left       float64
+	Top        float64
+	PitchX     float64
+	PitchY     float64
+}
+
+var Layouts = []Layout{
+	{"L7160", "Avery L7160 — 21 на аркуші, 63,5×38,1 мм", 210, 297, 3, 7, 63.5, 38.1, 7.2, 15.15, 66, 38.1},
+	{"L7159", "Avery L7159 — 24 на аркуші, 63,5×33,9 мм", 210, 297, 3, 8, 63.5, 33.9, 6.5, 12.9, 66, 33.9},
+	{"3474", "Avery 3474 — 24 на аркуші, 70×37 мм", 210, 297, 3, 8, 70, 37, 0, 0.5, 70, 37},
+	{"L7163", "Avery L7163 — 14 на аркуші, 99,1×38,1 мм", 210, 297, 2, 7, 99.1, 38.1, 4.65, 15.15, 101.6, 38.1},
+	{"L7165", "Avery L7165 — 8 на аркуші, 99,1×67,7 мм", 210, 297, 2, 4, 99.1, 67.7, 4.65, 13.1, 101.6, 67.7},
+}
+
+func LayoutByKey(key string) (Layout, bool) {
+	for _, layout := range Layouts {
+		if layout.Key == key {
+			return layout, true
+		}
+	}
+	return Layout{}, false
+}
+
+func (l Layout) PerPage() int {
+	return l.Columns * l.Rows
+}
+
+type Pictogram struct {
+	Code string
+	Name string
+}
+
+var Pictograms = []Pictogram{
+	{"GHS01", "Вибухові речовини"},
+	{"GHS02", "Займисті речовини"},
+	{"GHS03", "Окисники"},
+	{"GHS04", "Гази під тиском"},
+	{"GHS05", "Корозійні речовини"},
+	{"GHS06", "Гостра токсичність"},
+	{"GHS07", "Подразнювальні та шкідливі"},
+	{"GHS08", "Небезпека для здоров'я"},
+	{"GHS09", "Небезпека для довкілля"},
+}
+
+func PictogramName(code string) string {
+	for _, pictogram := range Pictograms {
+		if pictogram.Code == code {
+			return pictogram.Name
+		}
+	}
+	return code
+}
+
+func PictogramValid(code string) bool {
+	for _, pictogram := range Pictograms {
+		if pictogram.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+type Label struct {
+	Name     string
+	Formula  string
+	Expiry   string
+	Location string
+	Lot      string
+	Hazards  []string
+	URL      string
+	Code     string
+}
+
+type renderer struct {
+	page    *pdf.Page
+	regular *pdf.Font
+	bold    *pdf.Font
+}
+
+func Render(w io.Writer, layout Layout, labels []Label) error {
+	if len(labels) == 0 {
+		return ErrNoLabels
+	}
+	doc := pdf.New()
+	regular, err := doc.AddFont(goregular.TTF)
+	if err != nil {
+		return err
+	}
+	bold, err := doc.AddFont(gobold.TTF)
+	if err != nil {
+		return err
+	}
+	r := renderer{regular: regular, bold: bold}
+	for i, label := range labels {
+		position := i % layout.PerPage()
+		if position == 0 {
+			r.page = doc.AddPage(layout.PageWidth*pdf.PointsPerMM, layout.PageHeight*pdf.PointsPerMM)
+		}
+		column := position % layout.Columns
+		row := position / layout.Columns
+		x := layout.Left + float64(column)*layout.PitchX
+		top := layout.PageHeight - layout.Top - float64(row)*layout.PitchY
+		err = r.label(label, x, top-layout.Height, layout.Width, layout.Height)
+		if err != nil {
+			return err
+		}
+	}
+	return doc.Write(w)
+}
+
+func mm(value float64) float64 {
+	return value * pdf.PointsPerMM
+}
+
+func (r renderer) label(label Label, x, y, width, height float64) error {
+	code, err := qr.Encode(label.URL)
+	if err != nil {
+		return err
+	}
+	inner := height - 2*padding
+	codeHeight := 0.0
+	if label.Code != "" {
+		codeHeight = min(inner*0.15, 4)
+	}
+	qrSide := min(inner-codeHeight, (width-2*padding)*0.42)
+	qrX := x + width - padding - qrSide
+	qrY := y + codeHeight + (height-codeHeight-qrSide)/2
+	r.qr(code, qrX, qrY, qrSide)
+	if label.Code != "" {
+		codeSize := min(mm(codeHeight)*0.9, maxFontSize)
+		codeSize = min(codeSize, mm(qrSide)/r.bold.Width(label.Code, 1))
+		r.page.Text(
+			r.bold,
+			codeSize,
+			mm(qrX+qrSide/2)-r.bold.Width(label.Code, codeSize)/2,
+			mm(qrY)-codeSize*0.8,
+			label.Code,
+		)
+	}
+	textX := x + padding
+	textWidth := width - 3*padding - qrSide
+	textTop := y + height - padding
+	textHeight := inner
+	if len(label.Hazards) > 0 {
+		side := min(inner*0.3, textWidth/float64(len(label.Hazards)), 12)
+		textHeight -= side + padding/2
+		for i, hazard := range label.Hazards {
+			err = r.pictogram(hazard, textX+float64(i)*side, y+padding, side)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	lines := []string{label.Expiry, label.Location}
+	if label.Lot != "" {
+		lines = append(lines, label.Lot)
+	}
+	lineHeight := textHeight / float64(len(lines)+2)
+	size := min(mm(lineHeight)*0.75, maxFontSize)
+	baseline := textTop - lineHeight*0.8
+	r.page.SetFill(black)
+	r.fitText(r.bold, size, textX, baseline, textWidth, label.Name)
+	baseline -= lineHeight
+	r.formula(size, textX, baseline, textWidth, label.Formula)
+	for _, line := range lines {
+		baseline -= lineHeight
+		r.fitText(r.regular, size*0.9, textX, baseline, textWidth, line)
+	}
+	return nil
+}
+
+func (r renderer) fitText(font *pdf.Font, size, x, y, width float64, text string) {
+	limit := mm(width)
+	fitted := size
+	for fitted > size*minFontScale && font.Width(text, fitted) > limit {
+		fitted -= 0.25
+	}
+	if font.Width(text, fitted) > limit {
+		runes := []rune(text)
+		for len(runes) > 0 && font.Width(string(runes)+ellipsis, fitted) > limit {
+			runes = runes[:len(runes)-1]
+		}
+		text = strings.TrimSpace(string(runes)) + ellipsis
+	}
+	r.page.Text(font, fitted, mm(x), mm(y), text)
+}
+
+type formulaPart struct {
+	text      string
+	subscript bool
+}
+
+func formulaParts(formula string) (parts []formulaPart) {
+	var previous rune
+	for _, char := range formula {
+		subscript := false
+		if char >= '₀' && char <= '₉' {
+			char = '0' + char - '₀'
+			subscript = true
+		} else if unicode.IsDigit(char) {
+			subscript = unicode.IsLetter(previous) || previous == ')' || previous == ']' ||
+				(unicode.IsDigit(previous) && len(parts) > 0 && parts[len(parts)-1].subscript)
+		}
+		if len(parts) > 0 && parts[len(parts)-1].subscript == subscript {
+			parts[len(parts)-1].text += string(char)
+		} else {
+			parts = append(parts, formulaPart{text: string(char), subscript: subscript})
+		}
+		previous = char
+	}
+	return parts
+}
+
+func (r renderer) formula(size, x, y, width float64, formula string) {
+	parts := formulaParts(formula)
+	subscriptSize := size * 0.7
+	total := 0.0
+	for _, part := range parts {
+		if part.subscript {
+			total += r.regular.Width(part.text, subscriptSize)
+		} else {
+			total += r.regular.Width(part.text, size)
+		}
+	}
+	if total > mm(width) {
+		scale := max(mm(width)/total, minFontScale)
+		size *= scale
+		subscriptSize *= scale
+	}
+	cursor := mm(x)
+	for _, part := range parts {
+		if part.subscript {
+			r.page.Text(r.regular, subscriptSize, cursor, mm(y)-size*0.25, part.text)
+			cursor += r.regular.Width(part.text, subscriptSize)
+		} else {
+			r.page.Text(r.regular, size, cursor, mm(y), part.text)
+			cursor += r.regular.Width(part.text, size)
+		}
+	}
+}
+
+func (r renderer) qr(code *qr.Code, x, y, side float64) {
+	module := mm(side) / float64(code.Size)
+	r.page.SetFill(black)
+	for row := 0; row < code.Size; row++ {
+		for column := 0; column < code.Size; {
+			if !code.Dark(column, row) {
+				column++
+				continue
+			}
+			start := column
+			for column < code.Size && code.Dark(column, row) {
+				column++
+			}
+			r.page.Rect(
+				mm(x)+float64(start)*module,
+				mm(y+side)-float64(row+1)*module,
+				float64(column-start)*module,
+				module,
+			)
+		}
+	}
+}
+
+func (r renderer) pictogram(code string, x, y, side float64) error {
+	half := mm(side) / 2
+	centerX := mm(x) + half
+	centerY := mm(y) + half
+	inset := half * 0.08
+	r.page.SetFill(white)
+	r.page.SetStroke(red)
+	r.page.SetLineWidth(half * 0.12)
+	r.page.Polygon(
+		true,
+		true,
+		[2]float64{centerX, centerY + half - inset},
+		[2]float64{centerX + half - inset, centerY},
+		[2]float64{centerX, centerY - half + inset},
+		[2]float64{centerX - half + inset, centerY},
+	)
+	for _, shape := range pictogramShapes[code] {
+		r.page.SetFill(shape.fill)
+		err := r.path(shape.path, x, y, side)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r renderer) path(path string, x, y, side float64) error {
+	scale := mm(side) / 100
+	fields := strings.Fields(path)
+	values := make([]float64, 0, 6)
+	for i := 0; i < len(fields); {
+		command := fields[i]
+		i++
+		arity, ok := pathArity[command]
+		if !ok || i+arity > len(fields) {
+			return fmt.Errorf("invalid pictogram path %q", path)
+		}
+		values = values[:0]
+		for _, field := range fields[i : i+arity] {
+			value, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return fmt.Errorf("invalid pictogram path %q", path)
+			}
+			values = append(values, value*scale)
+		}
+		i += arity
+		for j := 0; j < len(values); j += 2 {
+			values[j] += mm(x)
+			values[j+1] = mm(y+side) - values[j+1]
+		}
+		switch command {
+		case "M":
+			r.page.MoveTo(values[0], values[1])
+		case "L":
+			r.page.LineTo(values[0], values[1])
+		case "C":
+			r.page.CurveTo(values[0], values[1], values[2], values[3], values[4], values[5])
+		case "Z":
+			r.page.ClosePath()
+		}
+	}
+	r.page.Fill()
+	return nil
+}
@@ -0,0 +1,53 @@
+package label
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/pdf"
+)
+
+func TestPictogramShapes(t *testing.T) {
+	for _, pictogram := range Pictograms {
+		if len(pictogramShapes[pictogram.Code]) == 0 {
+			t.Fatalf("%s has no shapes", pictogram.Code)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	var hazards []string
+	for _, pictogram := range Pictograms {
+		hazards = append(hazards, pictogram.Code)
+	}
+	labels := []Label{
+		{
+			Name:     "Пероксид водню",
+			Formula:  "H2O2",
+			Expiry:   "до 01.01.2027",
+			Location: "Шафа 1, комірка 2",
+			Hazards:  hazards,
+			URL:      "https://example.com/reagents/1/instances/2",
+			Code:     "AB12CD",
+		},
+	}
+	for _, layout := range Layouts {
+		var out bytes.Buffer
+		err := Render(&out, layout, labels)
+		if err != nil {
+			t.Fatalf("%s: %v", layout.Key, err)
+		}
+		if !bytes.HasPrefix(out.Bytes(), []byte("%PDF-")) {
+			t.Fatalf("%s: output is not a PDF", layout.Key)
+		}
+	}
+}
+
+func TestPathInvalid(t *testing.T) {
+	r := renderer{page: pdf.New().AddPage(10, 10)}
+	for _, path := range []string{"M 1 2 L 3", "M 1 x Z", "Q 1 2 3 4 Z"} {
+		if r.path(path, 0, 0, 10) == nil {
+			t.Fatalf("path %q: expected an error", path)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+)
+
+const (
+	InstanceChannel = "reagent_instance"
+	reconnectDelay  = 5 * time.Second
+	subscriberQueue = 16
+)
+
+type InstanceNotification struct {
+	ID      uuid.UUID `json:"id"`
+	Reagent uuid.UUID `json:"reagent"`
+	Op      string    `json:"op"`
+}
+
+type subscription struct {
+	reagentID uuid.UUID
+	ch        chan InstanceNotification
+}
+
+type Broker struct {
+	logger        *slog.Logger
+	mu            sync.Mutex
+	subscriptions map[*subscription]struct{}
+}
+
+func NewBroker(logger *slog.Logger) *Broker {
+	return &Broker{
+		logger:        logger.With(slog.String("process", "live")),
+		subscriptions: make(map[*subscription]struct{}),
+	}
+}
+
+func (b *Broker) Subscribe(reagentID uuid.UUID) (<-chan InstanceNotification, func()) {
+	sub := &subscription{
+		reagentID: reagentID,
+		ch:        make(chan InstanceNotification, subscriberQueue),
+	}
+	b.mu.Lock()
+	b.subscriptions[sub] = struct{}{}
+	b.mu.Unlock()
+	unsubscribe := func() {
+		b.mu.Lock()
+		delete(b.subscriptions, sub)
+		b.mu.Unlock()
+	}
+	return sub.ch, unsubscribe
+}
+
+func (b *Broker) publish(notification InstanceNotification) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscriptions {
+		if sub.reagentID != notification.Reagent {
+			continue
+		}
+		select {
+		case sub.ch <- notification:
+		default:
+			b.logger.Warn("Subscriber queue full, notification dropped")
+		}
+	}
+}
+
+func (b *Broker) Run(ctx context.Context) {
+	for {
+		err := b.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		b.logger.Error(err.Error())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (b *Broker) listen(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, env.Env.DatabaseUrl)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	_, err = conn.Exec(ctx, "LISTEN "+InstanceChannel)
+	if err != nil {
+		return err
+	}
+	for {
+		pgNotification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var notification InstanceNotification
+		err = json.Unmarshal([]byte(pgNotification.Payload), &notification)
+		if err != nil {
+			b.logger.Error(err.Error())
+			continue
+		}
+		b.publish(notification)
+	}
+}
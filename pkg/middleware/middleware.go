@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
@@ -14,13 +15,15 @@ import (
 	"github.com/Kelvedler/ChemicalStorage/pkg/common"
 	"github.com/Kelvedler/ChemicalStorage/pkg/db"
 	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/live"
 )
 
 type Settings struct {
-	AuthRequired bool
-	AuthExempt   bool
-	AllowedRoles []db.Role
-	XsrfExempt   bool
+	AuthRequired       bool
+	AuthExempt         bool
+	AllowedRoles       []db.Role
+	XsrfExempt         bool
+	UnconfirmedAllowed bool
 }
 
 var Unrestricted = Settings{
@@ -30,9 +33,25 @@ var Unrestricted = Settings{
 	XsrfExempt:   true,
 }
 
+var UnrestrictedUnconfirmed = Settings{
+	AuthRequired:       false,
+	AuthExempt:         false,
+	AllowedRoles:       AllowAll,
+	XsrfExempt:         true,
+	UnconfirmedAllowed: true,
+}
+
 var UnrestrictedNoAuth = Settings{
+	AuthRequired:       false,
+	AuthExempt:         false,
+	AllowedRoles:       AllowAll,
+	XsrfExempt:         true,
+	UnconfirmedAllowed: true,
+}
+
+var TokenAuthView = Settings{
 	AuthRequired: false,
-	AuthExempt:   false,
+	AuthExempt:   true,
 	AllowedRoles: AllowAll,
 	XsrfExempt:   true,
 }
@@ -44,6 +63,13 @@ var LecturerAssistantView = Settings{
 	XsrfExempt:   true,
 }
 
+var LecturerOnlyView = Settings{
+	AuthRequired: true,
+	AuthExempt:   false,
+	AllowedRoles: LecturerOnly,
+	XsrfExempt:   true,
+}
+
 var AssistantOnlyView = Settings{
 	AuthRequired: true,
 	AuthExempt:   false,
@@ -51,6 +77,13 @@ var AssistantOnlyView = Settings{
 	XsrfExempt:   true,
 }
 
+var AdminAssistantView = Settings{
+	AuthRequired: true,
+	AuthExempt:   false,
+	AllowedRoles: AdminAssistant,
+	XsrfExempt:   true,
+}
+
 var AdminOnlyView = Settings{
 	AuthRequired: true,
 	AuthExempt:   false,
@@ -58,6 +91,20 @@ var AdminOnlyView = Settings{
 	XsrfExempt:   true,
 }
 
+var LecturerAssistantAPI = Settings{
+	AuthRequired: true,
+	AuthExempt:   false,
+	AllowedRoles: LecturerAssistant,
+	XsrfExempt:   false,
+}
+
+var LecturerOnlyAPI = Settings{
+	AuthRequired: true,
+	AuthExempt:   false,
+	AllowedRoles: LecturerOnly,
+	XsrfExempt:   false,
+}
+
 var AssistantOnlyAPI = Settings{
 	AuthRequired: true,
 	AuthExempt:   false,
@@ -72,6 +119,13 @@ var AssistantOnlyNoXsrf = Settings{
 	XsrfExempt:   true,
 }
 
+var AdminAssistantAPI = Settings{
+	AuthRequired: true,
+	AuthExempt:   false,
+	AllowedRoles: AdminAssistant,
+	XsrfExempt:   false,
+}
+
 var AdminOnlyAPI = Settings{
 	AuthRequired: true,
 	AuthExempt:   false,
@@ -83,17 +137,20 @@ type HandlerContext struct {
 	dbpool   *pgxpool.Pool
 	sanitize *bluemonday.Policy
 	validate *validator.Validate
+	broker   *live.Broker
 }
 
 func NewHandlerContext(
 	dbpool *pgxpool.Pool,
 	sanitize *bluemonday.Policy,
 	validate *validator.Validate,
+	broker *live.Broker,
 ) *HandlerContext {
 	return &HandlerContext{
 		dbpool:   dbpool,
 		sanitize: sanitize,
 		validate: validate,
+		broker:   broker,
 	}
 }
 
@@ -106,6 +163,7 @@ type RequestContext struct {
 	DBpool   *pgxpool.Pool
 	Sanitize *bluemonday.Policy
 	Validate *validator.Validate
+	Broker   *live.Broker
 }
 
 func (settings Settings) Wrapper(
@@ -138,6 +196,15 @@ func (settings Settings) Wrapper(
 			}
 
 		}
+		if userRole == db.Unconfirmed && !settings.UnconfirmedAllowed {
+			logger.Info("Unconfirmed user")
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				common.ErrorResp(w, common.Forbidden)
+			} else {
+				http.Redirect(w, r, "/me", http.StatusSeeOther)
+			}
+			return
+		}
 		if !settings.XsrfExempt && !ValidateForXSRF(r, userID) {
 			common.ErrorResp(w, common.Forbidden)
 			logger.Warn("XSRF token invalid")
@@ -158,6 +225,7 @@ func (settings Settings) Wrapper(
 			DBpool:   handlerContext.dbpool,
 			Sanitize: handlerContext.sanitize,
 			Validate: handlerContext.validate,
+			Broker:   handlerContext.broker,
 		}
 		handler(rc, w, r, p)
 	}
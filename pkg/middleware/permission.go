@@ -10,7 +10,9 @@ var (
 	ErrorForbidden    = errors.New("Request forbidden")
 	AllowAll          = []db.Role{db.Admin, db.Lecturer, db.Assistant, db.Unconfirmed}
 	LecturerAssistant = []db.Role{db.Lecturer, db.Assistant}
+	LecturerOnly      = []db.Role{db.Lecturer}
 	AssistantOnly     = []db.Role{db.Assistant}
+	AdminAssistant    = []db.Role{db.Admin, db.Assistant}
 	AdminOnly         = []db.Role{db.Admin}
 )
 
@@ -0,0 +1,357 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image/color"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	PointsPerMM = 72 / 25.4
+	unitsPerEm  = 1000
+)
+
+type Font struct {
+	resource  string
+	data      []byte
+	sfnt      *sfnt.Font
+	buf       sfnt.Buffer
+	name      string
+	widths    map[sfnt.GlyphIndex]int
+	runes     map[sfnt.GlyphIndex]rune
+	bounds    [4]int
+	ascent    int
+	descent   int
+	capHeight int
+}
+
+type Page struct {
+	width   float64
+	height  float64
+	fonts   map[*Font]bool
+	content bytes.Buffer
+}
+
+type Document struct {
+	fonts []*Font
+	pages []*Page
+}
+
+func New() *Document {
+	return &Document{}
+}
+
+func (d *Document) AddFont(ttf []byte) (*Font, error) {
+	parsed, err := sfnt.Parse(ttf)
+	if err != nil {
+		return nil, err
+	}
+	f := &Font{
+		resource: fmt.Sprintf("F%d", len(d.fonts)+1),
+		data:     ttf,
+		sfnt:     parsed,
+		widths:   map[sfnt.GlyphIndex]int{},
+		runes:    map[sfnt.GlyphIndex]rune{},
+	}
+	f.name, err = parsed.Name(&f.buf, sfnt.NameIDPostScript)
+	if err != nil {
+		return nil, err
+	}
+	f.name = strings.ReplaceAll(f.name, " ", "")
+	ppem := fixed.I(unitsPerEm)
+	bounds, err := parsed.Bounds(&f.buf, ppem, font.HintingNone)
+	if err != nil {
+		return nil, err
+	}
+	f.bounds = [4]int{
+		bounds.Min.X.Round(),
+		-bounds.Max.Y.Round(),
+		bounds.Max.X.Round(),
+		-bounds.Min.Y.Round(),
+	}
+	metrics, err := parsed.Metrics(&f.buf, ppem, font.HintingNone)
+	if err != nil {
+		return nil, err
+	}
+	f.ascent = metrics.Ascent.Round()
+	f.descent = -metrics.Descent.Round()
+	f.capHeight = metrics.CapHeight.Round()
+	d.fonts = append(d.fonts, f)
+	return f, nil
+}
+
+func (f *Font) glyph(r rune) (sfnt.GlyphIndex, int) {
+	index, err := f.sfnt.GlyphIndex(&f.buf, r)
+	if err != nil || index == 0 {
+		index, _ = f.sfnt.GlyphIndex(&f.buf, '?')
+		r = '?'
+	}
+	if width, ok := f.widths[index]; ok {
+		return index, width
+	}
+	advance, err := f.sfnt.GlyphAdvance(&f.buf, index, fixed.I(unitsPerEm), font.HintingNone)
+	if err != nil {
+		advance = 0
+	}
+	f.widths[index] = advance.Round()
+	f.runes[index] = r
+	return index, f.widths[index]
+}
+
+func (f *Font) Width(text string, size float64) float64 {
+	total := 0
+	for _, r := range text {
+		_, width := f.glyph(r)
+		total += width
+	}
+	return float64(total) * size / unitsPerEm
+}
+
+func (d *Document) AddPage(width, height float64) *Page {
+	p := &Page{width: width, height: height, fonts: map[*Font]bool{}}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+func colorComponents(c color.Color) (float64, float64, float64) {
+	r, g, b, _ := c.RGBA()
+	return float64(r) / 0xffff, float64(g) / 0xffff, float64(b) / 0xffff
+}
+
+func (p *Page) SetFill(c color.Color) {
+	r, g, b := colorComponents(c)
+	fmt.Fprintf(&p.content, "%.3f %.3f %.3f rg\n", r, g, b)
+}
+
+func (p *Page) SetStroke(c color.Color) {
+	r, g, b := colorComponents(c)
+	fmt.Fprintf(&p.content, "%.3f %.3f %.3f RG\n", r, g, b)
+}
+
+func (p *Page) SetLineWidth(width float64) {
+	fmt.Fprintf(&p.content, "%.3f w\n", width)
+}
+
+func (p *Page) Rect(x, y, width, height float64) {
+	fmt.Fprintf(&p.content, "%.3f %.3f %.3f %.3f re f\n", x, y, width, height)
+}
+
+func (p *Page) Polygon(fill, stroke bool, points ...[2]float64) {
+	if len(points) == 0 {
+		return
+	}
+	for i, point := range points {
+		op := "l"
+		if i == 0 {
+			op = "m"
+		}
+		fmt.Fprintf(&p.content, "%.3f %.3f %s\n", point[0], point[1], op)
+	}
+	switch {
+	case fill && stroke:
+		p.content.WriteString("b\n")
+	case fill:
+		p.content.WriteString("f\n")
+	default:
+		p.content.WriteString("s\n")
+	}
+}
+
+func (p *Page) MoveTo(x, y float64) {
+	fmt.Fprintf(&p.content, "%.3f %.3f m\n", x, y)
+}
+
+func (p *Page) LineTo(x, y float64) {
+	fmt.Fprintf(&p.content, "%.3f %.3f l\n", x, y)
+}
+
+func (p *Page) CurveTo(x1, y1, x2, y2, x3, y3 float64) {
+	fmt.Fprintf(&p.content, "%.3f %.3f %.3f %.3f %.3f %.3f c\n", x1, y1, x2, y2, x3, y3)
+}
+
+func (p *Page) ClosePath() {
+	p.content.WriteString("h\n")
+}
+
+func (p *Page) Fill() {
+	p.content.WriteString("f\n")
+}
+
+func (p *Page) Text(f *Font, size, x, y float64, text string) {
+	p.fonts[f] = true
+	var hex strings.Builder
+	for _, r := range text {
+		index, _ := f.glyph(r)
+		fmt.Fprintf(&hex, "%04X", uint16(index))
+	}
+	fmt.Fprintf(
+		&p.content,
+		"BT /%s %.2f Tf %.3f %.3f Td <%s> Tj ET\n",
+		f.resource,
+		size,
+		x,
+		y,
+		hex.String(),
+	)
+}
+
+type writer struct {
+	w       io.Writer
+	offset  int
+	offsets []int
+	err     error
+}
+
+func (w *writer) printf(format string, args ...any) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, args...)
+	w.offset += n
+	w.err = err
+}
+
+func (w *writer) write(data []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(data)
+	w.offset += n
+	w.err = err
+}
+
+func (w *writer) object(id int, body string) {
+	w.offsets[id-1] = w.offset
+	w.printf("%d 0 obj\n%s\nendobj\n", id, body)
+}
+
+func (w *writer) stream(id int, dict string, data []byte) {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(data)
+	zw.Close()
+	w.offsets[id-1] = w.offset
+	w.printf(
+		"%d 0 obj\n<< /Length %d /Filter /FlateDecode %s>>\nstream\n",
+		id,
+		compressed.Len(),
+		dict,
+	)
+	w.write(compressed.Bytes())
+	w.printf("\nendstream\nendobj\n")
+}
+
+func (f *Font) glyphs() []sfnt.GlyphIndex {
+	glyphs := make([]sfnt.GlyphIndex, 0, len(f.widths))
+	for index := range f.widths {
+		glyphs = append(glyphs, index)
+	}
+	sort.Slice(glyphs, func(i, j int) bool { return glyphs[i] < glyphs[j] })
+	return glyphs
+}
+
+func (f *Font) toUnicode() []byte {
+	var b bytes.Buffer
+	b.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	b.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	b.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	b.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	glyphs := f.glyphs()
+	for start := 0; start < len(glyphs); start += 100 {
+		end := min(start+100, len(glyphs))
+		fmt.Fprintf(&b, "%d beginbfchar\n", end-start)
+		for _, index := range glyphs[start:end] {
+			fmt.Fprintf(&b, "<%04X> <", uint16(index))
+			for _, unit := range utf16.Encode([]rune{f.runes[index]}) {
+				fmt.Fprintf(&b, "%04X", unit)
+			}
+			b.WriteString(">\n")
+		}
+		b.WriteString("endbfchar\n")
+	}
+	b.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return b.Bytes()
+}
+
+func (d *Document) Write(w io.Writer) error {
+	const objectsPerFont = 5
+	fontBase := 3
+	pageBase := fontBase + len(d.fonts)*objectsPerFont
+	total := pageBase + len(d.pages)*2 - 1
+	out := &writer{w: w, offsets: make([]int, total)}
+	out.printf("%%PDF-1.7\n%%\xe2\xe3\xcf\xd3\n")
+	out.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+	var kids strings.Builder
+	for i := range d.pages {
+		fmt.Fprintf(&kids, "%d 0 R ", pageBase+i*2)
+	}
+	out.object(2, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids.String(), len(d.pages)))
+	fontIDs := map[*Font]int{}
+	for i, f := range d.fonts {
+		id := fontBase + i*objectsPerFont
+		fontIDs[f] = id
+		var widths strings.Builder
+		for _, index := range f.glyphs() {
+			fmt.Fprintf(&widths, "%d [%d] ", index, f.widths[index])
+		}
+		out.object(id, fmt.Sprintf(
+			"<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+			f.name,
+			id+1,
+			id+4,
+		))
+		out.object(id+1, fmt.Sprintf(
+			"<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /CIDToGIDMap /Identity /DW 0 /W [%s] >>",
+			f.name,
+			id+2,
+			widths.String(),
+		))
+		out.object(id+2, fmt.Sprintf(
+			"<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+			f.name,
+			f.bounds[0],
+			f.bounds[1],
+			f.bounds[2],
+			f.bounds[3],
+			f.ascent,
+			f.descent,
+			f.capHeight,
+			id+3,
+		))
+		out.stream(id+3, fmt.Sprintf("/Length1 %d ", len(f.data)), f.data)
+		out.stream(id+4, "", f.toUnicode())
+	}
+	for i, p := range d.pages {
+		id := pageBase + i*2
+		var fonts strings.Builder
+		for _, f := range d.fonts {
+			if p.fonts[f] {
+				fmt.Fprintf(&fonts, "/%s %d 0 R ", f.resource, fontIDs[f])
+			}
+		}
+		out.object(id, fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.3f %.3f] /Resources << /Font << %s>> >> /Contents %d 0 R >>",
+			p.width,
+			p.height,
+			fonts.String(),
+			id+1,
+		))
+		out.stream(id+1, "", p.content.Bytes())
+	}
+	xref := out.offset
+	out.printf("xref\n0 %d\n0000000000 65535 f \n", total+1)
+	for _, offset := range out.offsets {
+		out.printf("%010d 00000 n \n", offset)
+	}
+	out.printf("trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", total+1, xref)
+	return out.err
+}
@@ -0,0 +1,106 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image/color"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestDocumentWrite(t *testing.T) {
+	doc := New()
+	regular, err := doc.AddFont(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := doc.AddPage(100, 50)
+	page.SetFill(color.RGBA{230, 0, 0, 255})
+	page.Rect(1, 2, 3, 4)
+	page.MoveTo(10, 10)
+	page.LineTo(20, 10)
+	page.CurveTo(25, 10, 25, 20, 20, 20)
+	page.ClosePath()
+	page.Fill()
+	page.Text(regular, 10, 5, 5, "Ацетон")
+	doc.AddPage(100, 50)
+	var out bytes.Buffer
+	err = doc.Write(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := out.Bytes()
+	if !bytes.HasPrefix(data, []byte("%PDF-1.7\n")) {
+		t.Fatalf("missing header: %q", data[:16])
+	}
+	if !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatal("missing EOF marker")
+	}
+
+	trailer := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(data)
+	if trailer == nil {
+		t.Fatal("missing startxref")
+	}
+	xref, _ := strconv.Atoi(string(trailer[1]))
+	if !bytes.HasPrefix(data[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point to the xref table", xref)
+	}
+	lines := strings.Split(string(data[xref:]), "\n")
+	var count int
+	fmt.Sscanf(lines[1], "0 %d", &count)
+	if count != 3+5+2*2 {
+		t.Fatalf("xref size = %d, want %d", count, 3+5+2*2)
+	}
+	for id := 1; id < count; id++ {
+		offset, err := strconv.Atoi(lines[2+id][:10])
+		if err != nil {
+			t.Fatalf("xref entry %d: %v", id, err)
+		}
+		want := fmt.Sprintf("%d 0 obj\n", id)
+		if !bytes.HasPrefix(data[offset:], []byte(want)) {
+			t.Fatalf("xref entry %d points to %q", id, data[offset:offset+len(want)])
+		}
+	}
+
+	content := streamContent(t, data, 9)
+	for _, op := range []string{
+		"0.902 0.000 0.000 rg\n",
+		"1.000 2.000 3.000 4.000 re f\n",
+		"10.000 10.000 m\n20.000 10.000 l\n25.000 10.000 25.000 20.000 20.000 20.000 c\nh\nf\n",
+		"BT /F1 10.00 Tf 5.000 5.000 Td <",
+	} {
+		if !strings.Contains(content, op) {
+			t.Fatalf("page content %q does not contain %q", content, op)
+		}
+	}
+	toUnicode := streamContent(t, data, 7)
+	if !strings.Contains(toUnicode, "<0410>") {
+		t.Fatalf("ToUnicode map does not map Cyrillic glyphs: %q", toUnicode)
+	}
+}
+
+func streamContent(t *testing.T, data []byte, id int) string {
+	t.Helper()
+	start := bytes.Index(data, []byte(fmt.Sprintf("\n%d 0 obj\n", id)))
+	if start < 0 {
+		t.Fatalf("object %d not found", id)
+	}
+	object := data[start:]
+	begin := bytes.Index(object, []byte("stream\n")) + len("stream\n")
+	end := bytes.Index(object, []byte("\nendstream"))
+	reader, err := zlib.NewReader(bytes.NewReader(object[begin:end]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
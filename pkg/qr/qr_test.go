@@ -0,0 +1,250 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var formatM = []string{
+	"101010000010010",
+	"101000100100101",
+	"101111001111100",
+	"101101101001011",
+	"100010111111001",
+	"100000011001110",
+	"100111110010111",
+	"100101010100000",
+}
+
+func TestRSRemainderKnownVector(t *testing.T) {
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	got := rsRemainder(data, rsDivisor(10))
+	if !bytes.Equal(got, want) {
+		t.Fatalf("rsRemainder = %v, want %v", got, want)
+	}
+}
+
+func TestDataCodewordsKnownVector(t *testing.T) {
+	want := []byte{0x40, 0x14, 0x10, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC}
+	got := dataCodewords(versionsM[0], 1, []byte("A"))
+	if !bytes.Equal(got, want) {
+		t.Fatalf("dataCodewords = %x, want %x", got, want)
+	}
+}
+
+func TestEncodeFormatKnownVector(t *testing.T) {
+	code, err := Encode("HELLO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second := readFormat(code)
+	if first != second {
+		t.Fatalf("format copies differ: %s and %s", first, second)
+	}
+	if formatMask(first) < 0 {
+		t.Fatalf("format %s is not a level M format string", first)
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"A",
+		"https://chemical-storage.example.com/reagents/6f1c2a8e-4b7d-4c39-9e0a-1d2b3c4d5e6f/instances/0a9b8c7d-6e5f-4a3b-2c1d-0e9f8a7b6c5d",
+		"Пероксид водню 30%",
+		strings.Repeat("0123456789", 30),
+		strings.Repeat("x", 666),
+	} {
+		code, err := Encode(text)
+		if err != nil {
+			t.Fatalf("Encode(%d bytes): %v", len(text), err)
+		}
+		got, err := decode(code)
+		if err != nil {
+			t.Fatalf("decode(%d bytes): %v", len(text), err)
+		}
+		if got != text {
+			t.Fatalf("round trip = %q, want %q", got, text)
+		}
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	_, err := Encode(strings.Repeat("x", 667))
+	if !errors.Is(err, ErrTooLong) {
+		t.Fatalf("Encode error = %v, want ErrTooLong", err)
+	}
+}
+
+func readFormat(code *Code) (first, second string) {
+	var a, b [15]byte
+	for i := 0; i < 15; i++ {
+		a[i], b[i] = '0', '0'
+	}
+	mark := func(bits *[15]byte, i int, dark bool) {
+		if dark {
+			bits[14-i] = '1'
+		}
+	}
+	for i := 0; i <= 5; i++ {
+		mark(&a, i, code.Dark(8, i))
+	}
+	mark(&a, 6, code.Dark(8, 7))
+	mark(&a, 7, code.Dark(8, 8))
+	mark(&a, 8, code.Dark(7, 8))
+	for i := 9; i < 15; i++ {
+		mark(&a, i, code.Dark(14-i, 8))
+	}
+	for i := 0; i < 8; i++ {
+		mark(&b, i, code.Dark(code.Size-1-i, 8))
+	}
+	for i := 8; i < 15; i++ {
+		mark(&b, i, code.Dark(8, code.Size-15+i))
+	}
+	return string(a[:]), string(b[:])
+}
+
+func formatMask(format string) int {
+	for mask, known := range formatM {
+		if known == format {
+			return mask
+		}
+	}
+	return -1
+}
+
+func specMask(mask, row, col int) bool {
+	switch mask {
+	case 0:
+		return (row+col)%2 == 0
+	case 1:
+		return row%2 == 0
+	case 2:
+		return col%3 == 0
+	case 3:
+		return (row+col)%3 == 0
+	case 4:
+		return (row/2+col/3)%2 == 0
+	case 5:
+		return (row*col)%2+(row*col)%3 == 0
+	case 6:
+		return ((row*col)%2+(row*col)%3)%2 == 0
+	default:
+		return ((row+col)%2+(row*col)%3)%2 == 0
+	}
+}
+
+func syndromesZero(block []byte, ecLen int) bool {
+	var exp [512]byte
+	var log [256]int
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	for i := 255; i < 512; i++ {
+		exp[i] = exp[i-255]
+	}
+	for k := 0; k < ecLen; k++ {
+		var sum byte
+		for _, c := range block {
+			if sum != 0 {
+				sum = exp[log[sum]+k]
+			}
+			sum ^= c
+		}
+		if sum != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func decode(code *Code) (string, error) {
+	first, _ := readFormat(code)
+	mask := formatMask(first)
+	if mask < 0 {
+		return "", errors.New("unknown format")
+	}
+	version := (code.Size - 17) / 4
+	spec := versionsM[version-1]
+	function := newMatrix(code.Size)
+	function.drawFunctionPatterns(version, spec)
+	var bits []bool
+	for right := code.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < code.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = code.Size - 1 - vert
+				}
+				if !function.function[y][x] {
+					bits = append(bits, code.Dark(x, y) != specMask(mask, y, x))
+				}
+			}
+		}
+	}
+	blocksCount := spec.group1 + spec.group2
+	total := spec.dataCodewords() + blocksCount*spec.ecPerBlock
+	raw := make([]byte, total)
+	for i := 0; i < total*8; i++ {
+		if bits[i] {
+			raw[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	blockData := make([][]byte, blocksCount)
+	pos := 0
+	for i := 0; i < max(spec.group1Data, spec.group2Data); i++ {
+		for b := range blockData {
+			length := spec.group1Data
+			if b >= spec.group1 {
+				length = spec.group2Data
+			}
+			if i < length {
+				blockData[b] = append(blockData[b], raw[pos])
+				pos++
+			}
+		}
+	}
+	var data []byte
+	for b := range blockData {
+		block := append([]byte{}, blockData[b]...)
+		for i := 0; i < spec.ecPerBlock; i++ {
+			block = append(block, raw[pos+i*blocksCount+b])
+		}
+		if !syndromesZero(block, spec.ecPerBlock) {
+			return "", errors.New("error correction mismatch")
+		}
+		data = append(data, blockData[b]...)
+	}
+	read := func(offset, length int) int {
+		value := 0
+		for i := offset; i < offset+length; i++ {
+			value = value<<1 | int(data[i/8]>>(7-i%8)&1)
+		}
+		return value
+	}
+	if read(0, 4) != 0b0100 {
+		return "", errors.New("not byte mode")
+	}
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	count := read(4, countBits)
+	text := make([]byte, count)
+	for i := range text {
+		text[i] = byte(read(4+countBits+8*i, 8))
+	}
+	return string(text), nil
+}
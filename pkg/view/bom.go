@@ -0,0 +1,658 @@
+package view
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/xsrftoken"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+)
+
+const (
+	bomMaxLines      = 100
+	bomMaxQuery      = 300
+	bomMaxCandidates = 5
+)
+
+const (
+	bomResolved    = "resolved"
+	bomApproximate = "approximate"
+	bomAmbiguous   = "ambiguous"
+	bomMissing     = "missing"
+)
+
+const (
+	bomRankFuzzy = iota + 1
+	bomRankPartial
+	bomRankExact
+)
+
+var (
+	bomBulletPattern = regexp.MustCompile(`^(?:[0-9]{1,3}[.)]|[-*•])\s+`)
+	bomAmountPattern = regexp.MustCompile(
+		`^(.*?)(?:\s*[;\t,]\s*([0-9]{1,3})\s*(?:шт\.?|pcs\.?)?|(?:\s+[xх×]|\s*×)\s*([0-9]{1,3})|\s+([0-9]{1,3})\s*(?:шт\.?|pcs\.?))$`,
+	)
+	subscriptDigits = strings.NewReplacer(
+		"₀", "0", "₁", "1", "₂", "2", "₃", "3", "₄", "4",
+		"₅", "5", "₆", "6", "₇", "7", "₈", "8", "₉", "9",
+	)
+)
+
+type bomEntry struct {
+	Query  string
+	Amount int
+}
+
+type bomMatch struct {
+	Reagent  db.Reagent
+	Rank     int
+	Distance int
+}
+
+type bomLineData struct {
+	Position   int
+	Query      string
+	Amount     int
+	Status     string
+	Reagent    db.Reagent
+	Candidates []db.Reagent
+	Available  int
+	Shortfall  int
+	Locations  []string
+}
+
+type bomReportData struct {
+	Lines      []bomLineData
+	Resolved   int
+	Unresolved int
+	Short      int
+	Err        string
+}
+
+type bomChecksData struct {
+	Caller      db.StorageUser
+	ChecksSlice []db.BomCheckExtended
+	MaxLines    int
+	CheckXsrf   string
+	PostXsrf    string
+}
+
+type bomCheckData struct {
+	Caller     db.StorageUser
+	Check      db.BomCheckExtended
+	Report     bomReportData
+	DeleteXsrf string
+}
+
+type bomInput struct {
+	Title   string            `json:"title"`
+	Text    string            `json:"text"`
+	Choices map[string]string `json:"choices"`
+}
+
+func getBomPostXsrf(userID uuid.UUID) string {
+	return xsrftoken.Generate(env.Env.SecretKey, userID.String(), "/api/v1/bom")
+}
+
+func getBomXsrf(userID uuid.UUID, action string) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/bom/%s", action),
+	)
+}
+
+func parseBomText(text string) (entries []bomEntry) {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = bomBulletPattern.ReplaceAllString(line, "")
+		entry := bomEntry{Query: line, Amount: 1}
+		if match := bomAmountPattern.FindStringSubmatch(line); match != nil {
+			entry.Query = strings.TrimSpace(match[1])
+			entry.Amount, _ = strconv.Atoi(match[2] + match[3] + match[4])
+			entry.Amount = max(entry.Amount, 1)
+		}
+		if query := []rune(entry.Query); len(query) > bomMaxQuery {
+			entry.Query = string(query[:bomMaxQuery])
+		}
+		if entry.Query != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func normalizeTerm(term string) string {
+	var normalized strings.Builder
+	for _, r := range strings.ToLower(subscriptDigits.Replace(term)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			normalized.WriteRune(r)
+		}
+	}
+	return normalized.String()
+}
+
+func levenshtein(a, b string) int {
+	source, target := []rune(a), []rune(b)
+	previous := make([]int, len(target)+1)
+	current := make([]int, len(target)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(source); i++ {
+		current[0] = i
+		for j := 1; j <= len(target); j++ {
+			cost := 1
+			if source[i-1] == target[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(target)]
+}
+
+func matchReagent(reagent db.Reagent, term string) (bomMatch, bool) {
+	match := bomMatch{Reagent: reagent}
+	name := normalizeTerm(reagent.Name)
+	formula := normalizeTerm(reagent.Formula)
+	cas := normalizeTerm(reagent.Cas)
+	termLen := len([]rune(term))
+	switch {
+	case termLen == 0:
+		return match, false
+	case term == name || term == formula || (cas != "" && term == cas):
+		match.Rank = bomRankExact
+	case termLen >= 3 && strings.Contains(name, term):
+		match.Rank = bomRankPartial
+		match.Distance = len([]rune(name)) - termLen
+	case termLen >= 4:
+		distance := levenshtein(term, name)
+		if distance > termLen/4 {
+			distance = levenshtein(term, formula)
+			if distance > 1 {
+				return match, false
+			}
+		}
+		match.Rank = bomRankFuzzy
+		match.Distance = distance
+	default:
+		return match, false
+	}
+	return match, true
+}
+
+func resolveBomEntry(catalog []db.Reagent, entry bomEntry, choice string) bomLineData {
+	line := bomLineData{Query: entry.Query, Amount: entry.Amount, Status: bomMissing}
+	term := normalizeTerm(entry.Query)
+	var matches []bomMatch
+	for _, reagent := range catalog {
+		if match, ok := matchReagent(reagent, term); ok {
+			matches = append(matches, match)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Rank != matches[j].Rank {
+			return matches[i].Rank > matches[j].Rank
+		}
+		return matches[i].Distance < matches[j].Distance
+	})
+	for i, match := range matches {
+		if i == bomMaxCandidates {
+			break
+		}
+		line.Candidates = append(line.Candidates, match.Reagent)
+	}
+	if chosenID, err := uuid.Parse(choice); err == nil {
+		for _, reagent := range catalog {
+			if reagent.ID == chosenID {
+				line.Status = bomResolved
+				line.Reagent = reagent
+				if !containsReagent(line.Candidates, chosenID) {
+					line.Candidates = append([]db.Reagent{reagent}, line.Candidates...)
+				}
+				return line
+			}
+		}
+	}
+	switch {
+	case len(matches) == 0:
+	case matches[0].Rank == bomRankExact && (len(matches) == 1 || matches[1].Rank < bomRankExact):
+		line.Status = bomResolved
+		line.Reagent = matches[0].Reagent
+	case len(matches) == 1:
+		line.Status = bomApproximate
+		line.Reagent = matches[0].Reagent
+	default:
+		line.Status = bomAmbiguous
+	}
+	return line
+}
+
+func containsReagent(reagents []db.Reagent, reagentID uuid.UUID) bool {
+	for _, reagent := range reagents {
+		if reagent.ID == reagentID {
+			return true
+		}
+	}
+	return false
+}
+
+func (line bomLineData) Matched() bool {
+	return line.Status == bomResolved || line.Status == bomApproximate
+}
+
+func resolvedReagentIDs(lines []bomLineData) (ids []uuid.UUID) {
+	for _, line := range lines {
+		if line.Matched() && !containsID(ids, line.Reagent.ID) {
+			ids = append(ids, line.Reagent.ID)
+		}
+	}
+	return ids
+}
+
+func containsID(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, existing := range ids {
+		if existing == id {
+			return true
+		}
+	}
+	return false
+}
+
+func locationText(location db.ReagentLocation) string {
+	if location.Storage.Name == "" {
+		return fmt.Sprintf("Не розміщено (%d шт.)", location.Instances)
+	}
+	return fmt.Sprintf(
+		"%s, відділ %d (%d шт.)",
+		location.Storage.Name,
+		location.StorageCell.Number,
+		location.Instances,
+	)
+}
+
+func newBomReport(lines []bomLineData, locations []db.ReagentLocation) (report bomReportData) {
+	claimed := make(map[uuid.UUID]int)
+	for i, line := range lines {
+		line.Position = i + 1
+		if !line.Matched() {
+			report.Unresolved++
+			report.Lines = append(report.Lines, line)
+			continue
+		}
+		report.Resolved++
+		for _, location := range locations {
+			if location.Reagent == line.Reagent.ID {
+				line.Available += location.Instances
+				line.Locations = append(line.Locations, locationText(location))
+			}
+		}
+		left := max(line.Available-claimed[line.Reagent.ID], 0)
+		line.Shortfall = max(line.Amount-left, 0)
+		claimed[line.Reagent.ID] += line.Amount
+		if line.Shortfall > 0 {
+			report.Short++
+		}
+		report.Lines = append(report.Lines, line)
+	}
+	return report
+}
+
+func resolveBom(
+	rc *middleware.RequestContext,
+	r *http.Request,
+	input bomInput,
+) (lines []bomLineData, locations []db.ReagentLocation, err error) {
+	catalog := db.ReagentCatalog{}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{catalog.Get})
+	if errs[0] != nil {
+		return nil, nil, errs[0]
+	}
+	for _, entry := range parseBomText(input.Text) {
+		lines = append(lines, resolveBomEntry(catalog.Reagents, entry, input.Choices[entry.Query]))
+	}
+	reagentIDs := resolvedReagentIDs(lines)
+	if len(reagentIDs) == 0 {
+		return lines, nil, nil
+	}
+	locationsRange := db.ReagentLocationsRange{ReagentIDs: reagentIDs}
+	errs = db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{locationsRange.Get})
+	return lines, locationsRange.Locations, errs[0]
+}
+
+func bindBomInput(rc *middleware.RequestContext, r *http.Request) (input bomInput, errMsg string, err error) {
+	err = common.BindJSON(r, &input)
+	if err != nil {
+		return input, "", err
+	}
+	input.Title = strings.TrimSpace(rc.Sanitize.Sanitize(input.Title))
+	input.Text = rc.Sanitize.Sanitize(input.Text)
+	entries := parseBomText(input.Text)
+	switch {
+	case len(entries) == 0:
+		errMsg = "Список порожній"
+	case len(entries) > bomMaxLines:
+		errMsg = fmt.Sprintf("Список надто довгий (%d), максимум - %d рядків", len(entries), bomMaxLines)
+	}
+	return input, errMsg, nil
+}
+
+func bomReport(w http.ResponseWriter, report bomReportData) {
+	tmpl := template.Must(template.ParseFiles("templates/bom-assets.html")).
+		Lookup("bom-report")
+	tmpl.Execute(w, report)
+}
+
+func bomError(w http.ResponseWriter, err string) {
+	tmpl := template.Must(template.ParseFiles("templates/bom-assets.html")).
+		Lookup("bom-error")
+	tmpl.Execute(w, bomReportData{Err: err})
+}
+
+func BomChecks(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	caller := db.StorageUser{ID: rc.UserID}
+	checksRange := db.BomChecksRange{StorageUserID: rc.UserID}
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{caller.GetByID, checksRange.Get},
+	)
+	if errs[0] != nil {
+		rc.Logger.Info("Unauthorized")
+		common.ErrorResp(w, common.Unauthorized)
+		return
+	}
+	if errs[1] != nil {
+		rc.Logger.Error(errs[1].Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	data := bomChecksData{
+		Caller:      caller,
+		ChecksSlice: checksRange.Checks,
+		MaxLines:    bomMaxLines,
+		CheckXsrf:   getBomXsrf(rc.UserID, "check"),
+		PostXsrf:    getBomPostXsrf(rc.UserID),
+	}
+	tmpl := template.Must(
+		template.ParseFiles(
+			"templates/bom-checks.html",
+			"templates/bom-assets.html",
+			"templates/base.html",
+		),
+	)
+	tmpl.Execute(w, data)
+}
+
+func BomCheckAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	input, errMsg, err := bindBomInput(rc, r)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	if errMsg != "" {
+		rc.Logger.Info(errMsg)
+		bomReport(w, bomReportData{Err: errMsg})
+		return
+	}
+	lines, locations, err := resolveBom(rc, r, input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	bomReport(w, newBomReport(lines, locations))
+}
+
+func BomCreateAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	input, errMsg, err := bindBomInput(rc, r)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	if errMsg != "" {
+		rc.Logger.Info(errMsg)
+		bomError(w, errMsg)
+		return
+	}
+	check := db.BomCheckExtended{
+		BomCheck: db.BomCheck{StorageUser: rc.UserID, Title: input.Title},
+	}
+	err = rc.Validate.Struct(check.BomCheck)
+	if err != nil {
+		err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), check.BomCheck)
+		rc.Logger.Info(err.Error())
+		bomError(w, err.(common.ValidationError).Map()["TitleErr"])
+		return
+	}
+	lines, _, err := resolveBom(rc, r, input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	for _, line := range lines {
+		bomLine := db.BomLine{Query: line.Query, Amount: line.Amount, Status: line.Status}
+		if line.Matched() {
+			bomLine.Reagent = line.Reagent.ID
+		}
+		check.Lines = append(check.Lines, db.BomLineExtended{BomLine: bomLine})
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{check.Create})
+	if errs[0] != nil {
+		rc.Logger.Error(errs[0].Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	w.Header().Set("HX-Redirect", fmt.Sprintf("/bom/%s", check.BomCheck.ID))
+}
+
+func bomCheckFromParams(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+	batchSets ...db.BatchSet,
+) (db.BomCheckExtended, bomReportData, bool) {
+	bomID, err := uuid.Parse(params.ByName("bomID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return db.BomCheckExtended{}, bomReportData{}, false
+	}
+	check := db.BomCheckExtended{
+		BomCheck: db.BomCheck{ID: bomID, StorageUser: rc.UserID},
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, append([]db.BatchSet{check.Get}, batchSets...))
+	for _, err := range errs {
+		if err != nil {
+			errStruct := db.ErrorAsStruct(err)
+			switch errStruct.(type) {
+			case db.DoesNotExist:
+				rc.Logger.Info("Not found")
+				common.ErrorResp(w, common.NotFound)
+			default:
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return db.BomCheckExtended{}, bomReportData{}, false
+		}
+	}
+	var lines []bomLineData
+	for _, line := range check.Lines {
+		data := bomLineData{
+			Query:   line.BomLine.Query,
+			Amount:  line.BomLine.Amount,
+			Status:  line.BomLine.Status,
+			Reagent: line.Reagent,
+		}
+		if line.BomLine.Reagent == uuid.Nil && data.Matched() {
+			data.Status = bomMissing
+		}
+		lines = append(lines, data)
+	}
+	locationsRange := db.ReagentLocationsRange{ReagentIDs: resolvedReagentIDs(lines)}
+	if len(locationsRange.ReagentIDs) > 0 {
+		errs = db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{locationsRange.Get})
+		if errs[0] != nil {
+			rc.Logger.Error(errs[0].Error())
+			common.ErrorResp(w, common.Internal)
+			return db.BomCheckExtended{}, bomReportData{}, false
+		}
+	}
+	return check, newBomReport(lines, locationsRange.Locations), true
+}
+
+func BomCheck(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	caller := db.StorageUser{ID: rc.UserID}
+	check, report, ok := bomCheckFromParams(rc, w, r, params, caller.GetByID)
+	if !ok {
+		return
+	}
+	data := bomCheckData{
+		Caller:     caller,
+		Check:      check,
+		Report:     report,
+		DeleteXsrf: getBomXsrf(rc.UserID, check.BomCheck.ID.String()),
+	}
+	tmpl := template.Must(
+		template.ParseFiles(
+			"templates/bom-check.html",
+			"templates/bom-assets.html",
+			"templates/base.html",
+		),
+	)
+	tmpl.Execute(w, data)
+}
+
+func bomStatusText(line bomLineData) string {
+	switch line.Status {
+	case bomResolved:
+		return "Знайдено"
+	case bomApproximate:
+		return "Неточний збіг"
+	case bomAmbiguous:
+		return "Потребує уточнення"
+	default:
+		return "Не знайдено"
+	}
+}
+
+func BomExport(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	check, report, ok := bomCheckFromParams(rc, w, r, params)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set(
+		"Content-Disposition",
+		mime.FormatMediaType("attachment", map[string]string{"filename": check.BomCheck.Title + ".csv"}),
+	)
+	w.Write([]byte("\ufeff"))
+	writer := csv.NewWriter(w)
+	writer.Write([]string{
+		"№",
+		"Запит",
+		"Статус",
+		"Реагент",
+		"Формула",
+		"CAS",
+		"Потрібно",
+		"Доступно",
+		"Нестача",
+		"Розташування",
+	})
+	for _, line := range report.Lines {
+		writer.Write([]string{
+			strconv.Itoa(line.Position),
+			line.Query,
+			bomStatusText(line),
+			line.Reagent.Name,
+			line.Reagent.Formula,
+			line.Reagent.Cas,
+			strconv.Itoa(line.Amount),
+			strconv.Itoa(line.Available),
+			strconv.Itoa(line.Shortfall),
+			strings.Join(line.Locations, "; "),
+		})
+	}
+	writer.Flush()
+}
+
+func BomDeleteAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	bomID, err := uuid.Parse(params.ByName("bomID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	check := db.BomCheckExtended{
+		BomCheck: db.BomCheck{ID: bomID, StorageUser: rc.UserID},
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{check.Delete})
+	if errs[0] != nil {
+		errStruct := db.ErrorAsStruct(errs[0])
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Not found")
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(errs[0].Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	w.Header().Set("HX-Redirect", "/bom/")
+}
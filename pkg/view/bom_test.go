@@ -0,0 +1,48 @@
+package view
+
+import "testing"
+
+func TestParseBomText(t *testing.T) {
+	for _, test := range []struct {
+		line   string
+		query  string
+		amount int
+	}{
+		{"Етанол; 2", "Етанол", 2},
+		{"7647-14-5; 3", "7647-14-5", 3},
+		{"NaCl\t2", "NaCl", 2},
+		{"KCl, 4pcs", "KCl", 4},
+		{"NaCl 3 шт", "NaCl", 3},
+		{"Ethanol x 5", "Ethanol", 5},
+		{"Ethanol ×5", "Ethanol", 5},
+		{"- Ацетон; 2", "Ацетон", 2},
+		{"1. Ацетон", "Ацетон", 1},
+		{"Ацетон; 0", "Ацетон", 1},
+		{"Hydrogen peroxide 30", "Hydrogen peroxide 30", 1},
+		{"Polyethylene glycol 400", "Polyethylene glycol 400", 1},
+		{"Triton X-100", "Triton X-100", 1},
+		{"CuSO4·5H2O", "CuSO4·5H2O", 1},
+		{"Na2CO3·10H2O", "Na2CO3·10H2O", 1},
+		{"Na2SO4x10", "Na2SO4x10", 1},
+		{"C6H12O6", "C6H12O6", 1},
+		{"H₂SO₄", "H₂SO₄", 1},
+	} {
+		entries := parseBomText(test.line)
+		if len(entries) != 1 {
+			t.Fatalf("parseBomText(%q) = %v, want one entry", test.line, entries)
+		}
+		if entries[0].Query != test.query || entries[0].Amount != test.amount {
+			t.Errorf(
+				"parseBomText(%q) = %q × %d, want %q × %d",
+				test.line, entries[0].Query, entries[0].Amount, test.query, test.amount,
+			)
+		}
+	}
+}
+
+func TestParseBomTextSkipsBlankAndComments(t *testing.T) {
+	entries := parseBomText("# список\n\n  \nЕтанол; 2\n")
+	if len(entries) != 1 || entries[0].Query != "Етанол" {
+		t.Fatalf("parseBomText = %v, want only Етанол", entries)
+	}
+}
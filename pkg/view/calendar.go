@@ -0,0 +1,232 @@
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/xsrftoken"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/ical"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+)
+
+const (
+	calendarPastDays   = 30
+	calendarFutureDays = 365
+)
+
+type calendarData struct {
+	FeedURL   string
+	TokenXsrf string
+}
+
+func getCalendarTokenXsrf(userID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		"/api/v1/me/calendar-token",
+	)
+}
+
+func newCalendarData(user db.StorageUser) calendarData {
+	data := calendarData{TokenXsrf: getCalendarTokenXsrf(user.ID)}
+	if user.CalendarToken != "" {
+		data.FeedURL = fmt.Sprintf("%s/calendar/%s.ics", env.Env.PublicURL, user.CalendarToken)
+	}
+	return data
+}
+
+func expiryEvents(
+	baseURL string,
+	instances []db.ReagentInstanceExtended,
+) (events []ical.Event) {
+	var lines []string
+	for i, inst := range instances {
+		location := "без місця зберігання"
+		if inst.Storage.Name != "" {
+			location = fmt.Sprintf("склад %s, відділ %d", inst.Storage.Name, inst.StorageCell.Number)
+		}
+		lines = append(lines, fmt.Sprintf(
+			"%s (%s) - %s",
+			inst.Reagent.Name,
+			inst.Reagent.Formula,
+			location,
+		))
+		day := inst.ReagentInstance.ExpiresAt
+		last := i == len(instances)-1
+		if last || !instances[i+1].ReagentInstance.ExpiresAt.Equal(day) {
+			events = append(events, ical.Event{
+				UID:         fmt.Sprintf("expiry-%s@chemical-storage", day.Format("20060102")),
+				Date:        day,
+				Summary:     fmt.Sprintf("Закінчується термін придатності: %d екз.", len(lines)),
+				Description: strings.Join(lines, "\n"),
+				URL:         baseURL + "/reagents/",
+			})
+			lines = nil
+		}
+	}
+	return events
+}
+
+func peroxideTestEvents(baseURL string, tests []db.PeroxideTest) (events []ical.Event) {
+	var lines []string
+	for i, test := range tests {
+		location := "без місця зберігання"
+		if test.Instance.Storage.Name != "" {
+			location = fmt.Sprintf(
+				"склад %s, відділ %d",
+				test.Instance.Storage.Name,
+				test.Instance.StorageCell.Number,
+			)
+		}
+		lines = append(lines, fmt.Sprintf(
+			"%s %s (%s) - %s",
+			test.Instance.ReagentInstance.Code,
+			test.Instance.Reagent.Name,
+			test.Instance.Reagent.Formula,
+			location,
+		))
+		day := test.DueAt
+		last := i == len(tests)-1
+		if last || !tests[i+1].DueAt.Equal(day) {
+			events = append(events, ical.Event{
+				UID:         fmt.Sprintf("peroxide-%s@chemical-storage", day.Format("20060102")),
+				Date:        day,
+				Summary:     fmt.Sprintf("Перевірка на пероксиди: %d екз.", len(lines)),
+				Description: strings.Join(lines, "\n"),
+				URL:         baseURL + "/reagents/",
+			})
+			lines = nil
+		}
+	}
+	return events
+}
+
+func inspectionEvents(baseURL string, inspections []db.StorageInspection) (events []ical.Event) {
+	for _, inspection := range inspections {
+		events = append(events, ical.Event{
+			UID: fmt.Sprintf(
+				"inspection-%s-%s@chemical-storage",
+				inspection.Storage.ID,
+				inspection.DueAt.Format("20060102"),
+			),
+			Date:        inspection.DueAt,
+			Summary:     fmt.Sprintf("Інспекція: %s", inspection.Storage.Name),
+			Description: fmt.Sprintf("Інспекція проводиться кожні %d дн.", inspection.Days),
+			URL:         fmt.Sprintf("%s/storages/%s", baseURL, inspection.Storage.ID),
+		})
+	}
+	return events
+}
+
+func CalendarFeed(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	token := strings.TrimSuffix(params.ByName("token"), ".ics")
+	user := db.StorageUser{CalendarToken: token}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{user.GetByCalendarToken})
+	userErr := errs[0]
+	if userErr != nil {
+		errStruct := db.ErrorAsStruct(userErr)
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Calendar token not found")
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(userErr.Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	if !user.Active || middleware.CheckPermission(user.Role, middleware.LecturerAssistant) != nil {
+		rc.Logger.Info("Calendar feed forbidden")
+		common.ErrorResp(w, common.Forbidden)
+		return
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from := today.AddDate(0, 0, -calendarPastDays)
+	until := today.AddDate(0, 0, calendarFutureDays)
+	expiring := db.ExpiringInstancesRange{UserID: user.ID, From: from, Until: until}
+	peroxideTests := db.PeroxideTestsRange{UserID: user.ID, From: from, Until: until}
+	inspections := db.StorageInspectionsRange{UserID: user.ID, From: from, Until: until}
+	errs = db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{expiring.Get, peroxideTests.Get, inspections.Get},
+	)
+	for _, err := range errs {
+		if err != nil {
+			rc.Logger.Error(err.Error())
+			common.ErrorResp(w, common.Internal)
+			return
+		}
+	}
+	baseURL := env.Env.PublicURL
+	events := expiryEvents(baseURL, expiring.ReagentInstancesExtended)
+	events = append(events, peroxideTestEvents(baseURL, peroxideTests.PeroxideTests)...)
+	events = append(events, inspectionEvents(baseURL, inspections.Inspections)...)
+	calendar := ical.Calendar{
+		Name:   "Хімічний склад",
+		Events: events,
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", "inline; filename=chemical-storage.ics")
+	err := calendar.Write(w)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+	}
+}
+
+func calendarTokenSet(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	token string,
+) {
+	user := db.StorageUser{ID: rc.UserID, CalendarToken: token}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{user.SetCalendarToken})
+	userErr := errs[0]
+	if userErr != nil {
+		rc.Logger.Error(userErr.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	tmpl := template.Must(template.ParseFiles("templates/me.html", "templates/base.html")).
+		Lookup("calendar-feed")
+	tmpl.Execute(w, newCalendarData(user))
+}
+
+func CalendarTokenCreateAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	token, err := common.GenerateToken()
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	calendarTokenSet(rc, w, r, token)
+}
+
+func CalendarTokenDeleteAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	calendarTokenSet(rc, w, r, "")
+}
@@ -0,0 +1,413 @@
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/xsrftoken"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+	"github.com/Kelvedler/ChemicalStorage/pkg/webhook"
+)
+
+type checkoutData struct {
+	ReagentID     uuid.UUID
+	InstanceID    uuid.UUID
+	Checkout      db.CheckoutExtended
+	CheckedOut    bool
+	Available     bool
+	Returnable    bool
+	Form          checkoutInput
+	LocationErr   string
+	DueAtErr      string
+	Err           string
+	ReturnErr     string
+	StoragesSlice []db.Storage
+	ReturnStorage uuid.UUID
+	ReturnCell    int16
+	PostXsrf      string
+	ReturnXsrf    string
+}
+
+type checkoutsData struct {
+	Caller         db.StorageUser
+	Overdue        bool
+	OverdueCount   int
+	CheckoutsSlice []db.CheckoutExtended
+}
+
+type checkoutInput struct {
+	Location   string `json:"location"`
+	DueAt      string `json:"due_at"`
+	DueAtLocal string `json:"due_at_local"`
+}
+
+type checkinInput struct {
+	Storage string `json:"return_storage"`
+	Cell    string `json:"return_cell"`
+}
+
+func getCheckoutXsrf(userID, reagentID, instanceID uuid.UUID, action string) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/reagents/%s/instances/%s/%s", reagentID, instanceID, action),
+	)
+}
+
+func setCheckouts(instances []db.ReagentInstanceExtended, checkoutsRange db.CheckoutsRange) {
+	for i := range instances {
+		if checkout, ok := checkoutsRange.ByInstance(instances[i].ReagentInstance.ID); ok {
+			instances[i].Checkout = checkout
+		}
+	}
+}
+
+func newCheckoutData(
+	rc *middleware.RequestContext,
+	rie db.ReagentInstanceExtended,
+	checkoutsRange db.CheckoutsRange,
+	storages []db.Storage,
+) checkoutData {
+	reagentID := rie.ReagentInstance.Reagent
+	instanceID := rie.ReagentInstance.ID
+	data := checkoutData{
+		ReagentID:     reagentID,
+		InstanceID:    instanceID,
+		StoragesSlice: storages,
+		ReturnStorage: rie.Storage.ID,
+		ReturnCell:    rie.StorageCell.Number,
+		PostXsrf:      getCheckoutXsrf(rc.UserID, reagentID, instanceID, "checkout"),
+		ReturnXsrf:    getCheckoutXsrf(rc.UserID, reagentID, instanceID, "checkin"),
+	}
+	data.Checkout, data.CheckedOut = checkoutsRange.ByInstance(instanceID)
+	usable := rie.ReagentInstance.UsedAt.IsZero() && rie.ReagentInstance.DeletedAt.IsZero()
+	data.Available = usable && !data.CheckedOut
+	data.Returnable = data.CheckedOut &&
+		(rc.UserRole == db.Assistant || data.Checkout.Checkout.StorageUser == rc.UserID)
+	if data.CheckedOut && data.Checkout.FromStorage.ID != uuid.Nil {
+		data.ReturnStorage = data.Checkout.FromStorage.ID
+		data.ReturnCell = data.Checkout.FromStorageCell.Number
+	}
+	return data
+}
+
+func checkout(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	reagentID uuid.UUID,
+	instanceID uuid.UUID,
+	prepare func(data *checkoutData),
+) {
+	rie := db.ReagentInstanceExtended{
+		ReagentInstance: db.ReagentInstance{ID: instanceID, Reagent: reagentID},
+	}
+	checkoutsRange := db.CheckoutsRange{InstanceID: instanceID}
+	storagesRange := db.StoragesRange{Limit: 40, Offset: 0, Placeable: true}
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{rie.Get, checkoutsRange.Get, storagesRange.Get},
+	)
+	for _, err := range errs {
+		if err != nil {
+			errStruct := db.ErrorAsStruct(err)
+			switch errStruct.(type) {
+			case db.DoesNotExist:
+				rc.Logger.Info("Not found")
+				common.ErrorResp(w, common.NotFound)
+			default:
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return
+		}
+	}
+	data := newCheckoutData(rc, rie, checkoutsRange, storagesRange.Storages)
+	prepare(&data)
+	tmpl := template.Must(template.ParseFiles("templates/instances-assets.html")).
+		Lookup("checkout")
+	tmpl.Execute(w, data)
+}
+
+func Checkouts(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	caller := db.StorageUser{ID: rc.UserID}
+	checkoutsRange := db.CheckoutsRange{}
+	if rc.UserRole == db.Lecturer {
+		checkoutsRange.StorageUserID = rc.UserID
+	}
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{caller.GetByID, checkoutsRange.Get},
+	)
+	if errs[0] != nil {
+		rc.Logger.Info("Unauthorized")
+		common.ErrorResp(w, common.Unauthorized)
+		return
+	}
+	if errs[1] != nil {
+		rc.Logger.Error(errs[1].Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	_, overdue := r.URL.Query()["overdue"]
+	data := checkoutsData{Caller: caller, Overdue: overdue}
+	for _, co := range checkoutsRange.Checkouts {
+		if co.Overdue {
+			data.OverdueCount++
+		}
+		if co.Overdue || !overdue {
+			data.CheckoutsSlice = append(data.CheckoutsSlice, co)
+		}
+	}
+	tmpl := template.Must(
+		template.ParseFiles(
+			"templates/checkouts.html",
+			"templates/base.html",
+		),
+	)
+	tmpl.Execute(w, data)
+}
+
+func (input checkoutInput) Bind() (output db.Checkout, err error) {
+	output.Location = strings.TrimSpace(input.Location)
+	output.DueAt, err = time.Parse(time.RFC3339, input.DueAt)
+	if err != nil {
+		return db.Checkout{}, err
+	}
+	return output, nil
+}
+
+func CheckoutCreateAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	reagentID, reagentErr := uuid.Parse(params.ByName("reagentID"))
+	instanceID, instanceErr := uuid.Parse(params.ByName("instanceID"))
+	for _, err := range []error{reagentErr, instanceErr} {
+		if err != nil {
+			rc.Logger.Info(err.Error())
+			common.ErrorResp(w, common.NotFound)
+			return
+		}
+	}
+	var input checkoutInput
+	err := common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	input.Location = rc.Sanitize.Sanitize(input.Location)
+	input.DueAt = rc.Sanitize.Sanitize(input.DueAt)
+	input.DueAtLocal = rc.Sanitize.Sanitize(input.DueAtLocal)
+	invalid := func(prepare func(data *checkoutData)) {
+		checkout(rc, w, r, reagentID, instanceID, func(data *checkoutData) {
+			data.Form = input
+			prepare(data)
+		})
+	}
+	denied, err := storageAccessDenied(rc, r, &db.StoragePermission{InstanceID: instanceID})
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	if denied != nil {
+		rc.Logger.Info("Storage access denied")
+		invalid(func(data *checkoutData) { data.Err = storageAccessDeniedMessage(denied) })
+		return
+	}
+	co, err := input.Bind()
+	if err != nil {
+		rc.Logger.Info(err.Error())
+		invalid(func(data *checkoutData) { data.DueAtErr = "Вкажіть час повернення" })
+		return
+	}
+	co.ReagentInstance = instanceID
+	co.StorageUser = rc.UserID
+	locationErr := ""
+	err = rc.Validate.Struct(co)
+	if err != nil {
+		err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), co)
+		rc.Logger.Info(err.Error())
+		locationErr = err.(common.ValidationError).Map()["LocationErr"]
+	}
+	dueAtErr := ""
+	if !co.DueAt.After(time.Now()) {
+		dueAtErr = "Час повернення має бути в майбутньому"
+	}
+	if locationErr != "" || dueAtErr != "" {
+		invalid(func(data *checkoutData) {
+			data.LocationErr = locationErr
+			data.DueAtErr = dueAtErr
+		})
+		return
+	}
+	notification := db.InstanceNotification{InstanceID: instanceID, Op: "checkout"}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{co.Create, notification.Notify})
+	if errs[0] != nil {
+		errStruct := db.ErrorAsStruct(errs[0])
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			reservation, reserved, err := instanceReservationConflict(rc, r, instanceID)
+			if err != nil {
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+				return
+			}
+			rc.Logger.Info(errs[0].Error())
+			invalid(func(data *checkoutData) {
+				if reserved {
+					data.Err = reservationText(reservation)
+				} else {
+					data.Err = "Екземпляр уже видано або він недоступний"
+				}
+			})
+		case db.UniqueViolation:
+			rc.Logger.Info(errs[0].Error())
+			invalid(func(data *checkoutData) {
+				data.Err = "Екземпляр уже видано або він недоступний"
+			})
+		default:
+			rc.Logger.Error(errs[0].Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	if errs[1] != nil {
+		rc.Logger.Error(errs[1].Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	checkout(rc, w, r, reagentID, instanceID, func(*checkoutData) {})
+}
+
+func (input checkinInput) Bind() (storageCell db.StorageCell, err error) {
+	storageCell.Storage, err = uuid.Parse(input.Storage)
+	if err != nil {
+		return db.StorageCell{}, err
+	}
+	number, err := strconv.ParseInt(strings.TrimSpace(input.Cell), 10, 16)
+	if err != nil {
+		return db.StorageCell{}, err
+	}
+	storageCell.Number = int16(number)
+	return storageCell, nil
+}
+
+func CheckinAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	reagentID, reagentErr := uuid.Parse(params.ByName("reagentID"))
+	instanceID, instanceErr := uuid.Parse(params.ByName("instanceID"))
+	for _, err := range []error{reagentErr, instanceErr} {
+		if err != nil {
+			rc.Logger.Info(err.Error())
+			common.ErrorResp(w, common.NotFound)
+			return
+		}
+	}
+	var input checkinInput
+	err := common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	input.Storage = rc.Sanitize.Sanitize(input.Storage)
+	input.Cell = rc.Sanitize.Sanitize(input.Cell)
+	invalid := func(returnErr string) {
+		checkout(rc, w, r, reagentID, instanceID, func(data *checkoutData) {
+			data.ReturnErr = returnErr
+		})
+	}
+	storageCell, err := input.Bind()
+	if err != nil || storageCell.Number < 1 {
+		rc.Logger.Info("Invalid cell")
+		invalid("Оберіть склад і відділ для повернення")
+		return
+	}
+	denied, err := storageAccessDenied(rc, r, &db.StoragePermission{StorageID: storageCell.Storage})
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	if denied != nil {
+		rc.Logger.Info("Storage access denied")
+		invalid(storageAccessDeniedMessage(denied))
+		return
+	}
+	co := db.CheckoutExtended{
+		Checkout: db.Checkout{
+			ReagentInstance: instanceID,
+			ReturnedBy:      rc.UserID,
+		},
+		ToStorageCell: storageCell,
+	}
+	if rc.UserRole != db.Assistant {
+		co.Checkout.StorageUser = rc.UserID
+	}
+	event, err := webhook.NewEvent(
+		webhook.InstanceTransferred,
+		map[string]any{"returned_by": rc.UserID},
+		instanceID,
+	)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	notification := db.InstanceNotification{InstanceID: instanceID, Op: "checkin"}
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{co.Return, event.Enqueue, notification.Notify},
+	)
+	for _, err = range errs {
+		if err != nil {
+			errStruct := db.ErrorAsStruct(err)
+			switch errStruct.(type) {
+			case db.OutOfLimits:
+				err = errStruct.(db.OutOfLimits).Localize(storageCell)
+				rc.Logger.Info(err.Error())
+				invalid(err.(db.DBError).Map()["NumberErr"])
+			case db.CapacityExceeded:
+				err = errStruct.(db.CapacityExceeded).Localize(storageCell)
+				rc.Logger.Info(err.Error())
+				invalid(err.(db.DBError).Map()["NumberErr"])
+			case db.DoesNotExist:
+				rc.Logger.Info("Not checked out")
+				invalid("Екземпляр не видано або його видано іншому користувачу")
+			default:
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return
+		}
+	}
+	checkout(rc, w, r, reagentID, instanceID, func(*checkoutData) {})
+}
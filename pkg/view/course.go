@@ -0,0 +1,817 @@
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/xsrftoken"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+)
+
+const upcomingSessionsWeeks = 8
+
+type requirement struct {
+	Item       db.PracticalItemExtended
+	Total      string
+	Containers int
+	Available  int
+	Shortfall  int
+}
+
+type sessionPlan struct {
+	Session      db.LabSessionExtended
+	Requirements []requirement
+	Shortfalls   int
+	Past         bool
+	Covered      bool
+	Editable     bool
+	DeleteXsrf   string
+	RequestXsrf  string
+}
+
+type practicalItemData struct {
+	Item       db.PracticalItemExtended
+	Amount     string
+	Container  string
+	DeleteXsrf string
+}
+
+type practicalData struct {
+	Practical db.PracticalExtended
+	Items     []practicalItemData
+}
+
+type coursesData struct {
+	Caller       db.StorageUser
+	CoursesSlice []db.CourseExtended
+	Upcoming     []sessionPlan
+	Weeks        int
+	CanCreate    bool
+	PostXsrf     string
+}
+
+type courseData struct {
+	Caller        db.StorageUser
+	Course        db.CourseExtended
+	Editable      bool
+	Practicals    []practicalData
+	Sessions      []sessionPlan
+	Options       reagentOptionsData
+	MinDate       string
+	PracticalXsrf string
+	ItemXsrf      string
+	SessionXsrf   string
+}
+
+type courseErrorData struct {
+	ID  string
+	Err string
+}
+
+type courseInput struct {
+	Name string `json:"name"`
+}
+
+type practicalInput struct {
+	Title string `json:"title"`
+}
+
+type practicalItemInput struct {
+	Practical       string `json:"practical"`
+	Reagent         string `json:"reagent"`
+	Amount          string `json:"amount"`
+	Unit            string `json:"unit"`
+	Per             string `json:"per"`
+	ContainerAmount string `json:"container_amount"`
+}
+
+type labSessionInput struct {
+	Practical   string `json:"practical"`
+	ScheduledOn string `json:"scheduled_on"`
+	Students    string `json:"students"`
+	GroupSize   string `json:"group_size"`
+}
+
+func getCoursePostXsrf(userID uuid.UUID) string {
+	return xsrftoken.Generate(env.Env.SecretKey, userID.String(), "/api/v1/courses")
+}
+
+func getCourseXsrf(userID, courseID uuid.UUID, action string) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/courses/%s/%s", courseID, action),
+	)
+}
+
+func formatAmount(amount float64, unit string) string {
+	amountStr := strconv.FormatFloat(math.Round(amount*1000)/1000, 'f', -1, 64)
+	return strings.TrimSpace(amountStr + " " + unit)
+}
+
+func parseAmount(input string) (float64, error) {
+	input = strings.ReplaceAll(strings.TrimSpace(input), ",", ".")
+	if input == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(input, 64)
+}
+
+func containersNeeded(item db.PracticalItem, session db.LabSession) int {
+	if item.ContainerAmount <= 0 {
+		return 1
+	}
+	return int(math.Ceil(item.Total(session) / item.ContainerAmount))
+}
+
+type sessionItem struct {
+	session uuid.UUID
+	item    uuid.UUID
+}
+
+func sessionShortfalls(demand []db.LabSessionExtended) map[sessionItem]int {
+	claimed := make(map[uuid.UUID]int)
+	shortfalls := make(map[sessionItem]int)
+	for _, session := range demand {
+		if session.LabSession.ScheduledOn.Before(today()) || session.RequestStatus == db.RequestApproved {
+			continue
+		}
+		for _, item := range session.Items {
+			reagentID := item.PracticalItem.Reagent
+			containers := containersNeeded(item.PracticalItem, session.LabSession)
+			left := max(item.Reagent.Instances-claimed[reagentID], 0)
+			shortfalls[sessionItem{session.LabSession.ID, item.PracticalItem.ID}] = max(containers-left, 0)
+			claimed[reagentID] += containers
+		}
+	}
+	return shortfalls
+}
+
+func planSessions(
+	rc *middleware.RequestContext,
+	sessions []db.LabSessionExtended,
+	demand []db.LabSessionExtended,
+) (plans []sessionPlan) {
+	shortfalls := sessionShortfalls(demand)
+	for _, session := range sessions {
+		plan := sessionPlan{
+			Session:  session,
+			Past:     session.LabSession.ScheduledOn.Before(today()),
+			Covered:  session.RequestStatus == db.RequestApproved,
+			Editable: session.Course.StorageUser == rc.UserID,
+		}
+		for _, item := range session.Items {
+			req := requirement{
+				Item:       item,
+				Total:      formatAmount(item.PracticalItem.Total(session.LabSession), item.PracticalItem.Unit),
+				Containers: containersNeeded(item.PracticalItem, session.LabSession),
+				Available:  item.Reagent.Instances,
+			}
+			if !plan.Past && !plan.Covered {
+				req.Shortfall = shortfalls[sessionItem{session.LabSession.ID, item.PracticalItem.ID}]
+				if req.Shortfall > 0 {
+					plan.Shortfalls++
+				}
+			}
+			plan.Requirements = append(plan.Requirements, req)
+		}
+		if plan.Editable {
+			courseID := session.Course.ID
+			sessionPath := fmt.Sprintf("sessions/%s", session.LabSession.ID)
+			plan.DeleteXsrf = getCourseXsrf(rc.UserID, courseID, sessionPath)
+			plan.RequestXsrf = getCourseXsrf(rc.UserID, courseID, sessionPath+"/request")
+		}
+		plans = append(plans, plan)
+	}
+	return plans
+}
+
+func Courses(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	caller := db.StorageUser{ID: rc.UserID}
+	coursesRange := db.CoursesRange{}
+	upcomingRange := db.UpcomingSessionsRange{
+		Until: today().AddDate(0, 0, 7*upcomingSessionsWeeks),
+	}
+	if rc.UserRole == db.Lecturer {
+		coursesRange.StorageUserID = rc.UserID
+		upcomingRange.StorageUserID = rc.UserID
+	}
+	demandRange := db.UpcomingSessionsRange{}
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{caller.GetByID, coursesRange.Get, upcomingRange.Get, demandRange.Get},
+	)
+	if errs[0] != nil {
+		rc.Logger.Info("Unauthorized")
+		common.ErrorResp(w, common.Unauthorized)
+		return
+	}
+	for _, err := range errs[1:] {
+		if err != nil {
+			rc.Logger.Error(err.Error())
+			common.ErrorResp(w, common.Internal)
+			return
+		}
+	}
+	data := coursesData{
+		Caller:       caller,
+		CoursesSlice: coursesRange.Courses,
+		Upcoming:     planSessions(rc, upcomingRange.Sessions, demandRange.Sessions),
+		Weeks:        upcomingSessionsWeeks,
+		CanCreate:    rc.UserRole == db.Lecturer,
+		PostXsrf:     getCoursePostXsrf(rc.UserID),
+	}
+	tmpl := template.Must(
+		template.ParseFiles(
+			"templates/courses.html",
+			"templates/courses-assets.html",
+			"templates/requests-assets.html",
+			"templates/base.html",
+		),
+	)
+	tmpl.Execute(w, data)
+}
+
+func courseFromParams(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+	batchSets ...db.BatchSet,
+) (db.CourseExtended, bool) {
+	courseID, err := uuid.Parse(params.ByName("courseID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return db.CourseExtended{}, false
+	}
+	course := db.CourseExtended{Course: db.Course{ID: courseID}}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, append([]db.BatchSet{course.Get}, batchSets...))
+	for _, err := range errs {
+		if err != nil {
+			errStruct := db.ErrorAsStruct(err)
+			switch errStruct.(type) {
+			case db.DoesNotExist:
+				rc.Logger.Info("Not found")
+				common.ErrorResp(w, common.NotFound)
+			default:
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return db.CourseExtended{}, false
+		}
+	}
+	if rc.UserRole == db.Lecturer && course.Course.StorageUser != rc.UserID {
+		rc.Logger.Info("Foreign course")
+		common.ErrorResp(w, common.Forbidden)
+		return db.CourseExtended{}, false
+	}
+	return course, true
+}
+
+func Course(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	caller := db.StorageUser{ID: rc.UserID}
+	reagentsRange := db.ReagentsRange{Limit: 20, Offset: 0}
+	demandRange := db.UpcomingSessionsRange{}
+	course, ok := courseFromParams(rc, w, r, params, caller.GetByID, reagentsRange.Get, demandRange.Get)
+	if !ok {
+		return
+	}
+	courseID := course.Course.ID
+	data := courseData{
+		Caller:        caller,
+		Course:        course,
+		Editable:      course.Course.StorageUser == rc.UserID,
+		Sessions:      planSessions(rc, course.Sessions, demandRange.Sessions),
+		Options:       reagentOptionsData{ReagentsSlice: reagentsRange.Reagents},
+		MinDate:       today().Format(time.DateOnly),
+		PracticalXsrf: getCourseXsrf(rc.UserID, courseID, "practicals"),
+		ItemXsrf:      getCourseXsrf(rc.UserID, courseID, "items"),
+		SessionXsrf:   getCourseXsrf(rc.UserID, courseID, "sessions"),
+	}
+	for _, practical := range course.Practicals {
+		practicalData := practicalData{Practical: practical}
+		for _, item := range practical.Items {
+			itemData := practicalItemData{
+				Item:   item,
+				Amount: formatAmount(item.PracticalItem.Amount, item.PracticalItem.Unit),
+			}
+			if item.PracticalItem.ContainerAmount > 0 {
+				itemData.Container = formatAmount(
+					item.PracticalItem.ContainerAmount,
+					item.PracticalItem.Unit,
+				)
+			}
+			if data.Editable {
+				itemData.DeleteXsrf = getCourseXsrf(
+					rc.UserID,
+					courseID,
+					fmt.Sprintf("items/%s", item.PracticalItem.ID),
+				)
+			}
+			practicalData.Items = append(practicalData.Items, itemData)
+		}
+		data.Practicals = append(data.Practicals, practicalData)
+	}
+	tmpl := template.Must(
+		template.ParseFiles(
+			"templates/course.html",
+			"templates/courses-assets.html",
+			"templates/requests-assets.html",
+			"templates/base.html",
+		),
+	)
+	tmpl.Execute(w, data)
+}
+
+func courseError(w http.ResponseWriter, id, err string) {
+	tmpl := template.Must(template.ParseFiles("templates/courses-assets.html")).
+		Lookup("course-error")
+	tmpl.Execute(w, courseErrorData{ID: id, Err: err})
+}
+
+func courseRedirect(w http.ResponseWriter, courseID uuid.UUID) {
+	w.Header().Set("HX-Redirect", fmt.Sprintf("/courses/%s", courseID))
+}
+
+func courseParams(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	params httprouter.Params,
+	names ...string,
+) (ids []uuid.UUID, ok bool) {
+	for _, name := range names {
+		id, err := uuid.Parse(params.ByName(name))
+		if err != nil {
+			rc.Logger.Info(err.Error())
+			common.ErrorResp(w, common.NotFound)
+			return nil, false
+		}
+		ids = append(ids, id)
+	}
+	return ids, true
+}
+
+func CourseCreateAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	var input courseInput
+	err := common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	course := db.Course{
+		StorageUser: rc.UserID,
+		Name:        strings.TrimSpace(rc.Sanitize.Sanitize(input.Name)),
+	}
+	err = rc.Validate.Struct(course)
+	if err != nil {
+		err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), course)
+		rc.Logger.Info(err.Error())
+		courseError(w, "course-error", err.(common.ValidationError).Map()["NameErr"])
+		return
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{course.Create})
+	if errs[0] != nil {
+		errStruct := db.ErrorAsStruct(errs[0])
+		switch errStruct.(type) {
+		case db.UniqueViolation:
+			err = errStruct.(db.UniqueViolation).Localize(course)
+			rc.Logger.Info(err.Error())
+			courseError(w, "course-error", err.(db.DBError).Map()["NameErr"])
+		default:
+			rc.Logger.Error(errs[0].Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	courseRedirect(w, course.ID)
+}
+
+func PracticalCreateAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	ids, ok := courseParams(rc, w, params, "courseID")
+	if !ok {
+		return
+	}
+	var input practicalInput
+	err := common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	practical := db.PracticalExtended{
+		Practical: db.Practical{
+			Course: ids[0],
+			Title:  strings.TrimSpace(rc.Sanitize.Sanitize(input.Title)),
+		},
+		Course: db.Course{ID: ids[0], StorageUser: rc.UserID},
+	}
+	err = rc.Validate.Struct(practical.Practical)
+	if err != nil {
+		err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), practical.Practical)
+		rc.Logger.Info(err.Error())
+		courseError(w, "practical-error", err.(common.ValidationError).Map()["TitleErr"])
+		return
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{practical.Create})
+	if errs[0] != nil {
+		errStruct := db.ErrorAsStruct(errs[0])
+		switch errStruct.(type) {
+		case db.UniqueViolation:
+			err = errStruct.(db.UniqueViolation).Localize(practical.Practical)
+			rc.Logger.Info(err.Error())
+			courseError(w, "practical-error", err.(db.DBError).Map()["TitleErr"])
+		case db.DoesNotExist:
+			rc.Logger.Info("Foreign course")
+			common.ErrorResp(w, common.Forbidden)
+		default:
+			rc.Logger.Error(errs[0].Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	courseRedirect(w, ids[0])
+}
+
+func (input practicalItemInput) Bind() (output db.PracticalItem, err error) {
+	output.Practical, err = uuid.Parse(input.Practical)
+	if err != nil {
+		return db.PracticalItem{}, err
+	}
+	output.Reagent, err = uuid.Parse(input.Reagent)
+	if err != nil {
+		return db.PracticalItem{}, err
+	}
+	output.Amount, err = parseAmount(input.Amount)
+	if err != nil {
+		return db.PracticalItem{}, err
+	}
+	output.ContainerAmount, err = parseAmount(input.ContainerAmount)
+	if err != nil {
+		return db.PracticalItem{}, err
+	}
+	output.Unit = strings.TrimSpace(input.Unit)
+	output.Per = input.Per
+	return output, nil
+}
+
+func PracticalItemCreateAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	ids, ok := courseParams(rc, w, params, "courseID")
+	if !ok {
+		return
+	}
+	var input practicalItemInput
+	err := common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	input.Practical = rc.Sanitize.Sanitize(input.Practical)
+	input.Reagent = rc.Sanitize.Sanitize(input.Reagent)
+	input.Amount = rc.Sanitize.Sanitize(input.Amount)
+	input.Unit = rc.Sanitize.Sanitize(input.Unit)
+	input.Per = rc.Sanitize.Sanitize(input.Per)
+	input.ContainerAmount = rc.Sanitize.Sanitize(input.ContainerAmount)
+	item, err := input.Bind()
+	if err != nil {
+		rc.Logger.Info(err.Error())
+		courseError(w, "item-error", "Оберіть заняття, реагент та вкажіть кількість числом")
+		return
+	}
+	err = rc.Validate.Struct(item)
+	if err != nil {
+		err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), item)
+		rc.Logger.Info(err.Error())
+		errMap := err.(common.ValidationError).Map()
+		courseError(
+			w,
+			"item-error",
+			strings.TrimSpace(strings.Join(
+				[]string{errMap["AmountErr"], errMap["UnitErr"], errMap["PerErr"], errMap["ContainerAmountErr"]},
+				" ",
+			)),
+		)
+		return
+	}
+	itemExtended := db.PracticalItemExtended{
+		PracticalItem: item,
+		Course:        db.Course{ID: ids[0], StorageUser: rc.UserID},
+	}
+	reagent := db.Reagent{ID: item.Reagent}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{reagent.Get, itemExtended.Create})
+	if errs[0] != nil {
+		errStruct := db.ErrorAsStruct(errs[0])
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Reagent not found")
+			courseError(w, "item-error", "Реагент не знайдено, оберіть інший")
+		default:
+			rc.Logger.Error(errs[0].Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	if errs[1] != nil {
+		errStruct := db.ErrorAsStruct(errs[1])
+		switch errStruct.(type) {
+		case db.UniqueViolation:
+			rc.Logger.Info(errs[1].Error())
+			courseError(w, "item-error", "Цей реагент уже є в шаблоні заняття")
+		case db.DoesNotExist:
+			rc.Logger.Info("Foreign practical")
+			common.ErrorResp(w, common.Forbidden)
+		default:
+			rc.Logger.Error(errs[1].Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	courseRedirect(w, ids[0])
+}
+
+func PracticalItemDeleteAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	ids, ok := courseParams(rc, w, params, "courseID", "itemID")
+	if !ok {
+		return
+	}
+	item := db.PracticalItemExtended{
+		PracticalItem: db.PracticalItem{ID: ids[1]},
+		Course:        db.Course{ID: ids[0], StorageUser: rc.UserID},
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{item.Delete})
+	if errs[0] != nil {
+		errStruct := db.ErrorAsStruct(errs[0])
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Not found")
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(errs[0].Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	courseRedirect(w, ids[0])
+}
+
+func (input labSessionInput) Bind() (output db.LabSession, err error) {
+	output.Practical, err = uuid.Parse(input.Practical)
+	if err != nil {
+		return db.LabSession{}, err
+	}
+	output.ScheduledOn, err = time.Parse(time.DateOnly, input.ScheduledOn)
+	if err != nil {
+		return db.LabSession{}, err
+	}
+	output.Students, err = strconv.Atoi(strings.TrimSpace(input.Students))
+	if err != nil {
+		return db.LabSession{}, err
+	}
+	output.GroupSize, err = strconv.Atoi(strings.TrimSpace(input.GroupSize))
+	if err != nil {
+		return db.LabSession{}, err
+	}
+	return output, nil
+}
+
+func LabSessionCreateAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	ids, ok := courseParams(rc, w, params, "courseID")
+	if !ok {
+		return
+	}
+	var input labSessionInput
+	err := common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	input.Practical = rc.Sanitize.Sanitize(input.Practical)
+	input.ScheduledOn = rc.Sanitize.Sanitize(input.ScheduledOn)
+	input.Students = rc.Sanitize.Sanitize(input.Students)
+	input.GroupSize = rc.Sanitize.Sanitize(input.GroupSize)
+	session, err := input.Bind()
+	if err != nil {
+		rc.Logger.Info(err.Error())
+		courseError(w, "session-error", "Оберіть заняття, дату та вкажіть кількість студентів і розмір групи")
+		return
+	}
+	err = rc.Validate.Struct(session)
+	if err != nil {
+		err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), session)
+		rc.Logger.Info(err.Error())
+		errMap := err.(common.ValidationError).Map()
+		courseError(
+			w,
+			"session-error",
+			strings.TrimSpace(errMap["StudentsErr"]+" "+errMap["GroupSizeErr"]),
+		)
+		return
+	}
+	if session.ScheduledOn.Before(today()) {
+		courseError(w, "session-error", "Оберіть дату, не ранішу за сьогодні")
+		return
+	}
+	sessionExtended := db.LabSessionExtended{
+		LabSession: session,
+		Course:     db.Course{ID: ids[0], StorageUser: rc.UserID},
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{sessionExtended.Create})
+	if errs[0] != nil {
+		errStruct := db.ErrorAsStruct(errs[0])
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Foreign practical")
+			common.ErrorResp(w, common.Forbidden)
+		default:
+			rc.Logger.Error(errs[0].Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	courseRedirect(w, ids[0])
+}
+
+func LabSessionDeleteAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	ids, ok := courseParams(rc, w, params, "courseID", "sessionID")
+	if !ok {
+		return
+	}
+	session := db.LabSessionExtended{
+		LabSession: db.LabSession{ID: ids[1]},
+		Course:     db.Course{ID: ids[0], StorageUser: rc.UserID},
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{session.Delete})
+	if errs[0] != nil {
+		errStruct := db.ErrorAsStruct(errs[0])
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Not found")
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(errs[0].Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	courseRedirect(w, ids[0])
+}
+
+func sessionRequest(rc *middleware.RequestContext, plan sessionPlan) db.ReagentRequestExtended {
+	session := plan.Session
+	title := []rune(fmt.Sprintf("%s — %s", session.Practical.Title, session.Course.Name))
+	if len(title) > 200 {
+		title = title[:200]
+	}
+	request := db.ReagentRequestExtended{
+		ReagentRequest: db.ReagentRequest{
+			Title:    string(title),
+			NeededBy: session.LabSession.ScheduledOn,
+		},
+	}
+	for _, req := range plan.Requirements {
+		item := db.ReagentRequestItem{
+			Reagent: req.Item.PracticalItem.Reagent,
+			Amount:  fmt.Sprintf("%s (%d ємн.)", req.Total, req.Containers),
+		}
+		if rc.Validate.StructPartial(item, "Amount") != nil {
+			item.Amount = req.Total
+		}
+		request.Items = append(request.Items, db.ReagentRequestItemExtended{ReagentRequestItem: item})
+	}
+	return request
+}
+
+func LabSessionRequestAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	sessionID, err := uuid.Parse(params.ByName("sessionID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	course, ok := courseFromParams(rc, w, r, params)
+	if !ok {
+		return
+	}
+	var plan sessionPlan
+	for _, sessionPlan := range planSessions(rc, course.Sessions, nil) {
+		if sessionPlan.Session.LabSession.ID == sessionID {
+			plan = sessionPlan
+		}
+	}
+	switch {
+	case plan.Session.LabSession.ID == uuid.Nil:
+		rc.Logger.Info("Not found")
+		common.ErrorResp(w, common.NotFound)
+		return
+	case !plan.Editable:
+		rc.Logger.Info("Foreign course")
+		common.ErrorResp(w, common.Forbidden)
+		return
+	}
+	errID := fmt.Sprintf("session-request-error-%s", sessionID)
+	switch {
+	case plan.Session.LabSession.ReagentRequest != uuid.Nil:
+		courseError(w, errID, "Запит для цього заняття вже створено")
+		return
+	case plan.Past:
+		courseError(w, errID, "Заняття вже минуло")
+		return
+	case len(plan.Requirements) == 0:
+		courseError(w, errID, "Додайте реагенти до шаблону заняття")
+		return
+	}
+	request := sessionRequest(rc, plan)
+	for _, item := range request.Items {
+		err = rc.Validate.StructPartial(item.ReagentRequestItem, "Amount")
+		if err != nil {
+			err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), item.ReagentRequestItem)
+			rc.Logger.Info(err.Error())
+			courseError(w, errID, err.(common.ValidationError).Map()["AmountErr"])
+			return
+		}
+	}
+	request.ReagentRequest.ID = uuid.New()
+	request.ReagentRequest.StorageUser = rc.UserID
+	plan.Session.LabSession.ReagentRequest = request.ReagentRequest.ID
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{request.Create, plan.Session.SetRequest},
+	)
+	for _, err := range errs {
+		if err != nil {
+			errStruct := db.ErrorAsStruct(err)
+			switch errStruct.(type) {
+			case db.DoesNotExist:
+				rc.Logger.Info(err.Error())
+				courseError(w, errID, "Не вдалося створити запит, оновіть сторінку")
+			default:
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return
+		}
+	}
+	w.Header().Set("HX-Redirect", fmt.Sprintf("/requests/%s", request.ReagentRequest.ID))
+}
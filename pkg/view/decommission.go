@@ -0,0 +1,262 @@
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/xsrftoken"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+	"github.com/Kelvedler/ChemicalStorage/pkg/webhook"
+)
+
+type decommissionInstance struct {
+	Instance db.ReagentInstanceExtended
+	UseXsrf  string
+}
+
+type decommissionData struct {
+	Caller         db.StorageUser
+	Storage        db.Storage
+	PathSlice      []db.Storage
+	InstancesSlice []decommissionInstance
+	StoragesSlice  []db.Storage
+	RelocateXsrf   string
+	ArchiveXsrf    string
+}
+
+func getStorageRelocateXsrf(userID, storageID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/storages/%s/relocate", storageID),
+	)
+}
+
+func getStorageArchiveXsrf(userID, storageID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/storages/%s/archive", storageID),
+	)
+}
+
+func StorageDecommission(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	storageID, err := uuid.Parse(params.ByName("storageID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	storage := db.Storage{ID: storageID}
+	path := db.StoragePath{StorageID: storageID}
+	instancesRange := db.StorageInstancesRange{StorageID: storageID}
+	storagesRange := db.StoragesRange{
+		Limit:     40,
+		Offset:    0,
+		Placeable: true,
+	}
+	caller := db.StorageUser{ID: rc.UserID}
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{storage.Get, path.Get, instancesRange.Get, storagesRange.Get, caller.GetByID},
+	)
+	for _, err := range errs[:4] {
+		if err != nil {
+			errStruct := db.ErrorAsStruct(err)
+			switch errStruct.(type) {
+			case db.DoesNotExist:
+				rc.Logger.Info("Not found")
+				common.ErrorResp(w, common.NotFound)
+			default:
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return
+		}
+	}
+	if !storage.ArchivedAt.IsZero() {
+		http.Redirect(w, r, fmt.Sprintf("/storages/%s", storageID), http.StatusFound)
+		return
+	}
+	data := decommissionData{
+		Caller:        caller,
+		Storage:       storage,
+		PathSlice:     path.Storages,
+		StoragesSlice: storagesRange.Storages,
+		RelocateXsrf:  getStorageRelocateXsrf(rc.UserID, storageID),
+		ArchiveXsrf:   getStorageArchiveXsrf(rc.UserID, storageID),
+	}
+	for _, instance := range instancesRange.ReagentInstancesExtended {
+		data.InstancesSlice = append(data.InstancesSlice, decommissionInstance{
+			Instance: instance,
+			UseXsrf:  getInstanceUseXsrf(rc.UserID, instance.ReagentInstance.ID, instance.Reagent.ID),
+		})
+	}
+	tmpl := template.Must(
+		template.ParseFiles(
+			"templates/storage-decommission.html",
+			"templates/base.html",
+			"templates/storages-assets.html",
+		),
+	)
+	tmpl.Execute(w, data)
+}
+
+func StorageRelocateAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	storageID, err := uuid.Parse(params.ByName("storageID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	var inputStr reagentInstanceInput
+	err = common.BindJSON(r, &inputStr)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	sanitizeReagentInstance(rc, &inputStr)
+	input, err := inputStr.Bind()
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	tmpl := template.Must(template.ParseFiles("templates/storages-assets.html")).
+		Lookup("decommission-error")
+	denied, err := storageAccessDenied(
+		rc,
+		r,
+		&db.StoragePermission{StorageID: storageID},
+		&db.StoragePermission{StorageID: input.Storage},
+	)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	if denied != nil {
+		rc.Logger.Info("Storage access denied")
+		tmpl.Execute(w, storageAccessDeniedMessage(denied))
+		return
+	}
+	targetPath := db.StoragePath{StorageID: input.Storage}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{targetPath.Get})
+	if errs[0] != nil {
+		rc.Logger.Error(errs[0].Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	if len(targetPath.Storages) == 0 {
+		rc.Logger.Info("Target not found")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	for _, ancestor := range targetPath.Storages {
+		if ancestor.ID == input.Storage && !ancestor.ArchivedAt.IsZero() {
+			rc.Logger.Info("Target archived")
+			tmpl.Execute(w, "Неможливо перемістити в архівований елемент")
+			return
+		}
+		if ancestor.ID == storageID {
+			rc.Logger.Info("Target inside relocated storage")
+			tmpl.Execute(w, "Неможливо перемістити в елемент, що виводиться з експлуатації")
+			return
+		}
+	}
+	storageCell := db.StorageCell{
+		Storage: input.Storage,
+		Number:  input.Cell,
+	}
+	relocation := db.StorageRelocation{
+		StorageID: storageID,
+		Target:    storageCell,
+	}
+	event, err := webhook.NewEvent(webhook.InstanceTransferred, nil)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	errs = db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{storageCell.TryCreate, relocation.Relocate, event.Enqueue},
+	)
+	for _, err = range errs {
+		if err != nil {
+			errStruct := db.ErrorAsStruct(err)
+			switch errStruct.(type) {
+			case db.OutOfLimits:
+				err = errStruct.(db.OutOfLimits).Localize(storageCell)
+				rc.Logger.Info(err.Error())
+				tmpl.Execute(w, err.(db.DBError).Map()["NumberErr"])
+			case db.CapacityExceeded:
+				err = errStruct.(db.CapacityExceeded).Localize(storageCell)
+				rc.Logger.Info(err.Error())
+				tmpl.Execute(w, err.(db.DBError).Map()["NumberErr"])
+			default:
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return
+		}
+	}
+	rc.Logger.Info(fmt.Sprintf("Relocated %d instances", relocation.Moved))
+	w.Header().Set("HX-Refresh", "true")
+}
+
+func StorageArchiveAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	storageID, err := uuid.Parse(params.ByName("storageID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	storage := db.Storage{ID: storageID}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{storage.Archive})
+	storageErr := errs[0]
+	if storageErr != nil {
+		errStruct := db.ErrorAsStruct(storageErr)
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Not found")
+			common.ErrorResp(w, common.NotFound)
+		case db.NotEmpty:
+			err = errStruct.(db.NotEmpty).Localize()
+			rc.Logger.Info(err.Error())
+			tmpl := template.Must(template.ParseFiles("templates/storages-assets.html")).
+				Lookup("decommission-error")
+			tmpl.Execute(w, err.(db.DBError).Map()["ArchivedErr"])
+		default:
+			rc.Logger.Error(storageErr.Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	w.Header().Set("HX-Redirect", fmt.Sprintf("/storages/%s", storageID))
+}
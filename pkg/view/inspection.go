@@ -0,0 +1,199 @@
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/xsrftoken"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+)
+
+type storageInspectionData struct {
+	StorageID  uuid.UUID
+	Inspection db.StorageInspection
+	Manage     bool
+	Recordable bool
+	DaysErr    string
+	PutXsrf    string
+	RecordXsrf string
+}
+
+type storageInspectionInput struct {
+	Days string `json:"inspection_days"`
+}
+
+func getStorageInspectionPutXsrf(userID, storageID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/storages/%s/inspection", storageID),
+	)
+}
+
+func getStorageInspectionPostXsrf(userID, storageID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/storages/%s/inspections", storageID),
+	)
+}
+
+func newStorageInspectionData(
+	rc *middleware.RequestContext,
+	storage db.Storage,
+	inspection db.StorageInspection,
+) storageInspectionData {
+	active := storage.ArchivedAt.IsZero()
+	data := storageInspectionData{
+		StorageID:  storage.ID,
+		Inspection: inspection,
+		Manage: active && (rc.UserRole == db.Admin ||
+			(storage.Responsible != uuid.Nil && storage.Responsible == rc.UserID)),
+		Recordable: active && inspection.Days > 0 &&
+			(rc.UserRole == db.Admin || rc.UserRole == db.Assistant),
+	}
+	if data.Manage {
+		data.PutXsrf = getStorageInspectionPutXsrf(rc.UserID, storage.ID)
+	}
+	if data.Recordable {
+		data.RecordXsrf = getStorageInspectionPostXsrf(rc.UserID, storage.ID)
+	}
+	return data
+}
+
+func storageInspectionResp(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	storageID uuid.UUID,
+	inspection db.StorageInspection,
+	daysErr string,
+) {
+	storage := db.Storage{ID: storageID}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{storage.Get})
+	if errs[0] != nil {
+		rc.Logger.Error(errs[0].Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	data := newStorageInspectionData(rc, storage, inspection)
+	data.DaysErr = daysErr
+	tmpl := template.Must(template.ParseFiles("templates/storages-assets.html")).
+		Lookup("storage-inspection")
+	tmpl.Execute(w, data)
+}
+
+func StorageInspectionPutAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	storageID, err := uuid.Parse(params.ByName("storageID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	var input storageInspectionInput
+	err = common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	if !storageManageAllowed(rc, w, r, storageID) {
+		return
+	}
+	inspection := db.StorageInspection{Storage: db.Storage{ID: storageID}}
+	current := inspection
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{current.Get})
+	if errs[0] != nil {
+		rc.Logger.Error(errs[0].Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	days := strings.TrimSpace(rc.Sanitize.Sanitize(input.Days))
+	if days != "" {
+		parsed, err := strconv.ParseInt(days, 10, 16)
+		if err != nil {
+			rc.Logger.Info(err.Error())
+			storageInspectionResp(rc, w, r, storageID, current, "Невірне число днів")
+			return
+		}
+		inspection.Days = int16(parsed)
+	}
+	err = rc.Validate.StructPartial(inspection, "Days")
+	if err != nil {
+		err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), inspection)
+		rc.Logger.Info(err.Error())
+		storageInspectionResp(rc, w, r, storageID, current, err.(common.ValidationError).Map()["DaysErr"])
+		return
+	}
+	errs = db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{inspection.SetInterval})
+	inspectionErr := errs[0]
+	if inspectionErr != nil {
+		errStruct := db.ErrorAsStruct(inspectionErr)
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Not found")
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(inspectionErr.Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	storageInspectionResp(rc, w, r, storageID, inspection, "")
+}
+
+func StorageInspectionCreateAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	storageID, err := uuid.Parse(params.ByName("storageID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	denied, err := storageAccessDenied(rc, r, &db.StoragePermission{StorageID: storageID})
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	if denied != nil {
+		rc.Logger.Info("Storage access denied")
+		common.ErrorResp(w, common.Forbidden)
+		return
+	}
+	inspection := db.StorageInspection{Storage: db.Storage{ID: storageID}}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{inspection.Record})
+	inspectionErr := errs[0]
+	if inspectionErr != nil {
+		errStruct := db.ErrorAsStruct(inspectionErr)
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Not found")
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(inspectionErr.Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	storageInspectionResp(rc, w, r, storageID, inspection, "")
+}
@@ -0,0 +1,90 @@
+package view
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+	"github.com/Kelvedler/ChemicalStorage/pkg/qr"
+)
+
+const instanceQRScale = 8
+
+func ReagentInstanceQR(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	reagentID, reagentErr := uuid.Parse(params.ByName("reagentID"))
+	instanceID, instanceErr := uuid.Parse(params.ByName("instanceID"))
+	for _, err := range []error{reagentErr, instanceErr} {
+		if err != nil {
+			rc.Logger.Info(err.Error())
+			common.ErrorResp(w, common.NotFound)
+			return
+		}
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "png"
+	}
+	if format != "png" && format != "svg" {
+		rc.Logger.Info("Unknown QR format")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	rie := db.ReagentInstanceExtended{
+		ReagentInstance: db.ReagentInstance{ID: instanceID, Reagent: reagentID},
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{rie.Get})
+	instanceErr = errs[0]
+	if instanceErr != nil {
+		errStruct := db.ErrorAsStruct(instanceErr)
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Not found")
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(instanceErr.Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	code, err := qr.Encode(
+		fmt.Sprintf("%s/reagents/%s/instances/%s", env.Env.PublicURL, reagentID, instanceID),
+	)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	if r.URL.Query().Has("download") {
+		w.Header().Set(
+			"Content-Disposition",
+			mime.FormatMediaType(
+				"attachment",
+				map[string]string{"filename": fmt.Sprintf("instance-%s.%s", instanceID, format)},
+			),
+		)
+	}
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	switch format {
+	case "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		err = code.WriteSVG(w)
+	default:
+		w.Header().Set("Content-Type", "image/png")
+		err = code.WritePNG(w, instanceQRScale)
+	}
+	if err != nil {
+		rc.Logger.Error(err.Error())
+	}
+}
@@ -0,0 +1,182 @@
+package view
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/label"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+)
+
+type labelsFormData struct {
+	Param        string
+	ID           string
+	LayoutsSlice []label.Layout
+}
+
+type receivingData struct {
+	Caller         db.StorageUser
+	Receiving      db.ReceivingExtended
+	InstancesSlice []db.ReagentInstanceExtended
+	Labels         labelsFormData
+}
+
+func newLabelsFormData(param string, id uuid.UUID) labelsFormData {
+	return labelsFormData{Param: param, ID: id.String(), LayoutsSlice: label.Layouts}
+}
+
+func instanceLocationText(instance db.ReagentInstanceExtended) string {
+	if !instance.Placed() {
+		return "Місце: не розміщено"
+	}
+	location := fmt.Sprintf("Місце: %s, відділ %d", instance.Storage.Name, instance.StorageCell.Number)
+	if instance.StorageCell.Label != "" {
+		location = fmt.Sprintf("%s «%s»", location, instance.StorageCell.Label)
+	}
+	return location
+}
+
+func instanceLabels(instances []db.ReagentInstanceExtended) (labels []label.Label) {
+	baseURL := env.Env.PublicURL
+	for _, instance := range instances {
+		lot := ""
+		if instance.ReagentInstance.Lot != "" {
+			lot = "Партія: " + instance.ReagentInstance.Lot
+		}
+		labels = append(labels, label.Label{
+			Name:     instance.Reagent.Name,
+			Formula:  instance.Reagent.Formula,
+			Expiry:   "Придатний до: " + instance.ReagentInstance.ExpiresAt.Format("02.01.2006"),
+			Location: instanceLocationText(instance),
+			Lot:      lot,
+			Hazards:  instance.Reagent.Hazards,
+			URL: fmt.Sprintf(
+				"%s/reagents/%s/instances/%s",
+				baseURL,
+				instance.Reagent.ID,
+				instance.ReagentInstance.ID,
+			),
+			Code: instance.ReagentInstance.Code,
+		})
+	}
+	return labels
+}
+
+func Labels(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	query := r.URL.Query()
+	layout, ok := label.LayoutByKey(query.Get("layout"))
+	if !ok {
+		layout = label.Layouts[0]
+	}
+	labelsRange := db.InstanceLabelsRange{}
+	for param, target := range map[string]*uuid.UUID{
+		"reagent":   &labelsRange.ReagentID,
+		"receiving": &labelsRange.ReceivingID,
+	} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			rc.Logger.Info(err.Error())
+			common.ErrorResp(w, common.NotFound)
+			return
+		}
+		*target = id
+	}
+	if labelsRange.ReagentID == uuid.Nil && labelsRange.ReceivingID == uuid.Nil {
+		rc.Logger.Info("No labels selection")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{labelsRange.Get})
+	if errs[0] != nil {
+		rc.Logger.Error(errs[0].Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	if len(labelsRange.ReagentInstancesExtended) == 0 {
+		rc.Logger.Info("No instances to label")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	var document bytes.Buffer
+	err := label.Render(&document, layout, instanceLabels(labelsRange.ReagentInstancesExtended))
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set(
+		"Content-Disposition",
+		mime.FormatMediaType("inline", map[string]string{"filename": fmt.Sprintf("labels-%s.pdf", layout.Key)}),
+	)
+	w.Write(document.Bytes())
+}
+
+func Receiving(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	receivingID, err := uuid.Parse(params.ByName("receivingID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	receiving := db.ReceivingExtended{Receiving: db.Receiving{ID: receivingID}}
+	labelsRange := db.InstanceLabelsRange{ReceivingID: receivingID}
+	caller := db.StorageUser{ID: rc.UserID}
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{receiving.Get, labelsRange.Get, caller.GetByID},
+	)
+	for _, err = range errs[:2] {
+		if err != nil {
+			errStruct := db.ErrorAsStruct(err)
+			switch errStruct.(type) {
+			case db.DoesNotExist:
+				rc.Logger.Info("Not found")
+				common.ErrorResp(w, common.NotFound)
+			default:
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return
+		}
+	}
+	data := receivingData{
+		Caller:         caller,
+		Receiving:      receiving,
+		InstancesSlice: labelsRange.ReagentInstancesExtended,
+		Labels:         newLabelsFormData("receiving", receivingID),
+	}
+	tmpl := template.Must(
+		template.ParseFiles(
+			"templates/receiving.html",
+			"templates/base.html",
+			"templates/instances-assets.html",
+			"templates/storages-assets.html",
+		),
+	)
+	tmpl.Execute(w, data)
+}
@@ -0,0 +1,66 @@
+package view
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+)
+
+const sseHeartbeat = 30 * time.Second
+
+func ReagentEventsAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	reagentID, err := uuid.Parse(params.ByName("reagentID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		rc.Logger.Error("Streaming unsupported")
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	notifications, unsubscribe := rc.Broker.Subscribe(reagentID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case notification := <-notifications:
+			data, err := json.Marshal(notification)
+			if err != nil {
+				rc.Logger.Error(err.Error())
+				continue
+			}
+			fmt.Fprintf(w, "event: instance\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
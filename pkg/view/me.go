@@ -11,6 +11,11 @@ import (
 	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
 )
 
+type meData struct {
+	Caller   db.StorageUser
+	Calendar calendarData
+}
+
 func Me(
 	rc *middleware.RequestContext,
 	w http.ResponseWriter,
@@ -33,8 +38,9 @@ func Me(
 			return
 		}
 	}
-	data := CallerData{
-		Caller: caller,
+	data := meData{
+		Caller:   caller,
+		Calendar: newCalendarData(caller),
 	}
 	tmpl := template.Must(template.ParseFiles("templates/me.html", "templates/base.html"))
 	tmpl.Execute(w, data)
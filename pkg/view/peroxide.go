@@ -0,0 +1,99 @@
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/xsrftoken"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+)
+
+type peroxideTestData struct {
+	Caller     db.StorageUser
+	ReagentID  uuid.UUID
+	InstanceID uuid.UUID
+	Test       db.PeroxideTest
+	Recordable bool
+	RecordXsrf string
+}
+
+func getPeroxideTestXsrf(userID, instanceID, reagentID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/reagents/%s/instances/%s/peroxide-tests", reagentID, instanceID),
+	)
+}
+
+func newPeroxideTestData(
+	rc *middleware.RequestContext,
+	rie db.ReagentInstanceExtended,
+	test db.PeroxideTest,
+) peroxideTestData {
+	return peroxideTestData{
+		Caller:     db.StorageUser{ID: rc.UserID, Role: rc.UserRole},
+		ReagentID:  rie.Reagent.ID,
+		InstanceID: rie.ReagentInstance.ID,
+		Test:       test,
+		Recordable: rc.UserRole == db.Assistant && rie.ReagentInstance.UsedAt.IsZero() &&
+			rie.ReagentInstance.DeletedAt.IsZero(),
+		RecordXsrf: getPeroxideTestXsrf(rc.UserID, rie.ReagentInstance.ID, rie.Reagent.ID),
+	}
+}
+
+func ReagentInstancePeroxideTestAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	reagentID, reagentErr := uuid.Parse(params.ByName("reagentID"))
+	instanceID, instanceErr := uuid.Parse(params.ByName("instanceID"))
+	for _, err := range []error{reagentErr, instanceErr} {
+		if err != nil {
+			rc.Logger.Info(err.Error())
+			common.ErrorResp(w, common.NotFound)
+			return
+		}
+	}
+	denied, err := storageAccessDenied(rc, r, &db.StoragePermission{InstanceID: instanceID})
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	if denied != nil {
+		rc.Logger.Info("Storage access denied")
+		common.ErrorResp(w, common.Forbidden)
+		return
+	}
+	rie := db.ReagentInstanceExtended{
+		ReagentInstance: db.ReagentInstance{ID: instanceID, Reagent: reagentID},
+		Reagent:         db.Reagent{ID: reagentID},
+	}
+	test := db.PeroxideTest{Instance: rie}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{test.Record})
+	testErr := errs[0]
+	if testErr != nil {
+		errStruct := db.ErrorAsStruct(testErr)
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info(testErr.Error())
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(testErr.Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	tmpl := template.Must(template.ParseFiles("templates/instances-assets.html", "templates/storages-assets.html")).
+		Lookup("peroxide-test")
+	tmpl.Execute(w, newPeroxideTestData(rc, rie, test))
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"text/template"
 
 	"github.com/go-playground/validator/v10"
@@ -14,7 +15,9 @@ import (
 	"github.com/Kelvedler/ChemicalStorage/pkg/common"
 	"github.com/Kelvedler/ChemicalStorage/pkg/db"
 	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/label"
 	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+	"github.com/Kelvedler/ChemicalStorage/pkg/webhook"
 )
 
 type reagentsData struct {
@@ -22,7 +25,21 @@ type reagentsData struct {
 	LastReagent   db.Reagent
 	NextOffset    int
 	Src           string
+	Location      string
+	PathSlice     []db.Storage
 	Caller        db.StorageUser
+	Instance      db.ReagentInstanceExtended
+}
+
+func reagentsLocation(rc *middleware.RequestContext, r *http.Request) (uuid.UUID, error) {
+	locationStr := r.URL.Query().Get("location")
+	if locationStr == "" {
+		return uuid.Nil, nil
+	}
+	if rc.UserRole != db.Assistant && rc.UserRole != db.Lecturer {
+		return uuid.Nil, nil
+	}
+	return uuid.Parse(locationStr)
 }
 
 func (data *reagentsData) set(reagentsSlice []db.Reagent, src string, limit, offset int) {
@@ -41,18 +58,43 @@ type reagentData struct {
 	ID                 string
 	Name               string
 	Formula            string
+	Cas                string
+	PeroxideTestDays   int16
 	NameErr            string
 	FormulaErr         string
+	CasErr             string
+	PeroxideErr        string
 	PostXsrf           string
 	PutXsrf            string
+	HazardsSlice       []label.Pictogram
+	PictogramsSlice    []label.Pictogram
 	InstancesSlice     []db.ReagentInstanceExtended
 	UsedInstancesSlice []db.ReagentInstanceExtended
+	LostInstancesSlice []db.ReagentInstanceExtended
+	Barcodes           supplierBarcodesData
+	Unplaced           int
+	Labels             labelsFormData
+}
+
+func (data *reagentData) setHazards(hazards []string) {
+	data.PictogramsSlice = label.Pictograms
+	for _, code := range hazards {
+		data.HazardsSlice = append(data.HazardsSlice, label.Pictogram{
+			Code: code,
+			Name: label.PictogramName(code),
+		})
+	}
 }
 
 func (data *reagentData) addInstances(instancesSlice []db.ReagentInstanceExtended) {
 	for _, inst := range instancesSlice {
-		if inst.ReagentInstance.UsedAt.IsZero() {
+		if !inst.ReagentInstance.DeletedAt.IsZero() {
+			data.LostInstancesSlice = append(data.LostInstancesSlice, inst)
+		} else if inst.ReagentInstance.UsedAt.IsZero() {
 			data.InstancesSlice = append(data.InstancesSlice, inst)
+			if !inst.Placed() {
+				data.Unplaced++
+			}
 		} else {
 			data.UsedInstancesSlice = append(data.UsedInstancesSlice, inst)
 		}
@@ -84,30 +126,43 @@ func Reagents(
 	src := ""
 	limit := 24
 	offset := 0
+	location, err := reagentsLocation(rc, r)
+	if err != nil {
+		rc.Logger.Info(err.Error())
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
 	reagentsRange := db.ReagentsRange{
-		Limit:  limit,
-		Offset: offset,
-		Src:    src,
+		Limit:    limit,
+		Offset:   offset,
+		Src:      src,
+		Location: location,
 	}
+	path := db.StoragePath{StorageID: location}
 	caller := db.StorageUser{ID: rc.UserID}
 	errs := db.PerformBatch(
 		r.Context(),
 		rc.DBpool,
-		[]db.BatchSet{reagentsRange.Get, caller.GetByID},
+		[]db.BatchSet{reagentsRange.Get, path.Get, caller.GetByID},
 	)
-	reagentsErr := errs[0]
-	if reagentsErr != nil {
-		rc.Logger.Error(reagentsErr.Error())
-		common.ErrorResp(w, common.Internal)
-		return
+	for _, err := range errs[:2] {
+		if err != nil {
+			rc.Logger.Error(err.Error())
+			common.ErrorResp(w, common.Internal)
+			return
+		}
 	}
-	data := reagentsData{Caller: caller}
+	data := reagentsData{Caller: caller, PathSlice: path.Storages}
 	data.set(reagentsRange.Reagents, src, limit, offset)
+	if location != uuid.Nil {
+		data.Location = location.String()
+	}
 	tmpl := template.Must(
 		template.ParseFiles(
 			"templates/reagents.html",
 			"templates/base.html",
 			"templates/reagents-assets.html",
+			"templates/storages-assets.html",
 		),
 	)
 	tmpl.Execute(w, data)
@@ -130,14 +185,27 @@ func Reagent(
 	rir := db.ReagentInstanceRange{
 		ReagentID: reagentID,
 	}
+	barcodesRange := db.SupplierBarcodesRange{ReagentID: reagentID}
 	caller := db.StorageUser{ID: rc.UserID}
+	reservationsRange := db.ReservationsRange{ReagentID: reagentID}
+	checkoutsRange := db.CheckoutsRange{ReagentID: reagentID}
 	errs := db.PerformBatch(
 		r.Context(),
 		rc.DBpool,
-		[]db.BatchSet{reagent.Get, rir.Get, caller.GetByID},
+		[]db.BatchSet{
+			reagent.Get,
+			rir.Get,
+			barcodesRange.Get,
+			caller.GetByID,
+			reservationsRange.Get,
+			checkoutsRange.Get,
+		},
 	)
 	reagentErr := errs[0]
 	reagentInstanceErr := errs[1]
+	barcodesErr := errs[2]
+	reservationsErr := errs[4]
+	checkoutsErr := errs[5]
 	if reagentErr != nil {
 		errStruct := db.ErrorAsStruct(reagentErr)
 		switch errStruct.(type) {
@@ -151,24 +219,35 @@ func Reagent(
 			return
 		}
 	}
-	if reagentInstanceErr != nil {
-		rc.Logger.Error(reagentInstanceErr.Error())
-		common.ErrorResp(w, common.Internal)
-		return
+	for _, err := range []error{reagentInstanceErr, barcodesErr, reservationsErr, checkoutsErr} {
+		if err != nil {
+			rc.Logger.Error(err.Error())
+			common.ErrorResp(w, common.Internal)
+			return
+		}
 	}
 	data := reagentData{
 		Caller:  caller,
 		ID:      reagent.ID.String(),
 		Name:    reagent.Name,
 		Formula: reagent.Formula,
+		Cas:     reagent.Cas,
 		PutXsrf: getReagentPutXsrf(rc.UserID, reagentID),
+		Labels:  newLabelsFormData("reagent", reagent.ID),
+
+		PeroxideTestDays: reagent.PeroxideTestDays,
 	}
+	data.setHazards(reagent.Hazards)
+	setReservations(rir.ReagentInstancesExtended, reservationsRange)
+	setCheckouts(rir.ReagentInstancesExtended, checkoutsRange)
 	data.addInstances(rir.ReagentInstancesExtended)
+	data.Barcodes = newSupplierBarcodesData(rc, reagentID, barcodesRange.SupplierBarcodes)
 	tmpl := template.Must(
 		template.ParseFiles(
 			"templates/reagent.html",
 			"templates/reagents-assets.html",
 			"templates/instances-assets.html",
+			"templates/barcodes-assets.html",
 			"templates/base.html",
 		),
 	)
@@ -194,6 +273,7 @@ func ReagentCreate(
 		Caller:   caller,
 		PostXsrf: getReagentPostXsrf(rc.UserID),
 	}
+	data.setHazards(nil)
 	tmpl.Execute(w, data)
 }
 
@@ -224,13 +304,27 @@ func ReagentsAPI(
 		w.WriteHeader(400)
 		return
 	}
+	location, err := reagentsLocation(rc, r)
+	if err != nil {
+		rc.Logger.Info(err.Error())
+		w.WriteHeader(400)
+		return
+	}
 	limit := 24
 	reagentsRange := db.ReagentsRange{
-		Limit:  limit,
-		Offset: offset,
-		Src:    searchForm.Src,
+		Limit:    limit,
+		Offset:   offset,
+		Src:      searchForm.Src,
+		Location: location,
 	}
-	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{reagentsRange.Get})
+	batchSets := []db.BatchSet{reagentsRange.Get}
+	var instance db.ReagentInstanceExtended
+	if code, ok := normalizeInstanceCode(searchForm.Src); ok && offset == 0 &&
+		(rc.UserRole == db.Assistant || rc.UserRole == db.Lecturer) {
+		instance.ReagentInstance.Code = code
+		batchSets = append(batchSets, instance.GetByCode)
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, batchSets)
 	reagentsErr := errs[0]
 	if reagentsErr != nil {
 		rc.Logger.Error(reagentsErr.Error())
@@ -238,7 +332,13 @@ func ReagentsAPI(
 		return
 	}
 	var data reagentsData
+	if len(errs) > 1 && errs[1] == nil {
+		data.Instance = instance
+	}
 	data.set(reagentsRange.Reagents, src, limit, offset)
+	if location != uuid.Nil {
+		data.Location = location.String()
+	}
 	data.Caller = db.StorageUser{ID: rc.UserID, Role: rc.UserRole}
 	tmpl := template.Must(
 		template.ParseFiles(
@@ -253,10 +353,46 @@ func ReagentsAPI(
 	tmpl.Execute(w, data)
 }
 
-func sanitizeReagent(rc *middleware.RequestContext, reagent *db.Reagent) {
+type reagentInput struct {
+	Name             string `json:"name"`
+	Formula          string `json:"formula"`
+	Cas              string `json:"cas"`
+	Hazards          string `json:"hazards"`
+	PeroxideTestDays string `json:"peroxide_test_days"`
+}
+
+func sanitizeReagent(rc *middleware.RequestContext, input *reagentInput) {
 	sanitizer := rc.Sanitize
-	reagent.Name = sanitizer.Sanitize(reagent.Name)
-	reagent.Formula = sanitizer.Sanitize(reagent.Formula)
+	input.Name = sanitizer.Sanitize(input.Name)
+	input.Formula = sanitizer.Sanitize(input.Formula)
+	input.Cas = strings.TrimSpace(sanitizer.Sanitize(input.Cas))
+	input.Hazards = sanitizer.Sanitize(input.Hazards)
+	input.PeroxideTestDays = strings.TrimSpace(sanitizer.Sanitize(input.PeroxideTestDays))
+}
+
+func (input reagentInput) Bind() (output db.Reagent, err error) {
+	output.Name = input.Name
+	output.Formula = input.Formula
+	output.Cas = input.Cas
+	output.Hazards = []string{}
+	for _, code := range strings.Split(input.Hazards, ",") {
+		code = strings.TrimSpace(code)
+		if code == "" {
+			continue
+		}
+		if !label.PictogramValid(code) {
+			return db.Reagent{}, fmt.Errorf("unknown pictogram %s", code)
+		}
+		output.Hazards = append(output.Hazards, code)
+	}
+	if input.PeroxideTestDays != "" {
+		days, err := strconv.ParseInt(input.PeroxideTestDays, 10, 16)
+		if err != nil {
+			return db.Reagent{}, err
+		}
+		output.PeroxideTestDays = int16(days)
+	}
+	return output, nil
 }
 
 func ReagentCreateAPI(
@@ -265,48 +401,64 @@ func ReagentCreateAPI(
 	r *http.Request,
 	_ httprouter.Params,
 ) {
-	var reagent db.Reagent
-	err := common.BindJSON(r, &reagent)
+	var input reagentInput
+	err := common.BindJSON(r, &input)
 	if err != nil {
 		rc.Logger.Error(err.Error())
 		common.ErrorResp(w, common.Internal)
 		return
 	}
 
-	sanitizeReagent(rc, &reagent)
+	sanitizeReagent(rc, &input)
+	reagent, err := input.Bind()
+	if err != nil {
+		rc.Logger.Info(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
 	tmpl := template.Must(template.ParseFiles("templates/reagents-assets.html")).
 		Lookup("reagent-form")
 
-	err = rc.Validate.StructPartial(reagent, "Name", "Formula")
+	err = rc.Validate.StructPartial(reagent, "Name", "Formula", "Cas", "PeroxideTestDays")
 	var data reagentData
 	data.Caller.ID = rc.UserID
+	data.setHazards(reagent.Hazards)
 	if err != nil {
 		err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), reagent)
 		rc.Logger.Info(err.Error())
 		errMap := err.(common.ValidationError).Map()
 		data.NameErr = errMap["NameErr"]
 		data.FormulaErr = errMap["FormulaErr"]
+		data.CasErr = errMap["CasErr"]
+		data.PeroxideErr = errMap["PeroxideTestDaysErr"]
 		tmpl.Execute(w, data)
 		return
 	}
-	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{reagent.Create})
-	reagentErr := errs[0]
-	if reagentErr != nil {
-		errStruct := db.ErrorAsStruct(reagentErr)
-		switch errStruct.(type) {
-		case db.UniqueViolation:
-			err = errStruct.(db.UniqueViolation).Localize(db.Reagent{})
-			rc.Logger.Info(err.Error())
-			data.FormulaErr = err.(db.DBError).Map()["FormulaErr"]
-			tmpl.Execute(w, data)
-			return
-		default:
-			rc.Logger.Error(reagentErr.Error())
-			common.ErrorResp(w, common.Internal)
+	event, err := webhook.NewEvent(webhook.ReagentCreated, nil)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{reagent.Create, event.Enqueue})
+	for _, reagentErr := range errs {
+		if reagentErr != nil {
+			errStruct := db.ErrorAsStruct(reagentErr)
+			switch errStruct.(type) {
+			case db.UniqueViolation:
+				err = errStruct.(db.UniqueViolation).Localize(db.Reagent{})
+				rc.Logger.Info(err.Error())
+				errMap := err.(db.DBError).Map()
+				data.FormulaErr = errMap["FormulaErr"]
+				data.CasErr = errMap["CasErr"]
+				tmpl.Execute(w, data)
+			default:
+				rc.Logger.Error(reagentErr.Error())
+				common.ErrorResp(w, common.Internal)
+			}
 			return
 		}
 	}
-
 	w.Header().Set("HX-Redirect", fmt.Sprintf("/reagents/%s", reagent.ID))
 }
 
@@ -316,25 +468,37 @@ func ReagentPutAPI(
 	r *http.Request,
 	params httprouter.Params,
 ) {
-	var reagent db.Reagent
-	err := common.BindJSON(r, &reagent)
+	var input reagentInput
+	err := common.BindJSON(r, &input)
 	if err != nil {
 		rc.Logger.Error(err.Error())
 		common.ErrorResp(w, common.Internal)
 		return
 	}
-	sanitizeReagent(rc, &reagent)
+	sanitizeReagent(rc, &input)
+	reagent, err := input.Bind()
+	if err != nil {
+		rc.Logger.Info(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
 	tmpl := template.Must(template.ParseFiles("templates/reagents-assets.html"))
 
 	errTmpl := tmpl.Lookup("reagent-form")
+	var errData reagentData
+	errData.setHazards(reagent.Hazards)
 
-	err = rc.Validate.StructPartial(reagent, "Name", "Formula")
+	err = rc.Validate.StructPartial(reagent, "Name", "Formula", "Cas", "PeroxideTestDays")
 	if err != nil {
 		err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), reagent)
 		rc.Logger.Info(err.Error())
 		errMap := err.(common.ValidationError).Map()
+		errData.NameErr = errMap["NameErr"]
+		errData.FormulaErr = errMap["FormulaErr"]
+		errData.CasErr = errMap["CasErr"]
+		errData.PeroxideErr = errMap["PeroxideTestDaysErr"]
 		w.Header().Set("HX-Retarget", "#reagent-form")
-		errTmpl.Execute(w, errMap)
+		errTmpl.Execute(w, errData)
 		return
 	}
 	reagent.ID, err = uuid.Parse(params.ByName("reagentID"))
@@ -352,8 +516,11 @@ func ReagentPutAPI(
 			err = errStruct.(db.UniqueViolation).Localize(db.Reagent{})
 			rc.Logger.Info(err.Error())
 			errMap := err.(db.DBError).Map()
+			errData.NameErr = errMap["NameErr"]
+			errData.FormulaErr = errMap["FormulaErr"]
+			errData.CasErr = errMap["CasErr"]
 			w.Header().Set("HX-Retarget", "#reagent-form")
-			errTmpl.Execute(w, errMap)
+			errTmpl.Execute(w, errData)
 			return
 		default:
 			rc.Logger.Error(reagentErr.Error())
@@ -370,7 +537,11 @@ func ReagentPutAPI(
 		ID:      reagent.ID.String(),
 		Name:    reagent.Name,
 		Formula: reagent.Formula,
+		Cas:     reagent.Cas,
 		PutXsrf: getReagentPutXsrf(rc.UserID, reagent.ID),
+
+		PeroxideTestDays: reagent.PeroxideTestDays,
 	}
+	data.setHazards(reagent.Hazards)
 	successTmpl.Execute(w, data)
 }
@@ -5,6 +5,7 @@ import (
 	"html/template"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
@@ -16,28 +17,47 @@ import (
 	"github.com/Kelvedler/ChemicalStorage/pkg/db"
 	"github.com/Kelvedler/ChemicalStorage/pkg/env"
 	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+	"github.com/Kelvedler/ChemicalStorage/pkg/webhook"
 )
 
 type instanceData struct {
-	Caller         db.StorageUser
-	ID             uuid.UUID
-	Reagent        db.Reagent
-	Storage        db.Storage
-	StorageCell    db.StorageCell
-	UsedAt         time.Time
-	DeletedAt      time.Time
-	ExpiresAt      time.Time
-	Err            string
-	ExpiresAtErr   string
-	CellErr        string
-	StoragesSlice  []db.Storage
-	CreateXsrf     string
-	UseXsrf        string
-	TransferXsrf   string
-	EditState      bool
-	ReloadData     bool
-	ReloadUsedAt   bool
-	ReloadStorages bool
+	Caller           db.StorageUser
+	ID               uuid.UUID
+	Reagent          db.Reagent
+	Storage          db.Storage
+	StorageCell      db.StorageCell
+	UsedAt           time.Time
+	DeletedAt        time.Time
+	ExpiresAt        time.Time
+	Lot              string
+	Code             string
+	Supplier         string
+	Grade            string
+	Size             string
+	Barcode          string
+	Err              string
+	ExpiresAtErr     string
+	LotErr           string
+	SupplierErr      string
+	GradeErr         string
+	SizeErr          string
+	QuantityErr      string
+	CellErr          string
+	StoragesSlice    []db.Storage
+	CreateXsrf       string
+	UseXsrf          string
+	UseConfirm       string
+	TransferXsrf     string
+	Recertify        recertificationData
+	Recertifications []db.RecertificationExtended
+	Reservations     reservationsData
+	Checkout         checkoutData
+	PeroxideTest     peroxideTestData
+	PathSlice        []db.Storage
+	EditState        bool
+	ReloadData       bool
+	ReloadUsedAt     bool
+	ReloadStorages   bool
 }
 
 func getInstanceCreateXsrf(userID, reagentID uuid.UUID) string {
@@ -81,19 +101,23 @@ func ReagentInstanceCreate(
 			"templates/instance-new.html",
 			"templates/instances-assets.html",
 			"templates/storages-assets.html",
+			"templates/barcodes-assets.html",
 			"templates/base.html",
 		),
 	)
 	storagesRange := db.StoragesRange{
-		Limit:  40,
-		Offset: 0,
+		Limit:     40,
+		Offset:    0,
+		Placeable: true,
 	}
 	caller := db.StorageUser{ID: rc.UserID}
-	errs := db.PerformBatch(
-		r.Context(),
-		rc.DBpool,
-		[]db.BatchSet{storagesRange.Get, caller.GetByID},
-	)
+	scan := parseSupplierBarcode(r.URL.Query().Get("barcode"))
+	barcode := db.SupplierBarcode{Barcode: scan.Barcode}
+	batchSets := []db.BatchSet{storagesRange.Get, caller.GetByID}
+	if scan.Barcode != "" {
+		batchSets = append(batchSets, barcode.GetByBarcode)
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, batchSets)
 	storagesErr := errs[0]
 	if storagesErr != nil {
 		rc.Logger.Error(storagesErr.Error())
@@ -105,6 +129,16 @@ func ReagentInstanceCreate(
 		Reagent:       db.Reagent{ID: reagentID},
 		StoragesSlice: storagesRange.Storages,
 		CreateXsrf:    getInstanceCreateXsrf(caller.ID, reagentID),
+		Barcode:       scan.Barcode,
+		Lot:           scan.Lot,
+	}
+	if scan.ExpiresAt != "" {
+		data.ExpiresAt, _ = time.Parse(time.DateOnly, scan.ExpiresAt)
+	}
+	if len(errs) > 2 && errs[2] == nil && barcode.Reagent == reagentID {
+		data.Supplier = barcode.Supplier
+		data.Grade = barcode.Grade
+		data.Size = barcode.Size
 	}
 	tmpl.Execute(w, data)
 }
@@ -114,21 +148,47 @@ func sanitizeReagentInstance(rc *middleware.RequestContext, input *reagentInstan
 	input.ExpiresAt = sanitizer.Sanitize(input.ExpiresAt)
 	input.Storage = sanitizer.Sanitize(input.Storage)
 	input.Cell = sanitizer.Sanitize(input.Cell)
+	input.Lot = sanitizer.Sanitize(input.Lot)
+	input.Supplier = sanitizer.Sanitize(input.Supplier)
+	input.Grade = sanitizer.Sanitize(input.Grade)
+	input.Size = sanitizer.Sanitize(input.Size)
+	input.Quantity = sanitizer.Sanitize(input.Quantity)
 }
 
 type reagentInstanceInput struct {
 	ExpiresAt string `json:"expires_at"`
 	Storage   string `json:"storage"`
 	Cell      string `json:"cell"`
+	Lot       string `json:"lot"`
+	Supplier  string `json:"supplier"`
+	Grade     string `json:"grade"`
+	Size      string `json:"size"`
+	Quantity  string `json:"quantity"`
 }
 
 type reagentInstance struct {
-	ExpiresAt time.Time `json:"expires_at" validate:"gt" uaLocal:"термін придатності"`
+	ExpiresAt time.Time `json:"expires_at" validate:"gt"            uaLocal:"термін придатності"`
 	Storage   uuid.UUID `json:"storage"`
-	Cell      int16     `json:"cell"                     uaLocal:"відділ"`
+	Cell      int16     `json:"cell"                                uaLocal:"відділ"`
+	Lot       string    `json:"lot"        validate:"lte=50"        uaLocal:"партія"`
+	Supplier  string    `json:"supplier"   validate:"lte=100"       uaLocal:"постачальник"`
+	Grade     string    `json:"grade"      validate:"lte=50"        uaLocal:"кваліфікація"`
+	Size      string    `json:"size"       validate:"lte=50"        uaLocal:"фасування"`
+	Quantity  int       `json:"quantity"   validate:"min=1,max=50"  uaLocal:"кількість"`
 }
 
 func (input reagentInstanceInput) Bind() (output reagentInstance, err error) {
+	output.Lot = strings.TrimSpace(input.Lot)
+	output.Supplier = strings.TrimSpace(input.Supplier)
+	output.Grade = strings.TrimSpace(input.Grade)
+	output.Size = strings.TrimSpace(input.Size)
+	output.Quantity = 1
+	if input.Quantity != "" {
+		output.Quantity, err = strconv.Atoi(input.Quantity)
+		if err != nil {
+			return reagentInstance{}, err
+		}
+	}
 	if input.ExpiresAt != "" {
 		expiresAt, err := time.Parse(time.DateOnly, input.ExpiresAt)
 		if err != nil {
@@ -180,7 +240,13 @@ func ReagentInstanceCreateAPI(
 	if err != nil {
 		err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), input)
 		rc.Logger.Info(err.Error())
-		returnData.ExpiresAtErr = err.(common.ValidationError).Map()["ExpiresAtErr"]
+		errMap := err.(common.ValidationError).Map()
+		returnData.ExpiresAtErr = errMap["ExpiresAtErr"]
+		returnData.LotErr = errMap["LotErr"]
+		returnData.SupplierErr = errMap["SupplierErr"]
+		returnData.GradeErr = errMap["GradeErr"]
+		returnData.SizeErr = errMap["SizeErr"]
+		returnData.QuantityErr = errMap["QuantityErr"]
 		tmpl.Execute(w, returnData)
 		return
 	}
@@ -190,24 +256,63 @@ func ReagentInstanceCreateAPI(
 		common.ErrorResp(w, common.NotFound)
 		return
 	}
-	reagentInstance := db.ReagentInstance{
-		Reagent:   reagentID,
-		ExpiresAt: input.ExpiresAt,
-	}
 	storageCell := db.StorageCell{
 		Storage: input.Storage,
 		Number:  input.Cell,
 	}
-	reagentInstanceExtended := db.ReagentInstanceExtended{
-		ReagentInstance: reagentInstance,
-		Storage:         db.Storage{ID: input.Storage},
-		StorageCell:     storageCell,
+	receiving := db.ReceivingExtended{
+		Receiving: db.Receiving{
+			ID:          uuid.New(),
+			StorageUser: rc.UserID,
+			Reagent:     reagentID,
+			Supplier:    input.Supplier,
+			Grade:       input.Grade,
+			Size:        input.Size,
+		},
+		Storage:     db.Storage{ID: input.Storage},
+		StorageCell: storageCell,
+		ExpiresAt:   input.ExpiresAt,
+		Lot:         input.Lot,
+		Quantity:    input.Quantity,
+	}
+	denied, err := storageAccessDenied(rc, r, &db.StoragePermission{StorageID: input.Storage})
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	if denied != nil {
+		rc.Logger.Info("Storage access denied")
+		returnData.CellErr = storageAccessDeniedMessage(denied)
+		tmpl.Execute(w, returnData)
+		return
+	}
+	event, err := webhook.NewEvent(webhook.InstanceCreated, nil)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
 	}
+	reagent := db.Reagent{ID: reagentID}
 	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{
+		reagent.Get,
 		storageCell.TryCreate,
-		reagentInstanceExtended.Create,
+		receiving.Create,
+		event.Enqueue,
 	})
-	for _, err = range errs {
+	if errs[0] != nil {
+		errStruct := db.ErrorAsStruct(errs[0])
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Reagent not found")
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(errs[0].Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	for _, err = range errs[1:] {
 		if err != nil {
 			errStruct := db.ErrorAsStruct(err)
 			switch errStruct.(type) {
@@ -216,6 +321,15 @@ func ReagentInstanceCreateAPI(
 				rc.Logger.Info(err.Error())
 				returnData.CellErr = err.(db.DBError).Map()["NumberErr"]
 				tmpl.Execute(w, returnData)
+			case db.CapacityExceeded:
+				err = errStruct.(db.CapacityExceeded).Localize(storageCell)
+				rc.Logger.Info(err.Error())
+				returnData.CellErr = err.(db.DBError).Map()["NumberErr"]
+				tmpl.Execute(w, returnData)
+			case db.DoesNotExist:
+				rc.Logger.Info("Cell not found")
+				returnData.CellErr = "Відділ не знайдено, оберіть інший"
+				tmpl.Execute(w, returnData)
 			default:
 				rc.Logger.Error(err.Error())
 				common.ErrorResp(w, common.Internal)
@@ -223,8 +337,7 @@ func ReagentInstanceCreateAPI(
 			return
 		}
 	}
-
-	w.Header().Set("HX-Redirect", fmt.Sprintf("/reagents/%s", reagentInstance.Reagent))
+	w.Header().Set("HX-Redirect", fmt.Sprintf("/receivings/%s", receiving.Receiving.ID))
 }
 
 func ReagentInstance(
@@ -247,13 +360,28 @@ func ReagentInstance(
 		ReagentInstance: db.ReagentInstance{ID: instanceID, Reagent: reagentID},
 	}
 	storagesRange := db.StoragesRange{
-		Limit:  40,
-		Offset: 0,
+		Limit:     40,
+		Offset:    0,
+		Placeable: true,
 	}
+	recertificationRange := db.RecertificationRange{ReagentInstanceID: instanceID}
+	path := db.StoragePath{InstanceID: instanceID}
+	reservationsRange := db.ReservationsRange{InstanceID: instanceID}
+	checkoutsRange := db.CheckoutsRange{InstanceID: instanceID}
+	peroxideTest := db.PeroxideTest{Instance: rie}
 	errs := db.PerformBatch(
 		r.Context(),
 		rc.DBpool,
-		[]db.BatchSet{rie.Get, storagesRange.Get, caller.GetByID},
+		[]db.BatchSet{
+			rie.Get,
+			storagesRange.Get,
+			caller.GetByID,
+			recertificationRange.Get,
+			path.Get,
+			reservationsRange.Get,
+			checkoutsRange.Get,
+			peroxideTest.Get,
+		},
 	)
 	for i, err := range errs {
 		if err != nil {
@@ -268,7 +396,7 @@ func ReagentInstance(
 					common.ErrorResp(w, common.NotFound)
 				}
 			default:
-				rc.Logger.Error(instanceErr.Error())
+				rc.Logger.Error(err.Error())
 				common.ErrorResp(w, common.Internal)
 			}
 			return
@@ -279,14 +407,31 @@ func ReagentInstance(
 		Caller:        caller,
 		ID:            rie.ReagentInstance.ID,
 		UsedAt:        rie.ReagentInstance.UsedAt,
+		DeletedAt:     rie.ReagentInstance.DeletedAt,
 		ExpiresAt:     rie.ReagentInstance.ExpiresAt,
+		Lot:           rie.ReagentInstance.Lot,
+		Code:          rie.ReagentInstance.Code,
 		Reagent:       rie.Reagent,
 		Storage:       rie.Storage,
 		StorageCell:   rie.StorageCell,
 		StoragesSlice: storagesRange.Storages,
 		UseXsrf:       getInstanceUseXsrf(rc.UserID, rie.ReagentInstance.ID, rie.Reagent.ID),
+		UseConfirm:    reservationUseConfirm(reservationsRange.Reservations, rc.UserID),
 		TransferXsrf:  getInstanceTranserXsrf(rc.UserID, rie.ReagentInstance.ID, rie.Reagent.ID),
+		Recertify: recertificationData{
+			ReagentID:     rie.Reagent.ID,
+			InstanceID:    rie.ReagentInstance.ID,
+			RecertifyXsrf: getInstanceRecertifyXsrf(rc.UserID, rie.ReagentInstance.ID, rie.Reagent.ID),
+		},
+		Recertifications: recertificationRange.RecertificationsExtended,
+		Reservations:     newReservationsData(rc, rie, reservationsRange.Reservations),
+		Checkout:         newCheckoutData(rc, rie, checkoutsRange, storagesRange.Storages),
+		PeroxideTest:     newPeroxideTestData(rc, rie, peroxideTest),
+		PathSlice:        path.Storages,
 	}
+	_, transfer := r.URL.Query()["transfer"]
+	data.EditState = transfer && caller.Role == db.Assistant && rie.ReagentInstance.UsedAt.IsZero() &&
+		rie.ReagentInstance.DeletedAt.IsZero()
 	tmpl := template.Must(
 		template.ParseFiles(
 			"templates/instance.html",
@@ -316,29 +461,71 @@ func ReagentInstanceUseAPI(
 	tmpl := template.Must(template.ParseFiles("templates/instances-assets.html", "templates/storages-assets.html")).
 		Lookup("instance")
 
-	rie := db.ReagentInstanceExtended{
-		ReagentInstance: db.ReagentInstance{ID: instanceID, Reagent: reagentID, UsedAt: time.Now()},
+	denied, err := storageAccessDenied(rc, r, &db.StoragePermission{InstanceID: instanceID})
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
 	}
-	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{rie.Update})
-	instanceErr = errs[0]
-	if instanceErr != nil {
-		errStruct := db.ErrorAsStruct(instanceErr)
-		switch errStruct.(type) {
-		case db.AlreadySet:
-			rc.Logger.Info(instanceErr.Error())
-			common.ErrorResp(w, common.Internal)
-		case db.DoesNotExist:
-			rc.Logger.Info(instanceErr.Error())
-			common.ErrorResp(w, common.NotFound)
-		default:
-			rc.Logger.Error(instanceErr.Error())
-			common.ErrorResp(w, common.Internal)
-		}
+	if denied != nil {
+		rc.Logger.Info("Storage access denied")
+		common.ErrorResp(w, common.Forbidden)
 		return
 	}
+	_, force := r.URL.Query()["force"]
+	use := db.ReagentInstanceUse{
+		ReagentInstance:    db.ReagentInstance{ID: instanceID, Reagent: reagentID, UsedAt: time.Now()},
+		StorageUser:        rc.UserID,
+		IgnoreReservations: force,
+	}
+	event, err := webhook.NewEvent(
+		webhook.InstanceUsed,
+		map[string]any{
+			"used_at": use.ReagentInstance.UsedAt.UTC(),
+			"used_by": rc.UserID,
+		},
+		instanceID,
+	)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{use.Use, event.Enqueue})
+	for _, instanceErr = range errs {
+		if instanceErr != nil {
+			errStruct := db.ErrorAsStruct(instanceErr)
+			switch errStruct.(type) {
+			case db.AlreadySet:
+				rc.Logger.Info(instanceErr.Error())
+				common.ErrorResp(w, common.Internal)
+			case db.DoesNotExist:
+				reservation, reserved, err := instanceReservationConflict(rc, r, instanceID)
+				if err != nil {
+					rc.Logger.Error(err.Error())
+					common.ErrorResp(w, common.Internal)
+					return
+				}
+				if !reserved {
+					rc.Logger.Info(instanceErr.Error())
+					common.ErrorResp(w, common.NotFound)
+					return
+				}
+				rc.Logger.Info("Instance reserved")
+				errTmpl := template.Must(template.ParseFiles("templates/instances-assets.html")).
+					Lookup("instance-use-error")
+				w.Header().Set("HX-Retarget", "#instance-use-error")
+				errTmpl.Execute(w, reservationText(reservation))
+			default:
+				rc.Logger.Error(instanceErr.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return
+		}
+	}
 	data := instanceData{
 		Caller:       db.StorageUser{ID: rc.UserID, Role: rc.UserRole},
-		UsedAt:       rie.ReagentInstance.UsedAt,
+		UsedAt:       use.ReagentInstance.UsedAt,
 		ReloadUsedAt: true,
 	}
 	tmpl.Execute(w, data)
@@ -382,11 +569,6 @@ func ReagentInstanceTransferAPI(
 		StorageCell:     storageCell,
 		Storage:         db.Storage{ID: input.Storage},
 	}
-	errs := db.PerformBatch(
-		r.Context(),
-		rc.DBpool,
-		[]db.BatchSet{storageCell.TryCreate, rie.Update},
-	)
 	tmpl := template.Must(
 		template.ParseFiles("templates/instances-assets.html", "templates/storages-assets.html"),
 	).Lookup("instance")
@@ -395,6 +577,35 @@ func ReagentInstanceTransferAPI(
 		StorageCell:    rie.StorageCell,
 		ReloadStorages: true,
 	}
+	denied, err := storageAccessDenied(
+		rc,
+		r,
+		&db.StoragePermission{InstanceID: instanceID},
+		&db.StoragePermission{StorageID: input.Storage},
+	)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	if denied != nil {
+		rc.Logger.Info("Storage access denied")
+		data.CellErr = storageAccessDeniedMessage(denied)
+		data.EditState = true
+		tmpl.Execute(w, data)
+		return
+	}
+	event, err := webhook.NewEvent(webhook.InstanceTransferred, nil, instanceID)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{storageCell.TryCreate, rie.Update, event.Enqueue},
+	)
 	for _, err = range errs {
 		if err != nil {
 			errStruct := db.ErrorAsStruct(err)
@@ -405,6 +616,17 @@ func ReagentInstanceTransferAPI(
 				data.CellErr = err.(db.DBError).Map()["NumberErr"]
 				data.EditState = true
 				tmpl.Execute(w, data)
+			case db.CapacityExceeded:
+				err = errStruct.(db.CapacityExceeded).Localize(storageCell)
+				rc.Logger.Info(err.Error())
+				data.CellErr = err.(db.DBError).Map()["NumberErr"]
+				data.EditState = true
+				tmpl.Execute(w, data)
+			case db.DoesNotExist:
+				rc.Logger.Info("Cell not found")
+				data.CellErr = "Відділ не знайдено, оберіть інший"
+				data.EditState = true
+				tmpl.Execute(w, data)
 			default:
 				rc.Logger.Error(err.Error())
 				common.ErrorResp(w, common.Internal)
@@ -0,0 +1,469 @@
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/xsrftoken"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+)
+
+const reagentRequestMaxItems = 50
+
+type reagentRequestsData struct {
+	Caller         db.StorageUser
+	RequestsSlice  []db.ReagentRequestExtended
+	CanCreate      bool
+	AwaitingReview int
+}
+
+type reagentRequestNewData struct {
+	Caller      db.StorageUser
+	Reagent     db.Reagent
+	MinDate     string
+	PostXsrf    string
+	TitleErr    string
+	NeededByErr string
+	ItemsErr    string
+	Options     reagentOptionsData
+}
+
+type reagentRequestData struct {
+	Caller     db.StorageUser
+	Request    db.ReagentRequestExtended
+	Review     bool
+	Overdue    bool
+	Err        string
+	ReviewXsrf string
+}
+
+type reagentOptionsData struct {
+	ReagentsSlice []db.Reagent
+}
+
+type reagentRequestInput struct {
+	Title    string   `json:"title"`
+	NeededBy string   `json:"needed_by"`
+	Reagents []string `json:"reagents"`
+	Amounts  []string `json:"amounts"`
+}
+
+type reagentRequestReviewInput struct {
+	Action    string   `json:"action"`
+	Comment   string   `json:"comment"`
+	Instances []string `json:"instances"`
+}
+
+func getReagentRequestPostXsrf(userID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		"/api/v1/requests",
+	)
+}
+
+func getReagentRequestReviewXsrf(userID, requestID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/requests/%s/review", requestID),
+	)
+}
+
+func today() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
+
+func ReagentRequests(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	requestsRange := db.ReagentRequestsRange{Limit: 100}
+	if rc.UserRole == db.Lecturer {
+		requestsRange.StorageUserID = rc.UserID
+	}
+	caller := db.StorageUser{ID: rc.UserID}
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{requestsRange.Get, caller.GetByID},
+	)
+	if errs[0] != nil {
+		rc.Logger.Error(errs[0].Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	data := reagentRequestsData{
+		Caller:        caller,
+		RequestsSlice: requestsRange.ReagentRequests,
+		CanCreate:     rc.UserRole == db.Lecturer,
+	}
+	for _, request := range data.RequestsSlice {
+		if request.ReagentRequest.Status == db.RequestPending {
+			data.AwaitingReview++
+		}
+	}
+	tmpl := template.Must(
+		template.ParseFiles(
+			"templates/requests.html",
+			"templates/requests-assets.html",
+			"templates/base.html",
+		),
+	)
+	tmpl.Execute(w, data)
+}
+
+func ReagentRequestCreate(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	caller := db.StorageUser{ID: rc.UserID}
+	reagentsRange := db.ReagentsRange{Limit: 20, Offset: 0}
+	batchSets := []db.BatchSet{caller.GetByID, reagentsRange.Get}
+	reagent := db.Reagent{}
+	reagentID, err := uuid.Parse(r.URL.Query().Get("reagent"))
+	if err == nil {
+		reagent.ID = reagentID
+		batchSets = append(batchSets, reagent.Get)
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, batchSets)
+	if errs[0] != nil {
+		rc.Logger.Info("Unauthorized")
+		common.ErrorResp(w, common.Unauthorized)
+		return
+	}
+	if errs[1] != nil {
+		rc.Logger.Error(errs[1].Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	if len(errs) > 2 && errs[2] != nil {
+		rc.Logger.Info(errs[2].Error())
+		reagent = db.Reagent{}
+	}
+	data := reagentRequestNewData{
+		Caller:   caller,
+		Reagent:  reagent,
+		MinDate:  today().Format(time.DateOnly),
+		PostXsrf: getReagentRequestPostXsrf(rc.UserID),
+		Options:  reagentOptionsData{ReagentsSlice: reagentsRange.Reagents},
+	}
+	tmpl := template.Must(
+		template.ParseFiles(
+			"templates/request-new.html",
+			"templates/requests-assets.html",
+			"templates/base.html",
+		),
+	)
+	tmpl.Execute(w, data)
+}
+
+func ReagentOptionsAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	reagentsRange := db.ReagentsRange{
+		Limit:  20,
+		Offset: 0,
+		Src:    rc.Sanitize.Sanitize(strings.TrimSpace(r.URL.Query().Get("search"))),
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{reagentsRange.Get})
+	if errs[0] != nil {
+		rc.Logger.Error(errs[0].Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	tmpl := template.Must(template.ParseFiles("templates/requests-assets.html")).
+		Lookup("reagent-options")
+	tmpl.Execute(w, reagentOptionsData{ReagentsSlice: reagentsRange.Reagents})
+}
+
+func (input reagentRequestInput) Bind() (request db.ReagentRequestExtended, err error) {
+	request.ReagentRequest.Title = strings.TrimSpace(input.Title)
+	if input.NeededBy != "" {
+		request.ReagentRequest.NeededBy, err = time.Parse(time.DateOnly, input.NeededBy)
+		if err != nil {
+			return db.ReagentRequestExtended{}, err
+		}
+	}
+	seen := make(map[uuid.UUID]bool)
+	for i, reagentStr := range input.Reagents {
+		reagentID, err := uuid.Parse(reagentStr)
+		if err != nil {
+			return db.ReagentRequestExtended{}, err
+		}
+		if seen[reagentID] {
+			continue
+		}
+		seen[reagentID] = true
+		item := db.ReagentRequestItemExtended{
+			ReagentRequestItem: db.ReagentRequestItem{Reagent: reagentID},
+		}
+		if i < len(input.Amounts) {
+			item.ReagentRequestItem.Amount = strings.TrimSpace(input.Amounts[i])
+		}
+		request.Items = append(request.Items, item)
+	}
+	return request, nil
+}
+
+func ReagentRequestCreateAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	var input reagentRequestInput
+	err := common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	input.Title = rc.Sanitize.Sanitize(input.Title)
+	input.NeededBy = rc.Sanitize.Sanitize(input.NeededBy)
+	for i := range input.Reagents {
+		input.Reagents[i] = rc.Sanitize.Sanitize(input.Reagents[i])
+	}
+	for i := range input.Amounts {
+		input.Amounts[i] = rc.Sanitize.Sanitize(input.Amounts[i])
+	}
+	request, err := input.Bind()
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	tmpl := template.Must(template.ParseFiles("templates/requests-assets.html")).
+		Lookup("request-errors")
+	data := reagentRequestNewData{}
+	err = rc.Validate.Struct(request.ReagentRequest)
+	if err != nil {
+		err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), request.ReagentRequest)
+		rc.Logger.Info(err.Error())
+		data.TitleErr = err.(common.ValidationError).Map()["TitleErr"]
+	}
+	if request.ReagentRequest.NeededBy.Before(today()) {
+		data.NeededByErr = "Оберіть дату, не ранішу за сьогодні"
+	}
+	switch {
+	case len(request.Items) == 0:
+		data.ItemsErr = "Додайте хоча б один реагент"
+	case len(request.Items) > reagentRequestMaxItems:
+		data.ItemsErr = fmt.Sprintf("Не більше %d реагентів в одному запиті", reagentRequestMaxItems)
+	}
+	for _, item := range request.Items {
+		if rc.Validate.Struct(item.ReagentRequestItem) != nil {
+			data.ItemsErr = "Кількість має містити не більше 50 символів"
+		}
+	}
+	if data.TitleErr != "" || data.NeededByErr != "" || data.ItemsErr != "" {
+		rc.Logger.Info("Invalid request")
+		tmpl.Execute(w, data)
+		return
+	}
+	request.ReagentRequest.ID = uuid.New()
+	request.ReagentRequest.StorageUser = rc.UserID
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{request.Create})
+	if errs[0] != nil {
+		errStruct := db.ErrorAsStruct(errs[0])
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Reagents not found")
+			data.ItemsErr = "Обрані реагенти не знайдено"
+			tmpl.Execute(w, data)
+		default:
+			rc.Logger.Error(errs[0].Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	w.Header().Set("HX-Redirect", fmt.Sprintf("/requests/%s", request.ReagentRequest.ID))
+}
+
+func reagentRequestFromParams(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) (db.ReagentRequestExtended, bool) {
+	requestID, err := uuid.Parse(params.ByName("requestID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return db.ReagentRequestExtended{}, false
+	}
+	request := db.ReagentRequestExtended{ReagentRequest: db.ReagentRequest{ID: requestID}}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{request.Get})
+	if errs[0] != nil {
+		errStruct := db.ErrorAsStruct(errs[0])
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Not found")
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(errs[0].Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return db.ReagentRequestExtended{}, false
+	}
+	if rc.UserRole == db.Lecturer && request.ReagentRequest.StorageUser != rc.UserID {
+		rc.Logger.Info("Foreign request")
+		common.ErrorResp(w, common.Forbidden)
+		return db.ReagentRequestExtended{}, false
+	}
+	return request, true
+}
+
+func newReagentRequestData(
+	rc *middleware.RequestContext,
+	request db.ReagentRequestExtended,
+) reagentRequestData {
+	pending := request.ReagentRequest.Status == db.RequestPending
+	return reagentRequestData{
+		Caller:     db.StorageUser{ID: rc.UserID, Role: rc.UserRole},
+		Request:    request,
+		Review:     pending && rc.UserRole == db.Assistant,
+		Overdue:    pending && request.ReagentRequest.NeededBy.Before(today()),
+		ReviewXsrf: getReagentRequestReviewXsrf(rc.UserID, request.ReagentRequest.ID),
+	}
+}
+
+func ReagentRequest(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	request, ok := reagentRequestFromParams(rc, w, r, params)
+	if !ok {
+		return
+	}
+	caller := db.StorageUser{ID: rc.UserID}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{caller.GetByID})
+	if errs[0] != nil {
+		rc.Logger.Info("Unauthorized")
+		common.ErrorResp(w, common.Unauthorized)
+		return
+	}
+	data := newReagentRequestData(rc, request)
+	data.Caller = caller
+	tmpl := template.Must(
+		template.ParseFiles(
+			"templates/request.html",
+			"templates/requests-assets.html",
+			"templates/base.html",
+		),
+	)
+	tmpl.Execute(w, data)
+}
+
+func (input reagentRequestReviewInput) Bind() (picks []db.ReagentRequestInstance, err error) {
+	for _, pickStr := range input.Instances {
+		itemStr, instanceStr, _ := strings.Cut(pickStr, ":")
+		var pick db.ReagentRequestInstance
+		pick.ReagentRequestItem, err = uuid.Parse(itemStr)
+		if err != nil {
+			return nil, err
+		}
+		pick.ReagentInstance, err = uuid.Parse(instanceStr)
+		if err != nil {
+			return nil, err
+		}
+		picks = append(picks, pick)
+	}
+	return picks, nil
+}
+
+func ReagentRequestReviewAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	request, ok := reagentRequestFromParams(rc, w, r, params)
+	if !ok {
+		return
+	}
+	var input reagentRequestReviewInput
+	err := common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	input.Action = rc.Sanitize.Sanitize(input.Action)
+	input.Comment = rc.Sanitize.Sanitize(input.Comment)
+	for i := range input.Instances {
+		input.Instances[i] = rc.Sanitize.Sanitize(input.Instances[i])
+	}
+	picks, err := input.Bind()
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	tmpl := template.Must(template.ParseFiles("templates/requests-assets.html")).
+		Lookup("request-review-error")
+	request.ReagentRequest.Reviewer = rc.UserID
+	request.ReagentRequest.Comment = strings.TrimSpace(input.Comment)
+	err = rc.Validate.Struct(request.ReagentRequest)
+	if err != nil {
+		err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), request.ReagentRequest)
+		rc.Logger.Info(err.Error())
+		tmpl.Execute(w, err.(common.ValidationError).Map()["CommentErr"])
+		return
+	}
+	var review db.BatchSet
+	switch input.Action {
+	case db.RequestApproved:
+		if len(picks) == 0 {
+			rc.Logger.Info("Nothing picked")
+			tmpl.Execute(w, "Оберіть хоча б один екземпляр або відхиліть запит")
+			return
+		}
+		request.Picks = picks
+		review = request.Approve
+	case db.RequestRejected:
+		if request.ReagentRequest.Comment == "" {
+			rc.Logger.Info("Rejected without comment")
+			tmpl.Execute(w, "Вкажіть причину відхилення в коментарі")
+			return
+		}
+		review = request.Reject
+	default:
+		rc.Logger.Info("Unknown action")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{review})
+	if errs[0] != nil {
+		errStruct := db.ErrorAsStruct(errs[0])
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Request already reviewed")
+			tmpl.Execute(w, "Запит уже розглянуто або обрані екземпляри більше недоступні")
+		default:
+			rc.Logger.Error(errs[0].Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	w.Header().Set("HX-Redirect", fmt.Sprintf("/requests/%s", request.ReagentRequest.ID))
+}
@@ -0,0 +1,209 @@
+package view
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/xsrftoken"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+)
+
+const (
+	maxAttachmentSize = 5 << 20
+	maxAttachmentName = 255
+)
+
+type recertificationData struct {
+	ReagentID        uuid.UUID
+	InstanceID       uuid.UUID
+	NewExpiresAt     string
+	Justification    string
+	NewExpiresAtErr  string
+	JustificationErr string
+	AttachmentErr    string
+	RecertifyXsrf    string
+}
+
+func getInstanceRecertifyXsrf(userID, instanceID, reagentID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/reagents/%s/instances/%s/recertify", reagentID, instanceID),
+	)
+}
+
+func readAttachment(r *http.Request) (content []byte, name, contentType string, err error) {
+	file, header, err := r.FormFile("attachment")
+	if errors.Is(err, http.ErrMissingFile) {
+		return nil, "", "", nil
+	} else if err != nil {
+		return nil, "", "", err
+	}
+	defer file.Close()
+	content, err = io.ReadAll(io.LimitReader(file, maxAttachmentSize+1))
+	if err != nil {
+		return nil, "", "", err
+	}
+	name = filepath.Base(header.Filename)
+	if runes := []rune(name); len(runes) > maxAttachmentName {
+		name = string(runes[:maxAttachmentName])
+	}
+	return content, name, http.DetectContentType(content), nil
+}
+
+func ReagentInstanceRecertifyAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	reagentID, reagentErr := uuid.Parse(params.ByName("reagentID"))
+	instanceID, instanceErr := uuid.Parse(params.ByName("instanceID"))
+	for _, err := range []error{reagentErr, instanceErr} {
+		if err != nil {
+			rc.Logger.Info(err.Error())
+			common.ErrorResp(w, common.NotFound)
+			return
+		}
+	}
+	tmpl := template.Must(template.ParseFiles("templates/instances-assets.html", "templates/storages-assets.html")).
+		Lookup("recertify-form")
+	r.Body = http.MaxBytesReader(w, r.Body, maxAttachmentSize+(1<<20))
+	err := r.ParseMultipartForm(maxAttachmentSize)
+	if err != nil {
+		rc.Logger.Info(err.Error())
+		data := recertificationData{
+			ReagentID:     reagentID,
+			InstanceID:    instanceID,
+			AttachmentErr: "Не вдалося завантажити файл",
+			RecertifyXsrf: getInstanceRecertifyXsrf(rc.UserID, instanceID, reagentID),
+		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			data.AttachmentErr = "Файл перевищує 5 МБ"
+		}
+		tmpl.Execute(w, data)
+		return
+	}
+	sanitizer := rc.Sanitize
+	data := recertificationData{
+		ReagentID:     reagentID,
+		InstanceID:    instanceID,
+		NewExpiresAt:  sanitizer.Sanitize(r.FormValue("new_expires_at")),
+		Justification: sanitizer.Sanitize(r.FormValue("justification")),
+		RecertifyXsrf: getInstanceRecertifyXsrf(rc.UserID, instanceID, reagentID),
+	}
+	recertification := db.Recertification{
+		ReagentInstance: instanceID,
+		Reagent:         reagentID,
+		StorageUser:     rc.UserID,
+		Justification:   data.Justification,
+	}
+	if data.NewExpiresAt != "" {
+		recertification.NewExpiresAt, err = time.Parse(time.DateOnly, data.NewExpiresAt)
+		if err != nil {
+			rc.Logger.Info(err.Error())
+			data.NewExpiresAtErr = "Невірна дата"
+			tmpl.Execute(w, data)
+			return
+		}
+	}
+	err = rc.Validate.StructPartial(recertification, "NewExpiresAt", "Justification")
+	if err != nil {
+		err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), recertification)
+		rc.Logger.Info(err.Error())
+		errMap := err.(common.ValidationError).Map()
+		data.NewExpiresAtErr = errMap["NewExpiresAtErr"]
+		data.JustificationErr = errMap["JustificationErr"]
+		tmpl.Execute(w, data)
+		return
+	}
+	recertification.Attachment,
+		recertification.AttachmentName,
+		recertification.AttachmentType,
+		err = readAttachment(r)
+	if err != nil {
+		rc.Logger.Info(err.Error())
+		data.AttachmentErr = "Не вдалося завантажити файл"
+		tmpl.Execute(w, data)
+		return
+	}
+	if len(recertification.Attachment) > maxAttachmentSize {
+		rc.Logger.Info("Attachment too large")
+		data.AttachmentErr = "Файл перевищує 5 МБ"
+		tmpl.Execute(w, data)
+		return
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{recertification.Create})
+	recertificationErr := errs[0]
+	if recertificationErr != nil {
+		errStruct := db.ErrorAsStruct(recertificationErr)
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info(recertificationErr.Error())
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(recertificationErr.Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	w.Header().Set("HX-Redirect", fmt.Sprintf("/reagents/%s/instances/%s", reagentID, instanceID))
+}
+
+func RecertificationAttachment(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	reagentID, reagentErr := uuid.Parse(params.ByName("reagentID"))
+	instanceID, instanceErr := uuid.Parse(params.ByName("instanceID"))
+	recertificationID, recertificationErr := uuid.Parse(params.ByName("recertificationID"))
+	for _, err := range []error{reagentErr, instanceErr, recertificationErr} {
+		if err != nil {
+			rc.Logger.Info(err.Error())
+			common.ErrorResp(w, common.NotFound)
+			return
+		}
+	}
+	recertification := db.Recertification{
+		ID:              recertificationID,
+		ReagentInstance: instanceID,
+		Reagent:         reagentID,
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{recertification.GetAttachment})
+	attachmentErr := errs[0]
+	if attachmentErr != nil {
+		errStruct := db.ErrorAsStruct(attachmentErr)
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Not found")
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(attachmentErr.Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", http.DetectContentType(recertification.Attachment))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set(
+		"Content-Disposition",
+		mime.FormatMediaType("attachment", map[string]string{"filename": recertification.AttachmentName}),
+	)
+	w.Write(recertification.Attachment)
+}
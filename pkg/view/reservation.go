@@ -0,0 +1,311 @@
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/xsrftoken"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+)
+
+type reservationItem struct {
+	Reservation db.ReservationExtended
+	Cancelable  bool
+	DeleteXsrf  string
+}
+
+type reservationsData struct {
+	ReagentID         uuid.UUID
+	InstanceID        uuid.UUID
+	Reservable        bool
+	Form              reservationInput
+	MinDate           string
+	PurposeErr        string
+	DatesErr          string
+	PostXsrf          string
+	ReservationsSlice []reservationItem
+}
+
+type reservationInput struct {
+	Purpose       string `json:"purpose"`
+	ReservedFrom  string `json:"reserved_from"`
+	ReservedUntil string `json:"reserved_until"`
+}
+
+func getReservationPostXsrf(userID, reagentID, instanceID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/reagents/%s/instances/%s/reservations", reagentID, instanceID),
+	)
+}
+
+func getReservationDeleteXsrf(userID, reagentID, instanceID, reservationID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf(
+			"/api/v1/reagents/%s/instances/%s/reservations/%s",
+			reagentID,
+			instanceID,
+			reservationID,
+		),
+	)
+}
+
+func reservationText(reservation db.ReservationExtended) string {
+	return fmt.Sprintf(
+		"Зарезервовано для %s (%s) до %s",
+		reservation.StorageUser.Name,
+		reservation.Reservation.Purpose,
+		reservation.Reservation.ReservedUntil.Format("02.01.2006"),
+	)
+}
+
+func reservationConflict(
+	reservations []db.ReservationExtended,
+	userID uuid.UUID,
+) (db.ReservationExtended, bool) {
+	for _, reservation := range reservations {
+		if reservation.Active && reservation.Reservation.StorageUser != userID {
+			return reservation, true
+		}
+	}
+	return db.ReservationExtended{}, false
+}
+
+func instanceReservationConflict(
+	rc *middleware.RequestContext,
+	r *http.Request,
+	instanceID uuid.UUID,
+) (db.ReservationExtended, bool, error) {
+	reservationsRange := db.ReservationsRange{InstanceID: instanceID}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{reservationsRange.Get})
+	if errs[0] != nil {
+		return db.ReservationExtended{}, false, errs[0]
+	}
+	reservation, ok := reservationConflict(reservationsRange.Reservations, rc.UserID)
+	return reservation, ok, nil
+}
+
+func reservationUseConfirm(reservations []db.ReservationExtended, userID uuid.UUID) string {
+	reservation, ok := reservationConflict(reservations, userID)
+	if !ok {
+		return ""
+	}
+	return reservationText(reservation) + ". Використати попри резерв?"
+}
+
+func setReservations(
+	instances []db.ReagentInstanceExtended,
+	reservationsRange db.ReservationsRange,
+) {
+	for i := range instances {
+		reservations := reservationsRange.ByInstance(instances[i].ReagentInstance.ID)
+		if len(reservations) != 0 {
+			instances[i].Reservation = reservations[0]
+		}
+	}
+}
+
+func newReservationsData(
+	rc *middleware.RequestContext,
+	rie db.ReagentInstanceExtended,
+	reservations []db.ReservationExtended,
+) reservationsData {
+	reagentID := rie.ReagentInstance.Reagent
+	instanceID := rie.ReagentInstance.ID
+	data := reservationsData{
+		ReagentID:  reagentID,
+		InstanceID: instanceID,
+		Reservable: rie.ReagentInstance.UsedAt.IsZero() && rie.ReagentInstance.DeletedAt.IsZero(),
+		MinDate:    today().Format(time.DateOnly),
+		PostXsrf:   getReservationPostXsrf(rc.UserID, reagentID, instanceID),
+	}
+	data.Form.ReservedFrom = data.MinDate
+	for _, reservation := range reservations {
+		data.ReservationsSlice = append(data.ReservationsSlice, reservationItem{
+			Reservation: reservation,
+			Cancelable: rc.UserRole == db.Assistant ||
+				reservation.Reservation.StorageUser == rc.UserID,
+			DeleteXsrf: getReservationDeleteXsrf(
+				rc.UserID,
+				reagentID,
+				instanceID,
+				reservation.Reservation.ID,
+			),
+		})
+	}
+	return data
+}
+
+func reservations(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	reagentID uuid.UUID,
+	instanceID uuid.UUID,
+	prepare func(data *reservationsData),
+) {
+	rie := db.ReagentInstanceExtended{
+		ReagentInstance: db.ReagentInstance{ID: instanceID, Reagent: reagentID},
+	}
+	reservationsRange := db.ReservationsRange{InstanceID: instanceID}
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{rie.Get, reservationsRange.Get},
+	)
+	for _, err := range errs {
+		if err != nil {
+			errStruct := db.ErrorAsStruct(err)
+			switch errStruct.(type) {
+			case db.DoesNotExist:
+				rc.Logger.Info("Not found")
+				common.ErrorResp(w, common.NotFound)
+			default:
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return
+		}
+	}
+	data := newReservationsData(rc, rie, reservationsRange.Reservations)
+	prepare(&data)
+	tmpl := template.Must(template.ParseFiles("templates/instances-assets.html")).
+		Lookup("reservations")
+	tmpl.Execute(w, data)
+}
+
+func (input reservationInput) Bind() (output db.Reservation, err error) {
+	output.Purpose = strings.TrimSpace(input.Purpose)
+	output.ReservedFrom, err = time.Parse(time.DateOnly, input.ReservedFrom)
+	if err != nil {
+		return db.Reservation{}, err
+	}
+	output.ReservedUntil, err = time.Parse(time.DateOnly, input.ReservedUntil)
+	if err != nil {
+		return db.Reservation{}, err
+	}
+	return output, nil
+}
+
+func ReservationCreateAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	reagentID, reagentErr := uuid.Parse(params.ByName("reagentID"))
+	instanceID, instanceErr := uuid.Parse(params.ByName("instanceID"))
+	for _, err := range []error{reagentErr, instanceErr} {
+		if err != nil {
+			rc.Logger.Info(err.Error())
+			common.ErrorResp(w, common.NotFound)
+			return
+		}
+	}
+	var input reservationInput
+	err := common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	input.Purpose = rc.Sanitize.Sanitize(input.Purpose)
+	input.ReservedFrom = rc.Sanitize.Sanitize(input.ReservedFrom)
+	input.ReservedUntil = rc.Sanitize.Sanitize(input.ReservedUntil)
+	invalid := func(purposeErr, datesErr string) {
+		reservations(rc, w, r, reagentID, instanceID, func(data *reservationsData) {
+			data.Form = input
+			data.PurposeErr = purposeErr
+			data.DatesErr = datesErr
+		})
+	}
+	reservation, err := input.Bind()
+	if err != nil {
+		rc.Logger.Info(err.Error())
+		invalid("", "Вкажіть дати початку та завершення резерву")
+		return
+	}
+	reservation.ReagentInstance = instanceID
+	reservation.StorageUser = rc.UserID
+	purposeErr := ""
+	err = rc.Validate.Struct(reservation)
+	if err != nil {
+		err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), reservation)
+		rc.Logger.Info(err.Error())
+		purposeErr = err.(common.ValidationError).Map()["PurposeErr"]
+	}
+	datesErr := ""
+	switch {
+	case reservation.ReservedFrom.Before(today()):
+		datesErr = "Резерв не може починатися в минулому"
+	case reservation.ReservedUntil.Before(reservation.ReservedFrom):
+		datesErr = "Дата завершення не може передувати даті початку"
+	}
+	if purposeErr != "" || datesErr != "" {
+		invalid(purposeErr, datesErr)
+		return
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{reservation.Create})
+	if errs[0] != nil {
+		errStruct := db.ErrorAsStruct(errs[0])
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Reservation overlaps")
+			invalid("", "Екземпляр недоступний або вже зарезервований на ці дати")
+		default:
+			rc.Logger.Error(errs[0].Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	reservations(rc, w, r, reagentID, instanceID, func(*reservationsData) {})
+}
+
+func ReservationDeleteAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	reagentID, reagentErr := uuid.Parse(params.ByName("reagentID"))
+	instanceID, instanceErr := uuid.Parse(params.ByName("instanceID"))
+	reservationID, reservationErr := uuid.Parse(params.ByName("reservationID"))
+	for _, err := range []error{reagentErr, instanceErr, reservationErr} {
+		if err != nil {
+			rc.Logger.Info(err.Error())
+			common.ErrorResp(w, common.NotFound)
+			return
+		}
+	}
+	reservation := db.Reservation{ID: reservationID, ReagentInstance: instanceID}
+	if rc.UserRole != db.Assistant {
+		reservation.StorageUser = rc.UserID
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{reservation.Delete})
+	if errs[0] != nil {
+		errStruct := db.ErrorAsStruct(errs[0])
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Not found")
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(errs[0].Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	reservations(rc, w, r, reagentID, instanceID, func(*reservationsData) {})
+}
@@ -0,0 +1,173 @@
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+)
+
+const instanceCodePrefix = "CS-"
+
+var (
+	instanceCodePattern = regexp.MustCompile(`^(?:CS-?)?([0-9]{1,18})$`)
+	instanceURLPattern  = regexp.MustCompile(
+		`/reagents/([0-9a-fA-F-]{36})/instances/([0-9a-fA-F-]{36})/?$`,
+	)
+)
+
+type scanData struct {
+	Caller     db.StorageUser
+	Code       string
+	Err        string
+	Instance   db.ReagentInstanceExtended
+	Location   string
+	UseXsrf    string
+	UseConfirm string
+}
+
+func normalizeInstanceCode(input string) (string, bool) {
+	code := strings.ToUpper(strings.Join(strings.Fields(input), ""))
+	match := instanceCodePattern.FindStringSubmatch(code)
+	if match == nil {
+		return "", false
+	}
+	digits := strings.TrimLeft(match[1], "0")
+	if len(digits) < 6 {
+		digits = strings.Repeat("0", 6-len(digits)) + digits
+	}
+	return instanceCodePrefix + digits, true
+}
+
+func scannedInstance(input string) (reagentID, instanceID uuid.UUID, ok bool) {
+	match := instanceURLPattern.FindStringSubmatch(strings.TrimSpace(input))
+	if match == nil {
+		return uuid.Nil, uuid.Nil, false
+	}
+	reagentID, reagentErr := uuid.Parse(match[1])
+	instanceID, instanceErr := uuid.Parse(match[2])
+	return reagentID, instanceID, reagentErr == nil && instanceErr == nil
+}
+
+func scanSupplierBarcode(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	input string,
+) bool {
+	if rc.UserRole != db.Assistant {
+		return false
+	}
+	barcode := db.SupplierBarcode{Barcode: parseSupplierBarcode(input).Barcode}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{barcode.GetByBarcode})
+	if errs[0] != nil {
+		if _, notFound := db.ErrorAsStruct(errs[0]).(db.DoesNotExist); !notFound {
+			rc.Logger.Error(errs[0].Error())
+		}
+		return false
+	}
+	w.Header().Set("HX-Redirect", supplierBarcodeRedirect(barcode.Reagent, input))
+	return true
+}
+
+func Scan(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	caller := db.StorageUser{ID: rc.UserID}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{caller.GetByID})
+	if errs[0] != nil {
+		rc.Logger.Info("Unauthorized")
+		common.ErrorResp(w, common.Unauthorized)
+		return
+	}
+	tmpl := template.Must(
+		template.ParseFiles(
+			"templates/scan.html",
+			"templates/base.html",
+			"templates/instances-assets.html",
+			"templates/storages-assets.html",
+		),
+	)
+	tmpl.Execute(w, scanData{Caller: caller})
+}
+
+func ScanAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	input := r.URL.Query().Get("code")
+	tmpl := template.Must(
+		template.ParseFiles("templates/instances-assets.html", "templates/storages-assets.html"),
+	).Lookup("scan-result")
+	data := scanData{Caller: db.StorageUser{ID: rc.UserID, Role: rc.UserRole}}
+	if strings.TrimSpace(input) == "" {
+		tmpl.Execute(w, data)
+		return
+	}
+	if reagentID, instanceID, ok := scannedInstance(input); ok {
+		w.Header().Set("HX-Redirect", fmt.Sprintf("/reagents/%s/instances/%s", reagentID, instanceID))
+		return
+	}
+	code, ok := normalizeInstanceCode(input)
+	if !ok {
+		if scanSupplierBarcode(rc, w, r, input) {
+			return
+		}
+		data.Err = "Невірний код екземпляра"
+		tmpl.Execute(w, data)
+		return
+	}
+	data.Code = code
+	data.Instance = db.ReagentInstanceExtended{ReagentInstance: db.ReagentInstance{Code: code}}
+	reservationsRange := db.ReservationsRange{InstanceCode: code}
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{data.Instance.GetByCode, reservationsRange.Get},
+	)
+	if errs[0] != nil {
+		errStruct := db.ErrorAsStruct(errs[0])
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Not found")
+			if scanSupplierBarcode(rc, w, r, input) {
+				return
+			}
+			data.Err = fmt.Sprintf("Екземпляр %s не знайдено", code)
+			tmpl.Execute(w, data)
+		default:
+			rc.Logger.Error(errs[0].Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	if errs[1] != nil {
+		rc.Logger.Error(errs[1].Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	data.Location = instanceLocationText(data.Instance)
+	if len(reservationsRange.Reservations) != 0 {
+		data.Instance.Reservation = reservationsRange.Reservations[0]
+	}
+	data.UseConfirm = reservationUseConfirm(reservationsRange.Reservations, rc.UserID)
+	data.UseXsrf = getInstanceUseXsrf(
+		rc.UserID,
+		data.Instance.ReagentInstance.ID,
+		data.Instance.Reagent.ID,
+	)
+	tmpl.Execute(w, data)
+}
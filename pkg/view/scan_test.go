@@ -0,0 +1,44 @@
+package view
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestNormalizeInstanceCode(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		code  string
+		ok    bool
+	}{
+		{"CS-42", "CS-000042", true},
+		{"cs-42", "CS-000042", true},
+		{"CS42", "CS-000042", true},
+		{"42", "CS-000042", true},
+		{" CS-000 042 ", "CS-000042", true},
+		{"CS-0000000042", "CS-000042", true},
+		{"CS-1234567", "CS-1234567", true},
+		{"CS-", "", false},
+		{"AB-42", "", false},
+		{"CS-42a", "", false},
+		{"Етанол", "", false},
+	} {
+		code, ok := normalizeInstanceCode(test.input)
+		if code != test.code || ok != test.ok {
+			t.Errorf("normalizeInstanceCode(%q) = %q, %v, want %q, %v", test.input, code, ok, test.code, test.ok)
+		}
+	}
+}
+
+func TestScannedInstance(t *testing.T) {
+	reagentID, instanceID := uuid.New(), uuid.New()
+	url := "https://example.com/reagents/" + reagentID.String() + "/instances/" + instanceID.String()
+	gotReagent, gotInstance, ok := scannedInstance(url)
+	if !ok || gotReagent != reagentID || gotInstance != instanceID {
+		t.Fatalf("scannedInstance(%q) = %v, %v, %v", url, gotReagent, gotInstance, ok)
+	}
+	if _, _, ok = scannedInstance("CS-000042"); ok {
+		t.Fatal("scannedInstance accepted an instance code")
+	}
+}
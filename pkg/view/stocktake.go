@@ -0,0 +1,515 @@
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/xsrftoken"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+	"github.com/Kelvedler/ChemicalStorage/pkg/webhook"
+)
+
+type stocktakesData struct {
+	StorageID       string
+	Allowed         bool
+	PostXsrf        string
+	StocktakesSlice []db.StocktakeExtended
+}
+
+type stocktakeItem struct {
+	Scan     db.StocktakeScanExtended
+	Expected string
+}
+
+type stocktakeData struct {
+	Caller         db.StorageUser
+	Stocktake      db.StocktakeExtended
+	Cell           int16
+	Err            string
+	LastScan       string
+	FoundSlice     []stocktakeItem
+	MisplacedSlice []stocktakeItem
+	UnknownSlice   []stocktakeItem
+	ScanXsrf       string
+	FinishXsrf     string
+	ResolveXsrf    string
+}
+
+type stocktakeScanInput struct {
+	Code string `json:"code"`
+	Cell string `json:"cell"`
+}
+
+type stocktakeResolveInput struct {
+	Instance string `json:"instance"`
+	Action   string `json:"action"`
+}
+
+func getStocktakePostXsrf(userID, storageID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/storages/%s/stocktakes", storageID),
+	)
+}
+
+func getStocktakeScanXsrf(userID, stocktakeID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/stocktakes/%s/scans", stocktakeID),
+	)
+}
+
+func getStocktakeFinishXsrf(userID, stocktakeID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/stocktakes/%s/finish", stocktakeID),
+	)
+}
+
+func getStocktakeResolveXsrf(userID, stocktakeID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/stocktakes/%s/resolve", stocktakeID),
+	)
+}
+
+func newStocktakesData(
+	rc *middleware.RequestContext,
+	storage db.Storage,
+	stocktakes []db.StocktakeExtended,
+) stocktakesData {
+	return stocktakesData{
+		StorageID:       storage.ID.String(),
+		Allowed:         storage.ArchivedAt.IsZero() && storage.HasCells(),
+		PostXsrf:        getStocktakePostXsrf(rc.UserID, storage.ID),
+		StocktakesSlice: stocktakes,
+	}
+}
+
+func newStocktakeData(rc *middleware.RequestContext, stocktake db.StocktakeExtended) stocktakeData {
+	data := stocktakeData{
+		Caller:      db.StorageUser{ID: rc.UserID, Role: rc.UserRole},
+		Stocktake:   stocktake,
+		ScanXsrf:    getStocktakeScanXsrf(rc.UserID, stocktake.Stocktake.ID),
+		FinishXsrf:  getStocktakeFinishXsrf(rc.UserID, stocktake.Stocktake.ID),
+		ResolveXsrf: getStocktakeResolveXsrf(rc.UserID, stocktake.Stocktake.ID),
+	}
+	for _, scan := range stocktake.Scans {
+		item := stocktakeItem{Scan: scan}
+		instance := scan.Instance.ReagentInstance
+		switch {
+		case instance.ID == uuid.Nil:
+			item.Expected = "Код не знайдено"
+			data.UnknownSlice = append(data.UnknownSlice, item)
+		case !instance.UsedAt.IsZero():
+			item.Expected = "Екземпляр використано"
+			data.UnknownSlice = append(data.UnknownSlice, item)
+		case !instance.DeletedAt.IsZero():
+			item.Expected = "Екземпляр позначено втраченим"
+			data.UnknownSlice = append(data.UnknownSlice, item)
+		case instance.StorageCell == scan.StocktakeScan.StorageCell:
+			data.FoundSlice = append(data.FoundSlice, item)
+		default:
+			item.Expected = instanceLocationText(scan.Instance)
+			data.MisplacedSlice = append(data.MisplacedSlice, item)
+		}
+	}
+	return data
+}
+
+func (data *stocktakeData) setLastScan(code string) {
+	for _, items := range []struct {
+		slice  []stocktakeItem
+		status string
+	}{
+		{data.FoundSlice, "на місці"},
+		{data.MisplacedSlice, "не в тому відділі"},
+		{data.UnknownSlice, "невідомий код"},
+	} {
+		for _, item := range items.slice {
+			if item.Scan.StocktakeScan.Code != code {
+				continue
+			}
+			name := item.Scan.Instance.Reagent.Name
+			if name == "" {
+				name = "—"
+			}
+			data.LastScan = fmt.Sprintf("%s: %s, %s", code, name, items.status)
+			return
+		}
+	}
+}
+
+func stocktakeHandleErr(rc *middleware.RequestContext, w http.ResponseWriter, err error) {
+	errStruct := db.ErrorAsStruct(err)
+	switch errStruct.(type) {
+	case db.DoesNotExist:
+		rc.Logger.Info("Not found")
+		common.ErrorResp(w, common.NotFound)
+	default:
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+	}
+}
+
+func stocktakeFromParams(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) (db.StocktakeExtended, bool) {
+	stocktakeID, err := uuid.Parse(params.ByName("stocktakeID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return db.StocktakeExtended{}, false
+	}
+	stocktake := db.StocktakeExtended{Stocktake: db.Stocktake{ID: stocktakeID}}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{stocktake.Get})
+	if errs[0] != nil {
+		stocktakeHandleErr(rc, w, errs[0])
+		return db.StocktakeExtended{}, false
+	}
+	denied, err := storageAccessDenied(rc, r, &db.StoragePermission{StorageID: stocktake.Stocktake.Storage})
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return db.StocktakeExtended{}, false
+	}
+	if denied != nil {
+		rc.Logger.Info("Storage access denied")
+		common.ErrorResp(w, common.Forbidden)
+		return db.StocktakeExtended{}, false
+	}
+	return stocktake, true
+}
+
+func stocktakeReport(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	stocktakeID uuid.UUID,
+	prepare func(data *stocktakeData),
+) {
+	stocktake := db.StocktakeExtended{Stocktake: db.Stocktake{ID: stocktakeID}}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{stocktake.Get})
+	if errs[0] != nil {
+		stocktakeHandleErr(rc, w, errs[0])
+		return
+	}
+	data := newStocktakeData(rc, stocktake)
+	prepare(&data)
+	tmpl := template.Must(template.ParseFiles("templates/stocktakes-assets.html")).Lookup("stocktake-report")
+	tmpl.Execute(w, data)
+}
+
+func Stocktake(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	stocktake, ok := stocktakeFromParams(rc, w, r, params)
+	if !ok {
+		return
+	}
+	caller := db.StorageUser{ID: rc.UserID}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{caller.GetByID})
+	if errs[0] != nil {
+		rc.Logger.Info("Unauthorized")
+		common.ErrorResp(w, common.Unauthorized)
+		return
+	}
+	data := newStocktakeData(rc, stocktake)
+	data.Caller = caller
+	data.Cell = 1
+	tmpl := template.Must(
+		template.ParseFiles(
+			"templates/stocktake.html",
+			"templates/base.html",
+			"templates/stocktakes-assets.html",
+		),
+	)
+	tmpl.Execute(w, data)
+}
+
+func StocktakeCreateAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	storageID, err := uuid.Parse(params.ByName("storageID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	tmpl := template.Must(template.ParseFiles("templates/stocktakes-assets.html")).Lookup("stocktake-error")
+	denied, err := storageAccessDenied(rc, r, &db.StoragePermission{StorageID: storageID})
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	if denied != nil {
+		rc.Logger.Info("Storage access denied")
+		tmpl.Execute(w, storageAccessDeniedMessage(denied))
+		return
+	}
+	storage := db.Storage{ID: storageID}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{storage.Get})
+	if errs[0] != nil {
+		stocktakeHandleErr(rc, w, errs[0])
+		return
+	}
+	if !storage.ArchivedAt.IsZero() || !storage.HasCells() {
+		rc.Logger.Info("Storage has no cells")
+		tmpl.Execute(w, "Для цього елементу інвентаризація недоступна")
+		return
+	}
+	stocktake := db.StocktakeExtended{
+		Stocktake: db.Stocktake{ID: uuid.New(), Storage: storageID, StorageUser: rc.UserID},
+	}
+	errs = db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{stocktake.Create})
+	if errs[0] != nil {
+		errStruct := db.ErrorAsStruct(errs[0])
+		switch errStruct.(type) {
+		case db.UniqueViolation:
+			rc.Logger.Info(errs[0].Error())
+			tmpl.Execute(w, "Інвентаризація цього складу вже триває")
+		default:
+			stocktakeHandleErr(rc, w, errs[0])
+		}
+		return
+	}
+	w.Header().Set("HX-Redirect", fmt.Sprintf("/stocktakes/%s", stocktake.Stocktake.ID))
+}
+
+func (input stocktakeScanInput) Bind() (scan db.StocktakeScanExtended, err error) {
+	cell, err := strconv.Atoi(strings.TrimSpace(input.Cell))
+	if err != nil {
+		return scan, err
+	}
+	scan.StorageCell.Number = int16(cell)
+	if _, instanceID, ok := scannedInstance(input.Code); ok {
+		scan.InstanceID = instanceID
+		scan.StocktakeScan.Code = instanceID.String()
+	} else if code, ok := normalizeInstanceCode(input.Code); ok {
+		scan.StocktakeScan.Code = code
+	} else {
+		scan.StocktakeScan.Code = strings.ToUpper(strings.TrimSpace(input.Code))
+	}
+	return scan, nil
+}
+
+func StocktakeScanAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	stocktake, ok := stocktakeFromParams(rc, w, r, params)
+	if !ok {
+		return
+	}
+	var input stocktakeScanInput
+	err := common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	input.Code = rc.Sanitize.Sanitize(input.Code)
+	input.Cell = rc.Sanitize.Sanitize(input.Cell)
+	data := newStocktakeData(rc, stocktake)
+	tmpl := template.Must(template.ParseFiles("templates/stocktakes-assets.html")).Lookup("stocktake-report")
+	if !stocktake.Stocktake.FinishedAt.IsZero() {
+		rc.Logger.Info("Stocktake finished")
+		data.Err = "Інвентаризацію вже завершено"
+		tmpl.Execute(w, data)
+		return
+	}
+	scan, err := input.Bind()
+	if err != nil || scan.StorageCell.Number < 1 || scan.StorageCell.Number > stocktake.Storage.Cells {
+		rc.Logger.Info("Cell out of limits")
+		data.Err = fmt.Sprintf("Відділ має бути від 1 до %d", stocktake.Storage.Cells)
+		tmpl.Execute(w, data)
+		return
+	}
+	scan.StocktakeScan.Stocktake = stocktake.Stocktake.ID
+	err = rc.Validate.Struct(scan.StocktakeScan)
+	if err != nil {
+		rc.Logger.Info(err.Error())
+		data.Err = "Невірний код"
+		tmpl.Execute(w, data)
+		return
+	}
+	storageCell := db.StorageCell{Storage: stocktake.Stocktake.Storage, Number: scan.StorageCell.Number}
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{storageCell.TryCreate, scan.Create},
+	)
+	for _, err = range errs {
+		if err != nil {
+			errStruct := db.ErrorAsStruct(err)
+			switch errStruct.(type) {
+			case db.OutOfLimits:
+				err = errStruct.(db.OutOfLimits).Localize(storageCell)
+				rc.Logger.Info(err.Error())
+				data.Err = err.(db.DBError).Map()["NumberErr"]
+				tmpl.Execute(w, data)
+			case db.DoesNotExist:
+				rc.Logger.Info("Stocktake finished")
+				data.Err = "Інвентаризацію вже завершено"
+				tmpl.Execute(w, data)
+			default:
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return
+		}
+	}
+	stocktakeReport(rc, w, r, stocktake.Stocktake.ID, func(data *stocktakeData) {
+		data.setLastScan(scan.StocktakeScan.Code)
+	})
+}
+
+func StocktakeFinishAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	stocktake, ok := stocktakeFromParams(rc, w, r, params)
+	if !ok {
+		return
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{stocktake.Finish})
+	if errs[0] != nil {
+		stocktakeHandleErr(rc, w, errs[0])
+		return
+	}
+	w.Header().Set("HX-Redirect", fmt.Sprintf("/stocktakes/%s", stocktake.Stocktake.ID))
+}
+
+func (input stocktakeResolveInput) Bind() (action db.StocktakeActionExtended, err error) {
+	action.StocktakeAction.ReagentInstance, err = uuid.Parse(input.Instance)
+	if err != nil {
+		return action, err
+	}
+	if input.Action != db.StocktakeTransfer && input.Action != db.StocktakeLost {
+		return action, fmt.Errorf("unknown stocktake action %q", input.Action)
+	}
+	action.StocktakeAction.Action = input.Action
+	return action, nil
+}
+
+func StocktakeResolveAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	stocktake, ok := stocktakeFromParams(rc, w, r, params)
+	if !ok {
+		return
+	}
+	var input stocktakeResolveInput
+	err := common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	action, err := input.Bind()
+	if err != nil {
+		rc.Logger.Info(err.Error())
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	data := newStocktakeData(rc, stocktake)
+	tmpl := template.Must(template.ParseFiles("templates/stocktakes-assets.html")).Lookup("stocktake-report")
+	if stocktake.Stocktake.FinishedAt.IsZero() {
+		rc.Logger.Info("Stocktake not finished")
+		data.Err = "Спершу завершіть інвентаризацію"
+		tmpl.Execute(w, data)
+		return
+	}
+	denied, err := storageAccessDenied(
+		rc,
+		r,
+		&db.StoragePermission{InstanceID: action.StocktakeAction.ReagentInstance},
+	)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	if denied != nil {
+		rc.Logger.Info("Storage access denied")
+		data.Err = storageAccessDeniedMessage(denied)
+		tmpl.Execute(w, data)
+		return
+	}
+	action.StocktakeAction.Stocktake = stocktake.Stocktake.ID
+	action.StocktakeAction.StorageUser = rc.UserID
+	var event db.WebhookEvent
+	if action.StocktakeAction.Action == db.StocktakeTransfer {
+		event, err = webhook.NewEvent(
+			webhook.InstanceTransferred,
+			nil,
+			action.StocktakeAction.ReagentInstance,
+		)
+	} else {
+		event, err = webhook.NewEvent(
+			webhook.InstanceLost,
+			map[string]any{
+				"stocktake": stocktake.Stocktake.ID,
+				"lost_by":   rc.UserID,
+			},
+			action.StocktakeAction.ReagentInstance,
+		)
+	}
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{action.Create, event.Enqueue})
+	for _, err = range errs {
+		if err != nil {
+			errStruct := db.ErrorAsStruct(err)
+			switch errStruct.(type) {
+			case db.CapacityExceeded:
+				err = errStruct.(db.CapacityExceeded).Localize(db.StorageCell{})
+				rc.Logger.Info(err.Error())
+				data.Err = err.(db.DBError).Map()["NumberErr"]
+				tmpl.Execute(w, data)
+			case db.DoesNotExist:
+				rc.Logger.Info("Already resolved")
+				data.Err = "Розбіжність уже виправлено"
+				tmpl.Execute(w, data)
+			default:
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return
+		}
+	}
+	stocktakeReport(rc, w, r, stocktake.Stocktake.ID, func(*stocktakeData) {})
+}
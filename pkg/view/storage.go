@@ -3,8 +3,11 @@ package view
 import (
 	"fmt"
 	"html/template"
+	"math"
 	"net/http"
+	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
@@ -17,32 +20,206 @@ import (
 	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
 )
 
+type storagesColumn struct {
+	Title  string
+	Href   string
+	Active bool
+	Desc   bool
+}
+
 type storagesData struct {
-	Caller        db.StorageUser
-	StoragesSlice []db.Storage
-	LastStorage   db.Storage
-	NextOffset    int
-	Src           string
+	Caller         db.StorageUser
+	StoragesSlice  []db.StorageStats
+	LastStorage    db.StorageStats
+	NextOffset     int
+	Src            string
+	Location       string
+	Sort           string
+	Order          string
+	ColumnsSlice   []storagesColumn
+	LocationsSlice []db.Storage
 }
 
 type storageData struct {
-	Caller   db.StorageUser
-	ID       string
-	Name     string
-	NameErr  string
-	Cells    int
-	CellsErr string
-	PostXsrf string
-}
-
-func (s *storagesData) set(storagesSlice []db.Storage, src string, offset int) {
-	if len(storagesSlice) > 1 {
-		s.StoragesSlice = storagesSlice[:len(storagesSlice)-1]
-		s.LastStorage = storagesSlice[len(storagesSlice)-1]
-		s.NextOffset = offset + len(storagesSlice)
-		s.Src = src
+	Caller         db.StorageUser
+	ID             string
+	Name           string
+	NameErr        string
+	Cells          int
+	CellsErr       string
+	Rows           int
+	Columns        int
+	LayoutErr      string
+	Kind           string
+	KindErr        string
+	Parent         string
+	ParentName     string
+	ParentErr      string
+	Description    string
+	DescriptionErr string
+	PostXsrf       string
+	PutXsrf        string
+	CellPutXsrf    string
+	Archived       bool
+	PathSlice      []db.Storage
+	ChildrenSlice  []db.Storage
+	CellsSlice     []storageCellData
+	NestedSlice    []storageInstanceData
+	Occupied       int
+	Access         storageAccessData
+	Stocktakes     stocktakesData
+	Inspection     storageInspectionData
+}
+
+type storageCellData struct {
+	Number         int16
+	Row            int16
+	Column         int16
+	Label          string
+	Capacity       int16
+	Full           bool
+	InstancesSlice []storageInstanceData
+}
+
+type storageInstanceData struct {
+	Instance     db.ReagentInstanceExtended
+	Expired      bool
+	ExpiresSoon  bool
+	TransferXsrf string
+}
+
+const expiresSoonPeriod = 30 * 24 * time.Hour
+
+func newStorageInstanceData(
+	instance db.ReagentInstanceExtended,
+	userID uuid.UUID,
+	now time.Time,
+) storageInstanceData {
+	return storageInstanceData{
+		Instance:    instance,
+		Expired:     instance.ReagentInstance.ExpiresAt.Before(now),
+		ExpiresSoon: instance.ReagentInstance.ExpiresAt.Before(now.Add(expiresSoonPeriod)),
+		TransferXsrf: getInstanceTranserXsrf(
+			userID,
+			instance.ReagentInstance.ID,
+			instance.Reagent.ID,
+		),
+	}
+}
+
+func storageGrid(
+	storage db.Storage,
+	storageCells []db.StorageCell,
+	instances []db.ReagentInstanceExtended,
+	userID uuid.UUID,
+	now time.Time,
+) (cellsSlice []storageCellData, nestedSlice []storageInstanceData, occupied int) {
+	cellsSlice = make([]storageCellData, storage.Cells)
+	for i := range cellsSlice {
+		cellsSlice[i].Number = int16(i + 1)
+		cellsSlice[i].Row, cellsSlice[i].Column = storage.CellPosition(cellsSlice[i].Number)
+	}
+	for _, storageCell := range storageCells {
+		if storageCell.Number < 1 || storageCell.Number > storage.Cells {
+			continue
+		}
+		cellsSlice[storageCell.Number-1].Label = storageCell.Label
+		cellsSlice[storageCell.Number-1].Capacity = storageCell.Capacity
+	}
+	for _, instance := range instances {
+		number := instance.StorageCell.Number
+		if instance.Storage.ID != storage.ID || number < 1 || number > storage.Cells {
+			nestedSlice = append(nestedSlice, newStorageInstanceData(instance, userID, now))
+			continue
+		}
+		cell := &cellsSlice[number-1]
+		if len(cell.InstancesSlice) == 0 {
+			occupied++
+		}
+		cell.InstancesSlice = append(cell.InstancesSlice, newStorageInstanceData(instance, userID, now))
+		cell.Full = cell.Capacity != 0 && len(cell.InstancesSlice) >= int(cell.Capacity)
+	}
+	return cellsSlice, nestedSlice, occupied
+}
+
+var storagesColumns = []struct {
+	Sort  string
+	Title string
+}{
+	{"name", "Назва"},
+	{"responsible", "Відповідальна особа"},
+	{"instances", "Екземпляри"},
+	{"expired", "Прострочені"},
+	{"occupied", "Зайнято"},
+	{"free", "Вільно"},
+}
+
+func storagesQuery(r *http.Request) (storagesRange db.StorageStatsRange, offset int, err error) {
+	query := r.URL.Query()
+	offsetStr := query.Get("offset")
+	if offsetStr == "" {
+		offsetStr = "0"
+	}
+	offset, err = strconv.Atoi(offsetStr)
+	if err != nil {
+		return db.StorageStatsRange{}, 0, err
+	}
+	storagesRange = db.StorageStatsRange{
+		Limit:  20,
+		Offset: offset,
+		Src:    query.Get("src"),
+		Sort:   query.Get("sort"),
+		Desc:   query.Get("order") == "desc",
+	}
+	if _, ok := db.StorageStatsSorts[storagesRange.Sort]; !ok {
+		storagesRange.Sort = "name"
+	}
+	if locationStr := query.Get("location"); locationStr != "" {
+		storagesRange.Location, err = uuid.Parse(locationStr)
+		if err != nil {
+			return db.StorageStatsRange{}, 0, err
+		}
+	}
+	return storagesRange, offset, nil
+}
+
+func (s *storagesData) set(storagesRange db.StorageStatsRange, offset int) {
+	s.Src = storagesRange.Src
+	s.Sort = storagesRange.Sort
+	s.Order = "asc"
+	if storagesRange.Desc {
+		s.Order = "desc"
+	}
+	if storagesRange.Location != uuid.Nil {
+		s.Location = storagesRange.Location.String()
+	}
+	for _, column := range storagesColumns {
+		active := column.Sort == storagesRange.Sort
+		order := "asc"
+		if active && !storagesRange.Desc {
+			order = "desc"
+		}
+		query := url.Values{"sort": {column.Sort}, "order": {order}}
+		if s.Src != "" {
+			query.Set("src", s.Src)
+		}
+		if s.Location != "" {
+			query.Set("location", s.Location)
+		}
+		s.ColumnsSlice = append(s.ColumnsSlice, storagesColumn{
+			Title:  column.Title,
+			Href:   "/storages/?" + query.Encode(),
+			Active: active,
+			Desc:   storagesRange.Desc,
+		})
+	}
+	stats := storagesRange.StoragesStats
+	if len(stats) >= storagesRange.Limit {
+		s.StoragesSlice = stats[:len(stats)-1]
+		s.LastStorage = stats[len(stats)-1]
+		s.NextOffset = offset + len(stats)
 	} else {
-		s.StoragesSlice = storagesSlice
+		s.StoragesSlice = stats
 	}
 }
 
@@ -52,27 +229,36 @@ func Storages(
 	r *http.Request,
 	_ httprouter.Params,
 ) {
-	offset := 0
-	src := ""
-	storagesRange := db.StoragesRange{
-		Limit:  20,
-		Offset: offset,
-		Src:    src,
+	storagesRange, offset, err := storagesQuery(r)
+	if err != nil {
+		rc.Logger.Info(err.Error())
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	locationsRange := db.StoragesRange{
+		Limit:  100,
+		Offset: 0,
 	}
 	caller := db.StorageUser{ID: rc.UserID}
 	errs := db.PerformBatch(
 		r.Context(),
 		rc.DBpool,
-		[]db.BatchSet{storagesRange.Get, caller.GetByID},
+		[]db.BatchSet{storagesRange.Get, locationsRange.Get, caller.GetByID},
 	)
-	storagesErr := errs[0]
-	if storagesErr != nil {
-		rc.Logger.Error(storagesErr.Error())
-		common.ErrorResp(w, common.Internal)
-		return
+	for _, err := range errs[:2] {
+		if err != nil {
+			rc.Logger.Error(err.Error())
+			common.ErrorResp(w, common.Internal)
+			return
+		}
 	}
 	data := storagesData{Caller: caller}
-	data.set(storagesRange.Storages, src, offset)
+	for _, location := range locationsRange.Storages {
+		if location.Kind != "shelf" {
+			data.LocationsSlice = append(data.LocationsSlice, location)
+		}
+	}
+	data.set(storagesRange, offset)
 	tmpl := template.Must(
 		template.ParseFiles(
 			"templates/storages.html",
@@ -89,17 +275,17 @@ func StoragesAPI(
 	r *http.Request,
 	_ httprouter.Params,
 ) {
-	src := r.URL.Query().Get("src")
-	offsetStr := r.URL.Query().Get("offset")
-	if offsetStr == "" {
-		offsetStr = "0"
-	}
-	offset, err := strconv.Atoi(offsetStr)
+	storagesRange, offset, err := storagesQuery(r)
 	if err != nil {
 		rc.Logger.Info(err.Error())
+		w.WriteHeader(400)
 		return
 	}
-	searchForm := SearchAPIForm{Src: src, Offset: offset}
+	searchForm := SearchAPIForm{
+		Src:    storagesRange.Src,
+		Offset: offset,
+		Target: r.URL.Query().Get("target"),
+	}
 	err = rc.Validate.Struct(searchForm)
 	if err != nil {
 		err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), searchForm)
@@ -107,11 +293,6 @@ func StoragesAPI(
 		w.WriteHeader(400)
 		return
 	}
-	storagesRange := db.StoragesRange{
-		Limit:  20,
-		Offset: offset,
-		Src:    src,
-	}
 	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{storagesRange.Get})
 	storagesErr := errs[0]
 	if storagesErr != nil {
@@ -120,9 +301,13 @@ func StoragesAPI(
 		return
 	}
 	var data storagesData
-	data.set(storagesRange.Storages, src, offset)
-	tmpl := template.Must(template.ParseFiles("templates/storages-assets.html")).
-		Lookup("storages-search")
+	data.set(storagesRange, offset)
+	tmpl := template.Must(template.ParseFiles("templates/storages-assets.html"))
+	if searchForm.Target == "rows" {
+		tmpl = tmpl.Lookup("storages-rows")
+	} else {
+		tmpl = tmpl.Lookup("storages-search")
+	}
 	tmpl.Execute(w, data)
 }
 
@@ -139,28 +324,89 @@ func Storage(
 		return
 	}
 	storage := db.Storage{ID: storageID}
+	path := db.StoragePath{StorageID: storageID}
+	childrenRange := db.StorageChildrenRange{ParentID: storageID}
+	instancesRange := db.StorageInstancesRange{StorageID: storageID}
+	cellsRange := db.StorageCellsRange{StorageID: storageID}
+	permission := db.StoragePermission{StorageID: storageID, UserID: rc.UserID}
+	accessRange := db.StorageAccessRange{StorageID: storageID}
+	assistantsRange := db.StorageUsersRange{Limit: 100, Offset: 0, Assistants: true}
+	staffRange := db.StorageUsersRange{Limit: 100, Offset: 0, Staff: true}
+	stocktakesRange := db.StocktakesRange{StorageID: storageID, Limit: 5}
+	inspection := db.StorageInspection{Storage: db.Storage{ID: storageID}}
 	caller := db.StorageUser{ID: rc.UserID}
-	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{storage.Get, caller.GetByID})
-	storageErr := errs[0]
-	if storageErr != nil {
-		errStruct := db.ErrorAsStruct(storageErr)
-		switch errStruct.(type) {
-		case db.DoesNotExist:
-			rc.Logger.Info("Not found")
-			common.ErrorResp(w, common.NotFound)
-			return
-		default:
-			rc.Logger.Error(storageErr.Error())
-			common.ErrorResp(w, common.Internal)
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{
+			storage.Get,
+			path.Get,
+			childrenRange.Get,
+			instancesRange.Get,
+			cellsRange.Get,
+			permission.Get,
+			accessRange.Get,
+			assistantsRange.Get,
+			staffRange.Get,
+			stocktakesRange.Get,
+			inspection.Get,
+			caller.GetByID,
+		},
+	)
+	for _, err := range errs[:11] {
+		if err != nil {
+			errStruct := db.ErrorAsStruct(err)
+			switch errStruct.(type) {
+			case db.DoesNotExist:
+				rc.Logger.Info("Not found")
+				common.ErrorResp(w, common.NotFound)
+			default:
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+			}
 			return
 		}
 	}
 	data := storageData{
-		Caller: caller,
-		ID:     storage.ID.String(),
-		Name:   storage.Name,
+		Caller:        caller,
+		ID:            storage.ID.String(),
+		Name:          storage.Name,
+		Cells:         int(storage.Cells),
+		Rows:          int(storage.Rows),
+		Columns:       int(storage.Columns),
+		Kind:          storage.Kind,
+		Description:   storage.Description,
+		PutXsrf:       getStoragePutXsrf(rc.UserID, storageID),
+		Archived:      !storage.ArchivedAt.IsZero(),
+		CellPutXsrf:   getStorageCellPutXsrf(rc.UserID, storageID),
+		PathSlice:     path.Storages,
+		ChildrenSlice: childrenRange.Storages,
 	}
-	tmpl := template.Must(template.ParseFiles("templates/storage.html", "templates/base.html"))
+	data.Access = newStorageAccessData(
+		rc,
+		storage,
+		permission,
+		accessRange.StorageUsers,
+		assistantsRange.StorageUsers,
+		staffRange.StorageUsers,
+	)
+	data.Stocktakes = newStocktakesData(rc, storage, stocktakesRange.Stocktakes)
+	data.Inspection = newStorageInspectionData(rc, storage, inspection)
+	data.CellsSlice, data.NestedSlice, data.Occupied = storageGrid(
+		storage,
+		cellsRange.StorageCells,
+		instancesRange.ReagentInstancesExtended,
+		rc.UserID,
+		time.Now().UTC(),
+	)
+	tmpl := template.Must(
+		template.ParseFiles(
+			"templates/storage.html",
+			"templates/base.html",
+			"templates/storages-assets.html",
+			"templates/stocktakes-assets.html",
+		),
+	)
 	tmpl.Execute(w, data)
 }
 
@@ -172,14 +418,42 @@ func getStoragePostXsrf(userID uuid.UUID) string {
 	)
 }
 
+func getStoragePutXsrf(userID, storageID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/storages/%s", storageID),
+	)
+}
+
 func sanitizeStorage(rc *middleware.RequestContext, storage *db.Storage) {
 	sanitizer := rc.Sanitize
 	storage.Name = sanitizer.Sanitize(storage.Name)
+	storage.Description = sanitizer.Sanitize(storage.Description)
 }
 
 func storageErrMapAddInput(errMap map[string]string, storage db.Storage) {
 	errMap["Name"] = storage.Name
 	errMap["Cells"] = strconv.Itoa(int(storage.Cells))
+	if storage.HasLayout() {
+		errMap["Rows"] = strconv.Itoa(int(storage.Rows))
+		errMap["Columns"] = strconv.Itoa(int(storage.Columns))
+	}
+	errMap["Kind"] = storage.Kind
+	if storage.Parent != uuid.Nil {
+		errMap["Parent"] = storage.Parent.String()
+	}
+}
+
+func storageApplyLayout(storage *db.Storage) (layoutErr string) {
+	if storage.Rows == 0 && storage.Columns == 0 {
+		return ""
+	}
+	if storage.Rows <= 0 || storage.Columns <= 0 {
+		return "Вкажіть кількість рядів і місць у ряду"
+	}
+	storage.Cells = int16(min(int(storage.Rows)*int(storage.Columns), math.MaxInt16))
+	return ""
 }
 
 func storagePostErrMapAddInput(
@@ -205,11 +479,41 @@ func StorageCreate(
 		),
 	)
 	caller := db.StorageUser{ID: rc.UserID}
-	_ = db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{caller.GetByID})
+	batchSets := []db.BatchSet{caller.GetByID}
+	var parent db.Storage
+	parentStr := r.URL.Query().Get("parent")
+	if parentStr != "" {
+		parentID, err := uuid.Parse(parentStr)
+		if err != nil {
+			rc.Logger.Info("Invalid UUID")
+			common.ErrorResp(w, common.NotFound)
+			return
+		}
+		parent.ID = parentID
+		batchSets = append(batchSets, parent.Get)
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, batchSets)
+	if len(errs) > 1 && errs[1] != nil {
+		errStruct := db.ErrorAsStruct(errs[1])
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Not found")
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(errs[1].Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
 	data := storageData{
 		Caller:   caller,
+		Kind:     db.KindStorage,
 		PostXsrf: getStoragePostXsrf(rc.UserID),
 	}
+	if parent.ID != uuid.Nil {
+		data.Parent = parent.ID.String()
+		data.ParentName = parent.Name
+	}
 	tmpl.Execute(w, data)
 }
 
@@ -235,21 +539,131 @@ func StorageCreateAPI(
 	sanitizeStorage(rc, &storage)
 	tmpl := template.Must(template.ParseFiles("templates/storages-assets.html")).
 		Lookup("storage-form")
-	err = rc.Validate.StructPartial(storage, "Name", "Cells")
-	if err != nil {
-		err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), storage)
-		rc.Logger.Info(err.Error())
-		errMap := err.(common.ValidationError).Map()
+	fields := []string{"Name", "Kind", "Cells", "Rows", "Columns"}
+	if !storage.HasCells() {
+		storage.Cells, storage.Rows, storage.Columns = 0, 0, 0
+		fields = fields[:2]
+	}
+	layoutErr := storageApplyLayout(&storage)
+	err = rc.Validate.StructPartial(storage, fields...)
+	if err != nil || layoutErr != "" {
+		errMap := map[string]string{}
+		if err != nil {
+			err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), storage)
+			rc.Logger.Info(err.Error())
+			errMap = err.(common.ValidationError).Map()
+		}
+		errMap["LayoutErr"] = layoutErr + errMap["RowsErr"] + errMap["ColumnsErr"]
 		storagePostErrMapAddInput(errMap, storage, rc.UserID)
 		tmpl.Execute(w, errMap)
 		return
 	}
-	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{storage.Create})
+	batchSets := []db.BatchSet{storage.Create}
+	parent := db.Storage{ID: storage.Parent}
+	if storage.Parent != uuid.Nil {
+		batchSets = []db.BatchSet{parent.Get, storage.Create}
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, batchSets)
+	for _, err := range errs {
+		if err != nil {
+			errStruct := db.ErrorAsStruct(err)
+			switch errStruct.(type) {
+			case db.DoesNotExist:
+				rc.Logger.Info("Parent not found")
+				common.ErrorResp(w, common.NotFound)
+			case db.InvalidParent:
+				err = errStruct.(db.InvalidParent).Localize(storage)
+				rc.Logger.Info(err.Error())
+				errMap := err.(db.DBError).Map()
+				storagePostErrMapAddInput(errMap, storage, rc.UserID)
+				tmpl.Execute(w, errMap)
+			default:
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return
+		}
+	}
+	w.Header().Set("HX-Redirect", fmt.Sprintf("/storages/%s", storage.ID))
+}
+
+func StoragePutAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	storageID, err := uuid.Parse(params.ByName("storageID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	var input db.StorageInput
+	err = common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	storage, err := input.Bind()
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	storage.ID = storageID
+	sanitizeStorage(rc, &storage)
+	tmpl := template.Must(template.ParseFiles("templates/storages-assets.html")).
+		Lookup("storage-edit-form")
+	data := storageData{
+		ID:          storageID.String(),
+		Name:        storage.Name,
+		Cells:       int(storage.Cells),
+		Rows:        int(storage.Rows),
+		Columns:     int(storage.Columns),
+		Description: storage.Description,
+		PutXsrf:     getStoragePutXsrf(rc.UserID, storageID),
+	}
+	fields := []string{"Name", "Description"}
+	if input.Cells != "" || input.Rows != "" || input.Columns != "" {
+		fields = append(fields, "Cells", "Rows", "Columns")
+		data.Kind = db.KindStorage
+	}
+	data.LayoutErr = storageApplyLayout(&storage)
+	data.Cells = int(storage.Cells)
+	err = rc.Validate.StructPartial(storage, fields...)
+	if err != nil || data.LayoutErr != "" {
+		if err != nil {
+			err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), storage)
+			rc.Logger.Info(err.Error())
+			errMap := err.(common.ValidationError).Map()
+			data.NameErr = errMap["NameErr"]
+			data.CellsErr = errMap["CellsErr"]
+			data.LayoutErr = data.LayoutErr + errMap["RowsErr"] + errMap["ColumnsErr"]
+			data.DescriptionErr = errMap["DescriptionErr"]
+		}
+		tmpl.Execute(w, data)
+		return
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{storage.Update})
 	storageErr := errs[0]
 	if storageErr != nil {
-		rc.Logger.Error(storageErr.Error())
-		common.ErrorResp(w, common.Internal)
+		errStruct := db.ErrorAsStruct(storageErr)
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Not found")
+			common.ErrorResp(w, common.NotFound)
+		case db.CellsOccupied:
+			err = errStruct.(db.CellsOccupied).Localize(storage)
+			rc.Logger.Info(err.Error())
+			data.CellsErr = err.(db.DBError).Map()["CellsErr"]
+			tmpl.Execute(w, data)
+		default:
+			rc.Logger.Error(storageErr.Error())
+			common.ErrorResp(w, common.Internal)
+		}
 		return
 	}
-	w.Header().Set("HX-Redirect", fmt.Sprintf("/storages/%s", storage.ID))
+	w.Header().Set("HX-Refresh", "true")
 }
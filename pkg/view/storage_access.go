@@ -0,0 +1,308 @@
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/xsrftoken"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+)
+
+type storageAccessUser struct {
+	User       db.StorageUser
+	DeleteXsrf string
+}
+
+type storageAccessData struct {
+	StorageID       uuid.UUID
+	Responsible     db.StorageUser
+	ResponsibleID   string
+	Owner           db.Storage
+	Assigned        bool
+	Inherited       bool
+	IsAdmin         bool
+	Manage          bool
+	UsersSlice      []storageAccessUser
+	AssistantsSlice []db.StorageUser
+	StaffSlice      []db.StorageUser
+	ResponsibleXsrf string
+	AccessPostXsrf  string
+}
+
+type storageResponsibleInput struct {
+	Responsible string `json:"responsible"`
+}
+
+type storageAccessInput struct {
+	StorageUser string `json:"storage_user"`
+}
+
+func getStorageResponsiblePutXsrf(userID, storageID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/storages/%s/responsible", storageID),
+	)
+}
+
+func getStorageAccessPostXsrf(userID, storageID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/storages/%s/access", storageID),
+	)
+}
+
+func getStorageAccessDeleteXsrf(userID, storageID, storageUserID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/storages/%s/access/%s", storageID, storageUserID),
+	)
+}
+
+func newStorageAccessData(
+	rc *middleware.RequestContext,
+	storage db.Storage,
+	permission db.StoragePermission,
+	storageUsers []db.StorageUser,
+	assistants []db.StorageUser,
+	staff []db.StorageUser,
+) (data storageAccessData) {
+	data.StorageID = storage.ID
+	data.Responsible = permission.Responsible
+	data.Owner = permission.Owner
+	data.Assigned = permission.Owner.ID != uuid.Nil
+	data.Inherited = data.Assigned && permission.Owner.ID != storage.ID
+	if data.Assigned {
+		data.ResponsibleID = permission.Responsible.ID.String()
+	}
+	data.IsAdmin = rc.UserRole == db.Admin
+	data.Manage = data.IsAdmin ||
+		(storage.Responsible != uuid.Nil && storage.Responsible == rc.UserID)
+	if !data.Manage {
+		return data
+	}
+	data.AssistantsSlice = assistants
+	data.StaffSlice = staff
+	data.ResponsibleXsrf = getStorageResponsiblePutXsrf(rc.UserID, storage.ID)
+	data.AccessPostXsrf = getStorageAccessPostXsrf(rc.UserID, storage.ID)
+	for _, storageUser := range storageUsers {
+		data.UsersSlice = append(data.UsersSlice, storageAccessUser{
+			User:       storageUser,
+			DeleteXsrf: getStorageAccessDeleteXsrf(rc.UserID, storage.ID, storageUser.ID),
+		})
+	}
+	return data
+}
+
+func storageAccessDenied(
+	rc *middleware.RequestContext,
+	r *http.Request,
+	permissions ...*db.StoragePermission,
+) (*db.StoragePermission, error) {
+	if rc.UserRole == db.Admin {
+		return nil, nil
+	}
+	batchSets := []db.BatchSet{}
+	for _, permission := range permissions {
+		permission.UserID = rc.UserID
+		batchSets = append(batchSets, permission.Get)
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, batchSets)
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, permission := range permissions {
+		if !permission.Allowed {
+			return permission, nil
+		}
+	}
+	return nil, nil
+}
+
+func storageAccessDeniedMessage(permission *db.StoragePermission) string {
+	return fmt.Sprintf(
+		"Немає доступу до «%s», відповідальна особа: %s",
+		permission.Owner.Name,
+		permission.Responsible.Name,
+	)
+}
+
+func storageManageAllowed(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	storageID uuid.UUID,
+) bool {
+	storage := db.Storage{ID: storageID}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{storage.Get})
+	storageErr := errs[0]
+	if storageErr != nil {
+		errStruct := db.ErrorAsStruct(storageErr)
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Not found")
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(storageErr.Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return false
+	}
+	if rc.UserRole != db.Admin && storage.Responsible != rc.UserID {
+		rc.Logger.Info("Not responsible")
+		common.ErrorResp(w, common.Forbidden)
+		return false
+	}
+	return true
+}
+
+func StorageResponsiblePutAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	storageID, err := uuid.Parse(params.ByName("storageID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	var input storageResponsibleInput
+	err = common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	tmpl := template.Must(template.ParseFiles("templates/storages-assets.html")).
+		Lookup("access-error")
+	storage := db.Storage{ID: storageID}
+	if input.Responsible != "" {
+		storage.Responsible, err = uuid.Parse(rc.Sanitize.Sanitize(input.Responsible))
+		if err != nil {
+			rc.Logger.Info(err.Error())
+			common.ErrorResp(w, common.Internal)
+			return
+		}
+		responsible := db.StorageUser{ID: storage.Responsible}
+		errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{responsible.GetByID})
+		if errs[0] != nil || responsible.Role != db.Assistant || !responsible.Active {
+			rc.Logger.Info("Responsible is not an active assistant")
+			tmpl.Execute(w, "Відповідальною особою може бути лише активний лаборант")
+			return
+		}
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{storage.SetResponsible})
+	storageErr := errs[0]
+	if storageErr != nil {
+		errStruct := db.ErrorAsStruct(storageErr)
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Not found")
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(storageErr.Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	w.Header().Set("HX-Refresh", "true")
+}
+
+func StorageAccessCreateAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	storageID, err := uuid.Parse(params.ByName("storageID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	var input storageAccessInput
+	err = common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	storageUserID, err := uuid.Parse(rc.Sanitize.Sanitize(input.StorageUser))
+	if err != nil {
+		rc.Logger.Info(err.Error())
+		tmpl := template.Must(template.ParseFiles("templates/storages-assets.html")).
+			Lookup("access-error")
+		tmpl.Execute(w, "Оберіть користувача")
+		return
+	}
+	if !storageManageAllowed(rc, w, r, storageID) {
+		return
+	}
+	storageUser := db.StorageUser{ID: storageUserID}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{storageUser.GetByID})
+	if errs[0] != nil || !storageUser.Active ||
+		(storageUser.Role != db.Assistant && storageUser.Role != db.Lecturer) {
+		rc.Logger.Info("Storage user is not an active assistant or lecturer")
+		tmpl := template.Must(template.ParseFiles("templates/storages-assets.html")).
+			Lookup("access-error")
+		tmpl.Execute(w, "Доступ можна надати лише активному лаборанту або викладачу")
+		return
+	}
+	access := db.StorageAccess{Storage: storageID, StorageUser: storageUserID}
+	errs = db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{access.Create})
+	if errs[0] != nil {
+		rc.Logger.Error(errs[0].Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	w.Header().Set("HX-Refresh", "true")
+}
+
+func StorageAccessDeleteAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	storageID, storageErr := uuid.Parse(params.ByName("storageID"))
+	storageUserID, userErr := uuid.Parse(params.ByName("userID"))
+	for _, err := range []error{storageErr, userErr} {
+		if err != nil {
+			rc.Logger.Info(err.Error())
+			common.ErrorResp(w, common.NotFound)
+			return
+		}
+	}
+	if !storageManageAllowed(rc, w, r, storageID) {
+		return
+	}
+	access := db.StorageAccess{Storage: storageID, StorageUser: storageUserID}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{access.Delete})
+	accessErr := errs[0]
+	if accessErr != nil {
+		errStruct := db.ErrorAsStruct(accessErr)
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Not found")
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(accessErr.Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	w.Header().Set("HX-Refresh", "true")
+}
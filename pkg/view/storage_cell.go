@@ -0,0 +1,196 @@
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/xsrftoken"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+)
+
+type cellInfo struct {
+	Number   int16
+	Row      int16
+	Column   int16
+	Label    string
+	Capacity int16
+	Occupied int
+	Free     int
+}
+
+type cellsInfoData struct {
+	Cells        int16
+	Full         int
+	Columns      int16
+	RowsSlice    []int16
+	ColumnsSlice []int16
+	CellsSlice   []cellInfo
+}
+
+func newCellsInfoData(storage db.Storage, storageCells []db.StorageCell) (data cellsInfoData) {
+	data.Cells = storage.Cells
+	data.Columns = storage.Columns
+	if storage.HasLayout() {
+		for row := int16(1); row <= storage.Rows; row++ {
+			data.RowsSlice = append(data.RowsSlice, row)
+		}
+		for column := int16(1); column <= storage.Columns; column++ {
+			data.ColumnsSlice = append(data.ColumnsSlice, column)
+		}
+	}
+	data.CellsSlice = make([]cellInfo, storage.Cells)
+	for i := range data.CellsSlice {
+		data.CellsSlice[i].Number = int16(i + 1)
+		data.CellsSlice[i].Row, data.CellsSlice[i].Column = storage.CellPosition(int16(i + 1))
+	}
+	for _, storageCell := range storageCells {
+		if storageCell.Number < 1 || storageCell.Number > storage.Cells {
+			continue
+		}
+		info := &data.CellsSlice[storageCell.Number-1]
+		info.Label = storageCell.Label
+		info.Capacity = storageCell.Capacity
+		info.Occupied = storageCell.Occupied
+		if storageCell.Capacity != 0 {
+			info.Free = max(int(storageCell.Capacity)-storageCell.Occupied, 0)
+			if info.Free == 0 {
+				data.Full++
+			}
+		}
+	}
+	return data
+}
+
+func getStorageCellPutXsrf(userID, storageID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/storages/%s/cells", storageID),
+	)
+}
+
+func StorageCellsAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	storageID, err := uuid.Parse(params.ByName("storageID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	storage := db.Storage{ID: storageID}
+	cellsRange := db.StorageCellsRange{StorageID: storageID}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{storage.Get, cellsRange.Get})
+	for _, err := range errs {
+		if err != nil {
+			errStruct := db.ErrorAsStruct(err)
+			switch errStruct.(type) {
+			case db.DoesNotExist:
+				rc.Logger.Info("Not found")
+				common.ErrorResp(w, common.NotFound)
+			default:
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return
+		}
+	}
+	tmpl := template.Must(template.ParseFiles("templates/storages-assets.html")).
+		Lookup("cells-info")
+	tmpl.Execute(w, newCellsInfoData(storage, cellsRange.StorageCells))
+}
+
+type storageCellInput struct {
+	Number   string `json:"number"`
+	Label    string `json:"label"`
+	Capacity string `json:"capacity"`
+}
+
+func (input storageCellInput) Bind() (output db.StorageCell, err error) {
+	number, err := strconv.Atoi(input.Number)
+	if err != nil {
+		return db.StorageCell{}, err
+	}
+	output.Number = int16(number)
+	output.Label = input.Label
+	if input.Capacity != "" {
+		capacity, err := strconv.Atoi(input.Capacity)
+		if err != nil {
+			return db.StorageCell{}, err
+		}
+		output.Capacity = int16(capacity)
+	}
+	return output, nil
+}
+
+func StorageCellPutAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	storageID, err := uuid.Parse(params.ByName("storageID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	var input storageCellInput
+	err = common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	input.Label = rc.Sanitize.Sanitize(input.Label)
+	storageCell, err := input.Bind()
+	if err != nil {
+		rc.Logger.Info(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	storageCell.Storage = storageID
+	tmpl := template.Must(template.ParseFiles("templates/storages-assets.html")).
+		Lookup("cell-error")
+	err = rc.Validate.StructPartial(storageCell, "Number", "Label", "Capacity")
+	if err != nil {
+		err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), storageCell)
+		rc.Logger.Info(err.Error())
+		errMap := err.(common.ValidationError).Map()
+		tmpl.Execute(w, errMap["NumberErr"]+errMap["LabelErr"]+errMap["CapacityErr"])
+		return
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{storageCell.Upsert})
+	cellErr := errs[0]
+	if cellErr != nil {
+		errStruct := db.ErrorAsStruct(cellErr)
+		switch errStruct.(type) {
+		case db.OutOfLimits:
+			err = errStruct.(db.OutOfLimits).Localize(storageCell)
+			rc.Logger.Info(err.Error())
+			tmpl.Execute(w, err.(db.DBError).Map()["NumberErr"])
+		case db.CellsOccupied:
+			err = errStruct.(db.CellsOccupied).Localize(storageCell)
+			rc.Logger.Info(err.Error())
+			tmpl.Execute(w, err.(db.DBError).Map()["CapacityErr"])
+		default:
+			rc.Logger.Error(cellErr.Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	w.Header().Set("HX-Trigger", "storage-changed")
+	tmpl.Execute(w, "")
+}
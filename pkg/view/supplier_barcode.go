@@ -0,0 +1,350 @@
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/xsrftoken"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+)
+
+const gs1GroupSeparator = "\x1d"
+
+var gs1ElementPattern = regexp.MustCompile(`\(([0-9]{2,4})\)([^()]*)`)
+
+type supplierScan struct {
+	Barcode   string
+	ExpiresAt string
+	Lot       string
+}
+
+type supplierBarcodeItem struct {
+	Barcode    db.SupplierBarcode
+	DeleteXsrf string
+}
+
+type supplierBarcodesData struct {
+	ReagentID     uuid.UUID
+	Form          db.SupplierBarcode
+	BarcodeErr    string
+	SupplierErr   string
+	GradeErr      string
+	SizeErr       string
+	PostXsrf      string
+	BarcodesSlice []supplierBarcodeItem
+}
+
+type barcodeResultData struct {
+	ReagentID uuid.UUID
+	Scan      supplierScan
+	Barcode   db.SupplierBarcode
+	Found     bool
+	Err       string
+	Link      bool
+	LinkXsrf  string
+}
+
+type supplierBarcodeInput struct {
+	Barcode  string `json:"barcode"`
+	Supplier string `json:"supplier"`
+	Grade    string `json:"grade"`
+	Size     string `json:"size"`
+}
+
+func getSupplierBarcodePostXsrf(userID, reagentID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/reagents/%s/barcodes", reagentID),
+	)
+}
+
+func getSupplierBarcodeDeleteXsrf(userID, reagentID, barcodeID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/reagents/%s/barcodes/%s", reagentID, barcodeID),
+	)
+}
+
+func normalizeGTIN(barcode string) string {
+	if len(barcode) == 14 && strings.HasPrefix(barcode, "0") &&
+		strings.Trim(barcode, "0123456789") == "" {
+		return barcode[1:]
+	}
+	return barcode
+}
+
+func gs1Expiry(value string) string {
+	if len(value) != 6 || strings.Trim(value, "0123456789") != "" {
+		return ""
+	}
+	day := value[4:]
+	if day == "00" {
+		day = "01"
+	}
+	expiresAt, err := time.Parse("060102", value[:4]+day)
+	if err != nil {
+		return ""
+	}
+	if value[4:] == "00" {
+		expiresAt = expiresAt.AddDate(0, 1, -1)
+	}
+	return expiresAt.Format(time.DateOnly)
+}
+
+func gs1Elements(input string) map[string]string {
+	elements := make(map[string]string)
+	if matches := gs1ElementPattern.FindAllStringSubmatch(input, -1); matches != nil {
+		for _, match := range matches {
+			elements[match[1]] = strings.TrimSpace(strings.ReplaceAll(match[2], gs1GroupSeparator, ""))
+		}
+		return elements
+	}
+	fixed := map[string]int{"01": 14, "17": 6}
+	rest := strings.TrimPrefix(input, gs1GroupSeparator)
+	for rest != "" {
+		if len(rest) < 2 {
+			return nil
+		}
+		ai := rest[:2]
+		rest = rest[2:]
+		switch ai {
+		case "01", "17":
+			if len(rest) < fixed[ai] {
+				return nil
+			}
+			elements[ai] = rest[:fixed[ai]]
+			rest = strings.TrimPrefix(rest[fixed[ai]:], gs1GroupSeparator)
+		case "10", "21":
+			value, next, _ := strings.Cut(rest, gs1GroupSeparator)
+			elements[ai] = value
+			rest = next
+		default:
+			return nil
+		}
+	}
+	return elements
+}
+
+func parseSupplierBarcode(input string) (scan supplierScan) {
+	input = strings.TrimSpace(input)
+	elements := gs1Elements(input)
+	gtin, ok := elements["01"]
+	if !ok {
+		scan.Barcode = normalizeGTIN(strings.Join(strings.Fields(input), ""))
+		return scan
+	}
+	scan.Barcode = normalizeGTIN(gtin)
+	scan.ExpiresAt = gs1Expiry(elements["17"])
+	scan.Lot = elements["10"]
+	return scan
+}
+
+func newSupplierBarcodesData(
+	rc *middleware.RequestContext,
+	reagentID uuid.UUID,
+	barcodes []db.SupplierBarcode,
+) supplierBarcodesData {
+	data := supplierBarcodesData{
+		ReagentID: reagentID,
+		PostXsrf:  getSupplierBarcodePostXsrf(rc.UserID, reagentID),
+	}
+	for _, barcode := range barcodes {
+		data.BarcodesSlice = append(data.BarcodesSlice, supplierBarcodeItem{
+			Barcode:    barcode,
+			DeleteXsrf: getSupplierBarcodeDeleteXsrf(rc.UserID, reagentID, barcode.ID),
+		})
+	}
+	return data
+}
+
+func supplierBarcodes(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	reagentID uuid.UUID,
+	prepare func(data *supplierBarcodesData),
+) {
+	barcodesRange := db.SupplierBarcodesRange{ReagentID: reagentID}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{barcodesRange.Get})
+	if errs[0] != nil {
+		rc.Logger.Error(errs[0].Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	data := newSupplierBarcodesData(rc, reagentID, barcodesRange.SupplierBarcodes)
+	prepare(&data)
+	tmpl := template.Must(template.ParseFiles("templates/barcodes-assets.html")).
+		Lookup("supplier-barcodes")
+	tmpl.Execute(w, data)
+}
+
+func (input supplierBarcodeInput) Bind() db.SupplierBarcode {
+	return db.SupplierBarcode{
+		Barcode:  parseSupplierBarcode(input.Barcode).Barcode,
+		Supplier: strings.TrimSpace(input.Supplier),
+		Grade:    strings.TrimSpace(input.Grade),
+		Size:     strings.TrimSpace(input.Size),
+	}
+}
+
+func SupplierBarcodeCreateAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	reagentID, err := uuid.Parse(params.ByName("reagentID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	var input supplierBarcodeInput
+	err = common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	input.Barcode = rc.Sanitize.Sanitize(input.Barcode)
+	input.Supplier = rc.Sanitize.Sanitize(input.Supplier)
+	input.Grade = rc.Sanitize.Sanitize(input.Grade)
+	input.Size = rc.Sanitize.Sanitize(input.Size)
+	barcode := input.Bind()
+	barcode.Reagent = reagentID
+	err = rc.Validate.Struct(barcode)
+	if err != nil {
+		err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), barcode)
+		rc.Logger.Info(err.Error())
+		errMap := err.(common.ValidationError).Map()
+		supplierBarcodes(rc, w, r, reagentID, func(data *supplierBarcodesData) {
+			data.Form = barcode
+			data.BarcodeErr = errMap["BarcodeErr"]
+			data.SupplierErr = errMap["SupplierErr"]
+			data.GradeErr = errMap["GradeErr"]
+			data.SizeErr = errMap["SizeErr"]
+		})
+		return
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{barcode.Create})
+	if errs[0] != nil {
+		errStruct := db.ErrorAsStruct(errs[0])
+		switch errStruct.(type) {
+		case db.UniqueViolation:
+			err = errStruct.(db.UniqueViolation).Localize(db.SupplierBarcode{})
+			rc.Logger.Info(err.Error())
+			supplierBarcodes(rc, w, r, reagentID, func(data *supplierBarcodesData) {
+				data.Form = barcode
+				data.BarcodeErr = err.(db.DBError).Map()["BarcodeErr"]
+			})
+		case db.DoesNotExist:
+			rc.Logger.Info("Reagent not found")
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(errs[0].Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	supplierBarcodes(rc, w, r, reagentID, func(*supplierBarcodesData) {})
+}
+
+func SupplierBarcodeDeleteAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	reagentID, reagentErr := uuid.Parse(params.ByName("reagentID"))
+	barcodeID, barcodeErr := uuid.Parse(params.ByName("barcodeID"))
+	for _, err := range []error{reagentErr, barcodeErr} {
+		if err != nil {
+			rc.Logger.Info(err.Error())
+			common.ErrorResp(w, common.NotFound)
+			return
+		}
+	}
+	barcode := db.SupplierBarcode{ID: barcodeID, Reagent: reagentID}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{barcode.Delete})
+	if errs[0] != nil {
+		errStruct := db.ErrorAsStruct(errs[0])
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Not found")
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(errs[0].Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	supplierBarcodes(rc, w, r, reagentID, func(*supplierBarcodesData) {})
+}
+
+func supplierBarcodeRedirect(reagentID uuid.UUID, input string) string {
+	return fmt.Sprintf(
+		"/reagents/%s/instance-new?barcode=%s",
+		reagentID,
+		url.QueryEscape(input),
+	)
+}
+
+func SupplierBarcodeLookupAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	query := r.URL.Query()
+	input := query.Get("barcode")
+	reagentID, err := uuid.Parse(query.Get("reagent"))
+	if err != nil {
+		rc.Logger.Info(err.Error())
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	tmpl := template.Must(template.ParseFiles("templates/barcodes-assets.html")).
+		Lookup("barcode-result")
+	data := barcodeResultData{ReagentID: reagentID, Scan: parseSupplierBarcode(input)}
+	if data.Scan.Barcode == "" {
+		tmpl.Execute(w, data)
+		return
+	}
+	data.Barcode.Barcode = data.Scan.Barcode
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{data.Barcode.GetByBarcode})
+	if errs[0] != nil {
+		errStruct := db.ErrorAsStruct(errs[0])
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Barcode not mapped")
+			data.Err = fmt.Sprintf("Штрихкод %s не прив'язано до реагенту", data.Scan.Barcode)
+			data.Link = rc.UserRole == db.Assistant
+			data.LinkXsrf = getSupplierBarcodePostXsrf(rc.UserID, reagentID)
+			tmpl.Execute(w, data)
+		default:
+			rc.Logger.Error(errs[0].Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	if data.Barcode.Reagent != reagentID {
+		w.Header().Set("HX-Redirect", supplierBarcodeRedirect(data.Barcode.Reagent, input))
+		return
+	}
+	data.Found = true
+	tmpl.Execute(w, data)
+}
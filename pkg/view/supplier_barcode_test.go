@@ -0,0 +1,66 @@
+package view
+
+import "testing"
+
+func TestParseSupplierBarcode(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		input string
+		scan  supplierScan
+	}{
+		{"EAN-13", "4006381333931", supplierScan{Barcode: "4006381333931"}},
+		{"EAN-13 with spaces", " 4 006381 333931 ", supplierScan{Barcode: "4006381333931"}},
+		{"GTIN-14", "04006381333931", supplierScan{Barcode: "4006381333931"}},
+		{
+			"raw without separator",
+			"01040063813339311725123110LOT42",
+			supplierScan{Barcode: "4006381333931", ExpiresAt: "2025-12-31", Lot: "LOT42"},
+		},
+		{
+			"raw with separator",
+			"\x1d010400638133393110LOT42\x1d17251231",
+			supplierScan{Barcode: "4006381333931", ExpiresAt: "2025-12-31", Lot: "LOT42"},
+		},
+		{
+			"parenthesised",
+			"(01)04006381333931(17)251231(10)LOT42",
+			supplierScan{Barcode: "4006381333931", ExpiresAt: "2025-12-31", Lot: "LOT42"},
+		},
+		{
+			"parenthesised with separator",
+			"(01)04006381333931(10)LOT42\x1d(17)251231",
+			supplierScan{Barcode: "4006381333931", ExpiresAt: "2025-12-31", Lot: "LOT42"},
+		},
+		{
+			"day 00",
+			"(01)04006381333931(17)240200",
+			supplierScan{Barcode: "4006381333931", ExpiresAt: "2024-02-29"},
+		},
+	} {
+		scan := parseSupplierBarcode(test.input)
+		if scan != test.scan {
+			t.Errorf("%s: parseSupplierBarcode(%q) = %+v, want %+v", test.name, test.input, scan, test.scan)
+		}
+	}
+}
+
+func TestGS1Expiry(t *testing.T) {
+	for _, test := range []struct {
+		value string
+		want  string
+	}{
+		{"251231", "2025-12-31"},
+		{"251200", "2025-12-31"},
+		{"250400", "2025-04-30"},
+		{"240200", "2024-02-29"},
+		{"250200", "2025-02-28"},
+		{"251301", ""},
+		{"250230", ""},
+		{"25123", ""},
+		{"25A231", ""},
+	} {
+		if got := gs1Expiry(test.value); got != test.want {
+			t.Errorf("gs1Expiry(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
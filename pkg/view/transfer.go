@@ -0,0 +1,370 @@
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/xsrftoken"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+	"github.com/Kelvedler/ChemicalStorage/pkg/webhook"
+)
+
+type transferNewData struct {
+	Caller         db.StorageUser
+	Storage        db.Storage
+	Cell           int16
+	Reagent        db.Reagent
+	InstancesSlice []db.ReagentInstanceExtended
+	StoragesSlice  []db.Storage
+	TransferXsrf   string
+}
+
+type transferData struct {
+	Caller   db.StorageUser
+	Transfer db.BulkTransferExtended
+}
+
+type transferInput struct {
+	Instances []string `json:"instances"`
+	Storage   string   `json:"storage"`
+	Cell      string   `json:"cell"`
+}
+
+func getTransferXsrf(userID uuid.UUID) string {
+	return xsrftoken.Generate(env.Env.SecretKey, userID.String(), "/api/v1/transfers")
+}
+
+func (input transferInput) Bind() (ids []uuid.UUID, target reagentInstance, err error) {
+	for _, instance := range input.Instances {
+		id, err := uuid.Parse(instance)
+		if err != nil {
+			return nil, reagentInstance{}, err
+		}
+		ids = append(ids, id)
+	}
+	target, err = reagentInstanceInput{Storage: input.Storage, Cell: input.Cell}.Bind()
+	if err != nil {
+		return nil, reagentInstance{}, err
+	}
+	return ids, target, nil
+}
+
+func transferItems(
+	instances []db.ReagentInstanceExtended,
+	target db.StorageCell,
+	free int,
+	denied map[uuid.UUID]bool,
+) (items []db.BulkTransferItemExtended) {
+	for _, instance := range instances {
+		item := db.BulkTransferItemExtended{
+			BulkTransferItem: db.BulkTransferItem{
+				ReagentInstance: instance.ReagentInstance.ID,
+				FromStorageCell: instance.StorageCell.ID,
+			},
+		}
+		switch {
+		case instance.Storage.ID == target.Storage && instance.StorageCell.Number == target.Number:
+			item.BulkTransferItem.Reason = "Вже у цьому відділі"
+		case denied[instance.Storage.ID]:
+			item.BulkTransferItem.Reason = "Немає доступу"
+		case target.Capacity != 0 && free <= 0:
+			item.BulkTransferItem.Reason = "Відділ заповнений"
+		default:
+			item.BulkTransferItem.Moved = true
+			free--
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func ReagentInstancesTransfer(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	query := r.URL.Query()
+	selection := db.InstancesSelection{}
+	data := transferNewData{
+		Caller:       db.StorageUser{ID: rc.UserID},
+		TransferXsrf: getTransferXsrf(rc.UserID),
+	}
+	batchSets := []db.BatchSet{}
+	if storageStr := query.Get("storage"); storageStr != "" {
+		storageID, err := uuid.Parse(storageStr)
+		if err != nil {
+			rc.Logger.Info("Invalid UUID")
+			common.ErrorResp(w, common.NotFound)
+			return
+		}
+		selection.StorageID = storageID
+		data.Storage.ID = storageID
+		batchSets = append(batchSets, data.Storage.Get)
+		cell, err := strconv.Atoi(query.Get("cell"))
+		if err == nil && cell > 0 {
+			selection.Cell = int16(cell)
+			data.Cell = int16(cell)
+		}
+	}
+	if reagentStr := query.Get("reagent"); reagentStr != "" {
+		reagentID, err := uuid.Parse(reagentStr)
+		if err != nil {
+			rc.Logger.Info("Invalid UUID")
+			common.ErrorResp(w, common.NotFound)
+			return
+		}
+		selection.ReagentID = reagentID
+		data.Reagent.ID = reagentID
+		batchSets = append(batchSets, data.Reagent.Get)
+	}
+	storagesRange := db.StoragesRange{
+		Limit:     40,
+		Offset:    0,
+		Placeable: true,
+	}
+	batchSets = append(batchSets, selection.Get, storagesRange.Get, data.Caller.GetByID)
+	errs := db.PerformBatch(r.Context(), rc.DBpool, batchSets)
+	for _, err := range errs[:len(errs)-1] {
+		if err != nil {
+			errStruct := db.ErrorAsStruct(err)
+			switch errStruct.(type) {
+			case db.DoesNotExist:
+				rc.Logger.Info("Not found")
+				common.ErrorResp(w, common.NotFound)
+			default:
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return
+		}
+	}
+	data.InstancesSlice = selection.ReagentInstancesExtended
+	data.StoragesSlice = storagesRange.Storages
+	tmpl := template.Must(
+		template.ParseFiles(
+			"templates/transfer-new.html",
+			"templates/base.html",
+			"templates/instances-assets.html",
+			"templates/storages-assets.html",
+		),
+	)
+	tmpl.Execute(w, data)
+}
+
+func ReagentInstancesTransferAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	var input transferInput
+	err := common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	sanitizer := rc.Sanitize
+	input.Storage = sanitizer.Sanitize(input.Storage)
+	input.Cell = sanitizer.Sanitize(input.Cell)
+	ids, target, err := input.Bind()
+	if err != nil {
+		rc.Logger.Info(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	tmpl := template.Must(template.ParseFiles("templates/instances-assets.html", "templates/storages-assets.html")).
+		Lookup("transfer-error")
+	if len(ids) == 0 {
+		rc.Logger.Info("Empty selection")
+		tmpl.Execute(w, "Не обрано жодного екземпляру")
+		return
+	}
+	storage := db.Storage{ID: target.Storage}
+	cellsRange := db.StorageCellsRange{StorageID: target.Storage}
+	selection := db.InstancesSelection{IDs: ids}
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{storage.Get, cellsRange.Get, selection.Get},
+	)
+	for _, err := range errs {
+		if err != nil {
+			errStruct := db.ErrorAsStruct(err)
+			switch errStruct.(type) {
+			case db.DoesNotExist:
+				rc.Logger.Info("Not found")
+				common.ErrorResp(w, common.NotFound)
+			default:
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return
+		}
+	}
+	if !storage.ArchivedAt.IsZero() || !storage.HasCells() {
+		rc.Logger.Info("Target not placeable")
+		tmpl.Execute(w, "Неможливо перемістити до обраного елементу")
+		return
+	}
+	if target.Cell < 1 || target.Cell > storage.Cells {
+		rc.Logger.Info("Cell out of limits")
+		tmpl.Execute(w, fmt.Sprintf("Відділ має бути від 1 до %d", storage.Cells))
+		return
+	}
+	storageCell := db.StorageCell{Storage: target.Storage, Number: target.Cell}
+	for _, cell := range cellsRange.StorageCells {
+		if cell.Number == target.Cell {
+			storageCell.Capacity = cell.Capacity
+			storageCell.Occupied = cell.Occupied
+		}
+	}
+	if len(selection.ReagentInstancesExtended) == 0 {
+		rc.Logger.Info("Nothing to transfer")
+		tmpl.Execute(w, "Обрані екземпляри вже використано або видалено")
+		return
+	}
+	permissions := []*db.StoragePermission{{StorageID: target.Storage}}
+	sources := map[uuid.UUID]*db.StoragePermission{}
+	for _, instance := range selection.ReagentInstancesExtended {
+		if _, ok := sources[instance.Storage.ID]; !ok {
+			sources[instance.Storage.ID] = &db.StoragePermission{StorageID: instance.Storage.ID}
+			permissions = append(permissions, sources[instance.Storage.ID])
+		}
+	}
+	_, err = storageAccessDenied(rc, r, permissions...)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	denied := map[uuid.UUID]bool{}
+	if rc.UserRole != db.Admin {
+		if !permissions[0].Allowed {
+			rc.Logger.Info("Storage access denied")
+			tmpl.Execute(w, storageAccessDeniedMessage(permissions[0]))
+			return
+		}
+		for storageID, permission := range sources {
+			denied[storageID] = !permission.Allowed
+		}
+	}
+	transfer := db.BulkTransferExtended{
+		BulkTransfer: db.BulkTransfer{ID: uuid.New(), StorageUser: rc.UserID},
+		StorageCell:  storageCell,
+		Items: transferItems(
+			selection.ReagentInstancesExtended,
+			storageCell,
+			int(storageCell.Capacity)-storageCell.Occupied,
+			denied,
+		),
+	}
+	selected := map[uuid.UUID]bool{}
+	for _, instance := range selection.ReagentInstancesExtended {
+		selected[instance.ReagentInstance.ID] = true
+	}
+	for _, id := range ids {
+		if !selected[id] {
+			transfer.Items = append(transfer.Items, db.BulkTransferItemExtended{
+				BulkTransferItem: db.BulkTransferItem{ReagentInstance: id, Moved: true},
+			})
+		}
+	}
+	batchSets := []db.BatchSet{storageCell.TryCreate, transfer.Create}
+	var moved []uuid.UUID
+	for _, item := range transfer.Items {
+		if item.BulkTransferItem.Moved {
+			moved = append(moved, item.BulkTransferItem.ReagentInstance)
+		}
+	}
+	if len(moved) > 0 {
+		event, err := webhook.NewEvent(
+			webhook.InstanceTransferred,
+			map[string]any{"bulk_transfer": transfer.BulkTransfer.ID},
+			moved...,
+		)
+		if err != nil {
+			rc.Logger.Error(err.Error())
+			common.ErrorResp(w, common.Internal)
+			return
+		}
+		batchSets = append(batchSets, event.Enqueue)
+	}
+	errs = db.PerformBatch(r.Context(), rc.DBpool, batchSets)
+	for _, err = range errs {
+		if err != nil {
+			errStruct := db.ErrorAsStruct(err)
+			switch errStruct.(type) {
+			case db.OutOfLimits:
+				err = errStruct.(db.OutOfLimits).Localize(storageCell)
+				rc.Logger.Info(err.Error())
+				tmpl.Execute(w, err.(db.DBError).Map()["NumberErr"])
+			case db.CapacityExceeded:
+				err = errStruct.(db.CapacityExceeded).Localize(storageCell)
+				rc.Logger.Info(err.Error())
+				tmpl.Execute(w, err.(db.DBError).Map()["NumberErr"])
+			case db.DoesNotExist:
+				rc.Logger.Info("Cell not found")
+				tmpl.Execute(w, "Відділ не знайдено, оберіть інший")
+			default:
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return
+		}
+	}
+	rc.Logger.Info(fmt.Sprintf(
+		"Transferred %d instances, skipped %d %v",
+		transfer.BulkTransfer.Moved,
+		transfer.BulkTransfer.Skipped,
+		transfer.SkippedIDs,
+	))
+	w.Header().Set("HX-Redirect", fmt.Sprintf("/transfers/%s", transfer.BulkTransfer.ID))
+}
+
+func ReagentInstancesTransferSummary(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	transferID, err := uuid.Parse(params.ByName("transferID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	data := transferData{
+		Caller:   db.StorageUser{ID: rc.UserID},
+		Transfer: db.BulkTransferExtended{BulkTransfer: db.BulkTransfer{ID: transferID}},
+	}
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{data.Transfer.Get, data.Caller.GetByID},
+	)
+	transferErr := errs[0]
+	if transferErr != nil {
+		errStruct := db.ErrorAsStruct(transferErr)
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Not found")
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(transferErr.Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	tmpl := template.Must(template.ParseFiles("templates/transfer.html", "templates/base.html"))
+	tmpl.Execute(w, data)
+}
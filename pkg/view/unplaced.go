@@ -0,0 +1,236 @@
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/xsrftoken"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+	"github.com/Kelvedler/ChemicalStorage/pkg/webhook"
+)
+
+type unplacedInstanceData struct {
+	Unplaced      db.UnplacedInstance
+	StoragesSlice []db.Storage
+	PlaceXsrf     string
+	Placed        db.StorageCell
+	PlacedName    string
+	Err           string
+}
+
+type unplacedData struct {
+	Caller         db.StorageUser
+	InstancesSlice []unplacedInstanceData
+}
+
+func getInstancePlaceXsrf(userID, instanceID, reagentID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/reagents/%s/instances/%s/place", reagentID, instanceID),
+	)
+}
+
+func UnplacedInstances(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	unplacedRange := db.UnplacedInstancesRange{}
+	storagesRange := db.StoragesRange{
+		Limit:     100,
+		Offset:    0,
+		Placeable: true,
+	}
+	caller := db.StorageUser{ID: rc.UserID}
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{unplacedRange.Get, storagesRange.Get, caller.GetByID},
+	)
+	for _, err := range errs[:2] {
+		if err != nil {
+			rc.Logger.Error(err.Error())
+			common.ErrorResp(w, common.Internal)
+			return
+		}
+	}
+	data := unplacedData{Caller: caller}
+	for _, unplaced := range unplacedRange.UnplacedInstances {
+		data.InstancesSlice = append(data.InstancesSlice, unplacedInstanceData{
+			Unplaced:      unplaced,
+			StoragesSlice: storagesRange.Storages,
+			PlaceXsrf: getInstancePlaceXsrf(
+				rc.UserID,
+				unplaced.Instance.ReagentInstance.ID,
+				unplaced.Instance.Reagent.ID,
+			),
+		})
+	}
+	tmpl := template.Must(
+		template.ParseFiles(
+			"templates/unplaced.html",
+			"templates/base.html",
+			"templates/instances-assets.html",
+			"templates/storages-assets.html",
+		),
+	)
+	tmpl.Execute(w, data)
+}
+
+func instancePlacement(
+	current db.ReagentInstanceExtended,
+	storage db.Storage,
+	storageCell db.StorageCell,
+) db.ReagentInstanceExtended {
+	placement := current
+	placement.Storage = storage
+	placement.StorageCell = storageCell
+	return placement
+}
+
+func ReagentInstancePlaceAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	reagentID, reagentErr := uuid.Parse(params.ByName("reagentID"))
+	instanceID, instanceErr := uuid.Parse(params.ByName("instanceID"))
+	for _, err := range []error{reagentErr, instanceErr} {
+		if err != nil {
+			rc.Logger.Info(err.Error())
+			common.ErrorResp(w, common.NotFound)
+			return
+		}
+	}
+	var inputStr reagentInstanceInput
+	err := common.BindJSON(r, &inputStr)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	sanitizeReagentInstance(rc, &inputStr)
+	input, err := inputStr.Bind()
+	if err != nil {
+		rc.Logger.Info(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	tmpl := template.Must(template.ParseFiles("templates/instances-assets.html", "templates/storages-assets.html")).
+		Lookup("unplaced-instance")
+	storage := db.Storage{ID: input.Storage}
+	storageCell := db.StorageCell{Storage: input.Storage, Number: input.Cell}
+	data := unplacedInstanceData{
+		Unplaced: db.UnplacedInstance{
+			Instance: db.ReagentInstanceExtended{
+				ReagentInstance: db.ReagentInstance{ID: instanceID, Reagent: reagentID},
+				Reagent:         db.Reagent{ID: reagentID},
+			},
+		},
+		PlaceXsrf: getInstancePlaceXsrf(rc.UserID, instanceID, reagentID),
+	}
+	current := db.ReagentInstanceExtended{
+		ReagentInstance: db.ReagentInstance{ID: instanceID, Reagent: reagentID},
+	}
+	storagesRange := db.StoragesRange{
+		Limit:     100,
+		Offset:    0,
+		Placeable: true,
+	}
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{current.Get, storage.Get, storagesRange.Get},
+	)
+	for _, err = range errs {
+		if err != nil {
+			errStruct := db.ErrorAsStruct(err)
+			switch errStruct.(type) {
+			case db.DoesNotExist:
+				rc.Logger.Info("Not found")
+				common.ErrorResp(w, common.NotFound)
+			default:
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return
+		}
+	}
+	data.Unplaced.Instance = current
+	data.StoragesSlice = storagesRange.Storages
+	if current.Placed() {
+		rc.Logger.Info("Already placed")
+		data.Placed = current.StorageCell
+		data.PlacedName = current.Storage.Name
+		tmpl.Execute(w, data)
+		return
+	}
+	data.Unplaced.SuggestedStorage = storage
+	if !storage.ArchivedAt.IsZero() || !storage.HasCells() {
+		rc.Logger.Info("Target not placeable")
+		data.Err = "Неможливо розмістити в обраному елементі"
+		tmpl.Execute(w, data)
+		return
+	}
+	denied, err := storageAccessDenied(rc, r, &db.StoragePermission{StorageID: input.Storage})
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	if denied != nil {
+		rc.Logger.Info("Storage access denied")
+		data.Err = storageAccessDeniedMessage(denied)
+		tmpl.Execute(w, data)
+		return
+	}
+	event, err := webhook.NewEvent(webhook.InstanceTransferred, nil, instanceID)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	rie := instancePlacement(current, storage, storageCell)
+	errs = db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{storageCell.TryCreate, rie.Place, event.Enqueue},
+	)
+	for _, err = range errs {
+		if err != nil {
+			errStruct := db.ErrorAsStruct(err)
+			switch errStruct.(type) {
+			case db.OutOfLimits:
+				err = errStruct.(db.OutOfLimits).Localize(storageCell)
+				rc.Logger.Info(err.Error())
+				data.Err = err.(db.DBError).Map()["NumberErr"]
+				tmpl.Execute(w, data)
+			case db.CapacityExceeded:
+				err = errStruct.(db.CapacityExceeded).Localize(storageCell)
+				rc.Logger.Info(err.Error())
+				data.Err = err.(db.DBError).Map()["NumberErr"]
+				tmpl.Execute(w, data)
+			case db.DoesNotExist:
+				rc.Logger.Info("Not found")
+				common.ErrorResp(w, common.NotFound)
+			default:
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return
+		}
+	}
+	data.Placed = storageCell
+	data.PlacedName = storage.Name
+	tmpl.Execute(w, data)
+}
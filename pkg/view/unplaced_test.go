@@ -0,0 +1,39 @@
+package view
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+)
+
+func TestInstancePlacementUnplaced(t *testing.T) {
+	instanceID, reagentID, storageID := uuid.New(), uuid.New(), uuid.New()
+	current := db.ReagentInstanceExtended{
+		ReagentInstance: db.ReagentInstance{ID: instanceID, Reagent: reagentID},
+	}
+	if current.Placed() {
+		t.Fatal("instance without a cell reports as placed")
+	}
+	storage := db.Storage{ID: storageID, Name: "Шафа 1", Cells: 12}
+	storageCell := db.StorageCell{Storage: storageID, Number: 7}
+	rie := instancePlacement(current, storage, storageCell)
+	if rie.ReagentInstance.ID != instanceID || rie.ReagentInstance.Reagent != reagentID {
+		t.Fatalf("placement instance = %v/%v, want %v/%v",
+			rie.ReagentInstance.ID, rie.ReagentInstance.Reagent, instanceID, reagentID)
+	}
+	if rie.Storage.ID != storageID || rie.StorageCell.Number != 7 {
+		t.Fatalf("placement target = %v/%d, want %v/7", rie.Storage.ID, rie.StorageCell.Number, storageID)
+	}
+	operation, _ := rie.Place()
+	batch := &pgx.Batch{}
+	operation(batch)
+	if batch.Len() != 1 {
+		t.Fatalf("queued %d queries, want 1", batch.Len())
+	}
+	if current.Storage.ID != uuid.Nil || current.StorageCell.Number != 0 {
+		t.Fatal("placement changed the fetched instance")
+	}
+}
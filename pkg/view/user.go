@@ -15,6 +15,7 @@ import (
 	"github.com/Kelvedler/ChemicalStorage/pkg/db"
 	"github.com/Kelvedler/ChemicalStorage/pkg/env"
 	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+	"github.com/Kelvedler/ChemicalStorage/pkg/webhook"
 )
 
 type storageUsersData struct {
@@ -243,3 +244,186 @@ func UserPutAPI(
 		}
 	}
 }
+
+type pendingUser struct {
+	User        db.StorageUser
+	ApproveXsrf string
+	RejectXsrf  string
+	NoteErr     string
+	RoleErr     string
+}
+
+type pendingUsersData struct {
+	Caller       db.StorageUser
+	PendingUsers []pendingUser
+}
+
+func getUserApproveXsrf(callerID, userID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		callerID.String(),
+		fmt.Sprintf("/api/v1/users/%s/approve", userID),
+	)
+}
+
+func getUserRejectXsrf(callerID, userID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		callerID.String(),
+		fmt.Sprintf("/api/v1/users/%s/reject", userID),
+	)
+}
+
+func PendingUsers(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	storageUsersRange := db.StorageUsersRange{
+		Limit:     100,
+		Offset:    0,
+		ExcludeID: rc.UserID,
+		Pending:   true,
+	}
+	caller := db.StorageUser{ID: rc.UserID}
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{storageUsersRange.Get, caller.GetByID},
+	)
+	storageUsersErr := errs[0]
+	if storageUsersErr != nil {
+		rc.Logger.Error(storageUsersErr.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	data := pendingUsersData{Caller: caller}
+	for _, user := range storageUsersRange.StorageUsers {
+		data.PendingUsers = append(data.PendingUsers, pendingUser{
+			User:        user,
+			ApproveXsrf: getUserApproveXsrf(rc.UserID, user.ID),
+			RejectXsrf:  getUserRejectXsrf(rc.UserID, user.ID),
+		})
+	}
+	tmpl := template.Must(
+		template.ParseFiles(
+			"templates/pending-users.html",
+			"templates/base.html",
+			"templates/users-assets.html",
+		),
+	)
+	tmpl.Execute(w, data)
+}
+
+type userReviewInput struct {
+	Role string `json:"role"`
+	Note string `json:"note"`
+}
+
+func sanitizeUserReview(rc *middleware.RequestContext, input *userReviewInput) {
+	sanitizer := rc.Sanitize
+	input.Role = sanitizer.Sanitize(input.Role)
+	input.Note = sanitizer.Sanitize(input.Note)
+}
+
+func userReview(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+	reject bool,
+) {
+	userID, err := uuid.Parse(params.ByName("userID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	var input userReviewInput
+	err = common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	sanitizeUserReview(rc, &input)
+	user := db.StorageUser{
+		ID:         userID,
+		Role:       db.Unconfirmed,
+		Rejected:   reject,
+		ReviewNote: input.Note,
+		ReviewedBy: rc.UserID,
+	}
+	tmpl := template.Must(template.ParseFiles("templates/users-assets.html")).
+		Lookup("pending-user")
+	data := pendingUser{
+		User:        user,
+		ApproveXsrf: getUserApproveXsrf(rc.UserID, userID),
+		RejectXsrf:  getUserRejectXsrf(rc.UserID, userID),
+	}
+	if !reject {
+		role, err := db.StringToRole(input.Role)
+		if err != nil || role == db.Admin || role == db.Unconfirmed {
+			rc.Logger.Info(fmt.Sprintf("Can't approve as %s", input.Role))
+			data.RoleErr = "Оберіть роль лаборанта або викладача"
+			tmpl.Execute(w, data)
+			return
+		}
+		user.Role = role
+		data.User.Role = role
+	}
+	err = rc.Validate.StructPartial(user, "ReviewNote")
+	if err != nil {
+		err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), user)
+		rc.Logger.Info(err.Error())
+		data.NoteErr = err.(common.ValidationError).Map()["ReviewNoteErr"]
+		tmpl.Execute(w, data)
+		return
+	}
+	batchSets := []db.BatchSet{user.Review}
+	if !reject {
+		event, err := webhook.NewEvent(webhook.UserConfirmed, nil, user.ID)
+		if err != nil {
+			rc.Logger.Error(err.Error())
+			common.ErrorResp(w, common.Internal)
+			return
+		}
+		batchSets = append(batchSets, event.Enqueue)
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, batchSets)
+	for _, userErr := range errs {
+		if userErr != nil {
+			errStruct := db.ErrorAsStruct(userErr)
+			switch errStruct.(type) {
+			case db.InvalidUUID, db.DoesNotExist:
+				rc.Logger.Info("Not found")
+				common.ErrorResp(w, common.NotFound)
+			default:
+				rc.Logger.Error(userErr.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return
+		}
+	}
+	data.User = user
+	tmpl.Execute(w, data)
+}
+
+func UserApproveAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	userReview(rc, w, r, params, false)
+}
+
+func UserRejectAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	userReview(rc, w, r, params, true)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/microcosm-cc/bluemonday"
 
+	"github.com/Kelvedler/ChemicalStorage/pkg/live"
 	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
 )
 
@@ -26,57 +27,156 @@ func BaseRouter(
 	dbpool *pgxpool.Pool,
 	sanitize *bluemonday.Policy,
 	validate *validator.Validate,
+	broker *live.Broker,
 	mainLogger *slog.Logger,
 ) *httprouter.Router {
 	router := httprouter.New()
-	handlerContext := middleware.NewHandlerContext(dbpool, sanitize, validate)
+	handlerContext := middleware.NewHandlerContext(dbpool, sanitize, validate, broker)
 
 	router.GET("/favicon.ico", middleware.UnrestrictedNoAuth.Wrapper(Favicon, handlerContext))
 	router.ServeFiles("/static/*filepath", http.Dir(staticFilepath(mainLogger)))
 	router.GET("/", middleware.Unrestricted.Wrapper(Index, handlerContext))
 	router.GET("/sign-in", middleware.UnrestrictedNoAuth.Wrapper(SignIn, handlerContext))
 	router.GET("/sign-up", middleware.UnrestrictedNoAuth.Wrapper(SignUp, handlerContext))
-	router.GET("/me", middleware.Unrestricted.Wrapper(Me, handlerContext))
+	router.GET("/me", middleware.UnrestrictedUnconfirmed.Wrapper(Me, handlerContext))
+	router.GET("/calendar/:token", middleware.TokenAuthView.Wrapper(CalendarFeed, handlerContext))
 	router.GET("/users/", middleware.AdminOnlyView.Wrapper(Users, handlerContext))
 	router.GET("/users/:userID", middleware.AdminOnlyView.Wrapper(User, handlerContext))
+	router.GET("/pending-users/", middleware.AdminOnlyView.Wrapper(PendingUsers, handlerContext))
+	router.GET("/webhooks/", middleware.AdminOnlyView.Wrapper(Webhooks, handlerContext))
+	router.GET("/webhooks/:webhookID", middleware.AdminOnlyView.Wrapper(Webhook, handlerContext))
 	router.GET("/reagent-new", middleware.AssistantOnlyView.Wrapper(ReagentCreate, handlerContext))
 	router.GET("/reagents/", middleware.Unrestricted.Wrapper(Reagents, handlerContext))
 	router.GET("/reagents/:reagentID", middleware.Unrestricted.Wrapper(Reagent, handlerContext))
 	router.GET(
 		"/reagents/:reagentID/instance-new",
-		middleware.AssistantOnlyView.Wrapper(ReagentInstanceCreate, handlerContext),
+		middleware.AdminAssistantView.Wrapper(ReagentInstanceCreate, handlerContext),
 	)
 	router.GET(
 		"/reagents/:reagentID/instances/:instanceID",
 		middleware.LecturerAssistantView.Wrapper(ReagentInstance, handlerContext),
 	)
+	router.GET(
+		"/reagents/:reagentID/instances/:instanceID/qr",
+		middleware.LecturerAssistantView.Wrapper(ReagentInstanceQR, handlerContext),
+	)
+	router.GET(
+		"/reagents/:reagentID/instances/:instanceID/recertifications/:recertificationID/attachment",
+		middleware.LecturerAssistantView.Wrapper(RecertificationAttachment, handlerContext),
+	)
+	router.GET(
+		"/receivings/:receivingID",
+		middleware.AdminAssistantView.Wrapper(Receiving, handlerContext),
+	)
+	router.GET("/labels", middleware.AdminAssistantView.Wrapper(Labels, handlerContext))
+	router.GET("/scan", middleware.LecturerAssistantView.Wrapper(Scan, handlerContext))
+	router.GET(
+		"/transfer-new",
+		middleware.AdminAssistantView.Wrapper(ReagentInstancesTransfer, handlerContext),
+	)
+	router.GET(
+		"/transfers/:transferID",
+		middleware.AdminAssistantView.Wrapper(ReagentInstancesTransferSummary, handlerContext),
+	)
+	router.GET(
+		"/unplaced-instances",
+		middleware.AdminAssistantView.Wrapper(UnplacedInstances, handlerContext),
+	)
+	router.GET(
+		"/stocktakes/:stocktakeID",
+		middleware.AdminAssistantView.Wrapper(Stocktake, handlerContext),
+	)
+	router.GET(
+		"/requests/",
+		middleware.LecturerAssistantView.Wrapper(ReagentRequests, handlerContext),
+	)
+	router.GET(
+		"/requests/:requestID",
+		middleware.LecturerAssistantView.Wrapper(ReagentRequest, handlerContext),
+	)
+	router.GET(
+		"/request-new",
+		middleware.LecturerOnlyView.Wrapper(ReagentRequestCreate, handlerContext),
+	)
+	router.GET(
+		"/checkouts/",
+		middleware.LecturerAssistantView.Wrapper(Checkouts, handlerContext),
+	)
+	router.GET(
+		"/bom/",
+		middleware.LecturerAssistantView.Wrapper(BomChecks, handlerContext),
+	)
+	router.GET(
+		"/bom/:bomID",
+		middleware.LecturerAssistantView.Wrapper(BomCheck, handlerContext),
+	)
+	router.GET(
+		"/bom/:bomID/export",
+		middleware.LecturerAssistantView.Wrapper(BomExport, handlerContext),
+	)
+	router.GET(
+		"/courses/",
+		middleware.LecturerAssistantView.Wrapper(Courses, handlerContext),
+	)
+	router.GET(
+		"/courses/:courseID",
+		middleware.LecturerAssistantView.Wrapper(Course, handlerContext),
+	)
 	router.GET(
 		"/storage-new",
 		middleware.AssistantOnlyView.Wrapper(StorageCreate, handlerContext),
 	)
-	router.GET("/storages/", middleware.AssistantOnlyView.Wrapper(Storages, handlerContext))
+	router.GET("/storages/", middleware.AdminAssistantView.Wrapper(Storages, handlerContext))
 	router.GET(
 		"/storages/:storageID",
-		middleware.AssistantOnlyView.Wrapper(Storage, handlerContext),
+		middleware.AdminAssistantView.Wrapper(Storage, handlerContext),
+	)
+	router.GET(
+		"/storages/:storageID/decommission",
+		middleware.AssistantOnlyView.Wrapper(StorageDecommission, handlerContext),
 	)
 
 	router.POST(
 		"/api/v1/sign-in",
-		middleware.Unrestricted.Wrapper(SignInAPI, handlerContext),
+		middleware.UnrestrictedUnconfirmed.Wrapper(SignInAPI, handlerContext),
 	)
 	router.POST(
 		"/api/v1/sign-out",
-		middleware.Unrestricted.Wrapper(SignOutAPI, handlerContext),
+		middleware.UnrestrictedUnconfirmed.Wrapper(SignOutAPI, handlerContext),
 	)
 	router.POST(
 		"/api/v1/sign-up",
-		middleware.Unrestricted.Wrapper(SignUpAPI, handlerContext),
+		middleware.UnrestrictedUnconfirmed.Wrapper(SignUpAPI, handlerContext),
 	)
 	router.PUT(
 		"/api/v1/users/:userID",
 		middleware.AdminOnlyAPI.Wrapper(UserPutAPI, handlerContext),
 	)
+	router.POST(
+		"/api/v1/me/calendar-token",
+		middleware.LecturerAssistantAPI.Wrapper(CalendarTokenCreateAPI, handlerContext),
+	)
+	router.DELETE(
+		"/api/v1/me/calendar-token",
+		middleware.LecturerAssistantAPI.Wrapper(CalendarTokenDeleteAPI, handlerContext),
+	)
 	router.GET("/api/v1/users/", middleware.AdminOnlyAPI.Wrapper(UsersAPI, handlerContext))
+	router.POST(
+		"/api/v1/users/:userID/approve",
+		middleware.AdminOnlyAPI.Wrapper(UserApproveAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/users/:userID/reject",
+		middleware.AdminOnlyAPI.Wrapper(UserRejectAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/webhooks",
+		middleware.AdminOnlyAPI.Wrapper(WebhookCreateAPI, handlerContext),
+	)
+	router.PUT(
+		"/api/v1/webhooks/:webhookID",
+		middleware.AdminOnlyAPI.Wrapper(WebhookPutAPI, handlerContext),
+	)
 	router.GET(
 		"/api/v1/reagents/",
 		middleware.Unrestricted.Wrapper(ReagentsAPI, handlerContext),
@@ -89,25 +189,185 @@ func BaseRouter(
 		"/api/v1/reagents/:reagentID",
 		middleware.AssistantOnlyAPI.Wrapper(ReagentPutAPI, handlerContext),
 	)
+	router.GET(
+		"/api/v1/reagents/:reagentID/events",
+		middleware.LecturerAssistantView.Wrapper(ReagentEventsAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/reagents/:reagentID/barcodes",
+		middleware.AssistantOnlyAPI.Wrapper(SupplierBarcodeCreateAPI, handlerContext),
+	)
+	router.DELETE(
+		"/api/v1/reagents/:reagentID/barcodes/:barcodeID",
+		middleware.AssistantOnlyAPI.Wrapper(SupplierBarcodeDeleteAPI, handlerContext),
+	)
+	router.GET(
+		"/api/v1/barcodes",
+		middleware.AdminAssistantView.Wrapper(SupplierBarcodeLookupAPI, handlerContext),
+	)
 	router.POST(
 		"/api/v1/reagents/:reagentID/instances",
-		middleware.AssistantOnlyAPI.Wrapper(ReagentInstanceCreateAPI, handlerContext),
+		middleware.AdminAssistantAPI.Wrapper(ReagentInstanceCreateAPI, handlerContext),
 	)
 	router.POST(
 		"/api/v1/reagents/:reagentID/instances/:instanceID/use",
-		middleware.AssistantOnlyAPI.Wrapper(ReagentInstanceUseAPI, handlerContext),
+		middleware.AdminAssistantAPI.Wrapper(ReagentInstanceUseAPI, handlerContext),
 	)
 	router.POST(
 		"/api/v1/reagents/:reagentID/instances/:instanceID/transfer",
-		middleware.AssistantOnlyAPI.Wrapper(ReagentInstanceTransferAPI, handlerContext),
+		middleware.AdminAssistantAPI.Wrapper(ReagentInstanceTransferAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/reagents/:reagentID/instances/:instanceID/recertify",
+		middleware.AssistantOnlyAPI.Wrapper(ReagentInstanceRecertifyAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/reagents/:reagentID/instances/:instanceID/peroxide-tests",
+		middleware.AssistantOnlyAPI.Wrapper(ReagentInstancePeroxideTestAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/reagents/:reagentID/instances/:instanceID/place",
+		middleware.AdminAssistantAPI.Wrapper(ReagentInstancePlaceAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/reagents/:reagentID/instances/:instanceID/reservations",
+		middleware.LecturerAssistantAPI.Wrapper(ReservationCreateAPI, handlerContext),
+	)
+	router.DELETE(
+		"/api/v1/reagents/:reagentID/instances/:instanceID/reservations/:reservationID",
+		middleware.LecturerAssistantAPI.Wrapper(ReservationDeleteAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/reagents/:reagentID/instances/:instanceID/checkout",
+		middleware.LecturerAssistantAPI.Wrapper(CheckoutCreateAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/reagents/:reagentID/instances/:instanceID/checkin",
+		middleware.LecturerAssistantAPI.Wrapper(CheckinAPI, handlerContext),
+	)
+	router.GET(
+		"/api/v1/reagent-options",
+		middleware.LecturerAssistantView.Wrapper(ReagentOptionsAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/requests",
+		middleware.LecturerOnlyAPI.Wrapper(ReagentRequestCreateAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/requests/:requestID/review",
+		middleware.AssistantOnlyAPI.Wrapper(ReagentRequestReviewAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/courses",
+		middleware.LecturerOnlyAPI.Wrapper(CourseCreateAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/courses/:courseID/practicals",
+		middleware.LecturerOnlyAPI.Wrapper(PracticalCreateAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/courses/:courseID/items",
+		middleware.LecturerOnlyAPI.Wrapper(PracticalItemCreateAPI, handlerContext),
+	)
+	router.DELETE(
+		"/api/v1/courses/:courseID/items/:itemID",
+		middleware.LecturerOnlyAPI.Wrapper(PracticalItemDeleteAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/courses/:courseID/sessions",
+		middleware.LecturerOnlyAPI.Wrapper(LabSessionCreateAPI, handlerContext),
+	)
+	router.DELETE(
+		"/api/v1/courses/:courseID/sessions/:sessionID",
+		middleware.LecturerOnlyAPI.Wrapper(LabSessionDeleteAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/courses/:courseID/sessions/:sessionID/request",
+		middleware.LecturerOnlyAPI.Wrapper(LabSessionRequestAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/bom",
+		middleware.LecturerAssistantAPI.Wrapper(BomCreateAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/bom/check",
+		middleware.LecturerAssistantAPI.Wrapper(BomCheckAPI, handlerContext),
+	)
+	router.DELETE(
+		"/api/v1/bom/:bomID",
+		middleware.LecturerAssistantAPI.Wrapper(BomDeleteAPI, handlerContext),
+	)
+	router.GET(
+		"/api/v1/scan",
+		middleware.LecturerAssistantView.Wrapper(ScanAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/transfers",
+		middleware.AdminAssistantAPI.Wrapper(ReagentInstancesTransferAPI, handlerContext),
 	)
 	router.GET(
 		"/api/v1/storages",
-		middleware.AssistantOnlyAPI.Wrapper(StoragesAPI, handlerContext),
+		middleware.AdminAssistantAPI.Wrapper(StoragesAPI, handlerContext),
 	)
 	router.POST(
 		"/api/v1/storages",
 		middleware.AssistantOnlyAPI.Wrapper(StorageCreateAPI, handlerContext),
 	)
+	router.PUT(
+		"/api/v1/storages/:storageID",
+		middleware.AssistantOnlyAPI.Wrapper(StoragePutAPI, handlerContext),
+	)
+	router.GET(
+		"/api/v1/storages/:storageID/cells",
+		middleware.AdminAssistantAPI.Wrapper(StorageCellsAPI, handlerContext),
+	)
+	router.PUT(
+		"/api/v1/storages/:storageID/cells",
+		middleware.AssistantOnlyAPI.Wrapper(StorageCellPutAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/storages/:storageID/relocate",
+		middleware.AssistantOnlyAPI.Wrapper(StorageRelocateAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/storages/:storageID/archive",
+		middleware.AssistantOnlyAPI.Wrapper(StorageArchiveAPI, handlerContext),
+	)
+	router.PUT(
+		"/api/v1/storages/:storageID/responsible",
+		middleware.AdminOnlyAPI.Wrapper(StorageResponsiblePutAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/storages/:storageID/access",
+		middleware.AdminAssistantAPI.Wrapper(StorageAccessCreateAPI, handlerContext),
+	)
+	router.DELETE(
+		"/api/v1/storages/:storageID/access/:userID",
+		middleware.AdminAssistantAPI.Wrapper(StorageAccessDeleteAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/storages/:storageID/stocktakes",
+		middleware.AdminAssistantAPI.Wrapper(StocktakeCreateAPI, handlerContext),
+	)
+	router.PUT(
+		"/api/v1/storages/:storageID/inspection",
+		middleware.AdminAssistantAPI.Wrapper(StorageInspectionPutAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/storages/:storageID/inspections",
+		middleware.AdminAssistantAPI.Wrapper(StorageInspectionCreateAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/stocktakes/:stocktakeID/scans",
+		middleware.AdminAssistantAPI.Wrapper(StocktakeScanAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/stocktakes/:stocktakeID/finish",
+		middleware.AdminAssistantAPI.Wrapper(StocktakeFinishAPI, handlerContext),
+	)
+	router.POST(
+		"/api/v1/stocktakes/:stocktakeID/resolve",
+		middleware.AdminAssistantAPI.Wrapper(StocktakeResolveAPI, handlerContext),
+	)
 	return router
 }
@@ -0,0 +1,319 @@
+package view
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/net/xsrftoken"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/common"
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+	"github.com/Kelvedler/ChemicalStorage/pkg/env"
+	"github.com/Kelvedler/ChemicalStorage/pkg/middleware"
+	"github.com/Kelvedler/ChemicalStorage/pkg/webhook"
+)
+
+type webhooksData struct {
+	Caller        db.StorageUser
+	WebhooksSlice []db.Webhook
+	Events        []string
+	URL           string
+	URLErr        string
+	EventsErr     string
+	PostXsrf      string
+}
+
+type webhookData struct {
+	Caller          db.StorageUser
+	Webhook         db.Webhook
+	DeliveriesSlice []db.WebhookDelivery
+	Events          []string
+	URLErr          string
+	EventsErr       string
+	PutXsrf         string
+}
+
+func getWebhookPostXsrf(userID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		"/api/v1/webhooks",
+	)
+}
+
+func getWebhookPutXsrf(userID, webhookID uuid.UUID) string {
+	return xsrftoken.Generate(
+		env.Env.SecretKey,
+		userID.String(),
+		fmt.Sprintf("/api/v1/webhooks/%s", webhookID),
+	)
+}
+
+func Webhooks(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	webhooksRange := db.WebhooksRange{
+		Limit:  100,
+		Offset: 0,
+	}
+	caller := db.StorageUser{ID: rc.UserID}
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{webhooksRange.Get, caller.GetByID},
+	)
+	webhooksErr := errs[0]
+	if webhooksErr != nil {
+		rc.Logger.Error(webhooksErr.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	data := webhooksData{
+		Caller:        caller,
+		WebhooksSlice: webhooksRange.Webhooks,
+		Events:        webhook.Events,
+		PostXsrf:      getWebhookPostXsrf(rc.UserID),
+	}
+	tmpl := template.Must(
+		template.ParseFiles(
+			"templates/webhooks.html",
+			"templates/webhooks-assets.html",
+			"templates/base.html",
+		),
+	)
+	tmpl.Execute(w, data)
+}
+
+func Webhook(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	webhookID, err := uuid.Parse(params.ByName("webhookID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	hook := db.Webhook{ID: webhookID}
+	deliveriesRange := db.WebhookDeliveriesRange{
+		WebhookID: webhookID,
+		Limit:     50,
+	}
+	caller := db.StorageUser{ID: rc.UserID}
+	errs := db.PerformBatch(
+		r.Context(),
+		rc.DBpool,
+		[]db.BatchSet{hook.Get, deliveriesRange.Get, caller.GetByID},
+	)
+	for _, err := range errs[:2] {
+		if err != nil {
+			errStruct := db.ErrorAsStruct(err)
+			switch errStruct.(type) {
+			case db.DoesNotExist:
+				rc.Logger.Info("Not found")
+				common.ErrorResp(w, common.NotFound)
+			default:
+				rc.Logger.Error(err.Error())
+				common.ErrorResp(w, common.Internal)
+			}
+			return
+		}
+	}
+	data := webhookData{
+		Caller:          caller,
+		Webhook:         hook,
+		DeliveriesSlice: deliveriesRange.WebhookDeliveries,
+		Events:          webhook.Events,
+		PutXsrf:         getWebhookPutXsrf(rc.UserID, webhookID),
+	}
+	tmpl := template.Must(
+		template.ParseFiles(
+			"templates/webhook.html",
+			"templates/webhooks-assets.html",
+			"templates/base.html",
+		),
+	)
+	tmpl.Execute(w, data)
+}
+
+type webhookInput struct {
+	URL    string `json:"url"`
+	Events string `json:"events"`
+	Active string `json:"active"`
+}
+
+func sanitizeWebhook(rc *middleware.RequestContext, input *webhookInput) {
+	sanitizer := rc.Sanitize
+	input.URL = strings.TrimSpace(input.URL)
+	input.Events = sanitizer.Sanitize(input.Events)
+	input.Active = sanitizer.Sanitize(input.Active)
+}
+
+func (input webhookInput) Bind() (output db.Webhook, err error) {
+	output.URL = input.URL
+	for _, event := range strings.Split(input.Events, ",") {
+		event = strings.TrimSpace(event)
+		if event == "" {
+			continue
+		}
+		output.Events = append(output.Events, event)
+	}
+	if input.Active == "" {
+		input.Active = "false"
+	}
+	output.Active, err = strconv.ParseBool(input.Active)
+	if err != nil {
+		return db.Webhook{}, err
+	}
+	return output, nil
+}
+
+func webhookURLValid(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+func validateWebhook(rc *middleware.RequestContext, hook db.Webhook) map[string]string {
+	errMap := map[string]string{}
+	err := rc.Validate.StructPartial(hook, "URL", "Events")
+	if err != nil {
+		err = common.LocalizeValidationErrors(err.(validator.ValidationErrors), hook)
+		rc.Logger.Info(err.Error())
+		errMap = err.(common.ValidationError).Map()
+	}
+	if errMap["URLErr"] == "" && !webhookURLValid(hook.URL) {
+		rc.Logger.Info("Invalid webhook URL")
+		errMap["URLErr"] = "Адреса повинна починатися з http:// або https://"
+	}
+	for _, event := range hook.Events {
+		if !webhook.EventValid(event) {
+			rc.Logger.Info(fmt.Sprintf("Unknown webhook event %s", event))
+			errMap["EventsErr"] = fmt.Sprintf("Невідома подія %s", event)
+			break
+		}
+	}
+	return errMap
+}
+
+func WebhookCreateAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	_ httprouter.Params,
+) {
+	var input webhookInput
+	err := common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	sanitizeWebhook(rc, &input)
+	hook, err := input.Bind()
+	if err != nil {
+		rc.Logger.Info(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	tmpl := template.Must(template.ParseFiles("templates/webhooks-assets.html")).
+		Lookup("webhook-form")
+	errMap := validateWebhook(rc, hook)
+	if len(errMap) > 0 {
+		data := webhooksData{
+			Events:    webhook.Events,
+			URL:       hook.URL,
+			URLErr:    errMap["URLErr"],
+			EventsErr: errMap["EventsErr"],
+			PostXsrf:  getWebhookPostXsrf(rc.UserID),
+		}
+		tmpl.Execute(w, data)
+		return
+	}
+	hook.Secret, err = common.GenerateToken()
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{hook.Create})
+	webhookErr := errs[0]
+	if webhookErr != nil {
+		rc.Logger.Error(webhookErr.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	w.Header().Set("HX-Redirect", fmt.Sprintf("/webhooks/%s", hook.ID))
+}
+
+func WebhookPutAPI(
+	rc *middleware.RequestContext,
+	w http.ResponseWriter,
+	r *http.Request,
+	params httprouter.Params,
+) {
+	webhookID, err := uuid.Parse(params.ByName("webhookID"))
+	if err != nil {
+		rc.Logger.Info("Invalid UUID")
+		common.ErrorResp(w, common.NotFound)
+		return
+	}
+	var input webhookInput
+	err = common.BindJSON(r, &input)
+	if err != nil {
+		rc.Logger.Error(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	sanitizeWebhook(rc, &input)
+	hook, err := input.Bind()
+	if err != nil {
+		rc.Logger.Info(err.Error())
+		common.ErrorResp(w, common.Internal)
+		return
+	}
+	hook.ID = webhookID
+	errMap := validateWebhook(rc, hook)
+	if len(errMap) > 0 {
+		data := webhookData{
+			Webhook:   hook,
+			Events:    webhook.Events,
+			URLErr:    errMap["URLErr"],
+			EventsErr: errMap["EventsErr"],
+			PutXsrf:   getWebhookPutXsrf(rc.UserID, webhookID),
+		}
+		tmpl := template.Must(template.ParseFiles("templates/webhooks-assets.html")).
+			Lookup("webhook-edit-form")
+		tmpl.Execute(w, data)
+		return
+	}
+	errs := db.PerformBatch(r.Context(), rc.DBpool, []db.BatchSet{hook.Update})
+	webhookErr := errs[0]
+	if webhookErr != nil {
+		errStruct := db.ErrorAsStruct(webhookErr)
+		switch errStruct.(type) {
+		case db.DoesNotExist:
+			rc.Logger.Info("Not found")
+			common.ErrorResp(w, common.NotFound)
+		default:
+			rc.Logger.Error(webhookErr.Error())
+			common.ErrorResp(w, common.Internal)
+		}
+		return
+	}
+	w.Header().Set("HX-Refresh", "true")
+}
@@ -0,0 +1,142 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+)
+
+const (
+	pollInterval = 10 * time.Second
+	batchLimit   = 20
+	lease        = 2 * time.Minute
+	maxAttempts  = 8
+	baseBackoff  = 30 * time.Second
+	errMaxLength = 500
+)
+
+type Dispatcher struct {
+	dbpool *pgxpool.Pool
+	logger *slog.Logger
+	client *http.Client
+}
+
+func NewDispatcher(dbpool *pgxpool.Pool, logger *slog.Logger) *Dispatcher {
+	return &Dispatcher{
+		dbpool: dbpool,
+		logger: logger.With(slog.String("process", "webhook")),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		d.dispatchDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dispatcher) dispatchDue(ctx context.Context) {
+	due := db.WebhookDueDeliveries{Limit: batchLimit, Lease: lease}
+	errs := db.PerformBatch(ctx, d.dbpool, []db.BatchSet{due.Claim})
+	if errs[0] != nil {
+		d.logger.Error(errs[0].Error())
+		return
+	}
+	for _, item := range due.WebhookDeliveriesExtended {
+		delivery := d.deliver(ctx, item)
+		errs = db.PerformBatch(ctx, d.dbpool, []db.BatchSet{delivery.Update})
+		if errs[0] != nil {
+			d.logger.Error(errs[0].Error())
+		}
+	}
+}
+
+func backoff(attempts int16) time.Duration {
+	return baseBackoff * time.Duration(1<<(attempts-1))
+}
+
+func (d *Dispatcher) deliver(
+	ctx context.Context,
+	item db.WebhookDeliveryExtended,
+) db.WebhookDelivery {
+	delivery := item.WebhookDelivery
+	delivery.Attempts++
+	delivery.ResponseCode = 0
+	delivery.Error = ""
+	err := d.post(ctx, item.Webhook, &delivery)
+	if err == nil {
+		delivery.Status = db.DeliverySucceeded
+		delivery.NextAttemptAt = time.Now()
+		return delivery
+	}
+	d.logger.Info(
+		err.Error(),
+		slog.String("delivery", delivery.ID.String()),
+		slog.Int("attempt", int(delivery.Attempts)),
+	)
+	delivery.Error = err.Error()
+	if len(delivery.Error) > errMaxLength {
+		cut := errMaxLength
+		for cut > 0 && !utf8.RuneStart(delivery.Error[cut]) {
+			cut--
+		}
+		delivery.Error = delivery.Error[:cut]
+	}
+	if delivery.Attempts >= maxAttempts {
+		delivery.Status = db.DeliveryFailed
+		delivery.NextAttemptAt = time.Now()
+	} else {
+		delivery.Status = db.DeliveryPending
+		delivery.NextAttemptAt = time.Now().Add(backoff(delivery.Attempts))
+	}
+	return delivery
+}
+
+func (d *Dispatcher) post(
+	ctx context.Context,
+	webhook db.Webhook,
+	delivery *db.WebhookDelivery,
+) error {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		webhook.URL,
+		bytes.NewReader(delivery.Payload),
+	)
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ChemicalStorage-Webhook/1")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", delivery.ID.String())
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", Sign(webhook.Secret, timestamp, delivery.Payload))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	delivery.ResponseCode = int16(resp.StatusCode)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	return nil
+}
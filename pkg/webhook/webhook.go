@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/Kelvedler/ChemicalStorage/pkg/db"
+)
+
+const (
+	ReagentCreated      = "reagent.created"
+	InstanceCreated     = "instance.created"
+	InstanceUsed        = "instance.used"
+	InstanceTransferred = "instance.transferred"
+	InstanceLost        = "instance.lost"
+	UserConfirmed       = "user.confirmed"
+)
+
+var Events = []string{
+	ReagentCreated,
+	InstanceCreated,
+	InstanceUsed,
+	InstanceTransferred,
+	InstanceLost,
+	UserConfirmed,
+}
+
+var eventSources = map[string]string{
+	ReagentCreated:      "reagent",
+	InstanceCreated:     "reagent_instance",
+	InstanceUsed:        "reagent_instance",
+	InstanceTransferred: "reagent_instance",
+	InstanceLost:        "reagent_instance",
+	UserConfirmed:       "storage_user",
+}
+
+func EventValid(event string) bool {
+	for _, known := range Events {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+type payload struct {
+	Event      string         `json:"event"`
+	OccurredAt time.Time      `json:"occurred_at"`
+	Data       map[string]any `json:"data"`
+}
+
+func NewEvent(name string, data map[string]any, rows ...uuid.UUID) (db.WebhookEvent, error) {
+	if data == nil {
+		data = map[string]any{}
+	}
+	body, err := json.Marshal(payload{
+		Event:      name,
+		OccurredAt: time.Now().UTC(),
+		Data:       data,
+	})
+	if err != nil {
+		return db.WebhookEvent{}, err
+	}
+	return db.WebhookEvent{
+		Name:    name,
+		Payload: body,
+		Source:  eventSources[name],
+		Rows:    rows,
+	}, nil
+}
+
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
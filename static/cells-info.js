@@ -0,0 +1,21 @@
+function loadCellsInfo(select) {
+  var target = document.getElementById('cells-info')
+  if (!select || !select.value || !target) {
+    return
+  }
+  var storageID = JSON.parse(select.value)['id']
+  fetch('/api/v1/storages/' + storageID + '/cells').then(function (response) {
+    return response.ok ? response.text() : ''
+  }).then(function (html) {
+    target.innerHTML = html
+  })
+}
+
+function selectCellPosition(el) {
+  var layout = el.closest('[data-columns]')
+  var row = parseInt(layout.querySelector('[data-position=row]').value)
+  var column = parseInt(layout.querySelector('[data-position=column]').value)
+  var input = document.querySelector("input[name='cell']")
+  input.value = (row - 1) * parseInt(layout.dataset.columns) + column
+  input.dispatchEvent(new Event('input'))
+}
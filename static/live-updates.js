@@ -0,0 +1,13 @@
+function subscribeInstanceEvents(reagentID, instanceID) {
+  var source = new EventSource('/api/v1/reagents/' + reagentID + '/events')
+  source.addEventListener('instance', function (e) {
+    var data = JSON.parse(e.data)
+    if (instanceID && data.id !== instanceID) {
+      return
+    }
+    htmx.trigger(document.body, 'instance-changed', data)
+  })
+  window.addEventListener('beforeunload', function () {
+    source.close()
+  })
+}
@@ -0,0 +1,29 @@
+function storageInstanceDragStart(e) {
+  var el = e.currentTarget
+  e.dataTransfer.effectAllowed = 'move'
+  e.dataTransfer.setData('text/plain', JSON.stringify({
+    reagent: el.dataset.reagent,
+    instance: el.dataset.instance,
+    cell: el.dataset.cell,
+    xsrf: el.dataset.xsrf
+  }))
+}
+
+function storageCellDrop(e, storageID) {
+  e.preventDefault()
+  var cell = e.currentTarget.dataset.cell
+  var data = JSON.parse(e.dataTransfer.getData('text/plain'))
+  if (data.cell === cell) {
+    return
+  }
+  fetch('/api/v1/reagents/' + data.reagent + '/instances/' + data.instance + '/transfer', {
+    method: 'POST',
+    headers: {'Content-Type': 'application/json', '_xsrf': data.xsrf},
+    body: JSON.stringify({storage: storageID, cell: cell})
+  }).then(function (response) {
+    if (!response.ok || !response.headers.get('HX-Redirect')) {
+      alert('Не вдалося перемістити екземпляр')
+    }
+    htmx.trigger(document.body, 'storage-changed')
+  })
+}